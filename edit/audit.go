@@ -0,0 +1,360 @@
+package edit
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	hostAuditOfficial   = "official"
+	hostAuditOther      = "other"
+	hostAuditConfigured = "configured"
+	hostAuditIgnored    = "ignored"
+
+	hostAuditMinRunLength      = 4
+	hostAuditLoggedOccurrences = 3
+)
+
+// officialHostDomains are the CipSoft domains an edited client should no
+// longer reach. Subdomains match as well.
+var officialHostDomains = []string{"tibia.com", "cipsoft.com", "cipsoft.de"}
+
+var (
+	hostAuditURLPattern = regexp.MustCompile(`(?i)\b(?:https?|wss?|ftp)://[^\s"'<>\\^{}|` + "`" + `]+`)
+	// Bare hostnames are only recognized with a common top-level domain, as
+	// file names such as Qt5Core.dll share their shape.
+	hostAuditNamePattern = regexp.MustCompile(`(?i)\b(?:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?\.)+(?:com|net|org|info|biz|io|gg|dev|app|xyz|online|site|cloud|eu|de|br|pl|se|nl|uk|us|ru)\b`)
+	hostAuditIPv4Pattern = regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4][0-9]|1[0-9][0-9]|[1-9]?[0-9])\.){3}(?:25[0-5]|2[0-4][0-9]|1[0-9][0-9]|[1-9]?[0-9])\b`)
+	hostAuditHostPattern = regexp.MustCompile(`^[a-z0-9](?:[a-z0-9-]*[a-z0-9])?(?:\.[a-z0-9](?:[a-z0-9-]*[a-z0-9])?)*$`)
+)
+
+// HostAudit is the [audit] table of config.toml.
+type HostAudit struct {
+	// Ignore lists hosts, and their subdomains, the audit accepts, such as
+	// an official host the client only prints.
+	Ignore []string `mapstructure:"ignore"`
+}
+
+// hostLiteral is one URL, hostname or IPv4 literal found by the audit.
+type hostLiteral struct {
+	host     string
+	text     string
+	file     string
+	section  string
+	encoding string
+	offset   int
+}
+
+func (literal hostLiteral) describe() string {
+	location := fmt.Sprintf("%s @0x%X", literal.file, literal.offset)
+	if literal.section != "" {
+		location += " in " + literal.section
+	}
+	return fmt.Sprintf("%s (%s) %q", location, literal.encoding, literal.text)
+}
+
+type hostAuditFinding struct {
+	host        string
+	category    string
+	occurrences []hostLiteral
+}
+
+// hostAuditRange is a [start, end) file range the audit skips because the
+// client no longer references it.
+type hostAuditRange struct {
+	start  int
+	end    int
+	reason string
+}
+
+// textRun is a run of printable ASCII, stored one byte or two bytes per
+// character.
+type textRun struct {
+	text     string
+	offset   int
+	width    int
+	encoding string
+}
+
+func isAuditTextByte(value byte) bool {
+	return value >= 0x20 && value <= 0x7e
+}
+
+// textRuns returns the ASCII and UTF-16LE runs of at least
+// hostAuditMinRunLength characters, the way strings(1) would.
+func textRuns(data []byte) []textRun {
+	runs := make([]textRun, 0)
+	for start := 0; start < len(data); {
+		end := start
+		for end < len(data) && isAuditTextByte(data[end]) {
+			end++
+		}
+		if end-start >= hostAuditMinRunLength {
+			runs = append(runs, textRun{text: string(data[start:end]), offset: start, width: 1, encoding: "ascii"})
+		}
+		start = end + 1
+	}
+	for start := 0; start+1 < len(data); {
+		end := start
+		for end+1 < len(data) && isAuditTextByte(data[end]) && data[end+1] == 0 {
+			end += 2
+		}
+		if (end-start)/2 < hostAuditMinRunLength {
+			start++
+			continue
+		}
+		text := make([]byte, 0, (end-start)/2)
+		for offset := start; offset < end; offset += 2 {
+			text = append(text, data[offset])
+		}
+		runs = append(runs, textRun{text: string(text), offset: start, width: 2, encoding: "utf16-le"})
+		start = end
+	}
+	return runs
+}
+
+// urlHost returns the lowercased host of a URL literal, or "" when the
+// authority is not a plain hostname or address, as in a format string.
+func urlHost(literal string) string {
+	authority := literal[strings.Index(literal, "://")+3:]
+	if end := strings.IndexAny(authority, "/?#"); end != -1 {
+		authority = authority[:end]
+	}
+	if at := strings.LastIndexByte(authority, '@'); at != -1 {
+		authority = authority[at+1:]
+	}
+	if colon := strings.IndexByte(authority, ':'); colon != -1 {
+		authority = authority[:colon]
+	}
+	host := strings.TrimSuffix(strings.ToLower(authority), ".")
+	if !hostAuditHostPattern.MatchString(host) {
+		return ""
+	}
+	return host
+}
+
+// extractHostLiterals returns every URL, hostname and IPv4 literal of data
+// outside the skipped ranges. Hostnames and addresses inside a URL are
+// reported as part of the URL only.
+func extractHostLiterals(data []byte, file string, peData peInfo, skipped []hostAuditRange) []hostLiteral {
+	literals := make([]hostLiteral, 0)
+	for _, run := range textRuns(data) {
+		// Every literal the audit looks for has a dot.
+		if !strings.Contains(run.text, ".") {
+			continue
+		}
+		add := func(host string, match []int) {
+			offset := run.offset + match[0]*run.width
+			for _, skip := range skipped {
+				if offset >= skip.start && offset < skip.end {
+					return
+				}
+			}
+			literal := hostLiteral{host: host, text: run.text[match[0]:match[1]], file: file, encoding: run.encoding, offset: offset}
+			if section, ok := peData.sectionForOffset(offset); ok {
+				literal.section = section.name
+			}
+			literals = append(literals, literal)
+		}
+
+		urls := hostAuditURLPattern.FindAllStringIndex(run.text, -1)
+		insideURL := func(match []int) bool {
+			for _, url := range urls {
+				if match[0] < url[1] && match[1] > url[0] {
+					return true
+				}
+			}
+			return false
+		}
+		for _, match := range urls {
+			if host := urlHost(run.text[match[0]:match[1]]); host != "" {
+				add(host, match)
+			}
+		}
+		for _, match := range hostAuditNamePattern.FindAllStringIndex(run.text, -1) {
+			if !insideURL(match) {
+				add(strings.ToLower(run.text[match[0]:match[1]]), match)
+			}
+		}
+		for _, match := range hostAuditIPv4Pattern.FindAllStringIndex(run.text, -1) {
+			// A fifth dotted part makes it a version number.
+			if insideURL(match) || (match[0] > 0 && run.text[match[0]-1] == '.') ||
+				(match[1]+1 < len(run.text) && run.text[match[1]] == '.' && run.text[match[1]+1] >= '0' && run.text[match[1]+1] <= '9') {
+				continue
+			}
+			add(run.text[match[0]:match[1]], match)
+		}
+	}
+	return literals
+}
+
+// configuredHosts returns the hosts of config values and string
+// replacements, which the audit expects to find in the edited client.
+func configuredHosts(configValues map[string]string, replacements []StringReplacement) []string {
+	values := make([]string, 0, len(configValues)+len(replacements))
+	for _, key := range sortedKeys(configValues) {
+		values = append(values, configValues[key])
+	}
+	for _, replacement := range replacements {
+		values = append(values, replacement.Replace)
+	}
+
+	hosts := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, value := range values {
+		found := make([]string, 0)
+		for _, literal := range extractHostLiterals([]byte(value), "", peInfo{}, nil) {
+			found = append(found, literal.host)
+		}
+		// A value may also be a bare host of any top-level domain, with an
+		// optional port or path.
+		if len(found) == 0 && !strings.Contains(value, "://") {
+			host := strings.ToLower(value)
+			if end := strings.IndexAny(host, ":/"); end != -1 {
+				host = host[:end]
+			}
+			if strings.Contains(host, ".") && hostAuditHostPattern.MatchString(host) {
+				found = append(found, host)
+			}
+		}
+		for _, host := range found {
+			if !seen[host] {
+				seen[host] = true
+				hosts = append(hosts, host)
+			}
+		}
+	}
+	return hosts
+}
+
+func hostMatchesDomain(host string, domain string) bool {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	if hostAuditIPv4Pattern.MatchString(host) {
+		return host == domain
+	}
+	return domain != "" && (host == domain || strings.HasSuffix(host, "."+domain))
+}
+
+func hostMatchesAnyDomain(host string, domains []string) bool {
+	for _, domain := range domains {
+		if hostMatchesDomain(host, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// categorizeHost sorts a host into ignored, configured, official or other, in
+// that order of precedence. Subdomains of a configured host count as
+// configured.
+func categorizeHost(host string, configured []string, ignore []string) string {
+	switch {
+	case hostMatchesAnyDomain(host, ignore):
+		return hostAuditIgnored
+	case hostMatchesAnyDomain(host, configured):
+		return hostAuditConfigured
+	case hostMatchesAnyDomain(host, officialHostDomains):
+		return hostAuditOfficial
+	}
+	return hostAuditOther
+}
+
+// auditHosts groups the host literals of the edited client and config.ini by
+// host, official hosts first.
+func auditHosts(literals []hostLiteral, configured []string, ignore []string) []hostAuditFinding {
+	byHost := make(map[string]*hostAuditFinding)
+	for _, literal := range literals {
+		finding, ok := byHost[literal.host]
+		if !ok {
+			finding = &hostAuditFinding{host: literal.host, category: categorizeHost(literal.host, configured, ignore)}
+			byHost[literal.host] = finding
+		}
+		finding.occurrences = append(finding.occurrences, literal)
+	}
+
+	rank := map[string]int{hostAuditOfficial: 0, hostAuditOther: 1, hostAuditConfigured: 2, hostAuditIgnored: 3}
+	findings := make([]hostAuditFinding, 0, len(byHost))
+	for _, finding := range byHost {
+		findings = append(findings, *finding)
+	}
+	sort.Slice(findings, func(i, j int) bool {
+		if rank[findings[i].category] != rank[findings[j].category] {
+			return rank[findings[i].category] < rank[findings[j].category]
+		}
+		return findings[i].host < findings[j].host
+	})
+	return findings
+}
+
+// unreferencedHostAuditRanges returns the stock URL block of a client whose
+// block was relocated. It keeps the official URLs but is no longer read.
+func unreferencedHostAuditRanges(tibiaBinary []byte) []hostAuditRange {
+	if !hasRelocatedURLBlock(tibiaBinary) {
+		return nil
+	}
+	start, length, err := locateStockURLBlock(tibiaBinary, inspectPE(tibiaBinary))
+	if err != nil {
+		return nil
+	}
+	return []hostAuditRange{{start: start, end: start + length, reason: "unreferenced stock URL block"}}
+}
+
+// auditEditedHosts scans the edited client and the config.ini it will be
+// shipped with for leftover hosts.
+func auditEditedHosts(tibiaBinary []byte, configINIPath string, configINI []byte, configured []string, ignore []string) []hostAuditFinding {
+	skipped := unreferencedHostAuditRanges(tibiaBinary)
+	for _, skip := range skipped {
+		fmt.Printf("[INFO] Host audit skips the %s @0x%X (%d bytes)\n", skip.reason, skip.start, skip.end-skip.start)
+	}
+	literals := extractHostLiterals(tibiaBinary, "client", inspectExecutable(tibiaBinary), skipped)
+	if configINIPath != "" {
+		literals = append(literals, extractHostLiterals(configINI, configINIPath, peInfo{}, nil)...)
+	}
+	return auditHosts(literals, configured, ignore)
+}
+
+func countHostAuditFindings(findings []hostAuditFinding, category string) int {
+	count := 0
+	for _, finding := range findings {
+		if finding.category == category {
+			count++
+		}
+	}
+	return count
+}
+
+func logHostAudit(findings []hostAuditFinding) {
+	fmt.Printf("[INFO] Host audit: %d host(s) in the client and %s: %d configured, %d official, %d other, %d ignored\n",
+		len(findings), configINIFileName, countHostAuditFindings(findings, hostAuditConfigured), countHostAuditFindings(findings, hostAuditOfficial),
+		countHostAuditFindings(findings, hostAuditOther), countHostAuditFindings(findings, hostAuditIgnored))
+	for _, finding := range findings {
+		if finding.category != hostAuditOfficial && finding.category != hostAuditOther {
+			continue
+		}
+		occurrences := make([]string, 0, hostAuditLoggedOccurrences)
+		for index, occurrence := range finding.occurrences {
+			if index == hostAuditLoggedOccurrences {
+				occurrences = append(occurrences, fmt.Sprintf("%d more", len(finding.occurrences)-index))
+				break
+			}
+			occurrences = append(occurrences, occurrence.describe())
+		}
+		if finding.category == hostAuditOfficial {
+			fmt.Printf("[WARN] Official host %s remains (%d occurrence(s)): %s\n", finding.host, len(finding.occurrences), strings.Join(occurrences, "; "))
+			continue
+		}
+		fmt.Printf("[INFO] Host %s is not a configured host (%d occurrence(s)): %s\n", finding.host, len(finding.occurrences), strings.Join(occurrences, "; "))
+	}
+}
+
+func officialHosts(findings []hostAuditFinding) []string {
+	hosts := make([]string, 0)
+	for _, finding := range findings {
+		if finding.category == hostAuditOfficial {
+			hosts = append(hosts, finding.host)
+		}
+	}
+	return hosts
+}
@@ -0,0 +1,118 @@
+package edit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExtractHostLiteralsFindsURLsNamesAndAddresses(t *testing.T) {
+	data := []byte("\x00https://user@www.tibia.com:443/news?id=1\x00")
+	utf16Offset := len(data)
+	data = append(data, utf16LEBytes("Visit Support.CipSoft.com today")...)
+	data = append(data, "\x00server 10.0.0.7:7171\x00Qt5Core.dll\x00http://%s/login\x00version 15.1.0.2.3\x00"...)
+
+	literals := extractHostLiterals(data, "client", peInfo{}, nil)
+	found := make([]string, 0, len(literals))
+	for _, literal := range literals {
+		found = append(found, literal.host+" "+literal.encoding)
+	}
+	expected := []string{"www.tibia.com ascii", "10.0.0.7 ascii", "support.cipsoft.com utf16-le"}
+	if strings.Join(found, ", ") != strings.Join(expected, ", ") {
+		t.Fatalf("expected %v, got %v", expected, found)
+	}
+	if literals[0].offset != 1 || literals[0].text != "https://user@www.tibia.com:443/news?id=1" {
+		t.Fatalf("expected the whole URL @0x1, got %s", literals[0].describe())
+	}
+	if literals[2].offset != utf16Offset+12 || literals[2].text != "Support.CipSoft.com" {
+		t.Fatalf("expected the UTF-16LE hostname at its byte offset, got %s", literals[2].describe())
+	}
+
+	findings := auditHosts(literals, []string{"0.7"}, []string{"cipsoft.com"})
+	categories := make([]string, 0, len(findings))
+	for _, finding := range findings {
+		categories = append(categories, finding.host+"="+finding.category)
+	}
+	if strings.Join(categories, " ") != "www.tibia.com=official 10.0.0.7=other support.cipsoft.com=ignored" {
+		t.Fatalf("unexpected categories %v", categories)
+	}
+}
+
+func TestConfiguredHostsAcceptBareHostsAndSubdomains(t *testing.T) {
+	hosts := configuredHosts(map[string]string{
+		"loginWebService": "https://login.my-ot.example/service",
+		"gameHost":        "My-OT.example:7172",
+		"motd":            "Welcome",
+	}, []StringReplacement{{Find: "www.tibia.com", Replace: "my-ot.gg"}})
+	if strings.Join(hosts, " ") != "my-ot.example login.my-ot.example my-ot.gg" {
+		t.Fatalf("unexpected configured hosts %v", hosts)
+	}
+	if category := categorizeHost("static.my-ot.example", hosts, nil); category != hostAuditConfigured {
+		t.Fatalf("expected a subdomain of a configured host to be configured, got %s", category)
+	}
+	if category := categorizeHost("notibia.com", hosts, nil); category != hostAuditOther {
+		t.Fatalf("expected only tibia.com and its subdomains to be official, got %s", category)
+	}
+}
+
+func TestAuditEditedHostsSkipsRelocatedStockBlock(t *testing.T) {
+	relocated, _, err := relocateURLBlock(newRelocationFixture(t), map[string]string{"loginWebService": "https://login.my-ot.example/service"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	findings := auditEditedHosts(relocated, "config.ini", []byte("[URLS]\nclientWebService=https://www.tibia.com/client\n"), []string{"login.my-ot.example"}, nil)
+	if len(findings) != 2 || findings[0].host != "www.tibia.com" || findings[1].host != "login.my-ot.example" {
+		t.Fatalf("expected the relocated and config.ini hosts, got %+v", findings)
+	}
+	for _, occurrence := range findings[0].occurrences {
+		if occurrence.file == "client" && occurrence.section != urlRelocationSectionName {
+			t.Fatalf("expected the stock URL block to be skipped, got %s", occurrence.describe())
+		}
+	}
+	if occurrences := findings[0].occurrences; occurrences[len(occurrences)-1].file != "config.ini" {
+		t.Fatalf("expected the config.ini leftover to be reported, got %+v", occurrences)
+	}
+}
+
+func TestPatcherStrictRefusesOfficialHosts(t *testing.T) {
+	workDir := t.TempDir()
+	tibiaKeyPath := filepath.Join(workDir, "tibia.key")
+	otservKeyPath := filepath.Join(workDir, "otserv.key")
+	writeTestFile(t, tibiaKeyPath, bytes.Repeat([]byte("A"), 32))
+	writeTestFile(t, otservKeyPath, bytes.Repeat([]byte("B"), 32))
+	tibiaBinary := append([]byte("header--"), bytes.Repeat([]byte("A"), 32)...)
+	tibiaBinary = append(tibiaBinary, "--[URLS]\nloginWebService=https://www.tibia.com/login/service/endpoint\n\x00Report bugs at support.tibia.com\x00"...)
+	tibiaPath := filepath.Join(workDir, "client")
+	writeTestFile(t, tibiaPath, tibiaBinary)
+	options := PatcherOptions{
+		TargetExe:       tibiaPath,
+		TibiaRSAKeyPath: tibiaKeyPath,
+		RSAKeyPath:      otservKeyPath,
+		ConfigValues:    map[string]string{"loginWebService": "http://127.0.0.1/login"},
+		StrictHostAudit: true,
+	}
+
+	patcher, _ := NewPatcher(options)
+	result, err := patcher.Plan()
+	if err != nil || result.Plan.ExportAllowed || !result.Plan.HostAuditRefused {
+		t.Fatalf("expected the plan to refuse the export, got %+v err=%v", result.Plan, err)
+	}
+	if len(result.Plan.Hosts) != 2 || result.Plan.Hosts[0].Host != "support.tibia.com" || result.Plan.Hosts[1].Category != hostAuditConfigured {
+		t.Fatalf("expected the leftover and the configured host, got %+v", result.Plan.Hosts)
+	}
+	if _, err := patcher.Apply(); err == nil || !strings.Contains(err.Error(), "support.tibia.com") {
+		t.Fatalf("expected the strict host audit to refuse the export, got %v", err)
+	}
+	if unchanged, _ := os.ReadFile(tibiaPath); !bytes.Equal(unchanged, tibiaBinary) {
+		t.Fatal("expected a refused export to leave the client untouched")
+	}
+
+	options.IgnoreHosts = []string{"support.tibia.com"}
+	patcher, _ = NewPatcher(options)
+	if _, err := patcher.Apply(); err != nil {
+		t.Fatalf("expected an ignored host to pass the audit: %s", err)
+	}
+}
@@ -0,0 +1,304 @@
+package edit
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type clientBackup struct {
+	path      string
+	timestamp int64
+}
+
+// backupIndexEntry describes one BKP<unix>-<client> file. duplicateOf names
+// the newer backup with identical bytes, if any.
+type backupIndexEntry struct {
+	clientBackup
+	size        int
+	sha256      string
+	patchState  string
+	verdict     string
+	rsaKey      string
+	version     string
+	duplicateOf string
+}
+
+// listBackups returns the backups of tibiaPath, newest first.
+func listBackups(tibiaPath string) []clientBackup {
+	pattern := filepath.Join(filepath.Dir(tibiaPath), "BKP*-"+filepath.Base(tibiaPath))
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil
+	}
+	backups := make([]clientBackup, 0, len(matches))
+	for _, match := range matches {
+		var timestamp int64
+		name := strings.TrimSuffix(filepath.Base(match), "-"+filepath.Base(tibiaPath))
+		if _, err := fmt.Sscanf(name, "BKP%d", &timestamp); err != nil || fmt.Sprintf("BKP%d", timestamp) != name {
+			continue
+		}
+		backups = append(backups, clientBackup{path: match, timestamp: timestamp})
+	}
+	sort.SliceStable(backups, func(left, right int) bool {
+		if backups[left].timestamp == backups[right].timestamp {
+			return backups[left].path > backups[right].path
+		}
+		return backups[left].timestamp > backups[right].timestamp
+	})
+	return backups
+}
+
+// indexBackups hashes every backup of tibiaPath and, when analyze is set, also
+// records the patch state, RSA key and client version of each one.
+func indexBackups(tibiaPath string, analyze bool) []backupIndexEntry {
+	tibiaKey, _ := loadRSAKey(tibiaRSAKeyPath)
+	otservKey, _ := loadRSAKey(DefaultRSAKeyPath)
+	newestBySHA256 := make(map[string]string)
+	entries := make([]backupIndexEntry, 0)
+	for _, backup := range listBackups(tibiaPath) {
+		backupBinary, err := os.ReadFile(backup.path)
+		if err != nil {
+			fmt.Printf("[WARN] Unable to read backup %s: %s\n", filepath.Base(backup.path), err.Error())
+			continue
+		}
+		entry := backupIndexEntry{clientBackup: backup, size: len(backupBinary), sha256: sha256Hex(backupBinary)}
+		if newest, ok := newestBySHA256[entry.sha256]; ok {
+			entry.duplicateOf = newest
+		} else {
+			newestBySHA256[entry.sha256] = filepath.Base(backup.path)
+		}
+		if analyze {
+			diagnosis := analyzeTibiaBinary(activeSignatures(), backup.path, backupBinary)
+			entry.patchState = diagnosis.patchState()
+			entry.verdict = strings.SplitN(diagnosis.clientCheckVerdict(), ":", 2)[0]
+			entry.rsaKey = rsaKeyState(backupBinary, tibiaKey, otservKey)
+			entry.version = detectClientVersion("", backupBinary).text()
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// patchState summarizes the patchable BattlEye signatures of a client.
+func (diagnosis diagnosisReport) patchState() string {
+	original := diagnosis.originalPatchSignatureCount()
+	patched := diagnosis.patchedPatchSignatureCount()
+	switch {
+	case original == 0 && patched == 0:
+		return "unknown"
+	case patched == 0:
+		return "original"
+	case original == 0:
+		return "patched"
+	default:
+		return "mixed"
+	}
+}
+
+func rsaKeyState(tibiaBinary []byte, tibiaKey rsaKeyMaterial, otservKey rsaKeyMaterial) string {
+	switch {
+	case len(tibiaKey.raw) > 0 && tibiaKey.foundIn(tibiaBinary):
+		return "tibia"
+	case len(otservKey.raw) > 0 && otservKey.foundIn(tibiaBinary):
+		return "otserv"
+	case len(findEmbeddedRSAModuli(tibiaBinary)) > 0:
+		return "custom"
+	default:
+		return "unknown"
+	}
+}
+
+// findIdenticalBackup returns an existing backup with the same bytes.
+func findIdenticalBackup(tibiaPath string, tibiaBinary []byte) (string, bool) {
+	for _, backup := range listBackups(tibiaPath) {
+		info, err := os.Stat(backup.path)
+		if err != nil || info.Size() != int64(len(tibiaBinary)) {
+			continue
+		}
+		backupBinary, err := os.ReadFile(backup.path)
+		if err == nil && bytes.Equal(backupBinary, tibiaBinary) {
+			return backup.path, true
+		}
+	}
+	return "", false
+}
+
+// ListBackups prints every backup of tibiaExe with its hash and detected state.
+func ListBackups(tibiaExe string) {
+	tibiaPath := clean(tibiaExe)
+	entries := indexBackups(tibiaPath, true)
+	if len(entries) == 0 {
+		fmt.Printf("[INFO] No backups of %s found\n", filepath.Base(tibiaPath))
+		return
+	}
+
+	recordSource := editRecordSourceSHA256(tibiaPath)
+	totalSize := 0
+	for _, entry := range entries {
+		totalSize += entry.size
+		notes := make([]string, 0, 2)
+		if entry.duplicateOf != "" {
+			notes = append(notes, "duplicate of "+entry.duplicateOf)
+		}
+		if entry.sha256 == recordSource {
+			notes = append(notes, "edit record source")
+		}
+		note := ""
+		if len(notes) > 0 {
+			note = " (" + strings.Join(notes, ", ") + ")"
+		}
+		fmt.Printf("[INFO] %s %s size=%d sha256=%s version=%s battleye=%s verdict=%s rsa=%s%s\n",
+			filepath.Base(entry.path), time.Unix(entry.timestamp, 0).Format("2006-01-02 15:04:05"), entry.size, entry.sha256, entry.version, entry.patchState, entry.verdict, entry.rsaKey, note)
+	}
+	fmt.Printf("[INFO] %d backup(s), %d distinct, %d bytes total\n", len(entries), distinctBackupCount(entries), totalSize)
+}
+
+// RestoreBackup writes a backup over tibiaExe. selector is a backup file name
+// or path, or a SHA256 prefix; the newest backup is used when it is empty.
+func RestoreBackup(tibiaExe string, selector string) {
+	tibiaPath := clean(tibiaExe)
+	entries := indexBackups(tibiaPath, false)
+	entry, err := selectBackup(entries, selector)
+	if err != nil {
+		fmt.Printf("[ERROR] %s\n", err.Error())
+		os.Exit(1)
+	}
+	backupBinary, err := os.ReadFile(entry.path)
+	if err != nil {
+		fmt.Printf("[ERROR] %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if tibiaBinary, err := os.ReadFile(tibiaPath); err == nil {
+		if bytes.Equal(tibiaBinary, backupBinary) {
+			fmt.Printf("[INFO] %s already matches %s; client left unchanged\n", filepath.Base(tibiaPath), filepath.Base(entry.path))
+			return
+		}
+		if _, err := backupTibiaExecutable(tibiaPath, tibiaBinary, false); err != nil {
+			fmt.Printf("[ERROR] %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+
+	if err := os.WriteFile(tibiaPath, backupBinary, 0644); err != nil {
+		fmt.Printf("[ERROR] %s\n", err.Error())
+		os.Exit(1)
+	}
+	fmt.Printf("[PATCH] Restored %s from %s (SHA256 %s)\n", filepath.Base(tibiaPath), filepath.Base(entry.path), entry.sha256)
+}
+
+func selectBackup(entries []backupIndexEntry, selector string) (backupIndexEntry, error) {
+	if len(entries) == 0 {
+		return backupIndexEntry{}, fmt.Errorf("no backups found")
+	}
+	if selector == "" {
+		return entries[0], nil
+	}
+
+	selector = strings.ToLower(selector)
+	var match *backupIndexEntry
+	for index, entry := range entries {
+		if strings.EqualFold(filepath.Base(entry.path), filepath.Base(selector)) {
+			return entry, nil
+		}
+		if len(selector) >= 8 && strings.HasPrefix(entry.sha256, selector) {
+			if match != nil && match.sha256 != entry.sha256 {
+				return backupIndexEntry{}, fmt.Errorf("SHA256 prefix %s matches more than one backup", selector)
+			}
+			if match == nil {
+				match = &entries[index]
+			}
+		}
+	}
+	if match == nil {
+		return backupIndexEntry{}, fmt.Errorf("no backup matches %s", selector)
+	}
+	return *match, nil
+}
+
+// backupRetention keeps the newest keepDistinct hashes and every backup newer
+// than keepWithin. Older copies of a kept hash are always removed.
+type backupRetention struct {
+	keepDistinct int
+	keepWithin   time.Duration
+}
+
+// prunableBackups applies retention to entries, newest first. The pristine
+// source named by the edit record is never pruned.
+func (retention backupRetention) prunableBackups(entries []backupIndexEntry, recordSource string, now time.Time) []backupIndexEntry {
+	prunable := make([]backupIndexEntry, 0)
+	distinct := 0
+	for _, entry := range entries {
+		if entry.duplicateOf != "" {
+			prunable = append(prunable, entry)
+			continue
+		}
+		distinct++
+		recent := retention.keepWithin > 0 && now.Sub(time.Unix(entry.timestamp, 0)) < retention.keepWithin
+		if distinct <= retention.keepDistinct || recent || entry.sha256 == recordSource {
+			continue
+		}
+		prunable = append(prunable, entry)
+	}
+	return prunable
+}
+
+// PruneBackups removes duplicate backups and the ones outside the retention
+// policy. With dryRun set it only reports what would be removed.
+func PruneBackups(tibiaExe string, keepDistinct int, keepWithin time.Duration, dryRun bool) {
+	if keepDistinct < 0 {
+		fmt.Printf("[ERROR] --keep must not be negative\n")
+		os.Exit(1)
+	}
+	tibiaPath := clean(tibiaExe)
+	entries := indexBackups(tibiaPath, false)
+	retention := backupRetention{keepDistinct: keepDistinct, keepWithin: keepWithin}
+	prunable := retention.prunableBackups(entries, editRecordSourceSHA256(tibiaPath), time.Now())
+
+	freed := 0
+	for _, entry := range prunable {
+		reason := "outside retention"
+		if entry.duplicateOf != "" {
+			reason = "duplicate of " + entry.duplicateOf
+		}
+		if dryRun {
+			fmt.Printf("[PLAN] Would remove %s (%s)\n", filepath.Base(entry.path), reason)
+		} else {
+			if err := os.Remove(entry.path); err != nil {
+				fmt.Printf("[ERROR] %s\n", err.Error())
+				os.Exit(1)
+			}
+			fmt.Printf("[INFO] Removed %s (%s)\n", filepath.Base(entry.path), reason)
+		}
+		freed += entry.size
+	}
+
+	verb := "Removed"
+	if dryRun {
+		verb = "Would remove"
+	}
+	fmt.Printf("[INFO] %s %d of %d backup(s), %d bytes; %d kept\n", verb, len(prunable), len(entries), freed, len(entries)-len(prunable))
+}
+
+func distinctBackupCount(entries []backupIndexEntry) int {
+	count := 0
+	for _, entry := range entries {
+		if entry.duplicateOf == "" {
+			count++
+		}
+	}
+	return count
+}
+
+func editRecordSourceSHA256(tibiaPath string) string {
+	record, err := readPatchFile(editRecordPath(tibiaPath))
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(record.SourceSHA256)
+}
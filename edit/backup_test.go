@@ -0,0 +1,76 @@
+package edit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPruneBackupsKeepsDistinctHashesAndRecordSource(t *testing.T) {
+	workDir := t.TempDir()
+	tibiaPath := filepath.Join(workDir, "client")
+	writeTestFile(t, filepath.Join(workDir, "BKP100-client"), []byte("pristine"))
+	writeTestFile(t, filepath.Join(workDir, "BKP200-client"), []byte("edit one"))
+	writeTestFile(t, filepath.Join(workDir, "BKP300-client"), []byte("edit two"))
+	writeTestFile(t, filepath.Join(workDir, "BKP400-client"), []byte("edit one"))
+	writeTestFile(t, filepath.Join(workDir, "BKP500-client"), []byte("edit three"))
+	record, err := encodePatchFile(newPatchFile(tibiaPath, []byte("pristine"), []byte("patched!"), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, editRecordPath(tibiaPath), record)
+
+	PruneBackups(tibiaPath, 2, 0, true)
+	if backups := listBackups(tibiaPath); len(backups) != 5 {
+		t.Fatalf("expected a dry run to keep every backup, got %+v", backups)
+	}
+
+	PruneBackups(tibiaPath, 2, 0, false)
+
+	remaining := make([]int64, 0)
+	for _, backup := range listBackups(tibiaPath) {
+		remaining = append(remaining, backup.timestamp)
+	}
+	if len(remaining) != 3 || remaining[0] != 500 || remaining[1] != 400 || remaining[2] != 100 {
+		t.Fatalf("expected the two newest hashes and the edit record source, got %v", remaining)
+	}
+}
+
+func TestBackupRetentionKeepsRecentBackups(t *testing.T) {
+	now := time.Unix(10_000, 0)
+	entries := []backupIndexEntry{
+		{clientBackup: clientBackup{path: "BKP9000-client", timestamp: 9_000}, sha256: "c"},
+		{clientBackup: clientBackup{path: "BKP8000-client", timestamp: 8_000}, sha256: "b"},
+		{clientBackup: clientBackup{path: "BKP1000-client", timestamp: 1_000}, sha256: "a"},
+	}
+
+	prunable := backupRetention{keepDistinct: 0, keepWithin: time.Hour}.prunableBackups(entries, "", now)
+
+	if len(prunable) != 1 || prunable[0].sha256 != "a" {
+		t.Fatalf("expected only the backup older than an hour to be pruned, got %+v", prunable)
+	}
+}
+
+func TestRestoreBackupSelectsBySHA256AndBacksUpCurrentClient(t *testing.T) {
+	workDir := t.TempDir()
+	tibiaPath := filepath.Join(workDir, "client")
+	writeTestFile(t, tibiaPath, []byte("patched client"))
+	writeTestFile(t, filepath.Join(workDir, "BKP100-client"), []byte("pristine client"))
+	writeTestFile(t, filepath.Join(workDir, "BKP200-client"), []byte("other client"))
+
+	RestoreBackup(tibiaPath, sha256Hex([]byte("pristine client"))[:12])
+
+	if data, _ := os.ReadFile(tibiaPath); !bytes.Equal(data, []byte("pristine client")) {
+		t.Fatalf("expected the selected backup to be restored, got %q", data)
+	}
+	if _, ok := findIdenticalBackup(tibiaPath, []byte("patched client")); !ok {
+		t.Fatal("expected the replaced client to be backed up")
+	}
+
+	backupTibiaExecutable(tibiaPath, []byte("other client"), false)
+	if backups := listBackups(tibiaPath); len(backups) != 3 {
+		t.Fatalf("expected an identical backup not to be written again, got %+v", backups)
+	}
+}
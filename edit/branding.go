@@ -0,0 +1,86 @@
+package edit
+
+import (
+	"fmt"
+	"os"
+)
+
+// Branding is the [branding] table of config.toml. It rewrites resources of
+// Windows clients; other formats have no resource directory.
+type Branding struct {
+	// Icon is an .ico file replacing the images of the first icon group.
+	Icon string `mapstructure:"icon"`
+	// Manifest is an application manifest replacing RT_MANIFEST.
+	Manifest string `mapstructure:"manifest"`
+	// Version sets StringFileInfo values such as ProductName. Keys are
+	// matched case-insensitively, as viper lowercases them.
+	Version map[string]string `mapstructure:"version"`
+}
+
+func (branding Branding) empty() bool {
+	return branding.Icon == "" && branding.Manifest == "" && len(branding.Version) == 0
+}
+
+// applyBranding rewrites the icon, manifest and version strings and then the
+// resource directory, which may move to its own section when it grows.
+func applyBranding(tibiaBinary []byte, branding Branding) ([]byte, error) {
+	if branding.empty() {
+		return tibiaBinary, nil
+	}
+	if !isWindowsExecutable("", tibiaBinary) {
+		fmt.Printf("[WARN] [branding] only applies to Windows clients; skipped\n")
+		return tibiaBinary, nil
+	}
+	resources, _, err := readPEResources(tibiaBinary)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the client resources: %w", err)
+	}
+
+	changes := make([]string, 0)
+	if branding.Icon != "" {
+		ico, err := os.ReadFile(branding.Icon)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the branding icon: %w", err)
+		}
+		var change string
+		if resources, change, err = replaceIcon(resources, ico); err != nil {
+			return nil, fmt.Errorf("%s: %w", branding.Icon, err)
+		}
+		changes = append(changes, change)
+	}
+	if branding.Manifest != "" {
+		manifest, err := os.ReadFile(branding.Manifest)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the branding manifest: %w", err)
+		}
+		var change string
+		resources, change = replaceManifest(resources, manifest)
+		changes = append(changes, change)
+	}
+	if len(branding.Version) > 0 {
+		versionChanges, err := setVersionStrings(resources, branding.Version)
+		if err != nil {
+			return nil, err
+		}
+		for _, change := range versionChanges {
+			changes = append(changes, "RT_VERSION "+change)
+		}
+	}
+
+	branded, location, err := writePEResources(tibiaBinary, resources)
+	if err != nil {
+		return nil, fmt.Errorf("unable to write the client resources: %w", err)
+	}
+	written, _, err := readPEResources(branded)
+	if err != nil {
+		return nil, fmt.Errorf("rewritten resource directory failed to parse: %w", err)
+	}
+	if !samePEResources(written, resources) {
+		return nil, fmt.Errorf("rewritten resource directory does not read back as written")
+	}
+	for _, change := range changes {
+		fmt.Printf("[PATCH] Branding: %s\n", change)
+	}
+	fmt.Printf("[PATCH] Resource directory %s\n", location)
+	return branded, nil
+}
@@ -0,0 +1,54 @@
+package edit
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApplyBrandingKeepsRelocatedURLBlockLast(t *testing.T) {
+	workDir := t.TempDir()
+	iconPath := filepath.Join(workDir, "server.ico")
+	manifestPath := filepath.Join(workDir, "client.manifest")
+	writeTestFile(t, iconPath, newICOFile(bytes.Repeat([]byte{0x44}, 0x400)))
+	writeTestFile(t, manifestPath, []byte("<assembly manifestVersion=\"1.0\"/>"))
+	branding := Branding{Icon: iconPath, Manifest: manifestPath, Version: map[string]string{"productname": "My OT"}}
+
+	branded, err := applyBranding(newResourceFixture(t), branding)
+	if err != nil {
+		t.Fatalf("expected the branding to apply: %s", err)
+	}
+	relocated, _, err := relocateURLBlock(branded, map[string]string{"loginWebService": "https://login.my-ot.example/service"})
+	if err != nil {
+		t.Fatalf("expected the URL block to relocate behind the branding section: %s", err)
+	}
+
+	rebranded, err := applyBranding(relocated, branding)
+	if err != nil {
+		t.Fatalf("expected branding an edited client to rebuild its section in place: %s", err)
+	}
+	if _, _, err := relocateURLBlock(rebranded, map[string]string{"loginWebService": "https://login.my-ot.example/service"}); err != nil {
+		t.Fatalf("expected the relocated block to be rebuilt again: %s", err)
+	}
+	sections := inspectPE(rebranded).sections
+	if len(sections) != 5 || sections[3].name != brandingSectionName || sections[4].name != urlRelocationSectionName {
+		t.Fatalf("expected %s before %s, got %+v", brandingSectionName, urlRelocationSectionName, sections)
+	}
+	resources, _, _ := readPEResources(rebranded)
+	if resource := resources[len(resources)-1]; !resource.is(resourceTypeManifest) || !bytes.Contains(resource.data, []byte("manifestVersion")) {
+		t.Fatalf("expected the manifest to be replaced, got %s", resource.describe())
+	}
+}
+
+func TestApplyBrandingReportsMissingInputs(t *testing.T) {
+	if unchanged, err := applyBranding([]byte("\x7fELF"), Branding{Version: map[string]string{"productname": "My OT"}}); err != nil || string(unchanged) != "\x7fELF" {
+		t.Fatalf("expected non-PE clients to be left alone, got %q err=%v", unchanged, err)
+	}
+	if _, err := applyBranding(newResourceFixture(t), Branding{Icon: filepath.Join(t.TempDir(), "missing.ico")}); err == nil || !strings.Contains(err.Error(), "branding icon") {
+		t.Fatalf("expected a missing icon to fail, got %v", err)
+	}
+	if _, err := applyBranding(newRelocationFixture(t), Branding{Version: map[string]string{"productname": "My OT"}}); err == nil || !strings.Contains(err.Error(), "no resource directory") {
+		t.Fatalf("expected a client without resources to fail, got %v", err)
+	}
+}
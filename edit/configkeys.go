@@ -0,0 +1,246 @@
+package edit
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// reservedConfigKeys are config.toml tables that are not embedded config
+// overrides.
+var reservedConfigKeys = map[string]struct{}{
+	"edit":     {},
+	"patch":    {},
+	"strings":  {},
+	"profile":  {},
+	"baseurl":  {},
+	"branding": {},
+	"audit":    {},
+}
+
+// configOverridesFromSettings splits viper settings into top-level values
+// and [SECTION] tables. Array tables such as [[edit]] are skipped.
+func configOverridesFromSettings(settings map[string]interface{}) (map[string]string, map[string]map[string]string) {
+	values := make(map[string]string)
+	sections := make(map[string]map[string]string)
+	for name, setting := range settings {
+		if _, reserved := reservedConfigKeys[name]; reserved {
+			continue
+		}
+		switch setting := setting.(type) {
+		case map[string]interface{}:
+			section := make(map[string]string, len(setting))
+			for key, value := range setting {
+				if _, nested := value.(map[string]interface{}); nested {
+					fmt.Printf("[WARN] Config key [%s] %s is a table, not a value; ignored\n", name, key)
+					continue
+				}
+				section[key] = fmt.Sprint(value)
+			}
+			sections[name] = section
+		case []interface{}, []map[string]interface{}:
+			fmt.Printf("[WARN] Config key %s is a list, not a value; ignored\n", name)
+		default:
+			values[name] = fmt.Sprint(setting)
+		}
+	}
+	return values, sections
+}
+
+// resolveConfigOverrides maps configured values onto the keys of the embedded
+// config of tibiaBinary and returns them by embedded key name. A top-level
+// value matches its key in any section; a section value only matches inside
+// that section. Names match case-insensitively because viper lowercases
+// them. Values for keys this client does not contain are reported and
+// dropped, and keys that are not configured keep the client default.
+func resolveConfigOverrides(tibiaBinary []byte, values map[string]string, sections map[string]map[string]string) (map[string]string, error) {
+	overrides := make(map[string]string)
+	embedded, ok := embeddedConfig(tibiaBinary)
+	if !ok {
+		fmt.Printf("[WARN] Embedded config block was not found; config keys cannot be checked against this client\n")
+		for key, value := range values {
+			overrides[key] = value
+		}
+		for _, name := range sortedSectionNames(sections) {
+			fmt.Printf("[WARN] Config section [%s] ignored without an embedded config block\n", name)
+		}
+		return overrides, nil
+	}
+
+	for _, name := range sortedKeys(values) {
+		matches := make([]string, 0, 1)
+		key := ""
+		for _, section := range embedded.sections {
+			for _, item := range section.keys {
+				if strings.EqualFold(item.key, name) {
+					matches = append(matches, section.name)
+					key = item.key
+				}
+			}
+		}
+		switch len(matches) {
+		case 0:
+			fmt.Printf("[WARN] Config key %s is not part of this client's embedded config; ignored\n", name)
+		case 1:
+			overrides[key] = values[name]
+		default:
+			return nil, fmt.Errorf("config key %s appears in sections %s of the embedded config; set it inside one of those sections", name, strings.Join(matches, ", "))
+		}
+	}
+
+	for _, name := range sortedSectionNames(sections) {
+		var section *configINISection
+		for index := range embedded.sections {
+			if strings.EqualFold(embedded.sections[index].name, name) {
+				section = &embedded.sections[index]
+				break
+			}
+		}
+		if section == nil {
+			fmt.Printf("[WARN] Config section [%s] is not part of this client's embedded config; ignored\n", name)
+			continue
+		}
+		for _, keyName := range sortedKeys(sections[name]) {
+			key := ""
+			for _, item := range section.keys {
+				if strings.EqualFold(item.key, keyName) {
+					key = item.key
+					break
+				}
+			}
+			if key == "" {
+				fmt.Printf("[WARN] Config key [%s] %s is not part of this client's embedded config; ignored\n", section.name, keyName)
+				continue
+			}
+			if other := embeddedKeySections(embedded, key); len(other) > 1 {
+				return nil, fmt.Errorf("config key [%s] %s also appears in sections %s; a key may only be overridden when it is unique", section.name, key, strings.Join(other, ", "))
+			}
+			overrides[key] = sections[name][keyName]
+		}
+	}
+
+	for _, property := range properties {
+		if _, configured := overrides[property]; !configured && len(embeddedKeySections(embedded, property)) > 0 {
+			fmt.Printf("[INFO] %s is not set in the config; keeping the client default\n", property)
+		}
+	}
+	return overrides, nil
+}
+
+// reportConfigValues prints every resolved value with the space the stock
+// value leaves for it and returns the keys whose value does not fit.
+func reportConfigValues(tibiaBinary []byte, configValues map[string]string) []string {
+	tooLong := make([]string, 0)
+	for _, key := range sortedKeys(configValues) {
+		value := configValues[key]
+		capacity, ok := configValueCapacity(tibiaBinary, key)
+		if !ok {
+			fmt.Printf("[INFO] %s = %s\n", key, value)
+			continue
+		}
+		fmt.Printf("[INFO] %s = %s (%d of %d bytes)\n", key, value, len(value), capacity)
+		if len(value) > capacity {
+			tooLong = append(tooLong, fmt.Sprintf("%s (%d > %d bytes)", key, len(value), capacity))
+		}
+	}
+	return tooLong
+}
+
+// configValueCapacity returns the length of the stock value of key, which is
+// the most an in-place rewrite can store.
+func configValueCapacity(tibiaBinary []byte, key string) (int, bool) {
+	start, end, ok := locateEmbeddedConfigValue(tibiaBinary, key)
+	if !ok {
+		return 0, false
+	}
+	return end - start, true
+}
+
+// locateEmbeddedConfigValue returns the file offsets of the value of key in
+// the embedded config block. Only a line of the block starting with "key="
+// below a [SECTION] header counts, so the same text elsewhere in the binary
+// is never touched. The value runs to the end of its line or of the block. A
+// key that appears on more than one line is not located.
+func locateEmbeddedConfigValue(tibiaBinary []byte, key string) (int, int, bool) {
+	blockStart := bytes.Index(tibiaBinary, []byte(configINIStartMarker))
+	block, ok := extractEmbeddedConfigINIBlock(tibiaBinary)
+	if !ok {
+		return 0, 0, false
+	}
+
+	prefix := []byte(key + "=")
+	start, end, found := 0, 0, 0
+	inSection := false
+	for lineStart := 0; lineStart < len(block); {
+		lineEnd := len(block)
+		if newline := bytes.IndexByte(block[lineStart:], '\n'); newline != -1 {
+			lineEnd = lineStart + newline
+		}
+		line := block[lineStart:lineEnd]
+		if _, ok := parseConfigINISectionLine(string(line)); ok {
+			inSection = true
+		} else if inSection && bytes.HasPrefix(line, prefix) {
+			start, end = blockStart+lineStart+len(prefix), blockStart+lineEnd
+			found++
+		}
+		lineStart = lineEnd + 1
+	}
+	return start, end, found == 1
+}
+
+func embeddedConfig(tibiaBinary []byte) (embeddedConfigINI, bool) {
+	data, ok := extractEmbeddedConfigINIBlock(tibiaBinary)
+	if !ok {
+		return embeddedConfigINI{}, false
+	}
+	return parseEmbeddedConfigINI(data)
+}
+
+func embeddedKeySections(embedded embeddedConfigINI, key string) []string {
+	sections := make([]string, 0, 1)
+	for _, section := range embedded.sections {
+		if _, ok := section.keyValues[key]; ok {
+			sections = append(sections, section.name)
+		}
+	}
+	return sections
+}
+
+// embeddedConfigKeyNames returns the stock URL keys followed by every other
+// key of the embedded config, the set an edit may have rewritten.
+func embeddedConfigKeyNames(tibiaBinary []byte) []string {
+	names := append([]string(nil), properties...)
+	seen := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		seen[name] = struct{}{}
+	}
+	embedded, _ := embeddedConfig(tibiaBinary)
+	for _, section := range embedded.sections {
+		for _, item := range section.keys {
+			if _, ok := seen[item.key]; !ok {
+				seen[item.key] = struct{}{}
+				names = append(names, item.key)
+			}
+		}
+	}
+	return names
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedSectionNames(sections map[string]map[string]string) []string {
+	names := make([]string, 0, len(sections))
+	for name := range sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
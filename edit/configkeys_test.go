@@ -0,0 +1,103 @@
+package edit
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveConfigOverridesMatchesEmbeddedSectionsAndKeys(t *testing.T) {
+	tibiaBinary := []byte("--[URLS]\nloginWebService=https://www.tibia.com/login\n[GAME]\nport=7171\nname=Tibia\n[DEBUG]\nname=debug\n\x00")
+
+	overrides, err := resolveConfigOverrides(tibiaBinary,
+		map[string]string{"loginwebservice": "http://127.0.0.1/login", "unknownKey": "x"},
+		map[string]map[string]string{"game": {"Port": "7172", "missing": "y"}, "absent": {"key": "z"}})
+	if err != nil {
+		t.Fatalf("expected the overrides to resolve: %s", err)
+	}
+	expected := map[string]string{"loginWebService": "http://127.0.0.1/login", "port": "7172"}
+	if !reflect.DeepEqual(overrides, expected) {
+		t.Fatalf("expected %v, got %v", expected, overrides)
+	}
+
+	if _, err := resolveConfigOverrides(tibiaBinary, map[string]string{"name": "x"}, nil); err == nil || !strings.Contains(err.Error(), "appears in sections GAME, DEBUG") {
+		t.Fatalf("expected an ambiguous top-level key to be refused, got %v", err)
+	}
+	if _, err := resolveConfigOverrides(tibiaBinary, nil, map[string]map[string]string{"GAME": {"name": "x"}}); err == nil {
+		t.Fatal("expected a section key that also exists in another section to be refused")
+	}
+}
+
+func TestConfigValuesOnlyRewriteLinesOfTheEmbeddedBlock(t *testing.T) {
+	code := []byte{0x48, 0x8d, 0x0d, 0x11, 0x22, 0x33, 0x44, 0xe8, 0x01, 0x02, 0x03, 0x04}
+	tibiaBinary := append([]byte("support=\x00"), code...)
+	tibiaBinary = append(tibiaBinary, "\n--[URLS]\nloginWebService=https://www.tibia.com/login\n[GAME]\nsupport=yes\nport=7171\x00"...)
+
+	overrides, err := resolveConfigOverrides(tibiaBinary, nil, map[string]map[string]string{"game": {"port": "7172"}})
+	if err != nil || overrides["port"] != "7172" {
+		t.Fatalf("expected the port override to resolve, got %v err=%v", overrides, err)
+	}
+	if capacity, ok := configValueCapacity(tibiaBinary, "port"); !ok || capacity != 4 {
+		t.Fatalf("expected the capacity of the embedded port value, got %d ok=%v", capacity, ok)
+	}
+
+	substitution, ok := replacePropertyByName(tibiaBinary, "port", "7172")
+	if !ok || !bytes.HasSuffix(tibiaBinary, []byte("\nsupport=yes\nport=7172\x00")) {
+		t.Fatalf("expected the embedded port to be rewritten, got %q", tibiaBinary)
+	}
+	if !bytes.Equal(tibiaBinary[9:9+len(code)], code) || substitution.offset != len(tibiaBinary)-5 {
+		t.Fatalf("expected the bytes outside the block to stay untouched, got %q", tibiaBinary)
+	}
+	if _, ok := replacePropertyByName(tibiaBinary, "ort", "1"); ok {
+		t.Fatal("expected a key to match only at the start of a line")
+	}
+}
+
+func TestConfigOverridesFromSettingsSkipsReservedTables(t *testing.T) {
+	values, sections := configOverridesFromSettings(map[string]interface{}{
+		"edit":   []interface{}{map[string]interface{}{"id": "1"}},
+		"patch":  []interface{}{},
+		"faqurl": "https://example.com/faq",
+		"port":   int64(7171),
+		"game":   map[string]interface{}{"motd": "Hi"},
+	})
+	if !reflect.DeepEqual(values, map[string]string{"faqurl": "https://example.com/faq", "port": "7171"}) {
+		t.Fatalf("unexpected top-level values %v", values)
+	}
+	if !reflect.DeepEqual(sections, map[string]map[string]string{"game": {"motd": "Hi"}}) {
+		t.Fatalf("unexpected sections %v", sections)
+	}
+}
+
+func TestPatcherOverridesNonURLEmbeddedKeys(t *testing.T) {
+	workDir := t.TempDir()
+	tibiaRsa := bytes.Repeat([]byte("A"), 32)
+	tibiaKeyPath := filepath.Join(workDir, "tibia.key")
+	otservKeyPath := filepath.Join(workDir, "otserv.key")
+	writeTestFile(t, tibiaKeyPath, tibiaRsa)
+	writeTestFile(t, otservKeyPath, bytes.Repeat([]byte("B"), 32))
+	tibiaBinary := append([]byte("header--"), tibiaRsa...)
+	tibiaBinary = append(tibiaBinary, []byte("--[URLS]\nloginWebService=https://www.tibia.com/login\n[GAME]\nmotd=Welcome to Tibia\n\x00")...)
+	tibiaPath := filepath.Join(workDir, "client")
+	writeTestFile(t, tibiaPath, tibiaBinary)
+
+	patcher, _ := NewPatcher(PatcherOptions{
+		TargetExe:       tibiaPath,
+		TibiaRSAKeyPath: tibiaKeyPath,
+		RSAKeyPath:      otservKeyPath,
+		ConfigSections:  map[string]map[string]string{"game": {"MOTD": "Hi"}},
+	})
+	result, err := patcher.Plan()
+	if err != nil {
+		t.Fatalf("expected the plan to succeed: %s", err)
+	}
+	if substitutions := result.Plan.URLSubstitutions; len(substitutions) != 1 || substitutions[0].Property != "motd" || substitutions[0].After != "Hi" || substitutions[0].Padding != 14 {
+		t.Fatalf("expected only motd to be rewritten, got %+v", substitutions)
+	}
+	expectedDiff := []string{"+[URLS]", "+loginWebService=https://www.tibia.com/login", "+", "+[GAME]", "+motd=Hi"}
+	if result.Plan.ConfigINI == nil || !reflect.DeepEqual(result.Plan.ConfigINI.Diff, expectedDiff) {
+		t.Fatalf("expected config.ini to keep the default URL and take the override, got %+v", result.Plan.ConfigINI)
+	}
+}
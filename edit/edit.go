@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"debug/pe"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -12,6 +13,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 )
 
@@ -45,6 +47,7 @@ const (
 	configINIFileName       = "config.ini"
 	configINIDirName        = "conf"
 	configINIStartMarker    = "[URLS]"
+	executableFormatPE      = "PE"
 )
 
 type battleyePatch struct {
@@ -67,10 +70,13 @@ type bytePattern struct {
 	mask []bool
 }
 
+// knownPatchOffset is where a signature is expected in one client build,
+// identified by SHA256, by a version pattern, or by both.
 type knownPatchOffset struct {
-	sha256 string
-	offset int
-	note   string
+	sha256  string
+	version string
+	offset  int
+	note    string
 }
 
 type structuralPatchKind string
@@ -125,13 +131,18 @@ type peRuntimeFunction struct {
 	endRVA   int
 }
 
+// peInfo describes the executable layout used by the structural checks. ELF
+// clients reuse it with virtual addresses in place of RVAs.
 type peInfo struct {
 	valid            bool
+	format           string
 	errorText        string
 	imageBase        uint64
 	sections         []peSectionInfo
 	runtimeFunctions []peRuntimeFunction
 	imports          []string
+	importSlots      map[int]string
+	symbols          []executableSymbol
 }
 
 type clientCheckReference struct {
@@ -143,6 +154,8 @@ type clientCheckReference struct {
 	contextStart      int
 	patternMatches    []patternMatch
 	contextBytes      []byte
+	disassembly       []string
+	instructions      []string
 	knownPatchNearby  bool
 	strongUnsupported bool
 	suspiciousActive  bool
@@ -164,11 +177,20 @@ type diagnosisReport struct {
 	path                string
 	size                int
 	sha256              string
+	version             clientVersion
 	isWindowsExe        bool
+	isELF               bool
+	isMachO             bool
+	machOSlices         []machOSliceReport
 	pe                  peInfo
+	integrity           peIntegrity
 	patchStatuses       []battleyePatchStatus
 	clientCheckFindings []clientCheckFinding
 	qtIndicators        []string
+	resources           []peResource
+	resourceDirectory   peResourceDirectory
+	resourceError       string
+	signatures          loadedSignatures
 }
 
 var structuralClientCheckDisconnectedPattern = newBytePattern(
@@ -441,93 +463,273 @@ var qtContextIndicators = []string{
 	"QMessageBox",
 }
 
-func Edit(tibiaExe string, sourceTibiaExe string, strictClientCheck bool, aggressiveClientCheck bool) {
+// EditOptions configures one edit run.
+type EditOptions struct {
+	TibiaExe              string
+	SourceTibiaExe        string
+	StrictClientCheck     bool
+	AggressiveClientCheck bool
+	AdhocSignMachO        bool
+	// DryRun runs every patch in memory and prints the plan without writing
+	// the executable, the backup or config.ini.
+	DryRun bool
+	// PlanJSONPath, when set, receives the edit plan as JSON.
+	PlanJSONPath string
+	// PatchPath, when set, receives a portable patch file after a successful
+	// export so the same edit can be replayed with ApplyPatch.
+	PatchPath string
+	// RelocateURLs moves the embedded URL block into a new PE section when a
+	// value is longer than the stock one.
+	RelocateURLs bool
+	// StripSignature removes the Authenticode certificate table, which no
+	// longer matches the edited client.
+	StripSignature bool
+	// RSAKeyPath is the OTServ key as a PEM file or a hex or decimal modulus;
+	// it defaults to DefaultRSAKeyPath.
+	RSAKeyPath string
+	// Profile selects a [profile.<name>] table merged over the top-level
+	// config values.
+	Profile string
+	// Watch keeps running after the edit and repeats it whenever the client
+	// executable is replaced, for example by a launcher update.
+	Watch bool
+}
+
+func Edit(options EditOptions) {
 	err := viper.ReadInConfig()
 	if err != nil {
 		fmt.Printf("[ERROR] Failed to read config file: %s\n", err.Error())
 		os.Exit(1)
 	}
-	// Check if all properties are present in the config file
-	missingProperties := make([]string, 0)
-	for _, prop := range properties {
-		if !viper.IsSet(prop) {
-			missingProperties = append(missingProperties, prop)
-		}
+	settings, err := applyConfigProfile(viper.AllSettings(), options.Profile)
+	if err != nil {
+		fmt.Printf("[ERROR] %s\n", err.Error())
+		os.Exit(1)
 	}
-
-	// Error out if any properties are missing
-	if len(missingProperties) > 0 {
-		fmt.Printf("[ERROR] Missing properties in the config file: %v\n", missingProperties)
+	if options.Profile != "" {
+		fmt.Printf("[INFO] Using config profile %q\n", options.Profile)
+	}
+	configValues, configSections := configOverridesFromSettings(settings)
+	if err := expandConfigTemplates(settings, configValues, configSections, options.Profile); err != nil {
+		fmt.Printf("[ERROR] %s\n", err.Error())
 		os.Exit(1)
 	}
 
-	configValues := make(map[string]string)
-	for _, prop := range properties {
-		value := viper.GetString(prop)
-		configValues[prop] = value
+	var userPatches []UserPatch
+	if err := viper.UnmarshalKey("patch", &userPatches, func(config *mapstructure.DecoderConfig) {
+		config.ErrorUnused = true
+	}); err != nil {
+		fmt.Printf("[ERROR] Invalid [[patch]] table in the config file: %s\n", err.Error())
+		os.Exit(1)
 	}
 
-	tibiaPath := tibiaExe
-	sourcePath := resolveSourceExecutable(tibiaPath, sourceTibiaExe)
-	_, sourceBinary := readFile(sourcePath)
-	tibiaBinary := append([]byte(nil), sourceBinary...)
-	originalBinarySize := len(sourceBinary)
-	originalTibiaBinary := append([]byte(nil), tibiaBinary...)
+	var stringReplacements []StringReplacement
+	if err := viper.UnmarshalKey("strings", &stringReplacements, func(config *mapstructure.DecoderConfig) {
+		config.ErrorUnused = true
+	}); err != nil {
+		fmt.Printf("[ERROR] Invalid [[strings]] table in the config file: %s\n", err.Error())
+		os.Exit(1)
+	}
 
-	if sourcePath != tibiaExe {
-		fmt.Printf("[INFO] Using source client executable for patch input: %s\n", filepath.Base(sourcePath))
-		fmt.Printf("[INFO] Writing patched client to target executable: %s\n", filepath.Base(tibiaExe))
+	var branding Branding
+	if brandingSettings, ok := settings["branding"]; ok {
+		decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{Result: &branding, ErrorUnused: true})
+		if err == nil {
+			err = decoder.Decode(brandingSettings)
+		}
+		if err != nil {
+			fmt.Printf("[ERROR] Invalid [branding] table in the config file: %s\n", err.Error())
+			os.Exit(1)
+		}
 	}
 
-	tibiaBinary = replaceTibiaRSAKey(tibiaBinary)
-	tibiaBinary = removeBattlEye(tibiaPath, tibiaBinary, aggressiveClientCheck)
-	diagnosis := analyzeTibiaBinary(tibiaPath, tibiaBinary)
-	logClientCheckSupportSummary(diagnosis)
-	enforceEditClientCheckPolicy(diagnosis, strictClientCheck)
+	var hostAudit HostAudit
+	if auditSettings, ok := settings["audit"]; ok {
+		decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{Result: &hostAudit, ErrorUnused: true})
+		if err == nil {
+			err = decoder.Decode(auditSettings)
+		}
+		if err != nil {
+			fmt.Printf("[ERROR] Invalid [audit] table in the config file: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
 
-	for prop, value := range configValues {
-		ok := setPropertyByName(tibiaBinary, prop, value)
-		if !ok {
-			fmt.Printf("[ERROR] Unable to replace %s\n", prop)
+	patcherOptions := PatcherOptions{
+		TargetExe:             options.TibiaExe,
+		SourceExe:             options.SourceTibiaExe,
+		RSAKeyPath:            options.RSAKeyPath,
+		ConfigValues:          configValues,
+		ConfigSections:        configSections,
+		Patches:               userPatches,
+		Strings:               stringReplacements,
+		Branding:              branding,
+		IgnoreHosts:           hostAudit.Ignore,
+		StrictClientCheck:     options.StrictClientCheck,
+		StrictHostAudit:       options.StrictClientCheck,
+		AggressiveClientCheck: options.AggressiveClientCheck,
+		AdhocSignMachO:        options.AdhocSignMachO,
+		RelocateURLs:          options.RelocateURLs,
+		StripSignature:        options.StripSignature,
+		PatchPath:             options.PatchPath,
+	}
+	if options.Watch {
+		if options.DryRun {
+			fmt.Printf("[ERROR] --watch cannot be combined with --dry-run\n")
+			os.Exit(1)
 		}
+		if err := watchEdit(patcherOptions); err != nil {
+			fmt.Printf("[ERROR] %s\n", err.Error())
+			os.Exit(1)
+		}
+		return
 	}
 
-	backupBinary := originalTibiaBinary
-	if sourcePath != tibiaExe {
-		targetBinary, err := os.ReadFile(tibiaPath)
-		if err == nil {
-			backupBinary = targetBinary
-		} else if !os.IsNotExist(err) {
-			fmt.Printf("[ERROR] Unable to read target executable for backup: %s\n", err.Error())
+	patcher, err := NewPatcher(patcherOptions)
+	if err != nil {
+		fmt.Printf("[ERROR] %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	var result EditResult
+	if options.DryRun {
+		fmt.Printf("[INFO] Dry run: patches are applied in memory only\n")
+		result, err = patcher.Plan()
+	} else {
+		result, err = patcher.Apply()
+	}
+	var clientCheckErr *ClientCheckError
+	if errors.As(err, &clientCheckErr) {
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Printf("[ERROR] %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if options.DryRun {
+		result.Plan.print()
+	}
+	if options.PlanJSONPath != "" {
+		if err := result.Plan.writeJSON(options.PlanJSONPath); err != nil {
+			fmt.Printf("[ERROR] %s\n", err.Error())
 			os.Exit(1)
 		}
 	}
+	if options.DryRun {
+		fmt.Printf("[INFO] Dry run complete; no client, backup or %s files were written\n", configINIFileName)
+	}
+}
 
-	backupTibiaExecutable(tibiaPath, backupBinary, aggressiveClientCheck)
-	exportModifiedFile(tibiaPath, tibiaBinary, originalBinarySize)
-	syncConfigINI(tibiaPath, originalTibiaBinary, configValues)
-	logEditSuccess(diagnosis, strictClientCheck)
+// DiagnoseOptions configures one diagnose run.
+type DiagnoseOptions struct {
+	TibiaExe          string
+	CompareWith       string
+	StrictClientCheck bool
+	// SignaturesPath optionally replaces the built-in signature set.
+	SignaturesPath string
+	// Format is DiagnoseFormatText, DiagnoseFormatJSON or DiagnoseFormatSARIF.
+	// The machine-readable formats print nothing but the document.
+	Format string
+	// OutputPath receives the JSON or SARIF document instead of stdout.
+	OutputPath string
+	// Directory diagnoses every executable below it matching Match and prints
+	// a support matrix instead of a single report.
+	Directory string
+	Match     string
 }
 
-func Diagnose(tibiaExe string, compareWith string, strictClientCheck bool) {
-	tibiaPath, tibiaBinary := readFile(tibiaExe)
-	diagnosis := analyzeTibiaBinary(tibiaPath, tibiaBinary)
+func Diagnose(options DiagnoseOptions) {
+	format := options.Format
+	if format == "" {
+		format = DiagnoseFormatText
+	}
+	if format != DiagnoseFormatText && format != DiagnoseFormatJSON && format != DiagnoseFormatSARIF {
+		fmt.Printf("[ERROR] Unknown diagnose format %q; use %s, %s or %s\n", format, DiagnoseFormatText, DiagnoseFormatJSON, DiagnoseFormatSARIF)
+		os.Exit(1)
+	}
+	if format == DiagnoseFormatText {
+		LoadSignatureDatabase(options.SignaturesPath)
+	} else if options.SignaturesPath != "" {
+		signatures, err := readSignatureDatabase(options.SignaturesPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[ERROR] Invalid signature database %s: %s\n", options.SignaturesPath, err.Error())
+			os.Exit(1)
+		}
+		signatures.activate()
+	}
+	if options.Directory != "" {
+		diagnoseDirectory(options, format)
+		return
+	}
 
-	printDiagnosisReport(diagnosis, "target")
+	patcher, err := NewPatcher(PatcherOptions{TargetExe: options.TibiaExe})
+	if err != nil {
+		fmt.Printf("[ERROR] %s\n", err.Error())
+		os.Exit(1)
+	}
+	diagnosis, compareDiagnosis, err := patcher.diagnose(options.CompareWith)
+	if err != nil {
+		fmt.Printf("[ERROR] %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	switch format {
+	case DiagnoseFormatJSON:
+		writeDiagnosisOutput(options.OutputPath, newDiagnosisDocument(diagnosis, compareDiagnosis))
+	case DiagnoseFormatSARIF:
+		writeDiagnosisOutput(options.OutputPath, newSARIFLog(diagnosis))
+	default:
+		printDiagnosisReport(diagnosis, "target")
+		if compareDiagnosis != nil {
+			printDiagnosisReport(*compareDiagnosis, "baseline")
+			printDiagnosisComparison(*compareDiagnosis, diagnosis)
+		}
+	}
 
-	if compareWith != "" {
-		comparePath, compareBinary := readFile(compareWith)
-		compareDiagnosis := analyzeTibiaBinary(comparePath, compareBinary)
-		printDiagnosisReport(compareDiagnosis, "baseline")
-		printDiagnosisComparison(compareDiagnosis, diagnosis)
+	if format != DiagnoseFormatText && options.StrictClientCheck && diagnosis.hasUnsafeClientCheckRemainder() {
+		os.Exit(1)
+	}
+	failIfStrictClientCheck(diagnosis, options.StrictClientCheck)
+}
+
+func diagnoseDirectory(options DiagnoseOptions, format string) {
+	if format == DiagnoseFormatSARIF || options.CompareWith != "" {
+		fmt.Printf("[ERROR] --dir supports only the %s and %s formats and cannot be combined with --compare-with\n", DiagnoseFormatText, DiagnoseFormatJSON)
+		os.Exit(1)
+	}
+	match := options.Match
+	if match == "" {
+		match = DefaultHistoryMatch
+	}
+	directory := clean(options.Directory)
+	paths, err := findHistoryExecutables(directory, match)
+	if err != nil {
+		fmt.Printf("[ERROR] Unable to scan %s: %s\n", directory, err.Error())
+		os.Exit(1)
+	}
+	if len(paths) == 0 {
+		fmt.Printf("[ERROR] No executables matching %q found in %s\n", match, directory)
+		os.Exit(1)
 	}
 
-	failIfStrictClientCheck(diagnosis, strictClientCheck)
+	history := buildDiagnosisHistory(directory, paths)
+	if format == DiagnoseFormatJSON {
+		writeDiagnosisOutput(options.OutputPath, history)
+		if options.StrictClientCheck && history.newest.hasUnsafeClientCheckRemainder() {
+			os.Exit(1)
+		}
+		return
+	}
+	printDiagnosisHistory(history)
+	failIfStrictClientCheck(*history.newest, options.StrictClientCheck)
 }
 
-func backupTibiaExecutable(tibiaPath string, tibiaBinary []byte, aggressive bool) {
+// backupTibiaExecutable writes tibiaBinary as a new BKP<unix>-<client> backup
+// and returns its path, or the path of an existing identical backup.
+func backupTibiaExecutable(tibiaPath string, tibiaBinary []byte, aggressive bool) (string, error) {
 	tibiaExeFileName := filepath.Base(tibiaPath)
-	tibiaExeBackupPath := filepath.Join(filepath.Dir(tibiaPath), fmt.Sprintf("BKP%d-%s", time.Now().Unix(), tibiaExeFileName))
+	tibiaExeBackupPath := backupPathFor(tibiaPath)
 	tibiaExeBackupFileName := filepath.Base(tibiaExeBackupPath)
 
 	if aggressive {
@@ -540,42 +742,131 @@ func backupTibiaExecutable(tibiaPath string, tibiaBinary []byte, aggressive bool
 		fmt.Printf("[WARN] ============================================================\n")
 	}
 
+	if existingBackupPath, ok := findIdenticalBackup(tibiaPath, tibiaBinary); ok {
+		fmt.Printf("[INFO] %s is already backed up as %s\n", tibiaExeFileName, filepath.Base(existingBackupPath))
+		return existingBackupPath, nil
+	}
+	if _, err := os.Stat(tibiaExeBackupPath); err == nil {
+		return "", fmt.Errorf("backup %s already exists with different content; retry in a second", tibiaExeBackupFileName)
+	}
+
 	fmt.Printf("[INFO] Backing up %s to %s\n", tibiaExeFileName, tibiaExeBackupFileName)
 
-	err := os.WriteFile(tibiaExeBackupPath, tibiaBinary, 0644)
-	if err != nil {
-		fmt.Printf("[ERROR] %s\n", err.Error())
-		os.Exit(1)
+	if err := os.WriteFile(tibiaExeBackupPath, tibiaBinary, 0644); err != nil {
+		return "", err
 	}
+	return tibiaExeBackupPath, nil
 }
 
-func replaceTibiaRSAKey(tibiaBinary []byte) []byte {
-	tibiaRsaPath := "tibia_rsa.key"
-	otservRsaPath := "otserv_rsa.key"
+// backupSourceBinary returns the bytes to back up before tibiaPath is
+// overwritten: the current target when a separate source executable is used,
+// otherwise the source itself.
+func backupSourceBinary(tibiaPath string, sourcePath string, sourceBinary []byte) ([]byte, error) {
+	if sourcePath == tibiaPath {
+		return sourceBinary, nil
+	}
+	targetBinary, err := os.ReadFile(tibiaPath)
+	if err == nil {
+		return targetBinary, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("unable to read target executable for backup: %w", err)
+	}
+	return sourceBinary, nil
+}
+
+func backupPathFor(tibiaPath string) string {
+	return filepath.Join(filepath.Dir(tibiaPath), fmt.Sprintf("BKP%d-%s", time.Now().Unix(), filepath.Base(tibiaPath)))
+}
 
-	_, tibiaRsa := readFile(tibiaRsaPath)
-	_, otservRsa := readFile(otservRsaPath)
+// uniqueBackupPathFor returns backupPathFor, moved to the next free second
+// when a backup with that name already exists.
+func uniqueBackupPathFor(tibiaPath string) string {
+	for timestamp := time.Now().Unix(); ; timestamp++ {
+		backupPath := filepath.Join(filepath.Dir(tibiaPath), fmt.Sprintf("BKP%d-%s", timestamp, filepath.Base(tibiaPath)))
+		if _, err := os.Stat(backupPath); os.IsNotExist(err) {
+			return backupPath
+		}
+	}
+}
+
+// rekeyClient writes the OTServ key from keyPath over the Tibia key from
+// tibiaKeyPath. When the Tibia key is not embedded, for example in a client
+// that was re-keyed before, the single embedded modulus is replaced instead.
+func rekeyClient(tibiaBinary []byte, tibiaKeyPath string, keyPath string) ([]byte, error) {
+	if tibiaKeyPath == "" {
+		tibiaKeyPath = tibiaRSAKeyPath
+	}
+	if keyPath == "" {
+		keyPath = DefaultRSAKeyPath
+	}
+	otservKey, err := loadRSAKey(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read RSA key: %w", err)
+	}
+	tibiaKey, err := loadRSAKey(tibiaKeyPath)
+	if err != nil {
+		fmt.Printf("[WARN] Unable to read %s: %s\n", tibiaKeyPath, err.Error())
+	}
 
 	fmt.Printf("[INFO] Searching for Tibia RSA... \n")
 
-	if bytes.Contains(tibiaBinary, tibiaRsa) {
-		fmt.Printf("[INFO] Tibia RSA found!\n")
-		tibiaBinary = bytes.Replace(tibiaBinary, tibiaRsa, otservRsa, 1)
-		fmt.Printf("[PATCH] Tibia RSA replaced with OTServ RSA!\n")
-	} else if bytes.Contains(tibiaBinary, otservRsa) {
-		fmt.Printf("[WARN] OTServ RSA already patched!\n")
-	} else {
-		fmt.Printf("[ERROR] Unable to find Tibia RSA\n")
-		os.Exit(1)
+	for _, encoding := range tibiaKey.encodings() {
+		tibiaRsa, otservRsa := tibiaKey.text(encoding), otservKey.text(encoding)
+		if len(tibiaRsa) == 0 || len(otservRsa) == 0 || (!bytes.Contains(tibiaBinary, tibiaRsa) && !bytes.Contains(tibiaBinary, otservRsa)) {
+			continue
+		}
+		if replaced, ok := replaceRSAKeyInSlices(tibiaBinary, tibiaRsa, otservRsa); ok {
+			return replaced, nil
+		}
+	}
+
+	fmt.Printf("[INFO] Tibia RSA not found; searching for another embedded RSA modulus\n")
+	replaced, err := rekeyEmbeddedRSAModulus(tibiaBinary, otservKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find Tibia RSA: %w", err)
+	}
+	return replaced, nil
+}
+
+// replaceRSAKeyInSlices replaces the first Tibia RSA modulus of every
+// executable slice, so each architecture of a universal Mach-O is re-keyed.
+// Slices are processed from the end so earlier slice offsets stay valid.
+func replaceRSAKeyInSlices(tibiaBinary []byte, tibiaRsa []byte, otservRsa []byte) ([]byte, bool) {
+	slices := executableSlices(tibiaBinary)
+	found := 0
+	for index := len(slices) - 1; index >= 0; index-- {
+		slice := slices[index]
+		sliceLabel := ""
+		if slice.arch != "" {
+			sliceLabel = " in Mach-O slice " + slice.label()
+		}
+
+		sliceData := tibiaBinary[slice.start:slice.end]
+		if bytes.Contains(sliceData, tibiaRsa) {
+			fmt.Printf("[INFO] Tibia RSA found%s!\n", sliceLabel)
+			replaced := bytes.Replace(sliceData, tibiaRsa, otservRsa, 1)
+			updated := make([]byte, 0, len(tibiaBinary)-len(sliceData)+len(replaced))
+			updated = append(updated, tibiaBinary[:slice.start]...)
+			updated = append(updated, replaced...)
+			tibiaBinary = append(updated, tibiaBinary[slice.end:]...)
+			fmt.Printf("[PATCH] Tibia RSA replaced with OTServ RSA%s!\n", sliceLabel)
+			found++
+		} else if bytes.Contains(sliceData, otservRsa) {
+			fmt.Printf("[WARN] OTServ RSA already patched%s!\n", sliceLabel)
+			found++
+		} else if len(slices) > 1 {
+			fmt.Printf("[WARN] Unable to find Tibia RSA%s\n", sliceLabel)
+		}
 	}
 
-	return tibiaBinary
+	return tibiaBinary, found > 0
 }
 
-func removeBattlEye(tibiaPath string, tibiaBinary []byte, aggressive bool) []byte {
-	if !isWindowsExecutable(tibiaPath, tibiaBinary) {
-		fmt.Printf("[WARN] Battleye patch skipped because the client is not a Windows executable\n")
-		return tibiaBinary
+func removeBattlEye(signatures loadedSignatures, tibiaPath string, tibiaBinary []byte, aggressive bool) ([]byte, error) {
+	if !isWindowsExecutable(tibiaPath, tibiaBinary) && !isELFExecutable(tibiaBinary) && !isMachOExecutable(tibiaBinary) {
+		fmt.Printf("[WARN] Battleye patch skipped because the client is not a Windows, ELF or Mach-O executable\n")
+		return tibiaBinary, nil
 	}
 
 	fmt.Printf("[INFO] Searching for BattlEye byte patch signatures...\n")
@@ -583,11 +874,21 @@ func removeBattlEye(tibiaPath string, tibiaBinary []byte, aggressive bool) []byt
 		fmt.Printf("[WARN] Aggressive mode enabled: high-risk signatures are eligible for patching.\n")
 	}
 
-	activeBattleyePatches := make([]battleyePatch, len(battleyePatches))
-	for patchIndex, patch := range battleyePatches {
-		activeBattleyePatches[patchIndex] = patch.withAggressiveMode(aggressive)
+	peData := inspectExecutable(tibiaBinary)
+	if peData.format != executableFormatPE {
+		if !peData.valid {
+			fmt.Printf("[WARN] %s parsing failed; structural BattlEye verification is unavailable: %s\n", peData.format, peData.errorText)
+		}
+		fmt.Printf("[INFO] %s client detected; the client-check pair cannot be structurally verified and no BattlEye signature is patched\n", peData.format)
+	}
+	activeBattleyePatches := make([]battleyePatch, len(signatures.patches))
+	for patchIndex, patch := range battleyePatchesForFormat(signatures.patches, peData.format) {
+		aggressivePatch, err := patch.withAggressiveMode(aggressive)
+		if err != nil {
+			return tibiaBinary, err
+		}
+		activeBattleyePatches[patchIndex] = aggressivePatch
 	}
-	peData := inspectPE(tibiaBinary)
 	structuralPlan := buildStructuralPatchPlan(tibiaBinary, peData, activeBattleyePatches)
 	var beforeBattleyePatches []byte
 	if structuralPlan.verifiedGroups[structuralClientCheckGroup] {
@@ -595,6 +896,7 @@ func removeBattlEye(tibiaPath string, tibiaBinary []byte, aggressive bool) []byt
 		beforeBattleyePatches = append([]byte(nil), tibiaBinary...)
 	}
 
+	var err error
 	patchesApplied := 0
 	signaturesApplied := 0
 	alreadyApplied := 0
@@ -628,7 +930,9 @@ func removeBattlEye(tibiaPath string, tibiaBinary []byte, aggressive bool) []byt
 				aggressivePatch.replacement = append([]int(nil), patch.aggressiveReplacement...)
 				aggressivePatch.patched = newBytePattern(patch.name+" [aggressive]", patch.aggressiveReplacement...)
 
-				tibiaBinary = applyBattleyePatch(tibiaBinary, aggressivePatch, originalOffsets)
+				if tibiaBinary, err = applyBattleyePatch(tibiaBinary, aggressivePatch, originalOffsets); err != nil {
+					return tibiaBinary, err
+				}
 				count := len(originalOffsets)
 				patchesApplied += count
 				signaturesApplied++
@@ -643,7 +947,9 @@ func removeBattlEye(tibiaPath string, tibiaBinary []byte, aggressive bool) []byt
 		}
 
 		if len(originalOffsets) > 0 {
-			tibiaBinary = applyBattleyePatch(tibiaBinary, patch, originalOffsets)
+			if tibiaBinary, err = applyBattleyePatch(tibiaBinary, patch, originalOffsets); err != nil {
+				return tibiaBinary, err
+			}
 			count := len(originalOffsets)
 			patchesApplied += count
 			signaturesApplied++
@@ -662,11 +968,11 @@ func removeBattlEye(tibiaPath string, tibiaBinary []byte, aggressive bool) []byt
 	}
 
 	if beforeBattleyePatches != nil {
-		postPatchPE := inspectPE(tibiaBinary)
+		postPatchPE := inspectExecutable(tibiaBinary)
 		postPatchPlan := buildStructuralPatchPlan(tibiaBinary, postPatchPE, activeBattleyePatches)
 		if !postPatchPlan.groupFullyPatched(activeBattleyePatches, structuralClientCheckGroup) {
 			fmt.Printf("[ERROR] BattlEye structural post-patch verification failed; rolling back all BattlEye byte changes\n")
-			return beforeBattleyePatches
+			return beforeBattleyePatches, nil
 		}
 		fmt.Printf("[INFO] BattlEye structural client-check pair verified after patching\n")
 	}
@@ -676,33 +982,33 @@ func removeBattlEye(tibiaPath string, tibiaBinary []byte, aggressive bool) []byt
 		if signaturesApplied < patchableSignatures {
 			fmt.Printf("[WARN] BattlEye byte patch is partial for this binary; missing signatures can mean this client version uses different code paths\n")
 		}
-		if hasClientCheckStringIndicators(tibiaBinary) {
+		if hasClientCheckStringIndicators(tibiaBinary, signatures.indicators) {
 			if structuralPlan.verifiedGroups[structuralClientCheckGroup] {
 				fmt.Printf("[INFO] Client-check strings remain as Qt metadata; the structurally verified dispatch pair was neutralized\n")
 			} else {
 				fmt.Printf("[WARN] Client-check strings remain after BattlEye patching; this edit should be treated as PARTIAL unless code-reference diagnostics prove the paths inactive\n")
 			}
 		}
-		return tibiaBinary
+		return tibiaBinary, nil
 	}
 
 	if alreadyApplied > 0 {
 		fmt.Printf("[WARN] BattlEye byte patches were already present (%d occurrence(s)); no new byte patch was applied\n", alreadyApplied)
-		if hasClientCheckStringIndicators(tibiaBinary) {
+		if hasClientCheckStringIndicators(tibiaBinary, signatures.indicators) {
 			if structuralPlan.verifiedGroups[structuralClientCheckGroup] {
 				fmt.Printf("[INFO] Client-check strings remain as Qt metadata; the structurally verified dispatch pair is already neutralized\n")
 			} else {
 				fmt.Printf("[WARN] Client-check strings remain in an already patched binary; this should be treated as PARTIAL unless code-reference diagnostics prove the paths inactive\n")
 			}
 		}
-		return tibiaBinary
+		return tibiaBinary, nil
 	}
 
 	fmt.Printf("[WARN] BattlEye byte patch signatures not found\n")
-	if hasClientCheckStringIndicators(tibiaBinary) {
+	if hasClientCheckStringIndicators(tibiaBinary, signatures.indicators) {
 		fmt.Printf("[WARN] Client-check strings remain and no patchable BattlEye signature matched; this binary is likely unsupported by the current patch set\n")
 	}
-	return tibiaBinary
+	return tibiaBinary, nil
 }
 
 func logBattlEyeSignatureReport(patchStatuses []battleyePatchStatus) {
@@ -751,7 +1057,7 @@ func isWindowsExecutable(_ string, tibiaBinary []byte) bool {
 		tibiaBinary[peOffset+3] == 0x00
 }
 
-func analyzeTibiaBinary(tibiaPath string, tibiaBinary []byte) diagnosisReport {
+func analyzeTibiaBinary(signatures loadedSignatures, tibiaPath string, tibiaBinary []byte) diagnosisReport {
 	sum := sha256.Sum256(tibiaBinary)
 	sha256Text := fmt.Sprintf("%x", sum[:])
 	diagnosis := diagnosisReport{
@@ -759,22 +1065,38 @@ func analyzeTibiaBinary(tibiaPath string, tibiaBinary []byte) diagnosisReport {
 		size:         len(tibiaBinary),
 		sha256:       sha256Text,
 		isWindowsExe: isWindowsExecutable(tibiaPath, tibiaBinary),
+		isELF:        isELFExecutable(tibiaBinary),
+		isMachO:      isMachOExecutable(tibiaBinary),
+		version:      detectClientVersion(tibiaPath, tibiaBinary),
+		signatures:   signatures,
 	}
 
-	if diagnosis.isWindowsExe {
+	switch {
+	case diagnosis.isWindowsExe:
 		diagnosis.pe = inspectPE(tibiaBinary)
+		diagnosis.integrity = inspectPEIntegrity(tibiaBinary)
+		var err error
+		if diagnosis.resources, diagnosis.resourceDirectory, err = readPEResources(tibiaBinary); err != nil {
+			diagnosis.resourceError = err.Error()
+		}
+	case diagnosis.isELF:
+		diagnosis.pe = inspectELF(tibiaBinary)
+	case diagnosis.isMachO:
+		diagnosis.pe = inspectMachO(tibiaBinary)
+		diagnosis.machOSlices = inspectMachOSlices(tibiaBinary)
 	}
 
-	diagnosis.patchStatuses = scanBattlEyePatchStatus(tibiaBinary, sha256Text, diagnosis.pe)
-	diagnosis.clientCheckFindings = scanClientCheckFindings(tibiaBinary, diagnosis.pe, diagnosis.patchStatuses)
+	diagnosis.patchStatuses = scanBattlEyePatchStatus(signatures.patches, tibiaBinary, sha256Text, diagnosis.version.version, diagnosis.pe)
+	diagnosis.clientCheckFindings = scanClientCheckFindings(signatures, tibiaBinary, diagnosis.pe, diagnosis.patchStatuses)
 	diagnosis.qtIndicators = scanQtContextIndicators(tibiaBinary, diagnosis.pe)
 	return diagnosis
 }
 
-func scanBattlEyePatchStatus(tibiaBinary []byte, sha256Text string, peData peInfo) []battleyePatchStatus {
-	statuses := make([]battleyePatchStatus, 0, len(battleyePatches))
-	structuralPlan := buildStructuralPatchPlan(tibiaBinary, peData, battleyePatches)
-	for patchIndex, patch := range battleyePatches {
+func scanBattlEyePatchStatus(signaturePatches []battleyePatch, tibiaBinary []byte, sha256Text string, version string, peData peInfo) []battleyePatchStatus {
+	patches := battleyePatchesForFormat(signaturePatches, peData.format)
+	statuses := make([]battleyePatchStatus, 0, len(patches))
+	structuralPlan := buildStructuralPatchPlan(tibiaBinary, peData, patches)
+	for patchIndex, patch := range patches {
 		originalOffsets := patch.original.findAll(tibiaBinary)
 		patchedOffsets := patch.effectivePatchedPattern().findAll(tibiaBinary)
 		if patch.structuralGuard != nil {
@@ -791,26 +1113,43 @@ func scanBattlEyePatchStatus(tibiaBinary []byte, sha256Text string, peData peInf
 			patch:                patch,
 			originalOffset:       originalOffsets,
 			patchedOffset:        patchedOffsets,
-			expectedOffsetHits:   patch.expectedOffsetHits(tibiaBinary, sha256Text),
-			expectedOffsetMisses: patch.expectedOffsetMisses(tibiaBinary, sha256Text),
+			expectedOffsetHits:   patch.expectedOffsetHits(tibiaBinary, sha256Text, version),
+			expectedOffsetMisses: patch.expectedOffsetMisses(tibiaBinary, sha256Text, version),
 		})
 	}
 	return statuses
 }
 
+// inspectExecutable returns the section and function layout of a PE, ELF or
+// Mach-O client. ELF and Mach-O virtual addresses are stored as RVAs with a
+// zero image base so the structural and xref checks treat every format alike.
+func inspectExecutable(tibiaBinary []byte) peInfo {
+	switch {
+	case isELFExecutable(tibiaBinary):
+		return inspectELF(tibiaBinary)
+	case isMachOExecutable(tibiaBinary):
+		return inspectMachO(tibiaBinary)
+	default:
+		return inspectPE(tibiaBinary)
+	}
+}
+
 func inspectPE(tibiaBinary []byte) peInfo {
 	peFile, err := pe.NewFile(bytes.NewReader(tibiaBinary))
 	if err != nil {
-		return peInfo{errorText: err.Error()}
+		return peInfo{format: executableFormatPE, errorText: err.Error()}
 	}
 	defer peFile.Close()
 
-	info := peInfo{valid: true}
+	info := peInfo{valid: true, format: executableFormatPE}
+	importDirectoryRVA, thunkSize := 0, 8
 	switch optionalHeader := peFile.OptionalHeader.(type) {
 	case *pe.OptionalHeader32:
 		info.imageBase = uint64(optionalHeader.ImageBase)
+		importDirectoryRVA, thunkSize = int(optionalHeader.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_IMPORT].VirtualAddress), 4
 	case *pe.OptionalHeader64:
 		info.imageBase = optionalHeader.ImageBase
+		importDirectoryRVA = int(optionalHeader.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_IMPORT].VirtualAddress)
 	}
 
 	for _, section := range peFile.Sections {
@@ -875,6 +1214,7 @@ func inspectPE(tibiaBinary []byte) peInfo {
 		info.imports = append(info.imports, symbols...)
 	}
 	sort.Strings(info.imports)
+	info.importSlots = peImportSlots(tibiaBinary, info, importDirectoryRVA, thunkSize)
 
 	return info
 }
@@ -956,31 +1296,41 @@ func validateClientCheckDisconnectedStructure(tibiaBinary []byte, peData peInfo,
 	if !peData.codeRangeWithinRuntimeFunction(offset, bodyLength, false) {
 		return false
 	}
+	body, ok := decodeX86Body(tibiaBinary, offset, bodyLength)
+	if !ok {
+		return false
+	}
 
-	memberOffset := offset + 26
-	if memberOffset < 0 || memberOffset+4 > len(tibiaBinary) {
+	member := body[23]
+	if member.mnemonic() != "mov" || !member.hasMemoryOperand() || member.ripRelative() || member.displacementSize != 4 {
 		return false
 	}
-	memberDisplacement := int(int32(binary.LittleEndian.Uint32(tibiaBinary[memberOffset : memberOffset+4])))
-	if memberDisplacement < 0x100 || memberDisplacement > 0x4000 || memberDisplacement%8 != 0 {
+	if member.displacement < 0x100 || member.displacement > 0x4000 || member.displacement%8 != 0 {
 		return false
 	}
 
-	if !matchesRIPCString(tibiaBinary, peData, offset+36, "clientcheck_disconnected") ||
-		!matchesRIPCString(tibiaBinary, peData, offset+62, "error") {
+	if !matchesRIPCString(tibiaBinary, peData, body[36], "clientcheck_disconnected") ||
+		!matchesRIPCString(tibiaBinary, peData, body[62], "error") {
 		return false
 	}
 
-	firstQtIATRVA, firstQtOK := relativeTargetRVA(tibiaBinary, peData, offset+47, 6, 2)
-	secondQtIATRVA, secondQtOK := relativeTargetRVA(tibiaBinary, peData, offset+73, 6, 2)
+	firstQtIATRVA, firstQtOK := indirectCallTargetRVA(peData, body[47])
+	secondQtIATRVA, secondQtOK := indirectCallTargetRVA(peData, body[73])
 	if !firstQtOK || !secondQtOK || firstQtIATRVA != secondQtIATRVA || !peData.rvaIsNonCode(firstQtIATRVA) {
 		return false
 	}
 
-	if !relativeTargetIsCode(tibiaBinary, peData, offset+18, 5, 1) {
+	if !directTargetIsCode(peData, body[18], "call") {
 		return false
 	}
-	if !patched && !relativeTargetIsCode(tibiaBinary, peData, offset+93, 5, 1) {
+	if patched {
+		// The neutralized dispatch call is five single-byte NOPs.
+		for position := 93; position < 98; position++ {
+			if !body[position].isNop() || body[position].length != 1 {
+				return false
+			}
+		}
+	} else if !directTargetIsCode(peData, body[93], "call") {
 		return false
 	}
 
@@ -996,45 +1346,50 @@ func validateEnableClientCheckStructure(tibiaBinary []byte, peData peInfo, offse
 	if !ok || !section.isCode || offset+44 > section.rawEnd || offset+44 > len(tibiaBinary) {
 		return false
 	}
+	body, ok := decodeX86Body(tibiaBinary, offset, functionBodyLength)
+	if !ok {
+		return false
+	}
 
-	if !matchesRIPCString(tibiaBinary, peData, offset+4, "enableClientCheck") {
+	if !matchesRIPCString(tibiaBinary, peData, body[4], "enableClientCheck") {
 		return false
 	}
 
-	objectRVA, objectOK := relativeTargetRVA(tibiaBinary, peData, offset+11, 7, 3)
+	objectRVA, objectOK := addressLoadTargetRVA(peData, body[11])
 	objectSection, objectSectionOK := peData.sectionForRVA(objectRVA)
 	if !objectOK || !objectSectionOK || !objectSection.isWritable || objectSection.isCode {
 		return false
 	}
 
-	destructorThunkRVA, thunkOK := relativeTargetRVA(tibiaBinary, peData, offset+24, 7, 3)
+	destructorThunkRVA, thunkOK := addressLoadTargetRVA(peData, body[24])
 	destructorThunkOffset, thunkOffsetOK := peData.offsetForRVA(destructorThunkRVA)
 	if !thunkOK || !thunkOffsetOK || !peData.rvaIsCode(destructorThunkRVA) || destructorThunkOffset+14 > len(tibiaBinary) {
 		return false
 	}
-	if !bytes.Equal(tibiaBinary[destructorThunkOffset:destructorThunkOffset+3], []byte{0x48, 0x8d, 0x0d}) ||
-		!bytes.Equal(tibiaBinary[destructorThunkOffset+7:destructorThunkOffset+10], []byte{0x48, 0xff, 0x25}) {
+	thunk, ok := decodeX86Body(tibiaBinary, destructorThunkOffset, 14)
+	if !ok {
 		return false
 	}
-
-	thunkObjectRVA, thunkObjectOK := relativeTargetRVA(tibiaBinary, peData, destructorThunkOffset, 7, 3)
-	destructorIATRVA, destructorIATOK := relativeTargetRVA(tibiaBinary, peData, destructorThunkOffset+7, 7, 3)
+	thunkObjectRVA, thunkObjectOK := addressLoadTargetRVA(peData, thunk[0])
+	destructorIATRVA, destructorIATOK := indirectTargetRVA(peData, thunk[7], "jmp")
 	if !thunkObjectOK || thunkObjectRVA != objectRVA || !destructorIATOK || !peData.rvaIsNonCode(destructorIATRVA) {
 		return false
 	}
 
 	if !patched {
-		constructorIATRVA, constructorOK := relativeTargetRVA(tibiaBinary, peData, offset+18, 6, 2)
+		constructorIATRVA, constructorOK := indirectCallTargetRVA(peData, body[18])
 		if !constructorOK || !peData.rvaIsNonCode(constructorIATRVA) {
 			return false
 		}
 	}
 
-	return relativeTargetIsCode(tibiaBinary, peData, offset+35, 5, 1)
+	return directTargetIsCode(peData, body[35], "jmp")
 }
 
-func matchesRIPCString(tibiaBinary []byte, peData peInfo, instructionOffset int, value string) bool {
-	targetRVA, ok := relativeTargetRVA(tibiaBinary, peData, instructionOffset, 7, 3)
+// matchesRIPCString reports whether instruction loads the address of value
+// as a NUL-terminated string outside code.
+func matchesRIPCString(tibiaBinary []byte, peData peInfo, instruction x86Instruction, value string) bool {
+	targetRVA, ok := addressLoadTargetRVA(peData, instruction)
 	if !ok || !peData.rvaIsNonCode(targetRVA) {
 		return false
 	}
@@ -1045,37 +1400,54 @@ func matchesRIPCString(tibiaBinary []byte, peData peInfo, instructionOffset int,
 	return bytes.Equal(tibiaBinary[targetOffset:targetOffset+len(value)], []byte(value)) && tibiaBinary[targetOffset+len(value)] == 0
 }
 
-func relativeTargetRVA(tibiaBinary []byte, peData peInfo, instructionOffset int, instructionLength int, displacementOffset int) (int, bool) {
-	if instructionOffset < 0 || instructionOffset+displacementOffset+4 > len(tibiaBinary) {
+// addressLoadTargetRVA returns the target of a RIP-relative LEA.
+func addressLoadTargetRVA(peData peInfo, instruction x86Instruction) (int, bool) {
+	if !instruction.isAddressLoad() || !instruction.ripRelative() {
 		return 0, false
 	}
-	instructionRVA, ok := peData.rvaForOffset(instructionOffset)
-	if !ok {
+	return peData.x86TargetRVA(instruction)
+}
+
+// indirectTargetRVA returns the pointer slot of a CALL or JMP through a
+// RIP-relative memory operand, such as an import address table entry.
+func indirectTargetRVA(peData peInfo, instruction x86Instruction, mnemonic string) (int, bool) {
+	if instruction.mnemonic() != mnemonic || !instruction.ripRelative() {
 		return 0, false
 	}
-	displacement := int(int32(binary.LittleEndian.Uint32(tibiaBinary[instructionOffset+displacementOffset : instructionOffset+displacementOffset+4])))
-	return instructionRVA + instructionLength + displacement, true
+	return peData.x86TargetRVA(instruction)
 }
 
-func relativeTargetIsCode(tibiaBinary []byte, peData peInfo, instructionOffset int, instructionLength int, displacementOffset int) bool {
-	targetRVA, ok := relativeTargetRVA(tibiaBinary, peData, instructionOffset, instructionLength, displacementOffset)
+func indirectCallTargetRVA(peData peInfo, instruction x86Instruction) (int, bool) {
+	return indirectTargetRVA(peData, instruction, "call")
+}
+
+// directTargetIsCode reports whether a relative CALL or JMP lands in code.
+func directTargetIsCode(peData peInfo, instruction x86Instruction, mnemonic string) bool {
+	if instruction.mnemonic() != mnemonic || !instruction.relativeBranch {
+		return false
+	}
+	targetRVA, ok := peData.x86TargetRVA(instruction)
 	return ok && peData.rvaIsCode(targetRVA)
 }
 
-func scanClientCheckFindings(tibiaBinary []byte, peData peInfo, patchStatuses []battleyePatchStatus) []clientCheckFinding {
+func scanClientCheckFindings(signatures loadedSignatures, tibiaBinary []byte, peData peInfo, patchStatuses []battleyePatchStatus) []clientCheckFinding {
 	findings := make([]clientCheckFinding, 0)
-	for _, indicator := range clientCheckIndicators {
-		findings = appendClientCheckFinding(findings, tibiaBinary, peData, patchStatuses, indicator.name, "ascii", indicator.value)
+	var index xrefIndex
+	if peData.valid {
+		index = buildXrefIndex(tibiaBinary, peData)
+	}
+	for _, indicator := range signatures.indicators {
+		findings = appendClientCheckFinding(findings, tibiaBinary, peData, index, signatures.codePatterns, patchStatuses, indicator.name, "ascii", indicator.value)
 
 		utf16Value := utf16LEBytes(string(indicator.value))
 		if len(utf16Value) > 0 {
-			findings = appendClientCheckFinding(findings, tibiaBinary, peData, patchStatuses, indicator.name, "utf16-le", utf16Value)
+			findings = appendClientCheckFinding(findings, tibiaBinary, peData, index, signatures.codePatterns, patchStatuses, indicator.name, "utf16-le", utf16Value)
 		}
 	}
 	return findings
 }
 
-func appendClientCheckFinding(findings []clientCheckFinding, tibiaBinary []byte, peData peInfo, patchStatuses []battleyePatchStatus, name string, encoding string, needle []byte) []clientCheckFinding {
+func appendClientCheckFinding(findings []clientCheckFinding, tibiaBinary []byte, peData peInfo, index xrefIndex, codePatterns []bytePattern, patchStatuses []battleyePatchStatus, name string, encoding string, needle []byte) []clientCheckFinding {
 	offsets := findAllOffsets(tibiaBinary, needle)
 	if len(offsets) == 0 {
 		return findings
@@ -1089,112 +1461,41 @@ func appendClientCheckFinding(findings []clientCheckFinding, tibiaBinary []byte,
 
 	if peData.valid {
 		for _, offset := range offsets {
-			finding.references = append(finding.references, findStringCodeReferences(tibiaBinary, peData, patchStatuses, name, offset)...)
+			finding.references = append(finding.references, findStringCodeReferences(tibiaBinary, peData, index, codePatterns, patchStatuses, name, offset)...)
 		}
 	}
 
 	return append(findings, finding)
 }
 
-func findStringCodeReferences(tibiaBinary []byte, peData peInfo, patchStatuses []battleyePatchStatus, indicatorName string, stringOffset int) []clientCheckReference {
+func findStringCodeReferences(tibiaBinary []byte, peData peInfo, index xrefIndex, codePatterns []bytePattern, patchStatuses []battleyePatchStatus, indicatorName string, stringOffset int) []clientCheckReference {
 	stringRVA, ok := peData.rvaForOffset(stringOffset)
 	if !ok {
 		return nil
 	}
 
 	references := make([]clientCheckReference, 0)
-	for _, section := range peData.sections {
-		if !section.isCode {
+	for _, edge := range index.referencesTo(stringRVA) {
+		if edge.kind != xrefAddress && edge.kind != xrefData {
 			continue
 		}
-
-		for offset := section.rawStart; offset < section.rawEnd; offset++ {
-			instructionLength, instructionName, displacementOffset, ok := ripRelativeInstructionAt(tibiaBinary, section.rawEnd, offset)
-			if !ok {
-				continue
-			}
-
-			instructionRVA, ok := peData.rvaForOffset(offset)
-			if !ok {
-				continue
-			}
-
-			displacement := int(int32(binary.LittleEndian.Uint32(tibiaBinary[displacementOffset : displacementOffset+4])))
-			targetRVA := instructionRVA + instructionLength + displacement
-			if targetRVA != stringRVA {
-				continue
-			}
-
-			reference := clientCheckReference{
-				offset:      offset,
-				section:     section.name,
-				instruction: instructionName,
-			}
-			reference = enrichCodeReferenceContext(tibiaBinary, section, reference, patchStatuses, indicatorName)
-			references = append(references, reference)
+		instruction, ok := decodeX86(tibiaBinary, edge.offset, len(tibiaBinary))
+		section, sectionOK := peData.sectionForOffset(edge.offset)
+		if !ok || !sectionOK {
+			continue
 		}
-	}
-
-	return dedupeAdjacentRexReferences(references)
-}
-
-func dedupeAdjacentRexReferences(references []clientCheckReference) []clientCheckReference {
-	deduped := make([]clientCheckReference, 0, len(references))
-	for _, reference := range references {
-		if len(deduped) > 0 {
-			previous := deduped[len(deduped)-1]
-			if reference.offset == previous.offset+1 &&
-				strings.Contains(previous.instruction, "REX:") &&
-				(reference.instruction == "LEA" || reference.instruction == "MOV") {
-				continue
-			}
+		reference := clientCheckReference{
+			offset:      instruction.offset,
+			section:     section.name,
+			instruction: instruction.text(),
 		}
-		deduped = append(deduped, reference)
+		reference = enrichCodeReferenceContext(tibiaBinary, peData, section, reference, codePatterns, patchStatuses, indicatorName)
+		references = append(references, reference)
 	}
-	return deduped
+	return references
 }
 
-func ripRelativeInstructionAt(tibiaBinary []byte, sectionEnd int, offset int) (int, string, int, bool) {
-	if offset >= sectionEnd {
-		return 0, "", 0, false
-	}
-
-	opcodeOffset := offset
-	rexPrefix := byte(0)
-	if tibiaBinary[opcodeOffset]&0xf0 == 0x40 {
-		rexPrefix = tibiaBinary[opcodeOffset]
-		opcodeOffset++
-	}
-
-	if opcodeOffset+6 > sectionEnd || opcodeOffset+6 > len(tibiaBinary) {
-		return 0, "", 0, false
-	}
-
-	opcode := tibiaBinary[opcodeOffset]
-	if opcode != 0x8d && opcode != 0x8b {
-		return 0, "", 0, false
-	}
-
-	modRM := tibiaBinary[opcodeOffset+1]
-	if modRM&0xc7 != 0x05 {
-		return 0, "", 0, false
-	}
-
-	instructionLength := opcodeOffset - offset + 6
-	instructionName := "rip-relative"
-	if opcode == 0x8d {
-		instructionName = "LEA"
-	} else if opcode == 0x8b {
-		instructionName = "MOV"
-	}
-	if rexPrefix != 0 {
-		instructionName = fmt.Sprintf("%s REX:%02X", instructionName, rexPrefix)
-	}
-
-	return instructionLength, instructionName, opcodeOffset + 2, true
-}
-
-func enrichCodeReferenceContext(tibiaBinary []byte, section peSectionInfo, reference clientCheckReference, patchStatuses []battleyePatchStatus, indicatorName string) clientCheckReference {
+func enrichCodeReferenceContext(tibiaBinary []byte, peData peInfo, section peSectionInfo, reference clientCheckReference, codePatterns []bytePattern, patchStatuses []battleyePatchStatus, indicatorName string) clientCheckReference {
 	windowStart := reference.offset - codeContextRadius
 	if windowStart < section.rawStart {
 		windowStart = section.rawStart
@@ -1204,25 +1505,45 @@ func enrichCodeReferenceContext(tibiaBinary []byte, section peSectionInfo, refer
 		windowEnd = section.rawEnd
 	}
 
-	reference.branchOffsets = findConditionalBranches(tibiaBinary, windowStart, windowEnd)
-	reference.callOffsets = findCalls(tibiaBinary, windowStart, windowEnd)
-	reference.patternMatches = findCodePatternMatches(tibiaBinary, windowStart, windowEnd)
+	// Decode from the earliest window byte that sweeps onto the reference so
+	// branches and calls are only counted at real instruction boundaries.
+	sweepStart, _ := syncX86Sweep(tibiaBinary, windowStart, []int{reference.offset})
+	instructions := disassembleX86(tibiaBinary, sweepStart, windowEnd)
+	reference.branchOffsets, reference.callOffsets = findBranchesAndCalls(instructions)
+	reference.patternMatches = findCodePatternMatches(tibiaBinary, codePatterns, windowStart, windowEnd)
 	reference.knownPatchNearby = hasKnownPatchNearby(patchStatuses, reference.contextOffsets(), knownPatchContextRadius)
 	reference.contextStart, reference.contextBytes = bytesAround(tibiaBinary, reference.offset, contextBytesRadius)
+	contextInstructions := instructionsWithin(instructions, reference.offset-contextBytesRadius, reference.offset+contextBytesRadius)
+	reference.disassembly = x86Listing(tibiaBinary, peData, contextInstructions, reference.offset)
+	reference.instructions = x86Summary(tibiaBinary, peData, contextInstructions)
 	reference.strongUnsupported = isStrongClientCheckEvidence(indicatorName, reference)
 	reference.suspiciousActive = isSuspiciousActiveClientCheckEvidence(indicatorName, reference)
 
 	return reference
 }
 
-func findConditionalBranches(tibiaBinary []byte, start int, end int) []int {
-	offsets := make([]int, 0)
-	for offset := start; offset < end && offset < len(tibiaBinary); offset++ {
-		if isConditionalJump(tibiaBinary, offset, end) {
-			offsets = append(offsets, offset)
+func findBranchesAndCalls(instructions []x86Instruction) ([]int, []int) {
+	branchOffsets := make([]int, 0)
+	callOffsets := make([]int, 0)
+	for _, instruction := range instructions {
+		if instruction.isConditionalBranch() {
+			branchOffsets = append(branchOffsets, instruction.offset)
+		}
+		if instruction.isCall() {
+			callOffsets = append(callOffsets, instruction.offset)
 		}
 	}
-	return offsets
+	return branchOffsets, callOffsets
+}
+
+func instructionsWithin(instructions []x86Instruction, start int, end int) []x86Instruction {
+	within := make([]x86Instruction, 0)
+	for _, instruction := range instructions {
+		if instruction.offset >= start && instruction.offset < end {
+			within = append(within, instruction)
+		}
+	}
+	return within
 }
 
 func isStrongClientCheckEvidence(indicatorName string, reference clientCheckReference) bool {
@@ -1270,38 +1591,7 @@ func isCriticalClientCheckIndicator(indicatorName string) bool {
 	}
 }
 
-func isConditionalJump(data []byte, offset int, end int) bool {
-	if offset < 0 || offset >= end || offset >= len(data) {
-		return false
-	}
-
-	opcode := data[offset]
-	if opcode >= 0x70 && opcode <= 0x7f {
-		return true
-	}
-
-	return offset+1 < end &&
-		offset+1 < len(data) &&
-		opcode == 0x0f &&
-		data[offset+1] >= 0x80 &&
-		data[offset+1] <= 0x8f
-}
-
-func findCalls(tibiaBinary []byte, start int, end int) []int {
-	offsets := make([]int, 0)
-	for offset := start; offset < end && offset < len(tibiaBinary); offset++ {
-		if offset+5 <= end && tibiaBinary[offset] == 0xe8 {
-			offsets = append(offsets, offset)
-			continue
-		}
-		if offset+2 <= end && tibiaBinary[offset] == 0xff && tibiaBinary[offset+1]&0x38 == 0x10 {
-			offsets = append(offsets, offset)
-		}
-	}
-	return offsets
-}
-
-func findCodePatternMatches(tibiaBinary []byte, start int, end int) []patternMatch {
+func findCodePatternMatches(tibiaBinary []byte, codePatterns []bytePattern, start int, end int) []patternMatch {
 	matches := make([]patternMatch, 0)
 	if start < 0 {
 		start = 0
@@ -1314,7 +1604,7 @@ func findCodePatternMatches(tibiaBinary []byte, start int, end int) []patternMat
 	}
 
 	window := tibiaBinary[start:end]
-	for _, pattern := range clientCheckCodePatterns {
+	for _, pattern := range codePatterns {
 		for _, offset := range pattern.findAll(window) {
 			matches = append(matches, patternMatch{name: pattern.name, offset: start + offset})
 		}
@@ -1371,13 +1661,41 @@ func printDiagnosisReport(diagnosis diagnosisReport, label string) {
 	fmt.Printf("[INFO] Diagnosing %s: %s\n", label, diagnosis.path)
 	fmt.Printf("[INFO] Size: %d bytes\n", diagnosis.size)
 	fmt.Printf("[INFO] SHA256: %s\n", diagnosis.sha256)
+	fmt.Printf("[INFO] Version: %s\n", diagnosis.version.describe())
+	fmt.Printf("[INFO] Signature database: %s\n", diagnosis.signatures.database.describe())
 
-	if !diagnosis.isWindowsExe {
-		fmt.Printf("[WARN] This file is not a Windows PE executable; BattlEye byte patch signatures are informational only\n")
-	}
-	if diagnosis.isWindowsExe && !diagnosis.pe.valid {
+	switch {
+	case diagnosis.isELF && !diagnosis.pe.valid:
+		fmt.Printf("[WARN] ELF section parsing failed; code-reference diagnostics are unavailable: %s\n", diagnosis.pe.errorText)
+	case diagnosis.isELF:
+		fmt.Printf("[INFO] Format: ELF executable with %d section(s), %d function boundary(ies), %d function symbol(s), %d import(s)\n", len(diagnosis.pe.sections), len(diagnosis.pe.runtimeFunctions), len(diagnosis.pe.symbols), len(diagnosis.pe.imports))
+		fmt.Printf("[INFO] Unverified byte signatures observed in Windows builds are informational only for ELF clients\n")
+	case diagnosis.isMachO:
+		for _, report := range diagnosis.machOSlices {
+			fmt.Printf("[INFO] Mach-O slice %s (%d bytes) code signature: %s\n", report.slice.label(), report.slice.end-report.slice.start, report.codeSignature.describe())
+		}
+		if !diagnosis.pe.valid {
+			fmt.Printf("[WARN] Mach-O x86_64 slice parsing failed; code-reference diagnostics are unavailable: %s\n", diagnosis.pe.errorText)
+		} else {
+			fmt.Printf("[INFO] Format: Mach-O x86_64 slice with %d section(s), %d function start(s), %d import(s)\n", len(diagnosis.pe.sections), len(diagnosis.pe.runtimeFunctions), len(diagnosis.pe.imports))
+		}
+		fmt.Printf("[INFO] Unverified byte signatures observed in Windows builds are informational only for Mach-O clients\n")
+	case !diagnosis.isWindowsExe:
+		fmt.Printf("[WARN] This file is not a Windows PE, ELF or Mach-O executable; BattlEye byte patch signatures are informational only\n")
+	case !diagnosis.pe.valid:
 		fmt.Printf("[WARN] PE section parsing failed; code-reference diagnostics are unavailable: %s\n", diagnosis.pe.errorText)
 	}
+	if diagnosis.integrity.valid {
+		level := "INFO"
+		if !diagnosis.integrity.checksumValid() {
+			level = "WARN"
+		}
+		fmt.Printf("[%s] PE checksum: %s\n", level, diagnosis.integrity.describeChecksum())
+		fmt.Printf("[INFO] Authenticode: %s\n", diagnosis.integrity.describeSignature())
+	}
+	if diagnosis.isWindowsExe {
+		logPEResources(diagnosis)
+	}
 
 	logBattlEyeSignatureReport(diagnosis.patchStatuses)
 	logClientCheckSupportSummary(diagnosis)
@@ -1387,7 +1705,7 @@ func logClientCheckSupportSummary(diagnosis diagnosisReport) {
 	fmt.Printf("[INFO] Client-check support verdict: %s\n", diagnosis.clientCheckVerdict())
 	fmt.Printf("[INFO] Known byte-patch coverage: %d/%d signature(s), original=%d, patched=%d\n",
 		diagnosis.knownPatchCoverage(),
-		patchableBattleyePatchCount(),
+		diagnosis.patchableSignatureCount(),
 		diagnosis.originalPatchSignatureCount(),
 		diagnosis.patchedPatchSignatureCount(),
 	)
@@ -1554,14 +1872,20 @@ func printDiagnosisComparison(baseline diagnosisReport, target diagnosisReport)
 	} else {
 		fmt.Printf("[INFO] SHA256: baseline=%s target=%s\n", baseline.sha256, target.sha256)
 	}
+	fmt.Printf("[INFO] Version: baseline=%s target=%s\n", baseline.version.describe(), target.version.describe())
+
+	if baseline.integrity.valid || target.integrity.valid {
+		fmt.Printf("[INFO] PE checksum: baseline=%s target=%s\n", baseline.integrity.describeChecksum(), target.integrity.describeChecksum())
+		fmt.Printf("[INFO] Authenticode: baseline=%s target=%s\n", baseline.integrity.describeSignature(), target.integrity.describeSignature())
+	}
 
 	fmt.Printf("[INFO] Known patch coverage: baseline=%d/%d target=%d/%d\n",
 		baseline.knownPatchCoverage(),
-		patchableBattleyePatchCount(),
+		baseline.patchableSignatureCount(),
 		target.knownPatchCoverage(),
-		patchableBattleyePatchCount(),
+		target.patchableSignatureCount(),
 	)
-	for _, patch := range battleyePatches {
+	for _, patch := range target.signatures.patches {
 		fmt.Printf("[INFO] Patch %q: baseline=%s target=%s\n",
 			patch.name,
 			baseline.patchStateByName(patch.name),
@@ -1590,13 +1914,22 @@ func printDiagnosisComparison(baseline diagnosisReport, target diagnosisReport)
 	}
 }
 
-func enforceEditClientCheckPolicy(diagnosis diagnosisReport, strictClientCheck bool) {
+// editExportRefused mirrors enforceEditClientCheckPolicy without exiting, so a
+// dry run can report whether the export would go ahead.
+func editExportRefused(diagnosis diagnosisReport, strictClientCheck bool) bool {
+	if diagnosis.strongUnsupportedEvidenceCount() > 0 {
+		return true
+	}
+	return strictClientCheck && (diagnosis.isPartialClientCheckSupport() || diagnosis.isWarningClientCheckSupport())
+}
+
+func enforceEditClientCheckPolicy(diagnosis diagnosisReport, strictClientCheck bool) error {
 	verdict := diagnosis.clientCheckVerdict()
 	if diagnosis.strongUnsupportedEvidenceCount() > 0 {
 		fmt.Printf("[ERROR] UNSUPPORTED support - refusing export because strong client-check evidence remains (%d code reference(s))\n", diagnosis.strongUnsupportedEvidenceCount())
 		fmt.Printf("[ERROR] Verdict: %s\n", verdict)
 		fmt.Printf("[ERROR] Run diagnose and inspect the Strong unsupported evidence section before using this client\n")
-		os.Exit(1)
+		return &ClientCheckError{Verdict: verdict, Strict: false}
 	}
 
 	if diagnosis.isPartialClientCheckSupport() {
@@ -1604,12 +1937,12 @@ func enforceEditClientCheckPolicy(diagnosis diagnosisReport, strictClientCheck b
 			fmt.Printf("[ERROR] PARTIAL support - refusing export because --strict is enabled\n")
 			fmt.Printf("[ERROR] Verdict: %s\n", verdict)
 			fmt.Printf("[ERROR] Re-run without --strict only if this partial support is acceptable for manual testing\n")
-			os.Exit(1)
+			return &ClientCheckError{Verdict: verdict, Strict: true}
 		}
 
 		fmt.Printf("[WARN] PARTIAL support - client may work but not fully verified\n")
 		fmt.Printf("[WARN] Verdict: %s\n", verdict)
-		return
+		return nil
 	}
 
 	if diagnosis.isWarningClientCheckSupport() {
@@ -1617,16 +1950,17 @@ func enforceEditClientCheckPolicy(diagnosis diagnosisReport, strictClientCheck b
 			fmt.Printf("[ERROR] WARNING support - refusing export because --strict is enabled\n")
 			fmt.Printf("[ERROR] Verdict: %s\n", verdict)
 			fmt.Printf("[ERROR] Re-run diagnose and inspect Suspicious active client-check candidates before using this client\n")
-			os.Exit(1)
+			return &ClientCheckError{Verdict: verdict, Strict: true}
 		}
 
 		fmt.Printf("[WARN] WARNING support - client-check branch/call candidates remain after the known patch\n")
 		fmt.Printf("[WARN] Client-check paths may still be active. Test recommended.\n")
 		fmt.Printf("[WARN] Verdict: %s\n", verdict)
-		return
+		return nil
 	}
 
 	fmt.Printf("[INFO] Client-check edit gate: %s\n", verdict)
+	return nil
 }
 
 func failIfStrictClientCheck(diagnosis diagnosisReport, strictClientCheck bool) {
@@ -1680,7 +2014,7 @@ func (diagnosis diagnosisReport) clientCheckVerdict() string {
 	}
 
 	coverage := diagnosis.knownPatchCoverage()
-	patchableCount := patchableBattleyePatchCount()
+	patchableCount := diagnosis.patchableSignatureCount()
 	if coverage < patchableCount {
 		return "PARTIAL: only some known patchable signatures are covered"
 	}
@@ -2037,97 +2371,13 @@ func formatBytes(data []byte) string {
 }
 
 func formatPossibleInstructions(reference clientCheckReference) string {
-	if len(reference.contextBytes) == 0 {
+	if len(reference.instructions) == 0 {
 		return "none"
 	}
-
-	instructions := make([]string, 0)
-	for index := 0; index < len(reference.contextBytes); index++ {
-		offset := reference.contextStart + index
-		data := reference.contextBytes[index:]
-
-		if len(data) >= 7 && data[0] == 0x48 && data[1] == 0x8d && (data[2] == 0x15 || data[2] == 0x0d) {
-			registerName := "rdx"
-			if data[2] == 0x0d {
-				registerName = "rcx"
-			}
-			displacement := int(int32(binary.LittleEndian.Uint32(data[3:7])))
-			target := offset + 7 + displacement
-			instructions = append(instructions, fmt.Sprintf("0x%X: lea %s,[rip%+d] -> 0x%X", offset, registerName, displacement, target))
-			index += 6
-			continue
-		}
-		if len(data) >= 4 && data[0] == 0x48 && data[1] == 0x8d && data[2] == 0x4d {
-			instructions = append(instructions, fmt.Sprintf("0x%X: lea rcx,[rbp%+d]", offset, int(int8(data[3]))))
-			index += 3
-			continue
-		}
-		if len(data) >= 6 && data[0] == 0x41 && data[1] == 0xb8 {
-			immediate := binary.LittleEndian.Uint32(data[2:6])
-			instructions = append(instructions, fmt.Sprintf("0x%X: mov r8d,0x%X", offset, immediate))
-			index += 5
-			continue
-		}
-		if len(data) >= 5 && data[0] == 0xe8 {
-			displacement := int(int32(binary.LittleEndian.Uint32(data[1:5])))
-			target := offset + 5 + displacement
-			instructions = append(instructions, fmt.Sprintf("0x%X: call rel32 -> 0x%X", offset, target))
-			index += 4
-			continue
-		}
-		if len(data) >= 6 && data[0] == 0xff && data[1] == 0x15 {
-			displacement := int(int32(binary.LittleEndian.Uint32(data[2:6])))
-			target := offset + 6 + displacement
-			instructions = append(instructions, fmt.Sprintf("0x%X: call qword [rip%+d] -> 0x%X", offset, displacement, target))
-			index += 5
-			continue
-		}
-		if len(data) >= 5 && data[0] == 0xe9 {
-			displacement := int(int32(binary.LittleEndian.Uint32(data[1:5])))
-			target := offset + 5 + displacement
-			instructions = append(instructions, fmt.Sprintf("0x%X: jmp rel32 -> 0x%X", offset, target))
-			index += 4
-			continue
-		}
-		if len(data) >= 2 && data[0] == 0xeb {
-			target := offset + 2 + int(int8(data[1]))
-			instructions = append(instructions, fmt.Sprintf("0x%X: jmp short -> 0x%X", offset, target))
-			index += 1
-			continue
-		}
-		if isConditionalJump(reference.contextBytes, index, len(reference.contextBytes)) {
-			if data[0] >= 0x70 && data[0] <= 0x7f && len(data) >= 2 {
-				target := offset + 2 + int(int8(data[1]))
-				instructions = append(instructions, fmt.Sprintf("0x%X: jcc short 0x%02X -> 0x%X", offset, data[0], target))
-				index += 1
-				continue
-			}
-			if len(data) >= 6 && data[0] == 0x0f {
-				displacement := int(int32(binary.LittleEndian.Uint32(data[2:6])))
-				target := offset + 6 + displacement
-				instructions = append(instructions, fmt.Sprintf("0x%X: jcc near 0x%02X -> 0x%X", offset, data[1], target))
-				index += 5
-				continue
-			}
-		}
-		if len(data) >= 4 && data[0] == 0x48 && data[1] == 0x83 && (data[2] == 0xec || data[2] == 0xc4) {
-			operation := "sub"
-			if data[2] == 0xc4 {
-				operation = "add"
-			}
-			instructions = append(instructions, fmt.Sprintf("0x%X: %s rsp,0x%X", offset, operation, data[3]))
-			index += 3
-			continue
-		}
+	if len(reference.instructions) > 10 {
+		return strings.Join(reference.instructions[:10], "; ") + fmt.Sprintf("; ... +%d more", len(reference.instructions)-10)
 	}
-
-	if len(instructions) == 0 {
-		return "none"
-	}
-	if len(instructions) > 10 {
-		return strings.Join(instructions[:10], "; ") + fmt.Sprintf("; ... +%d more", len(instructions)-10)
-	}
-	return strings.Join(instructions, "; ")
+	return strings.Join(reference.instructions, "; ")
 }
 
 func newBytePattern(name string, values ...int) bytePattern {
@@ -2182,13 +2432,12 @@ func newPatchReplacement(values ...int) []int {
 	return replacement
 }
 
-func applyBattleyePatch(tibiaBinary []byte, patch battleyePatch, offsets []int) []byte {
+func applyBattleyePatch(tibiaBinary []byte, patch battleyePatch, offsets []int) ([]byte, error) {
 	if patch.diagnosticOnly {
-		return tibiaBinary
+		return tibiaBinary, nil
 	}
 	if len(patch.replacement) != len(patch.original.data) {
-		fmt.Printf("[ERROR] Invalid BattlEye patch %q: replacement length differs from signature length\n", patch.name)
-		os.Exit(1)
+		return tibiaBinary, fmt.Errorf("invalid BattlEye patch %q: replacement length differs from signature length", patch.name)
 	}
 
 	for _, offset := range offsets {
@@ -2204,12 +2453,18 @@ func applyBattleyePatch(tibiaBinary []byte, patch battleyePatch, offsets []int)
 		fmt.Printf("[INFO]   bytes before @0x%X..0x%X: %s\n", contextStart, contextEnd, formatBytes(beforeBytes))
 		fmt.Printf("[INFO]   bytes after  @0x%X..0x%X: %s\n", contextStart, contextEnd, formatBytes(afterBytes))
 	}
-	return tibiaBinary
+	return tibiaBinary, nil
 }
 
-func patchableBattleyePatchCount() int {
+// patchableSignatureCount counts the signatures that can be patched in the
+// diagnosed executable format, matching the statuses knownPatchCoverage counts.
+func (diagnosis diagnosisReport) patchableSignatureCount() int {
+	return patchableBattleyePatchCount(battleyePatchesForFormat(diagnosis.signatures.patches, diagnosis.pe.format))
+}
+
+func patchableBattleyePatchCount(patches []battleyePatch) int {
 	count := 0
-	for _, patch := range battleyePatches {
+	for _, patch := range patches {
 		if !patch.diagnosticOnly {
 			count++
 		}
@@ -2217,20 +2472,46 @@ func patchableBattleyePatchCount() int {
 	return count
 }
 
-func (patch battleyePatch) withAggressiveMode(aggressive bool) battleyePatch {
+// battleyePatchesForFormat returns the signature set for an executable format.
+// Every signature was observed in Windows builds, so ELF and Mach-O clients
+// keep them as diagnostics. The structural guards are dropped there as well:
+// they require calls through the PE import address table (ff 15), while
+// those clients call imports through PLT entries or stubs, so the pair could
+// never be verified.
+func battleyePatchesForFormat(signaturePatches []battleyePatch, format string) []battleyePatch {
+	if format == "" || format == executableFormatPE {
+		return signaturePatches
+	}
+
+	patches := make([]battleyePatch, len(signaturePatches))
+	for patchIndex, patch := range signaturePatches {
+		if patch.structuralGuard != nil {
+			patch.structuralGuard = nil
+			patch.diagnosticOnly = true
+			patch.aggressiveReplacement = nil
+			patch.falsePositiveCheck = "unverifiable on " + format + " clients because the structural guard only recognizes Windows import address table calls"
+		} else if !patch.diagnosticOnly {
+			patch.diagnosticOnly = true
+			patch.falsePositiveCheck = "diagnostic-only on " + format + " clients because this signature was only observed in Windows builds and has no structural guard"
+		}
+		patches[patchIndex] = patch
+	}
+	return patches
+}
+
+func (patch battleyePatch) withAggressiveMode(aggressive bool) (battleyePatch, error) {
 	if !aggressive || len(patch.aggressiveReplacement) == 0 {
-		return patch
+		return patch, nil
 	}
 
 	if len(patch.aggressiveReplacement) != len(patch.original.data) {
-		fmt.Printf("[ERROR] Invalid aggressive replacement for signature %q: replacement length differs from signature length\n", patch.name)
-		os.Exit(1)
+		return patch, fmt.Errorf("invalid aggressive replacement for signature %q: replacement length differs from signature length", patch.name)
 	}
 
 	patch.replacement = append([]int(nil), patch.aggressiveReplacement...)
 	patch.patched = newBytePattern(patch.name+" [aggressive]", patch.aggressiveReplacement...)
 
-	return patch
+	return patch, nil
 }
 
 func (patch battleyePatch) effectivePatchedPattern() bytePattern {
@@ -2270,10 +2551,10 @@ func (pattern bytePattern) matchesAt(data []byte, offset int) bool {
 	return true
 }
 
-func (patch battleyePatch) expectedOffsetHits(data []byte, sha256Text string) []knownPatchOffset {
+func (patch battleyePatch) expectedOffsetHits(data []byte, sha256Text string, version string) []knownPatchOffset {
 	hits := make([]knownPatchOffset, 0)
 	for _, expected := range patch.expectedOffsets {
-		if !expected.appliesToSHA256(sha256Text) {
+		if !expected.appliesTo(sha256Text, version) {
 			continue
 		}
 		if patch.matchesAtExpectedOffset(data, expected.offset) {
@@ -2283,10 +2564,10 @@ func (patch battleyePatch) expectedOffsetHits(data []byte, sha256Text string) []
 	return hits
 }
 
-func (patch battleyePatch) expectedOffsetMisses(data []byte, sha256Text string) []knownPatchOffset {
+func (patch battleyePatch) expectedOffsetMisses(data []byte, sha256Text string, version string) []knownPatchOffset {
 	misses := make([]knownPatchOffset, 0)
 	for _, expected := range patch.expectedOffsets {
-		if !expected.appliesToSHA256(sha256Text) {
+		if !expected.appliesTo(sha256Text, version) {
 			continue
 		}
 		if !patch.matchesAtExpectedOffset(data, expected.offset) {
@@ -2300,8 +2581,11 @@ func (patch battleyePatch) matchesAtExpectedOffset(data []byte, offset int) bool
 	return patch.original.matchesAt(data, offset) || patch.effectivePatchedPattern().matchesAt(data, offset)
 }
 
-func (expected knownPatchOffset) appliesToSHA256(sha256Text string) bool {
-	return expected.sha256 == "" || strings.EqualFold(expected.sha256, sha256Text)
+func (expected knownPatchOffset) appliesTo(sha256Text string, version string) bool {
+	if expected.sha256 != "" && !strings.EqualFold(expected.sha256, sha256Text) {
+		return false
+	}
+	return expected.version == "" || matchesVersion(expected.version, version)
 }
 
 func (peData peInfo) rvaForOffset(offset int) (int, bool) {
@@ -2407,8 +2691,8 @@ func utf16LEBytes(value string) []byte {
 	return encoded
 }
 
-func hasClientCheckStringIndicators(tibiaBinary []byte) bool {
-	for _, indicator := range clientCheckIndicators {
+func hasClientCheckStringIndicators(tibiaBinary []byte, indicators []clientCheckIndicator) bool {
+	for _, indicator := range indicators {
 		if bytes.Contains(tibiaBinary, indicator.value) || bytes.Contains(tibiaBinary, utf16LEBytes(string(indicator.value))) {
 			return true
 		}
@@ -2440,21 +2724,19 @@ func absDistance(left int, right int) int {
 	return distance
 }
 
-func exportModifiedFile(tibiaPath string, tibiaBinary []byte, originalBinarySize int) {
+func exportModifiedFile(tibiaPath string, tibiaBinary []byte, originalBinarySize int) error {
 	outputFilePath := tibiaPath
 
 	if len(tibiaBinary) != originalBinarySize {
-		fmt.Printf("[ERROR] Invalid patched file size, original: %d, modified: %d\n", originalBinarySize, len(tibiaBinary))
-		os.Exit(1)
+		return fmt.Errorf("invalid patched file size, original: %d, modified: %d", originalBinarySize, len(tibiaBinary))
 	}
 
-	err := os.WriteFile(outputFilePath, tibiaBinary, 0644)
-	if err != nil {
-		fmt.Printf("[ERROR] %s\n", err.Error())
-		os.Exit(1)
+	if err := os.WriteFile(outputFilePath, tibiaBinary, 0644); err != nil {
+		return err
 	}
 
 	fmt.Printf("[INFO] Patched file exported to: %s\n", outputFilePath)
+	return nil
 }
 
 func readFile(filePath string) (string, []byte) {
@@ -2526,47 +2808,71 @@ type embeddedConfigINI struct {
 	sectionByName map[string]configINISection
 }
 
-func syncConfigINI(tibiaPath string, tibiaBinary []byte, configValues map[string]string) {
+// configINISyncPlan is the config.ini content computed from the embedded
+// client config before anything is written.
+type configINISyncPlan struct {
+	path         string
+	exists       bool
+	original     []byte
+	updated      []byte
+	changedCount int
+	addedCount   int
+	removedCount int
+	changed      bool
+}
+
+func syncConfigINI(tibiaPath string, tibiaBinary []byte, configValues map[string]string) error {
+	sync, ok, err := planConfigINISync(tibiaPath, tibiaBinary, configValues)
+	if err != nil || !ok {
+		return err
+	}
+	return applyConfigINISync(sync)
+}
+
+func planConfigINISync(tibiaPath string, tibiaBinary []byte, configValues map[string]string) (configINISyncPlan, bool, error) {
 	embeddedConfigData, ok := extractEmbeddedConfigINIBlock(tibiaBinary)
 	if !ok {
 		fmt.Printf("[WARN] Embedded config.ini block starting at %q was not found; %s sync skipped\n", configINIStartMarker, configINIFileName)
-		return
+		return configINISyncPlan{}, false, nil
 	}
 
 	embeddedConfig, ok := parseEmbeddedConfigINI(embeddedConfigData)
 	if !ok {
 		fmt.Printf("[WARN] Embedded config.ini block could not be parsed; %s sync skipped\n", configINIFileName)
-		return
+		return configINISyncPlan{}, false, nil
 	}
 	embeddedConfig = overrideEmbeddedConfigValues(embeddedConfig, configValues)
 
-	configPath, configExists := resolveConfigINIPath(tibiaPath)
-	configData := make([]byte, 0)
-	if configExists {
-		data, err := os.ReadFile(configPath)
+	sync := configINISyncPlan{original: make([]byte, 0)}
+	sync.path, sync.exists = resolveConfigINIPath(tibiaPath)
+	if sync.exists {
+		data, err := os.ReadFile(sync.path)
 		if err != nil {
-			fmt.Printf("[ERROR] Unable to read %s: %s\n", configPath, err.Error())
-			os.Exit(1)
+			return configINISyncPlan{}, false, fmt.Errorf("unable to read %s: %w", sync.path, err)
 		}
-		configData = data
+		sync.original = data
 	}
 
-	updatedConfig, changedCount, addedCount, removedCount, changed := updateConfigINIContent(configData, embeddedConfig)
-	if !changed {
+	sync.updated, sync.changedCount, sync.addedCount, sync.removedCount, sync.changed = updateConfigINIContent(sync.original, embeddedConfig)
+	return sync, true, nil
+}
+
+func applyConfigINISync(sync configINISyncPlan) error {
+	if !sync.changed {
 		fmt.Printf("[INFO] %s already up to date\n", configINIFileName)
-		return
+		return nil
 	}
 
-	if err := os.WriteFile(configPath, updatedConfig, 0644); err != nil {
-		fmt.Printf("[ERROR] Unable to write %s: %s\n", configPath, err.Error())
-		os.Exit(1)
+	if err := os.WriteFile(sync.path, sync.updated, 0644); err != nil {
+		return fmt.Errorf("unable to write %s: %w", sync.path, err)
 	}
 
-	if configExists {
-		fmt.Printf("[PATCH] %s updated from embedded client config (%d outdated value(s), %d new key(s), %d obsolete key(s) removed)\n", configINIFileName, changedCount, addedCount, removedCount)
-		return
+	if sync.exists {
+		fmt.Printf("[PATCH] %s updated from embedded client config (%d outdated value(s), %d new key(s), %d obsolete key(s) removed)\n", configINIFileName, sync.changedCount, sync.addedCount, sync.removedCount)
+		return nil
 	}
-	fmt.Printf("[PATCH] %s created from embedded client config (%d key(s))\n", configINIFileName, addedCount)
+	fmt.Printf("[PATCH] %s created from embedded client config (%d key(s))\n", configINIFileName, sync.addedCount)
+	return nil
 }
 
 func resolveConfigINIPath(tibiaPath string) (string, bool) {
@@ -2851,42 +3157,48 @@ func detectLineEnding(data []byte) string {
 	return "\n"
 }
 
-func setPropertyByName(tibiaBinary []byte, propertyName string, customValue string) bool {
-	originalBinarySize := len(tibiaBinary)
-	propertyName = fmt.Sprintf("%s=", propertyName)
-	propertyIndex := bytes.Index(tibiaBinary, []byte(propertyName))
-	if propertyIndex != -1 {
-		// Extract current property value
-		startValue := propertyIndex + len(propertyName)
-		endValue := startValue + bytes.IndexByte(tibiaBinary[startValue:], '\n')
-		propertyValue := string(tibiaBinary[startValue:endValue])
-
-		if len(customValue) > len(propertyValue) {
-			fmt.Printf("[ERROR] Cannot replace %s to '%s' because the new value must be smaller than '%s' (%d chars).\n", propertyName, customValue, propertyValue, len(propertyValue))
-			return false
-		}
-
-		fmt.Printf("[INFO] %s found! %s\n", propertyName, propertyValue)
+// propertySubstitution describes one embedded URL rewrite. offset is the
+// position of the value inside the buffer passed to replacePropertyByName.
+type propertySubstitution struct {
+	name    string
+	offset  int
+	before  string
+	after   string
+	padding int
+}
 
-		// Create the new value with the correct length
-		customValueBytes := []byte(customValue)
-		paddedCustomValue := append(customValueBytes, bytes.Repeat(paddingByte, len(propertyValue)-len(customValueBytes))...)
+func setPropertyByName(tibiaBinary []byte, propertyName string, customValue string) bool {
+	_, ok := replacePropertyByName(tibiaBinary, propertyName, customValue)
+	return ok
+}
 
-		// Merge everything back to the client
-		remainingBinary := tibiaBinary[endValue:]
+// replacePropertyByName rewrites the value of propertyName in the embedded
+// config block in place, padding it to the stock length.
+func replacePropertyByName(tibiaBinary []byte, propertyName string, customValue string) (propertySubstitution, bool) {
+	substitution := propertySubstitution{name: propertyName, after: customValue}
+	startValue, endValue, found := locateEmbeddedConfigValue(tibiaBinary, propertyName)
+	propertyName = fmt.Sprintf("%s=", propertyName)
+	if !found {
+		fmt.Printf("[WARNING] %s was not found!\n", propertyName)
+		return substitution, false
+	}
 
-		tibiaBinary = append(tibiaBinary[:startValue], paddedCustomValue...)
-		tibiaBinary = append(tibiaBinary, remainingBinary...)
+	propertyValue := string(tibiaBinary[startValue:endValue])
+	if len(customValue) > len(propertyValue) {
+		fmt.Printf("[ERROR] Cannot replace %s to '%s' because the new value must be smaller than '%s' (%d chars). Use --relocate-urls to move the URL block into a new section.\n", propertyName, customValue, propertyValue, len(propertyValue))
+		return substitution, false
+	}
 
-		if originalBinarySize != len(tibiaBinary) {
-			fmt.Printf("[ERROR] Fatal error: The new modified client (size %d) has a different byte size from the original (size %d). Make sure to use the correct versions of both the client and client-editor or report a bug.\n", len(tibiaBinary), originalBinarySize)
-			os.Exit(1)
-		}
+	fmt.Printf("[INFO] %s found! %s\n", propertyName, propertyValue)
 
-		fmt.Printf("[PATCH] %s replaced to %s!\n", propertyName, customValue)
-		return true
-	}
+	// Create the new value with the correct length
+	customValueBytes := []byte(customValue)
+	paddedCustomValue := append(customValueBytes, bytes.Repeat(paddingByte, len(propertyValue)-len(customValueBytes))...)
+	copy(tibiaBinary[startValue:endValue], paddedCustomValue)
 
-	fmt.Printf("[WARNING] %s was not found!\n", propertyName)
-	return false
+	fmt.Printf("[PATCH] %s replaced to %s!\n", propertyName, customValue)
+	substitution.offset = startValue
+	substitution.before = propertyValue
+	substitution.padding = len(propertyValue) - len(customValueBytes)
+	return substitution, true
 }
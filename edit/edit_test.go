@@ -13,7 +13,10 @@ func TestRemoveBattlEyeAppliesAllKnownWindowsPatches(t *testing.T) {
 	tibiaBinary = append(tibiaBinary, []byte{0x75, 0x0f, 0xe8, 0xd9, 0xd4, 0xed, 0xff, 0x48}...)
 	tibiaBinary = append(tibiaBinary, []byte{0x75, 0x0f, 0xe8, 0x35, 0xff, 0xff, 0xff, 0x48}...)
 
-	patched := removeBattlEye("client.exe", tibiaBinary, false)
+	patched, err := removeBattlEye(activeSignatures(), "client.exe", tibiaBinary, false)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if bytes.Contains(patched, []byte{0x8d, 0x4d, 0xb4, 0x75, 0x0e, 0xe8, 0xb4, 0x53}) {
 		t.Fatal("expected legacy Battleye bytes to be patched")
@@ -49,7 +52,11 @@ func TestStructuralClientCheckPairPatchesOnlyVerifiedCallSites(t *testing.T) {
 		if !match.unique || len(match.originalOffsets) != 1 || len(match.patchedOffsets) != 0 {
 			t.Fatalf("expected one original structural match for %q, got %+v", patch.name, match)
 		}
-		tibiaBinary = applyBattleyePatch(tibiaBinary, patch, match.originalOffsets)
+		patchedBinary, err := applyBattleyePatch(tibiaBinary, patch, match.originalOffsets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tibiaBinary = patchedBinary
 	}
 
 	expectedChanges := make(map[int]bool)
@@ -128,7 +135,10 @@ func TestRemoveBattlEyeSkipsNonWindowsExecutable(t *testing.T) {
 	tibiaBinary = append(tibiaBinary, []byte{0x75, 0x0f, 0xe8, 0x35, 0xff, 0xff, 0xff, 0x48}...)
 	original := append([]byte(nil), tibiaBinary...)
 
-	patched := removeBattlEye("client.exe", tibiaBinary, false)
+	patched, err := removeBattlEye(activeSignatures(), "client.exe", tibiaBinary, false)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if !bytes.Equal(patched, original) {
 		t.Fatal("expected non-Windows executable to be unchanged")
@@ -140,7 +150,10 @@ func TestRemoveBattlEyeSkipsMZWithoutPESignature(t *testing.T) {
 	tibiaBinary = append(tibiaBinary, []byte{0x75, 0x0f, 0xe8, 0x35, 0xff, 0xff, 0xff, 0x48}...)
 	original := append([]byte(nil), tibiaBinary...)
 
-	patched := removeBattlEye("client.exe", tibiaBinary, false)
+	patched, err := removeBattlEye(activeSignatures(), "client.exe", tibiaBinary, false)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if !bytes.Equal(patched, original) {
 		t.Fatal("expected MZ-only executable to be unchanged")
@@ -157,9 +170,9 @@ func TestBytePatternFindAllSupportsWildcards(t *testing.T) {
 }
 
 func TestClientCheckStrongUnsupportedEvidenceRequiresUnknownCodeContext(t *testing.T) {
-	tibiaBinary, peData, referenceOffset := newClientCheckReferenceFixture("clientcheck_disconnected")
+	tibiaBinary, peData, referenceOffset := newDecodedClientCheckReferenceFixture("clientcheck_disconnected")
 
-	findings := scanClientCheckFindings(tibiaBinary, peData, nil)
+	findings := scanClientCheckFindings(activeSignatures(), tibiaBinary, peData, nil)
 	diagnosis := diagnosisReport{clientCheckFindings: findings}
 
 	if diagnosis.strongUnsupportedEvidenceCount() != 1 {
@@ -169,7 +182,7 @@ func TestClientCheckStrongUnsupportedEvidenceRequiresUnknownCodeContext(t *testi
 	patchStatuses := []battleyePatchStatus{
 		{patch: battleyePatches[0], originalOffset: []int{referenceOffset + 8}},
 	}
-	findings = scanClientCheckFindings(tibiaBinary, peData, patchStatuses)
+	findings = scanClientCheckFindings(activeSignatures(), tibiaBinary, peData, patchStatuses)
 	diagnosis = diagnosisReport{clientCheckFindings: findings}
 
 	if diagnosis.strongUnsupportedEvidenceCount() != 0 {
@@ -177,10 +190,28 @@ func TestClientCheckStrongUnsupportedEvidenceRequiresUnknownCodeContext(t *testi
 	}
 }
 
+func TestCodeContextCountsBranchesAtInstructionBoundaries(t *testing.T) {
+	tibiaBinary, peData, referenceOffset := newClientCheckReferenceFixture("clientcheck_disconnected")
+
+	references := scanClientCheckFindings(activeSignatures(), tibiaBinary, peData, nil)[0].references
+	if len(references) != 1 || len(references[0].patternMatches) != 1 || references[0].patternMatches[0].offset != referenceOffset+8 {
+		t.Fatalf("expected the byte pattern to match inside the decoded instruction, got %+v", references)
+	}
+	if len(references[0].branchOffsets) != 0 || references[0].strongUnsupported {
+		t.Fatalf("expected the JNE bytes decoded as an operand not to count as a branch, got %+v", references[0])
+	}
+
+	tibiaBinary, peData, _ = newClientCheckReferenceFixtureWithoutRecognizedPattern("clientcheck_disconnected")
+	references = scanClientCheckFindings(activeSignatures(), tibiaBinary, peData, nil)[0].references
+	if len(references) != 1 || len(references[0].patternMatches) != 0 || len(references[0].branchOffsets) != 0 || references[0].suspiciousActive {
+		t.Fatalf("expected no pattern, branch or suspicious evidence, got %+v", references)
+	}
+}
+
 func TestBEClientReferenceIsWeakIndicator(t *testing.T) {
 	tibiaBinary, peData, _ := newClientCheckReferenceFixture("BEClient")
 
-	findings := scanClientCheckFindings(tibiaBinary, peData, nil)
+	findings := scanClientCheckFindings(activeSignatures(), tibiaBinary, peData, nil)
 	diagnosis := diagnosisReport{clientCheckFindings: findings}
 
 	if diagnosis.strongUnsupportedEvidenceCount() != 0 {
@@ -189,12 +220,13 @@ func TestBEClientReferenceIsWeakIndicator(t *testing.T) {
 }
 
 func TestSuspiciousActiveEvidenceRequiresPatchedSignatureForWarningVerdict(t *testing.T) {
-	tibiaBinary, peData, _ := newClientCheckReferenceFixtureWithoutRecognizedPattern("clientcheck_disconnected")
+	tibiaBinary, peData, _ := newDecodedClientCheckReferenceFixtureWithoutRecognizedPattern("clientcheck_disconnected")
 
-	findings := scanClientCheckFindings(tibiaBinary, peData, nil)
+	findings := scanClientCheckFindings(activeSignatures(), tibiaBinary, peData, nil)
 	diagnosis := diagnosisReport{
 		patchStatuses:       []battleyePatchStatus{{patch: battleyePatches[0], originalOffset: []int{0x180}}},
 		clientCheckFindings: findings,
+		signatures:          activeSignatures(),
 	}
 
 	if diagnosis.strongUnsupportedEvidenceCount() != 0 {
@@ -495,3 +527,24 @@ func newClientCheckReferenceFixtureWithoutRecognizedPattern(indicator string) ([
 
 	return tibiaBinary, peData, referenceOffset
 }
+
+// newDecodedClientCheckReferenceFixture is newClientCheckReferenceFixture as
+// straight-line code: the zero byte between the LEA and the JNE would decode
+// as "add [rbp+0x5],dh" and swallow the branch, so it becomes a NOP.
+func newDecodedClientCheckReferenceFixture(indicator string) ([]byte, peInfo, int) {
+	tibiaBinary, peData, referenceOffset := newClientCheckReferenceFixture(indicator)
+	tibiaBinary[referenceOffset+7] = 0x90
+	return tibiaBinary, peData, referenceOffset
+}
+
+// newDecodedClientCheckReferenceFixtureWithoutRecognizedPattern NOPs every
+// byte from the end of the LEA up to the JNE at +0x20. Zero bytes decode in
+// pairs, so an odd run in front of the JNE would swallow it; the even run
+// between the JNE and the CALL at +0x40 keeps the CALL aligned.
+func newDecodedClientCheckReferenceFixtureWithoutRecognizedPattern(indicator string) ([]byte, peInfo, int) {
+	tibiaBinary, peData, referenceOffset := newClientCheckReferenceFixtureWithoutRecognizedPattern(indicator)
+	for index := referenceOffset + 7; index < referenceOffset+0x20; index++ {
+		tibiaBinary[index] = 0x90
+	}
+	return tibiaBinary, peData, referenceOffset
+}
@@ -0,0 +1,375 @@
+package edit
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"sort"
+)
+
+const (
+	executableFormatELF = "ELF"
+
+	ehPointerOmit    = 0xff
+	ehPointerAbsPtr  = 0x00
+	ehPointerULEB128 = 0x01
+	ehPointerUData2  = 0x02
+	ehPointerUData4  = 0x03
+	ehPointerUData8  = 0x04
+	ehPointerSLEB128 = 0x09
+	ehPointerSData2  = 0x0a
+	ehPointerSData4  = 0x0b
+	ehPointerSData8  = 0x0c
+	ehPointerPCRel   = 0x10
+)
+
+type executableSymbol struct {
+	name     string
+	beginRVA int
+	endRVA   int
+}
+
+func isELFExecutable(tibiaBinary []byte) bool {
+	return len(tibiaBinary) >= 4 && bytes.Equal(tibiaBinary[:4], []byte(elf.ELFMAG))
+}
+
+func inspectELF(tibiaBinary []byte) peInfo {
+	elfFile, err := elf.NewFile(bytes.NewReader(tibiaBinary))
+	if err != nil {
+		return peInfo{format: executableFormatELF, errorText: err.Error()}
+	}
+	defer elfFile.Close()
+
+	info := peInfo{valid: true, format: executableFormatELF}
+	var ehFrame *elf.Section
+	for _, section := range elfFile.Sections {
+		if section.Flags&elf.SHF_ALLOC == 0 || section.Type == elf.SHT_NOBITS || section.Size == 0 {
+			continue
+		}
+		rawStart := int(section.Offset)
+		rawEnd := rawStart + int(section.Size)
+		if rawStart < 0 || rawEnd < 0 || rawStart > len(tibiaBinary) {
+			continue
+		}
+		if rawEnd > len(tibiaBinary) {
+			rawEnd = len(tibiaBinary)
+		}
+		if rawEnd <= rawStart {
+			continue
+		}
+
+		info.sections = append(info.sections, peSectionInfo{
+			name:       section.Name,
+			rawStart:   rawStart,
+			rawEnd:     rawEnd,
+			rvaStart:   int(section.Addr),
+			rvaEnd:     int(section.Addr) + int(section.Size),
+			isCode:     section.Flags&elf.SHF_EXECINSTR != 0,
+			isWritable: section.Flags&elf.SHF_WRITE != 0,
+		})
+		if section.Name == ".eh_frame" {
+			ehFrame = section
+		}
+	}
+
+	info.symbols = elfFunctionSymbols(elfFile)
+	if elfFile.Machine == elf.EM_X86_64 {
+		if ehFrame != nil {
+			ehFrameEnd := int(ehFrame.Offset) + int(ehFrame.Size)
+			if ehFrameEnd <= len(tibiaBinary) {
+				info.runtimeFunctions = parseEHFrameFunctions(tibiaBinary[ehFrame.Offset:ehFrameEnd], int(ehFrame.Addr))
+			}
+		}
+		if len(info.runtimeFunctions) == 0 {
+			for _, symbol := range info.symbols {
+				info.runtimeFunctions = append(info.runtimeFunctions, peRuntimeFunction{beginRVA: symbol.beginRVA, endRVA: symbol.endRVA})
+			}
+		}
+		info.runtimeFunctions = info.codeRuntimeFunctions(info.runtimeFunctions)
+	}
+
+	if libraries, err := elfFile.ImportedLibraries(); err == nil {
+		info.imports = append(info.imports, libraries...)
+	}
+	if symbols, err := elfFile.ImportedSymbols(); err == nil {
+		for _, symbol := range symbols {
+			info.imports = append(info.imports, symbol.Name)
+		}
+	}
+	sort.Strings(info.imports)
+	info.importSlots = elfImportSlots(elfFile)
+
+	return info
+}
+
+func elfFunctionSymbols(elfFile *elf.File) []executableSymbol {
+	seen := make(map[int]struct{})
+	symbols := make([]executableSymbol, 0)
+	appendSymbols := func(elfSymbols []elf.Symbol) {
+		for _, symbol := range elfSymbols {
+			if elf.ST_TYPE(symbol.Info) != elf.STT_FUNC || symbol.Value == 0 || symbol.Size == 0 {
+				continue
+			}
+			beginRVA := int(symbol.Value)
+			if _, ok := seen[beginRVA]; ok {
+				continue
+			}
+			seen[beginRVA] = struct{}{}
+			symbols = append(symbols, executableSymbol{name: symbol.Name, beginRVA: beginRVA, endRVA: beginRVA + int(symbol.Size)})
+		}
+	}
+
+	if elfSymbols, err := elfFile.Symbols(); err == nil {
+		appendSymbols(elfSymbols)
+	}
+	if elfSymbols, err := elfFile.DynamicSymbols(); err == nil {
+		appendSymbols(elfSymbols)
+	}
+	sort.Slice(symbols, func(left, right int) bool {
+		return symbols[left].beginRVA < symbols[right].beginRVA
+	})
+	return symbols
+}
+
+// codeRuntimeFunctions keeps the function ranges that start and end inside the
+// same executable section, sorted by start address and without duplicates.
+func (peData peInfo) codeRuntimeFunctions(functions []peRuntimeFunction) []peRuntimeFunction {
+	valid := make([]peRuntimeFunction, 0, len(functions))
+	seen := make(map[int]struct{}, len(functions))
+	for _, function := range functions {
+		if function.beginRVA == 0 || function.endRVA <= function.beginRVA {
+			continue
+		}
+		if _, ok := seen[function.beginRVA]; ok {
+			continue
+		}
+		beginSection, beginOK := peData.sectionForRVA(function.beginRVA)
+		endSection, endOK := peData.sectionForRVA(function.endRVA - 1)
+		if !beginOK || !endOK || !beginSection.isCode || beginSection.name != endSection.name {
+			continue
+		}
+		seen[function.beginRVA] = struct{}{}
+		valid = append(valid, function)
+	}
+	sort.Slice(valid, func(left, right int) bool {
+		return valid[left].beginRVA < valid[right].beginRVA
+	})
+	return valid
+}
+
+// parseEHFrameFunctions walks the CIE/FDE records of an .eh_frame section and
+// returns the [pc_begin, pc_begin+pc_range) range of every FDE.
+func parseEHFrameFunctions(ehFrame []byte, ehFrameAddress int) []peRuntimeFunction {
+	functions := make([]peRuntimeFunction, 0)
+	cieEncodings := make(map[int]byte)
+
+	for offset := 0; offset+4 <= len(ehFrame); {
+		recordStart := offset
+		length := int(binary.LittleEndian.Uint32(ehFrame[offset : offset+4]))
+		offset += 4
+		if length == 0 {
+			break
+		}
+		if length == 0xffffffff {
+			if offset+8 > len(ehFrame) {
+				break
+			}
+			length = int(binary.LittleEndian.Uint64(ehFrame[offset : offset+8]))
+			offset += 8
+		}
+		recordEnd := offset + length
+		if length < 4 || recordEnd > len(ehFrame) || recordEnd < offset {
+			break
+		}
+
+		idOffset := offset
+		cieID := int(binary.LittleEndian.Uint32(ehFrame[offset : offset+4]))
+		offset += 4
+		if cieID == 0 {
+			if encoding, ok := parseEHFrameCIE(ehFrame[offset:recordEnd]); ok {
+				cieEncodings[recordStart] = encoding
+			}
+			offset = recordEnd
+			continue
+		}
+
+		encoding, ok := cieEncodings[idOffset-cieID]
+		if !ok {
+			offset = recordEnd
+			continue
+		}
+		beginRVA, beginLength, ok := readEHPointer(ehFrame[offset:recordEnd], encoding, ehFrameAddress+offset)
+		if !ok {
+			offset = recordEnd
+			continue
+		}
+		functionRange, _, ok := readEHPointer(ehFrame[offset+beginLength:recordEnd], encoding&0x0f, 0)
+		if ok && functionRange > 0 {
+			functions = append(functions, peRuntimeFunction{beginRVA: beginRVA, endRVA: beginRVA + functionRange})
+		}
+		offset = recordEnd
+	}
+
+	return functions
+}
+
+func parseEHFrameCIE(cie []byte) (byte, bool) {
+	if len(cie) < 2 {
+		return 0, false
+	}
+	version := cie[0]
+	augmentationEnd := bytes.IndexByte(cie[1:], 0)
+	if augmentationEnd == -1 {
+		return 0, false
+	}
+	augmentation := string(cie[1 : 1+augmentationEnd])
+	offset := 1 + augmentationEnd + 1
+	if len(augmentation) >= 2 && augmentation[:2] == "eh" {
+		offset += 8
+	}
+
+	var ok bool
+	var length int
+	if _, length, ok = readULEB128(cie, offset); !ok {
+		return 0, false
+	}
+	offset += length
+	if _, length, ok = readSLEB128(cie, offset); !ok {
+		return 0, false
+	}
+	offset += length
+	if version == 1 {
+		offset++
+	} else {
+		if _, length, ok = readULEB128(cie, offset); !ok {
+			return 0, false
+		}
+		offset += length
+	}
+
+	encoding := byte(ehPointerAbsPtr)
+	if augmentation == "" || augmentation[0] != 'z' {
+		return encoding, true
+	}
+	if _, length, ok = readULEB128(cie, offset); !ok {
+		return 0, false
+	}
+	offset += length
+
+	for _, augmentationChar := range augmentation[1:] {
+		if offset >= len(cie) {
+			return 0, false
+		}
+		switch augmentationChar {
+		case 'R':
+			encoding = cie[offset]
+			offset++
+		case 'L':
+			offset++
+		case 'P':
+			personalityEncoding := cie[offset]
+			offset++
+			_, length, ok := readEHPointer(cie[offset:], personalityEncoding&0x0f, 0)
+			if !ok {
+				return 0, false
+			}
+			offset += length
+		case 'S', 'B':
+		default:
+			return 0, false
+		}
+	}
+	return encoding, true
+}
+
+// readEHPointer decodes a DW_EH_PE encoded pointer. fieldAddress is the
+// virtual address of the field and is only used for pc-relative values.
+func readEHPointer(data []byte, encoding byte, fieldAddress int) (int, int, bool) {
+	if encoding == ehPointerOmit {
+		return 0, 0, false
+	}
+
+	var value, length int
+	switch encoding & 0x0f {
+	case ehPointerAbsPtr, ehPointerUData8:
+		if len(data) < 8 {
+			return 0, 0, false
+		}
+		value, length = int(binary.LittleEndian.Uint64(data[:8])), 8
+	case ehPointerSData8:
+		if len(data) < 8 {
+			return 0, 0, false
+		}
+		value, length = int(int64(binary.LittleEndian.Uint64(data[:8]))), 8
+	case ehPointerUData4:
+		if len(data) < 4 {
+			return 0, 0, false
+		}
+		value, length = int(binary.LittleEndian.Uint32(data[:4])), 4
+	case ehPointerSData4:
+		if len(data) < 4 {
+			return 0, 0, false
+		}
+		value, length = int(int32(binary.LittleEndian.Uint32(data[:4]))), 4
+	case ehPointerUData2:
+		if len(data) < 2 {
+			return 0, 0, false
+		}
+		value, length = int(binary.LittleEndian.Uint16(data[:2])), 2
+	case ehPointerSData2:
+		if len(data) < 2 {
+			return 0, 0, false
+		}
+		value, length = int(int16(binary.LittleEndian.Uint16(data[:2]))), 2
+	case ehPointerULEB128:
+		var ok bool
+		if value, length, ok = readULEB128(data, 0); !ok {
+			return 0, 0, false
+		}
+	case ehPointerSLEB128:
+		var ok bool
+		if value, length, ok = readSLEB128(data, 0); !ok {
+			return 0, 0, false
+		}
+	default:
+		return 0, 0, false
+	}
+
+	switch encoding & 0x70 {
+	case 0:
+	case ehPointerPCRel:
+		value += fieldAddress
+	default:
+		return 0, 0, false
+	}
+	return value, length, true
+}
+
+func readULEB128(data []byte, offset int) (int, int, bool) {
+	value := 0
+	shift := 0
+	for index := offset; index < len(data) && shift < 63; index++ {
+		value |= int(data[index]&0x7f) << shift
+		shift += 7
+		if data[index]&0x80 == 0 {
+			return value, index - offset + 1, true
+		}
+	}
+	return 0, 0, false
+}
+
+func readSLEB128(data []byte, offset int) (int, int, bool) {
+	value := 0
+	shift := 0
+	for index := offset; index < len(data) && shift < 63; index++ {
+		value |= int(data[index]&0x7f) << shift
+		shift += 7
+		if data[index]&0x80 == 0 {
+			if shift < 63 && data[index]&0x40 != 0 {
+				value |= -1 << shift
+			}
+			return value, index - offset + 1, true
+		}
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,222 @@
+package edit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+type elfTestSection struct {
+	name    string
+	flags   uint64
+	address uint64
+	data    []byte
+}
+
+func TestInspectELFReadsSectionsAndEHFrameFunctionBoundaries(t *testing.T) {
+	tibiaBinary := newELFBinary(t, newELFTestText(), []byte("clientcheck_disconnected\x00"))
+
+	peData := inspectExecutable(tibiaBinary)
+	if !peData.valid || peData.format != executableFormatELF {
+		t.Fatalf("expected a valid ELF layout, got %+v", peData)
+	}
+
+	text, ok := peData.sectionForRVA(0x401000)
+	if !ok || text.name != ".text" || !text.isCode || text.rawStart != 0x1000 {
+		t.Fatalf("expected executable .text mapped at 0x401000, got %+v", text)
+	}
+	rodata, ok := peData.sectionForRVA(0x402000)
+	if !ok || rodata.name != ".rodata" || rodata.isCode {
+		t.Fatalf("expected non-code .rodata mapped at 0x402000, got %+v", rodata)
+	}
+
+	function, ok := peData.runtimeFunctionContainingRVA(0x401010)
+	if !ok || function.beginRVA != 0x401000 || function.endRVA != 0x401040 {
+		t.Fatalf("expected .eh_frame function 0x401000..0x401040, got %+v ok=%t", function, ok)
+	}
+}
+
+func TestAnalyzeTibiaBinaryFindsRIPRelativeStringReferencesInELF(t *testing.T) {
+	tibiaBinary := newELFBinary(t, newELFTestText(), []byte("clientcheck_disconnected\x00"))
+
+	diagnosis := analyzeTibiaBinary(activeSignatures(), "client", tibiaBinary)
+	if !diagnosis.isELF || diagnosis.isWindowsExe {
+		t.Fatal("expected the fixture to be diagnosed as ELF")
+	}
+	if diagnosis.clientCheckCodeReferenceCount() != 1 {
+		t.Fatalf("expected one clientcheck_disconnected code reference, got %d", diagnosis.clientCheckCodeReferenceCount())
+	}
+	reference := diagnosis.clientCheckFindings[0].references[0]
+	if reference.offset != 0x1004 || reference.section != ".text" || reference.instruction != "lea rcx,[rip+0xFF5]" {
+		t.Fatalf("unexpected ELF string reference %+v", reference)
+	}
+}
+
+func TestClientCheckVerdictIgnoresDiagnosticOnlySignaturesOnELF(t *testing.T) {
+	tibiaBinary := newELFBinary(t, newELFTestText(), []byte("Tibia\x00"))
+
+	diagnosis := analyzeTibiaBinary(activeSignatures(), "client", tibiaBinary)
+	if patchable := diagnosis.patchableSignatureCount(); patchable != 0 {
+		t.Fatalf("expected no patchable signatures on ELF, got %d", patchable)
+	}
+	if verdict := diagnosis.clientCheckVerdict(); !strings.HasPrefix(verdict, "SUPPORTED:") {
+		t.Fatalf("expected SUPPORTED verdict for an ELF client without evidence, got %q", verdict)
+	}
+	if diagnosis.hasUnsafeClientCheckRemainder() {
+		t.Fatal("expected strict mode to accept an ELF client without client-check evidence")
+	}
+	if report := diagnosis.toJSON(); report.Coverage.Patchable != 0 {
+		t.Fatalf("expected JSON coverage to count 0 patchable signatures, got %d", report.Coverage.Patchable)
+	}
+}
+
+func TestRemoveBattlEyeKeepsUnguardedSignaturesDiagnosticOnELF(t *testing.T) {
+	text := newELFTestText()
+	copy(text[0x20:], []byte{0x8d, 0x4d, 0xb4, 0x75, 0x0e, 0xe8, 0xb4, 0x53})
+	tibiaBinary := newELFBinary(t, text, []byte("BattlEye\x00"))
+	original := append([]byte(nil), tibiaBinary...)
+
+	patched, err := removeBattlEye(activeSignatures(), "client", tibiaBinary, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(patched, original) {
+		t.Fatal("expected unguarded Windows signature to stay unpatched in an ELF client")
+	}
+}
+
+func TestBattleyePatchesReportStructuralPairUnverifiableOnELF(t *testing.T) {
+	guarded := 0
+	for index, patch := range battleyePatchesForFormat(battleyePatches, executableFormatELF) {
+		if battleyePatches[index].structuralGuard == nil {
+			continue
+		}
+		guarded++
+		if patch.structuralGuard != nil || !patch.diagnosticOnly || len(patch.aggressiveReplacement) > 0 || !strings.HasPrefix(patch.falsePositiveCheck, "unverifiable on ELF") {
+			t.Fatalf("expected %q to be reported as unverifiable, got %+v", patch.name, patch)
+		}
+	}
+	if guarded != 2 {
+		t.Fatalf("expected the two client-check pair signatures, got %d", guarded)
+	}
+}
+
+func TestParseEHFrameFunctionsSkipsUnknownCIE(t *testing.T) {
+	ehFrame := newELFTestEHFrame(0x403000, 0x401000, 0x40)
+	binary.LittleEndian.PutUint32(ehFrame[len(ehFrame)-20:], 0x100)
+
+	if functions := parseEHFrameFunctions(ehFrame, 0x403000); len(functions) != 0 {
+		t.Fatalf("expected FDE with dangling CIE pointer to be ignored, got %+v", functions)
+	}
+}
+
+func newELFTestText() []byte {
+	text := make([]byte, 0x40)
+	for index := range text {
+		text[index] = 0x90
+	}
+	// push rbp; mov rbp,rsp; lea rcx,[rip+disp32] -> .rodata
+	copy(text, []byte{0x55, 0x48, 0x89, 0xe5, 0x48, 0x8d, 0x0d})
+	binary.LittleEndian.PutUint32(text[7:11], uint32(0x402000-(0x401004+7)))
+	text[0x3f] = 0xc3
+	return text
+}
+
+// newELFTestEHFrame builds one CIE with a pcrel|sdata4 FDE encoding followed
+// by one FDE describing [functionAddress, functionAddress+functionSize).
+func newELFTestEHFrame(ehFrameAddress int, functionAddress int, functionSize int) []byte {
+	cie := []byte{
+		0, 0, 0, 0, // CIE id
+		1,           // version
+		'z', 'R', 0, // augmentation
+		1,    // code alignment
+		0x78, // data alignment -8
+		16,   // return address register
+		1,    // augmentation length
+		0x1b, // DW_EH_PE_pcrel | DW_EH_PE_sdata4
+		0, 0, 0,
+	}
+	ehFrame := make([]byte, 4, 64)
+	binary.LittleEndian.PutUint32(ehFrame, uint32(len(cie)))
+	ehFrame = append(ehFrame, cie...)
+
+	fdeStart := len(ehFrame)
+	fde := make([]byte, 20)
+	binary.LittleEndian.PutUint32(fde[0:4], 16)
+	binary.LittleEndian.PutUint32(fde[4:8], uint32(fdeStart+4))
+	pcBeginAddress := ehFrameAddress + fdeStart + 8
+	binary.LittleEndian.PutUint32(fde[8:12], uint32(int32(functionAddress-pcBeginAddress)))
+	binary.LittleEndian.PutUint32(fde[12:16], uint32(functionSize))
+	ehFrame = append(ehFrame, fde...)
+	return append(ehFrame, 0, 0, 0, 0)
+}
+
+func newELFBinary(t *testing.T, text []byte, rodata []byte) []byte {
+	t.Helper()
+	return buildELFBinary(t, []elfTestSection{
+		{name: ".text", flags: 0x6, address: 0x401000, data: text},
+		{name: ".rodata", flags: 0x2, address: 0x402000, data: rodata},
+		{name: ".eh_frame", flags: 0x2, address: 0x403000, data: newELFTestEHFrame(0x403000, 0x401000, 0x40)},
+	})
+}
+
+// buildELFBinary lays out an x86-64 ELF64 executable with one page per section
+// at file offset address-0x400000, followed by .shstrtab and section headers.
+func buildELFBinary(t *testing.T, sections []elfTestSection) []byte {
+	t.Helper()
+	const headerSize = 64
+	const sectionHeaderSize = 64
+
+	shstrtab := []byte{0}
+	nameOffsets := make([]int, len(sections))
+	for index, section := range sections {
+		nameOffsets[index] = len(shstrtab)
+		shstrtab = append(shstrtab, append([]byte(section.name), 0)...)
+	}
+	shstrtabNameOffset := len(shstrtab)
+	shstrtab = append(shstrtab, []byte(".shstrtab\x00")...)
+
+	fileEnd := 0x1000
+	for _, section := range sections {
+		offset := int(section.address - 0x400000)
+		if offset+len(section.data) > fileEnd {
+			fileEnd = offset + len(section.data)
+		}
+	}
+	shstrtabOffset := fileEnd
+	sectionHeaderOffset := (shstrtabOffset + len(shstrtab) + 7) &^ 7
+	tibiaBinary := make([]byte, sectionHeaderOffset+(len(sections)+2)*sectionHeaderSize)
+
+	copy(tibiaBinary, []byte{0x7f, 'E', 'L', 'F', 2, 1, 1})
+	binary.LittleEndian.PutUint16(tibiaBinary[16:], 2)    // ET_EXEC
+	binary.LittleEndian.PutUint16(tibiaBinary[18:], 0x3e) // EM_X86_64
+	binary.LittleEndian.PutUint32(tibiaBinary[20:], 1)
+	binary.LittleEndian.PutUint64(tibiaBinary[24:], sections[0].address)
+	binary.LittleEndian.PutUint64(tibiaBinary[40:], uint64(sectionHeaderOffset))
+	binary.LittleEndian.PutUint16(tibiaBinary[52:], headerSize)
+	binary.LittleEndian.PutUint16(tibiaBinary[58:], sectionHeaderSize)
+	binary.LittleEndian.PutUint16(tibiaBinary[60:], uint16(len(sections)+2))
+	binary.LittleEndian.PutUint16(tibiaBinary[62:], uint16(len(sections)+1))
+
+	writeHeader := func(index int, nameOffset int, sectionType uint32, flags uint64, address uint64, offset int, size int) {
+		header := tibiaBinary[sectionHeaderOffset+index*sectionHeaderSize:]
+		binary.LittleEndian.PutUint32(header[0:], uint32(nameOffset))
+		binary.LittleEndian.PutUint32(header[4:], sectionType)
+		binary.LittleEndian.PutUint64(header[8:], flags)
+		binary.LittleEndian.PutUint64(header[16:], address)
+		binary.LittleEndian.PutUint64(header[24:], uint64(offset))
+		binary.LittleEndian.PutUint64(header[32:], uint64(size))
+		binary.LittleEndian.PutUint64(header[48:], 1)
+	}
+	for index, section := range sections {
+		offset := int(section.address - 0x400000)
+		copy(tibiaBinary[offset:], section.data)
+		writeHeader(index+1, nameOffsets[index], 1, section.flags, section.address, offset, len(section.data))
+	}
+	copy(tibiaBinary[shstrtabOffset:], shstrtab)
+	writeHeader(len(sections)+1, shstrtabNameOffset, 3, 0, 0, shstrtabOffset, len(shstrtab))
+
+	return tibiaBinary
+}
@@ -0,0 +1,287 @@
+package edit
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	historySchemaName    = "client-editor-diagnosis-history"
+	historySchemaVersion = 1
+
+	// DefaultHistoryMatch selects client executables in an archive and skips
+	// the Qt, crash handler and launcher binaries shipped beside them.
+	DefaultHistoryMatch = "client*"
+
+	signatureNotScanned = "n/a"
+)
+
+var backupFileNamePattern = regexp.MustCompile(`^BKP[0-9]+-`)
+
+// diagnosisHistory is the support matrix of every client build in a directory,
+// ordered from the oldest to the newest version.
+type diagnosisHistory struct {
+	Schema            string                  `json:"schema"`
+	SchemaVersion     int                     `json:"schemaVersion"`
+	SignatureDatabase string                  `json:"signatureDatabase"`
+	Directory         string                  `json:"directory"`
+	Signatures        []string                `json:"signatures"`
+	Builds            []historyBuildJSON      `json:"builds"`
+	Transitions       []historyTransitionJSON `json:"transitions"`
+	newest            *diagnosisReport
+}
+
+type historyBuildJSON struct {
+	Path         string            `json:"path"`
+	Version      string            `json:"version"`
+	Size         int               `json:"size"`
+	SHA256       string            `json:"sha256"`
+	Format       string            `json:"format"`
+	Signatures   map[string]string `json:"signatures"`
+	Coverage     int               `json:"coverage"`
+	Patchable    int               `json:"patchable"`
+	Verdict      string            `json:"verdict"`
+	VerdictLevel string            `json:"verdictLevel"`
+	Unsafe       bool              `json:"unsafe"`
+	DuplicateOf  string            `json:"duplicateOf,omitempty"`
+}
+
+type historyTransitionJSON struct {
+	From        string   `json:"from"`
+	To          string   `json:"to"`
+	Appeared    []string `json:"appeared"`
+	Disappeared []string `json:"disappeared"`
+	VerdictFrom string   `json:"verdictFrom"`
+	VerdictTo   string   `json:"verdictTo"`
+}
+
+// findHistoryExecutables walks directory for executables whose file name
+// matches match. Backups and edit records are skipped.
+func findHistoryExecutables(directory string, match string) ([]string, error) {
+	if _, err := filepath.Match(match, ""); err != nil {
+		return nil, fmt.Errorf("invalid --match pattern %q: %w", match, err)
+	}
+	paths := make([]string, 0)
+	err := filepath.WalkDir(directory, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		name := entry.Name()
+		if backupFileNamePattern.MatchString(name) || strings.HasSuffix(name, editRecordSuffix) {
+			return nil
+		}
+		if matched, _ := filepath.Match(match, name); !matched {
+			return nil
+		}
+		header := make([]byte, 4096)
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		count, _ := file.Read(header)
+		_ = file.Close()
+		header = header[:count]
+		if isWindowsExecutable(path, header) || isELFExecutable(header) || isMachOExecutable(header) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	return paths, err
+}
+
+// buildDiagnosisHistory analyzes every build, orders them by FileVersion and
+// compares each build with the previous one.
+func buildDiagnosisHistory(directory string, paths []string) diagnosisHistory {
+	history := diagnosisHistory{
+		Schema:            historySchemaName,
+		SchemaVersion:     historySchemaVersion,
+		SignatureDatabase: activeSignatureDatabase.describe(),
+		Directory:         directory,
+		Signatures:        make([]string, 0),
+		Builds:            make([]historyBuildJSON, 0, len(paths)),
+		Transitions:       make([]historyTransitionJSON, 0),
+	}
+	diagnoses := make(map[string]diagnosisReport, len(paths))
+	knownSignatures := make(map[string]bool)
+	for _, path := range paths {
+		tibiaPath, tibiaBinary := readFile(path)
+		diagnosis := analyzeTibiaBinary(activeSignatures(), tibiaPath, tibiaBinary)
+		verdict := diagnosis.clientCheckVerdict()
+		build := historyBuildJSON{
+			Path:         tibiaPath,
+			Version:      diagnosis.version.text(),
+			Size:         diagnosis.size,
+			SHA256:       diagnosis.sha256,
+			Format:       diagnosis.formatName(),
+			Signatures:   make(map[string]string, len(diagnosis.patchStatuses)),
+			Coverage:     diagnosis.knownPatchCoverage(),
+			Patchable:    diagnosis.patchableSignatureCount(),
+			Verdict:      verdict,
+			VerdictLevel: strings.SplitN(verdict, ":", 2)[0],
+			Unsafe:       diagnosis.hasUnsafeClientCheckRemainder(),
+		}
+		for _, status := range diagnosis.patchStatuses {
+			build.Signatures[status.patch.name] = status.state()
+			if !knownSignatures[status.patch.name] {
+				knownSignatures[status.patch.name] = true
+				history.Signatures = append(history.Signatures, status.patch.name)
+			}
+		}
+		diagnoses[tibiaPath] = diagnosis
+		history.Builds = append(history.Builds, build)
+	}
+
+	firstBySHA256 := make(map[string]string)
+	sort.SliceStable(history.Builds, func(left, right int) bool {
+		return historyBuildLess(history.Builds[left], history.Builds[right])
+	})
+	for index := range history.Builds {
+		build := &history.Builds[index]
+		if first, ok := firstBySHA256[build.SHA256]; ok {
+			build.DuplicateOf = first
+		} else {
+			firstBySHA256[build.SHA256] = build.Path
+		}
+		for _, name := range history.Signatures {
+			if _, ok := build.Signatures[name]; !ok {
+				build.Signatures[name] = signatureNotScanned
+			}
+		}
+	}
+
+	var previous *historyBuildJSON
+	for index := range history.Builds {
+		build := &history.Builds[index]
+		if build.DuplicateOf != "" {
+			continue
+		}
+		if previous != nil {
+			history.Transitions = append(history.Transitions, newHistoryTransition(history.Signatures, *previous, *build))
+		}
+		previous = build
+	}
+	if previous != nil {
+		newest := diagnoses[previous.Path]
+		history.newest = &newest
+	}
+	return history
+}
+
+func newHistoryTransition(signatures []string, from historyBuildJSON, to historyBuildJSON) historyTransitionJSON {
+	transition := historyTransitionJSON{
+		From:        from.Path,
+		To:          to.Path,
+		Appeared:    make([]string, 0),
+		Disappeared: make([]string, 0),
+		VerdictFrom: from.VerdictLevel,
+		VerdictTo:   to.VerdictLevel,
+	}
+	for _, name := range signatures {
+		before, after := from.Signatures[name], to.Signatures[name]
+		if before == signatureNotScanned || after == signatureNotScanned {
+			continue
+		}
+		switch {
+		case before == "absent" && after != "absent":
+			transition.Appeared = append(transition.Appeared, name)
+		case before != "absent" && after == "absent":
+			transition.Disappeared = append(transition.Disappeared, name)
+		}
+	}
+	return transition
+}
+
+// historyBuildLess orders builds by version; builds without a readable
+// version follow the versioned ones and are ordered by path.
+func historyBuildLess(left historyBuildJSON, right historyBuildJSON) bool {
+	leftKnown, rightKnown := left.Version != "unknown", right.Version != "unknown"
+	if leftKnown != rightKnown {
+		return leftKnown
+	}
+	if leftKnown {
+		if order := compareVersions(left.Version, right.Version); order != 0 {
+			return order < 0
+		}
+	}
+	return left.Path < right.Path
+}
+
+// compareVersions compares dotted versions field by field, numerically where
+// both fields are numbers.
+func compareVersions(left string, right string) int {
+	leftFields := strings.FieldsFunc(left, isVersionSeparator)
+	rightFields := strings.FieldsFunc(right, isVersionSeparator)
+	for index := 0; index < len(leftFields) || index < len(rightFields); index++ {
+		if index >= len(leftFields) {
+			return -1
+		}
+		if index >= len(rightFields) {
+			return 1
+		}
+		leftNumber, leftErr := strconv.Atoi(leftFields[index])
+		rightNumber, rightErr := strconv.Atoi(rightFields[index])
+		switch {
+		case leftErr == nil && rightErr == nil && leftNumber != rightNumber:
+			if leftNumber < rightNumber {
+				return -1
+			}
+			return 1
+		case (leftErr != nil || rightErr != nil) && leftFields[index] != rightFields[index]:
+			return strings.Compare(leftFields[index], rightFields[index])
+		}
+	}
+	return 0
+}
+
+func isVersionSeparator(char rune) bool {
+	return char == '.' || char == ',' || char == ' '
+}
+
+func printDiagnosisHistory(history diagnosisHistory) {
+	fmt.Printf("[INFO] Diagnosed %d build(s) in %s\n", len(history.Builds), history.Directory)
+	fmt.Printf("[INFO] Signature database: %s\n", history.SignatureDatabase)
+	for index, name := range history.Signatures {
+		fmt.Printf("[INFO] S%d: %s\n", index+1, name)
+	}
+
+	for _, build := range history.Builds {
+		states := make([]string, 0, len(history.Signatures))
+		for index, name := range history.Signatures {
+			states = append(states, fmt.Sprintf("S%d=%s", index+1, build.Signatures[name]))
+		}
+		note := ""
+		if build.DuplicateOf != "" {
+			note = " (duplicate of " + build.DuplicateOf + ")"
+		}
+		fmt.Printf("[INFO] %s version=%s sha256=%s coverage=%d/%d %s verdict=%s%s\n",
+			build.Path, build.Version, build.SHA256, build.Coverage, build.Patchable, strings.Join(states, " "), build.VerdictLevel, note)
+	}
+
+	changed := false
+	for _, transition := range history.Transitions {
+		if len(transition.Appeared) > 0 {
+			fmt.Printf("[INFO] %s -> %s: signature(s) appeared: %s\n", transition.From, transition.To, strings.Join(transition.Appeared, ", "))
+			changed = true
+		}
+		if len(transition.Disappeared) > 0 {
+			fmt.Printf("[WARN] %s -> %s: signature(s) disappeared: %s\n", transition.From, transition.To, strings.Join(transition.Disappeared, ", "))
+			changed = true
+		}
+		if transition.VerdictFrom != transition.VerdictTo {
+			fmt.Printf("[WARN] %s -> %s: verdict changed from %s to %s\n", transition.From, transition.To, transition.VerdictFrom, transition.VerdictTo)
+			changed = true
+		}
+	}
+	if !changed && len(history.Transitions) > 0 {
+		fmt.Printf("[INFO] No signature or verdict changes between consecutive builds\n")
+	}
+}
@@ -0,0 +1,96 @@
+package edit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiagnosisHistoryOrdersBuildsAndReportsSignatureChanges(t *testing.T) {
+	workDir := t.TempDir()
+	var signature battleyePatch
+	for _, patch := range battleyePatches {
+		if patch.structuralGuard == nil && !patch.diagnosticOnly {
+			signature = patch
+			break
+		}
+	}
+	if signature.name == "" {
+		t.Skip("no plain byte signature in the built-in set")
+	}
+
+	newHistoryBuild := func(version string, withSignature bool) []byte {
+		resources, _, err := readPEResources(newResourceFixture(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := setVersionStrings(resources, map[string]string{"FileVersion": version}); err != nil {
+			t.Fatal(err)
+		}
+		tibiaBinary, _, err := writePEResources(newResourceFixture(t), resources)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if withSignature {
+			copy(tibiaBinary[0x500:], signature.original.data)
+		}
+		return tibiaBinary
+	}
+	for _, release := range []string{"14.9", "14.10", "15.0"} {
+		if err := os.Mkdir(filepath.Join(workDir, release), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeTestFile(t, filepath.Join(workDir, "15.0", "client.exe"), newHistoryBuild("15.0.0.1", false))
+	writeTestFile(t, filepath.Join(workDir, "14.9", "client.exe"), newHistoryBuild("14.9.0.3", true))
+	writeTestFile(t, filepath.Join(workDir, "14.10", "client.exe"), newHistoryBuild("14.10.0.0", true))
+	writeTestFile(t, filepath.Join(workDir, "14.10", "client - original.exe"), newHistoryBuild("14.10.0.0", true))
+	writeTestFile(t, filepath.Join(workDir, "14.10", "BKP1700000000-client.exe"), newHistoryBuild("14.10.0.0", true))
+	writeTestFile(t, filepath.Join(workDir, "14.10", "Qt6Core.dll"), newHistoryBuild("6.5.0", false))
+
+	paths, err := findHistoryExecutables(workDir, DefaultHistoryMatch)
+	if err != nil || len(paths) != 4 {
+		t.Fatalf("expected four client builds, got %v err=%v", paths, err)
+	}
+	history := buildDiagnosisHistory(workDir, paths)
+
+	versions := make([]string, 0, len(history.Builds))
+	for _, build := range history.Builds {
+		versions = append(versions, build.Version)
+	}
+	if len(versions) != 4 || versions[0] != "14.9.0.3" || versions[1] != "14.10.0.0" || versions[3] != "15.0.0.1" {
+		t.Fatalf("expected builds ordered by version, got %v", versions)
+	}
+	if history.Builds[1].DuplicateOf != "" || history.Builds[2].DuplicateOf != history.Builds[1].Path {
+		t.Fatalf("expected the second 14.10 copy to be marked as duplicate, got %+v", history.Builds[1:3])
+	}
+	if history.Builds[0].Signatures[signature.name] != "original" || history.Builds[3].Signatures[signature.name] != "absent" {
+		t.Fatalf("unexpected signature states %+v", history.Builds)
+	}
+	if len(history.Transitions) != 2 {
+		t.Fatalf("expected duplicates to be skipped in transitions, got %+v", history.Transitions)
+	}
+	last := history.Transitions[1]
+	if len(last.Disappeared) != 1 || last.Disappeared[0] != signature.name || len(last.Appeared) != 0 {
+		t.Fatalf("expected %q to disappear in 15.0, got %+v", signature.name, last)
+	}
+	if history.newest == nil || history.newest.path != history.Builds[3].Path {
+		t.Fatalf("expected the newest build to drive --strict, got %+v", history.newest)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	for _, test := range []struct {
+		left, right string
+		expected    int
+	}{
+		{"14.10.0.0", "14.9.0.3", 1},
+		{"13.40", "13.40.0", -1},
+		{"15.0.1", "15.0.1", 0},
+		{"15.0.beta", "15.0.rc", -1},
+	} {
+		if order := compareVersions(test.left, test.right); order != test.expected {
+			t.Fatalf("compareVersions(%q, %q) = %d, expected %d", test.left, test.right, order, test.expected)
+		}
+	}
+}
@@ -0,0 +1,693 @@
+package edit
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"debug/macho"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const (
+	executableFormatMachO = "Mach-O"
+
+	machOFatMagic   = 0xcafebabe
+	machOFatMagic64 = 0xcafebabf
+	machOMaxFatArch = 16
+
+	machOLoadCodeSignature  = 0x1d
+	machOLoadFunctionStarts = 0x26
+
+	machOSectionTypeMask            = 0xff
+	machOSectionZeroFill            = 0x01
+	machOSectionGBZeroFill          = 0x0c
+	machOSectionThreadLocalZeroFill = 0x12
+	machOSectionCodeAttributes      = 0x80000400
+	machOProtWrite                  = 0x2
+
+	codeSignSuperBlobMagic     = 0xfade0cc0
+	codeSignCodeDirectoryMagic = 0xfade0c02
+	codeSignRequirementsMagic  = 0xfade0c01
+	codeSignBlobWrapperMagic   = 0xfade0b01
+
+	codeSignSlotCodeDirectory        = 0
+	codeSignSlotInfoPlist            = 1
+	codeSignSlotRequirements         = 2
+	codeSignSlotResourceDirectory    = 3
+	codeSignSlotEntitlements         = 5
+	codeSignSlotDEREntitlements      = 7
+	codeSignSlotAlternateDirectories = 0x1000
+	codeSignSlotSignature            = 0x10000
+
+	codeSignHashSHA1          = 1
+	codeSignHashSHA256        = 2
+	codeSignHashSHA256Trunc   = 3
+	codeSignAdhocFlag         = 0x2
+	codeSignExecSegMainBinary = 0x1
+	codeSignPageSizeLog2      = 12
+	codeSignDirectoryVersion  = 0x20400
+	codeSignDirectoryHeader   = 88
+)
+
+var errMachONoCodeSignature = errors.New("no LC_CODE_SIGNATURE load command")
+
+type machOSlice struct {
+	arch  string
+	start int
+	end   int
+}
+
+type machOCodeSignatureStatus struct {
+	present         bool
+	adhoc           bool
+	identifier      string
+	hashType        string
+	pages           int
+	mismatchedPages int
+	errorText       string
+}
+
+type machOSliceReport struct {
+	slice         machOSlice
+	codeSignature machOCodeSignatureStatus
+}
+
+type machOCodeSignatureLocation struct {
+	dataOffset int
+	dataSize   int
+}
+
+func isMachOExecutable(tibiaBinary []byte) bool {
+	if len(tibiaBinary) < 8 {
+		return false
+	}
+	switch binary.LittleEndian.Uint32(tibiaBinary[:4]) {
+	case macho.Magic32, macho.Magic64:
+		return true
+	}
+	return isFatMachO(tibiaBinary)
+}
+
+func isFatMachO(tibiaBinary []byte) bool {
+	if len(tibiaBinary) < 8 {
+		return false
+	}
+	magic := binary.BigEndian.Uint32(tibiaBinary[:4])
+	archCount := binary.BigEndian.Uint32(tibiaBinary[4:8])
+	return (magic == machOFatMagic || magic == machOFatMagic64) && archCount > 0 && archCount <= machOMaxFatArch
+}
+
+// executableSlices returns the architecture slices of a universal Mach-O
+// binary. Any other executable is returned as one slice covering the file.
+func executableSlices(tibiaBinary []byte) []machOSlice {
+	if isFatMachO(tibiaBinary) {
+		if slices, err := machOFatSlices(tibiaBinary); err == nil {
+			return slices
+		}
+	}
+
+	arch := ""
+	if isMachOExecutable(tibiaBinary) {
+		if machoFile, err := macho.NewFile(bytes.NewReader(tibiaBinary)); err == nil {
+			arch = machOArchName(machoFile.Cpu)
+		}
+	}
+	return []machOSlice{{arch: arch, start: 0, end: len(tibiaBinary)}}
+}
+
+func machOFatSlices(tibiaBinary []byte) ([]machOSlice, error) {
+	magic := binary.BigEndian.Uint32(tibiaBinary[:4])
+	archCount := int(binary.BigEndian.Uint32(tibiaBinary[4:8]))
+	entrySize := 20
+	if magic == machOFatMagic64 {
+		entrySize = 32
+	}
+	if 8+archCount*entrySize > len(tibiaBinary) {
+		return nil, fmt.Errorf("truncated universal header")
+	}
+
+	slices := make([]machOSlice, 0, archCount)
+	for index := 0; index < archCount; index++ {
+		entry := tibiaBinary[8+index*entrySize : 8+(index+1)*entrySize]
+		cpu := macho.Cpu(binary.BigEndian.Uint32(entry[0:4]))
+		var start, size int
+		if magic == machOFatMagic64 {
+			start = int(binary.BigEndian.Uint64(entry[8:16]))
+			size = int(binary.BigEndian.Uint64(entry[16:24]))
+		} else {
+			start = int(binary.BigEndian.Uint32(entry[8:12]))
+			size = int(binary.BigEndian.Uint32(entry[12:16]))
+		}
+		if start <= 0 || size <= 0 || start+size > len(tibiaBinary) {
+			return nil, fmt.Errorf("universal slice %d is outside the file", index)
+		}
+		slices = append(slices, machOSlice{arch: machOArchName(cpu), start: start, end: start + size})
+	}
+	sort.Slice(slices, func(left, right int) bool {
+		return slices[left].start < slices[right].start
+	})
+	return slices, nil
+}
+
+func machOArchName(cpu macho.Cpu) string {
+	switch cpu {
+	case macho.CpuAmd64:
+		return "x86_64"
+	case macho.CpuArm64:
+		return "arm64"
+	case macho.Cpu386:
+		return "i386"
+	case macho.CpuArm:
+		return "arm"
+	default:
+		return fmt.Sprintf("cpu-0x%X", uint32(cpu))
+	}
+}
+
+func (slice machOSlice) label() string {
+	if slice.arch == "" {
+		return fmt.Sprintf("@0x%X", slice.start)
+	}
+	return fmt.Sprintf("%s @0x%X", slice.arch, slice.start)
+}
+
+// inspectMachO returns the layout of the x86_64 slice, since the structural
+// checks decode x86-64 code. Offsets are absolute file offsets so findAll
+// matches over the whole universal file can be validated directly.
+func inspectMachO(tibiaBinary []byte) peInfo {
+	for _, slice := range executableSlices(tibiaBinary) {
+		if slice.arch == "x86_64" {
+			return inspectMachOSlice(tibiaBinary, slice)
+		}
+	}
+	return peInfo{format: executableFormatMachO, errorText: "no x86_64 slice found"}
+}
+
+func inspectMachOSlice(tibiaBinary []byte, slice machOSlice) peInfo {
+	sliceData := tibiaBinary[slice.start:slice.end]
+	machoFile, err := macho.NewFile(bytes.NewReader(sliceData))
+	if err != nil {
+		return peInfo{format: executableFormatMachO, errorText: err.Error()}
+	}
+	defer machoFile.Close()
+
+	info := peInfo{valid: true, format: executableFormatMachO}
+	writableSegments := make(map[string]bool)
+	textSegmentAddress := 0
+	for _, load := range machoFile.Loads {
+		segment, ok := load.(*macho.Segment)
+		if !ok {
+			continue
+		}
+		writableSegments[segment.Name] = segment.Prot&machOProtWrite != 0
+		if segment.Name == "__TEXT" {
+			textSegmentAddress = int(segment.Addr)
+		}
+	}
+
+	for _, section := range machoFile.Sections {
+		switch section.Flags & machOSectionTypeMask {
+		case machOSectionZeroFill, machOSectionGBZeroFill, machOSectionThreadLocalZeroFill:
+			continue
+		}
+		rawStart := slice.start + int(section.Offset)
+		rawEnd := rawStart + int(section.Size)
+		if section.Offset == 0 || rawEnd > slice.end || rawEnd <= rawStart {
+			continue
+		}
+		info.sections = append(info.sections, peSectionInfo{
+			name:       section.Seg + "," + section.Name,
+			rawStart:   rawStart,
+			rawEnd:     rawEnd,
+			rvaStart:   int(section.Addr),
+			rvaEnd:     int(section.Addr) + int(section.Size),
+			isCode:     section.Flags&machOSectionCodeAttributes != 0,
+			isWritable: writableSegments[section.Seg],
+		})
+	}
+
+	if machoFile.Cpu == macho.CpuAmd64 {
+		if functionStarts, ok := machOLinkEditData(machoFile, machOLoadFunctionStarts); ok && functionStarts.dataOffset+functionStarts.dataSize <= len(sliceData) {
+			data := sliceData[functionStarts.dataOffset : functionStarts.dataOffset+functionStarts.dataSize]
+			info.runtimeFunctions = info.codeRuntimeFunctions(info.machOFunctionStarts(data, textSegmentAddress))
+		}
+	}
+
+	if libraries, err := machoFile.ImportedLibraries(); err == nil {
+		info.imports = append(info.imports, libraries...)
+	}
+	if symbols, err := machoFile.ImportedSymbols(); err == nil {
+		info.imports = append(info.imports, symbols...)
+	}
+	sort.Strings(info.imports)
+
+	return info
+}
+
+// machOFunctionStarts decodes LC_FUNCTION_STARTS. Each function ends where the
+// next one starts; the last one ends with its section.
+func (peData peInfo) machOFunctionStarts(data []byte, textSegmentAddress int) []peRuntimeFunction {
+	starts := make([]int, 0)
+	address := textSegmentAddress
+	for offset := 0; offset < len(data); {
+		delta, length, ok := readULEB128(data, offset)
+		if !ok || delta == 0 {
+			break
+		}
+		offset += length
+		address += delta
+		starts = append(starts, address)
+	}
+
+	functions := make([]peRuntimeFunction, 0, len(starts))
+	for index, start := range starts {
+		section, ok := peData.sectionForRVA(start)
+		if !ok {
+			continue
+		}
+		end := section.rvaEnd
+		if index+1 < len(starts) && starts[index+1] < end {
+			end = starts[index+1]
+		}
+		functions = append(functions, peRuntimeFunction{beginRVA: start, endRVA: end})
+	}
+	return functions
+}
+
+func machOLinkEditData(machoFile *macho.File, command uint32) (machOCodeSignatureLocation, bool) {
+	for _, load := range machoFile.Loads {
+		raw := load.Raw()
+		if len(raw) < 16 || machoFile.ByteOrder.Uint32(raw[0:4]) != command {
+			continue
+		}
+		return machOCodeSignatureLocation{
+			dataOffset: int(machoFile.ByteOrder.Uint32(raw[8:12])),
+			dataSize:   int(machoFile.ByteOrder.Uint32(raw[12:16])),
+		}, true
+	}
+	return machOCodeSignatureLocation{}, false
+}
+
+func inspectMachOSlices(tibiaBinary []byte) []machOSliceReport {
+	reports := make([]machOSliceReport, 0)
+	for _, slice := range executableSlices(tibiaBinary) {
+		reports = append(reports, machOSliceReport{
+			slice:         slice,
+			codeSignature: verifyMachOCodeSignature(tibiaBinary[slice.start:slice.end]),
+		})
+	}
+	return reports
+}
+
+// verifyMachOCodeSignature recomputes the code page hashes of every
+// CodeDirectory in the slice signature and counts the pages that differ.
+func verifyMachOCodeSignature(sliceData []byte) machOCodeSignatureStatus {
+	status := machOCodeSignatureStatus{}
+	machoFile, err := macho.NewFile(bytes.NewReader(sliceData))
+	if err != nil {
+		status.errorText = err.Error()
+		return status
+	}
+	defer machoFile.Close()
+
+	location, ok := machOLinkEditData(machoFile, machOLoadCodeSignature)
+	if !ok {
+		return status
+	}
+	status.present = true
+
+	blobs, err := parseCodeSignatureSuperBlob(sliceData, location)
+	if err != nil {
+		status.errorText = err.Error()
+		return status
+	}
+
+	directories := 0
+	for slot, blob := range blobs {
+		if slot != codeSignSlotCodeDirectory && (slot < codeSignSlotAlternateDirectories || slot >= codeSignSlotAlternateDirectories+5) {
+			continue
+		}
+		directory, err := parseCodeDirectory(blob)
+		if err != nil {
+			status.errorText = err.Error()
+			return status
+		}
+		directories++
+		if slot == codeSignSlotCodeDirectory || directory.hashType == codeSignHashSHA256 {
+			status.adhoc = directory.flags&codeSignAdhocFlag != 0
+			status.identifier = directory.identifier
+			status.hashType = codeSignHashName(directory.hashType)
+			status.pages = len(directory.codeHashes)
+		}
+		status.mismatchedPages += directory.mismatchedPages(sliceData)
+	}
+	if directories == 0 {
+		status.errorText = "code signature has no CodeDirectory"
+	}
+	return status
+}
+
+func (status machOCodeSignatureStatus) valid() bool {
+	return status.present && status.errorText == "" && status.pages > 0 && status.mismatchedPages == 0
+}
+
+func (status machOCodeSignatureStatus) describe() string {
+	switch {
+	case !status.present:
+		return "unsigned (no LC_CODE_SIGNATURE)"
+	case status.errorText != "":
+		return "INVALID: " + status.errorText
+	case status.mismatchedPages > 0:
+		return fmt.Sprintf("INVALID: %d/%d %s page hash(es) no longer match", status.mismatchedPages, status.pages, status.hashType)
+	case status.adhoc:
+		return fmt.Sprintf("valid ad-hoc signature %q (%d %s page hash(es))", status.identifier, status.pages, status.hashType)
+	default:
+		return fmt.Sprintf("valid signature %q (%d %s page hash(es))", status.identifier, status.pages, status.hashType)
+	}
+}
+
+type codeDirectory struct {
+	flags         uint32
+	hashType      byte
+	pageSize      int
+	codeLimit     int
+	identifier    string
+	codeHashes    [][]byte
+	specialHashes map[int][]byte
+}
+
+func parseCodeSignatureSuperBlob(sliceData []byte, location machOCodeSignatureLocation) (map[int][]byte, error) {
+	end := location.dataOffset + location.dataSize
+	if location.dataOffset <= 0 || end > len(sliceData) || location.dataSize < 12 {
+		return nil, fmt.Errorf("code signature is outside the slice")
+	}
+	data := sliceData[location.dataOffset:end]
+	if binary.BigEndian.Uint32(data[0:4]) != codeSignSuperBlobMagic {
+		return nil, fmt.Errorf("code signature super blob magic mismatch")
+	}
+	length := int(binary.BigEndian.Uint32(data[4:8]))
+	count := int(binary.BigEndian.Uint32(data[8:12]))
+	if length > len(data) || 12+count*8 > length {
+		return nil, fmt.Errorf("truncated code signature super blob")
+	}
+
+	blobs := make(map[int][]byte, count)
+	for index := 0; index < count; index++ {
+		entry := data[12+index*8 : 20+index*8]
+		slot := int(binary.BigEndian.Uint32(entry[0:4]))
+		offset := int(binary.BigEndian.Uint32(entry[4:8]))
+		if offset+8 > length {
+			return nil, fmt.Errorf("code signature blob %d is outside the super blob", slot)
+		}
+		blobLength := int(binary.BigEndian.Uint32(data[offset+4 : offset+8]))
+		if blobLength < 8 || offset+blobLength > length {
+			return nil, fmt.Errorf("code signature blob %d is truncated", slot)
+		}
+		blobs[slot] = data[offset : offset+blobLength]
+	}
+	return blobs, nil
+}
+
+func parseCodeDirectory(blob []byte) (codeDirectory, error) {
+	if len(blob) < 44 || binary.BigEndian.Uint32(blob[0:4]) != codeSignCodeDirectoryMagic {
+		return codeDirectory{}, fmt.Errorf("invalid CodeDirectory blob")
+	}
+	directory := codeDirectory{
+		flags:         binary.BigEndian.Uint32(blob[12:16]),
+		codeLimit:     int(binary.BigEndian.Uint32(blob[32:36])),
+		hashType:      blob[37],
+		specialHashes: make(map[int][]byte),
+	}
+	hashOffset := int(binary.BigEndian.Uint32(blob[16:20]))
+	identOffset := int(binary.BigEndian.Uint32(blob[20:24]))
+	specialSlots := int(binary.BigEndian.Uint32(blob[24:28]))
+	codeSlots := int(binary.BigEndian.Uint32(blob[28:32]))
+	hashSize := int(blob[36])
+	if blob[39] > 0 {
+		directory.pageSize = 1 << blob[39]
+	}
+	if hashSize == 0 || hashOffset-specialSlots*hashSize < 0 || hashOffset+codeSlots*hashSize > len(blob) {
+		return codeDirectory{}, fmt.Errorf("CodeDirectory hash slots are outside the blob")
+	}
+	if identOffset > 0 && identOffset < len(blob) {
+		if end := bytes.IndexByte(blob[identOffset:], 0); end >= 0 {
+			directory.identifier = string(blob[identOffset : identOffset+end])
+		}
+	}
+	for slot := 1; slot <= specialSlots; slot++ {
+		start := hashOffset - slot*hashSize
+		directory.specialHashes[slot] = blob[start : start+hashSize]
+	}
+	for slot := 0; slot < codeSlots; slot++ {
+		start := hashOffset + slot*hashSize
+		directory.codeHashes = append(directory.codeHashes, blob[start:start+hashSize])
+	}
+	return directory, nil
+}
+
+func (directory codeDirectory) mismatchedPages(sliceData []byte) int {
+	mismatched := 0
+	for page, expected := range directory.codeHashes {
+		start := page * directory.pageSize
+		end := start + directory.pageSize
+		if directory.pageSize == 0 {
+			start, end = 0, directory.codeLimit
+		}
+		if end > directory.codeLimit {
+			end = directory.codeLimit
+		}
+		if start > len(sliceData) || end > len(sliceData) || start > end {
+			mismatched++
+			continue
+		}
+		actual, ok := codeSignHash(directory.hashType, sliceData[start:end])
+		if !ok || !bytes.Equal(actual[:len(expected)], expected) {
+			mismatched++
+		}
+	}
+	return mismatched
+}
+
+func codeSignHash(hashType byte, data []byte) ([]byte, bool) {
+	switch hashType {
+	case codeSignHashSHA1:
+		sum := sha1.Sum(data)
+		return sum[:], true
+	case codeSignHashSHA256, codeSignHashSHA256Trunc:
+		sum := sha256.Sum256(data)
+		return sum[:], true
+	default:
+		return nil, false
+	}
+}
+
+func codeSignHashName(hashType byte) string {
+	switch hashType {
+	case codeSignHashSHA1:
+		return "sha1"
+	case codeSignHashSHA256:
+		return "sha256"
+	case codeSignHashSHA256Trunc:
+		return "sha256-truncated"
+	default:
+		return fmt.Sprintf("hash-type-%d", hashType)
+	}
+}
+
+// finalizeMachOCodeSignature re-signs every slice ad-hoc when requested, or
+// warns about each slice whose existing signature no longer matches.
+func finalizeMachOCodeSignature(tibiaBinary []byte, adhocSign bool) error {
+	for _, slice := range executableSlices(tibiaBinary) {
+		sliceData := tibiaBinary[slice.start:slice.end]
+		if adhocSign {
+			err := adhocSignMachOSlice(sliceData)
+			if errors.Is(err, errMachONoCodeSignature) {
+				fmt.Printf("[WARN] Mach-O slice %s has no LC_CODE_SIGNATURE; ad-hoc signing skipped\n", slice.label())
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("unable to ad-hoc sign Mach-O slice %s: %w", slice.label(), err)
+			}
+			fmt.Printf("[PATCH] Mach-O slice %s re-signed ad-hoc: %s\n", slice.label(), verifyMachOCodeSignature(sliceData).describe())
+			continue
+		}
+
+		status := verifyMachOCodeSignature(sliceData)
+		if status.present && !status.valid() {
+			fmt.Printf("[WARN] Mach-O slice %s code signature is now %s\n", slice.label(), status.describe())
+			fmt.Printf("[WARN] macOS refuses to launch arm64 code with an invalid signature; re-run with --macho-adhoc-sign or run codesign --force --sign - on the app\n")
+		}
+	}
+	return nil
+}
+
+// adhocSignMachOSlice replaces the slice signature in place with an ad-hoc
+// SHA-256 signature. The LC_CODE_SIGNATURE size is kept so the load commands
+// and __LINKEDIT layout stay untouched; unused space is zero filled. The
+// Info.plist and CodeResources hashes and the entitlement blobs are carried
+// over from the previous signature when present.
+func adhocSignMachOSlice(sliceData []byte) error {
+	machoFile, err := macho.NewFile(bytes.NewReader(sliceData))
+	if err != nil {
+		return err
+	}
+	defer machoFile.Close()
+
+	location, ok := machOLinkEditData(machoFile, machOLoadCodeSignature)
+	if !ok {
+		return errMachONoCodeSignature
+	}
+	if location.dataOffset <= 0 || location.dataOffset+location.dataSize > len(sliceData) {
+		return fmt.Errorf("code signature is outside the slice")
+	}
+
+	identifier := "client"
+	specialHashes := make(map[int][]byte)
+	carriedBlobs := make(map[int][]byte)
+	if blobs, err := parseCodeSignatureSuperBlob(sliceData, location); err == nil {
+		for slot, blob := range blobs {
+			switch {
+			case slot == codeSignSlotEntitlements || slot == codeSignSlotDEREntitlements:
+				carriedBlobs[slot] = append([]byte(nil), blob...)
+			case slot == codeSignSlotCodeDirectory || (slot >= codeSignSlotAlternateDirectories && slot < codeSignSlotAlternateDirectories+5):
+				directory, err := parseCodeDirectory(blob)
+				if err != nil {
+					continue
+				}
+				if directory.identifier != "" {
+					identifier = directory.identifier
+				}
+				if directory.hashType != codeSignHashSHA256 {
+					continue
+				}
+				for _, specialSlot := range []int{codeSignSlotInfoPlist, codeSignSlotResourceDirectory} {
+					if hash, ok := directory.specialHashes[specialSlot]; ok && !isZeroBytes(hash) {
+						specialHashes[specialSlot] = append([]byte(nil), hash...)
+					}
+				}
+			}
+		}
+	}
+
+	requirements := make([]byte, 12)
+	binary.BigEndian.PutUint32(requirements[0:4], codeSignRequirementsMagic)
+	binary.BigEndian.PutUint32(requirements[4:8], 12)
+	requirementsHash := sha256.Sum256(requirements)
+	specialHashes[codeSignSlotRequirements] = requirementsHash[:]
+	for slot, blob := range carriedBlobs {
+		hash := sha256.Sum256(blob)
+		specialHashes[slot] = hash[:]
+	}
+
+	execSegmentBase, execSegmentLimit := uint64(0), uint64(0)
+	if segment := machoFile.Segment("__TEXT"); segment != nil {
+		execSegmentBase, execSegmentLimit = segment.Offset, segment.Filesz
+	}
+	execSegmentFlags := uint64(0)
+	if machoFile.Type == macho.TypeExec {
+		execSegmentFlags = codeSignExecSegMainBinary
+	}
+
+	directory := buildAdhocCodeDirectory(sliceData[:location.dataOffset], identifier, specialHashes, execSegmentBase, execSegmentLimit, execSegmentFlags)
+	signatureWrapper := make([]byte, 8)
+	binary.BigEndian.PutUint32(signatureWrapper[0:4], codeSignBlobWrapperMagic)
+	binary.BigEndian.PutUint32(signatureWrapper[4:8], 8)
+
+	blobs := map[int][]byte{
+		codeSignSlotCodeDirectory: directory,
+		codeSignSlotRequirements:  requirements,
+		codeSignSlotSignature:     signatureWrapper,
+	}
+	for slot, blob := range carriedBlobs {
+		blobs[slot] = blob
+	}
+	superBlob := buildCodeSignatureSuperBlob(blobs)
+	if len(superBlob) > location.dataSize {
+		return fmt.Errorf("ad-hoc signature needs %d bytes but LC_CODE_SIGNATURE only reserves %d", len(superBlob), location.dataSize)
+	}
+
+	signatureArea := sliceData[location.dataOffset : location.dataOffset+location.dataSize]
+	for index := range signatureArea {
+		signatureArea[index] = 0
+	}
+	copy(signatureArea, superBlob)
+	return nil
+}
+
+func buildAdhocCodeDirectory(signedData []byte, identifier string, specialHashes map[int][]byte, execSegmentBase uint64, execSegmentLimit uint64, execSegmentFlags uint64) []byte {
+	const hashSize = sha256.Size
+	pageSize := 1 << codeSignPageSizeLog2
+	codeSlots := (len(signedData) + pageSize - 1) / pageSize
+	specialSlots := 0
+	for slot := range specialHashes {
+		if slot > specialSlots {
+			specialSlots = slot
+		}
+	}
+
+	identOffset := codeSignDirectoryHeader
+	hashOffset := identOffset + len(identifier) + 1 + specialSlots*hashSize
+	directory := make([]byte, hashOffset+codeSlots*hashSize)
+	binary.BigEndian.PutUint32(directory[0:4], codeSignCodeDirectoryMagic)
+	binary.BigEndian.PutUint32(directory[4:8], uint32(len(directory)))
+	binary.BigEndian.PutUint32(directory[8:12], codeSignDirectoryVersion)
+	binary.BigEndian.PutUint32(directory[12:16], codeSignAdhocFlag)
+	binary.BigEndian.PutUint32(directory[16:20], uint32(hashOffset))
+	binary.BigEndian.PutUint32(directory[20:24], uint32(identOffset))
+	binary.BigEndian.PutUint32(directory[24:28], uint32(specialSlots))
+	binary.BigEndian.PutUint32(directory[28:32], uint32(codeSlots))
+	binary.BigEndian.PutUint32(directory[32:36], uint32(len(signedData)))
+	directory[36] = hashSize
+	directory[37] = codeSignHashSHA256
+	directory[39] = codeSignPageSizeLog2
+	binary.BigEndian.PutUint64(directory[64:72], execSegmentBase)
+	binary.BigEndian.PutUint64(directory[72:80], execSegmentLimit)
+	binary.BigEndian.PutUint64(directory[80:88], execSegmentFlags)
+	copy(directory[identOffset:], identifier)
+
+	for slot, hash := range specialHashes {
+		copy(directory[hashOffset-slot*hashSize:], hash)
+	}
+	for page := 0; page < codeSlots; page++ {
+		start := page * pageSize
+		end := start + pageSize
+		if end > len(signedData) {
+			end = len(signedData)
+		}
+		hash := sha256.Sum256(signedData[start:end])
+		copy(directory[hashOffset+page*hashSize:], hash[:])
+	}
+	return directory
+}
+
+func buildCodeSignatureSuperBlob(blobs map[int][]byte) []byte {
+	slots := make([]int, 0, len(blobs))
+	for slot := range blobs {
+		slots = append(slots, slot)
+	}
+	sort.Ints(slots)
+
+	headerLength := 12 + len(slots)*8
+	superBlob := make([]byte, headerLength)
+	binary.BigEndian.PutUint32(superBlob[0:4], codeSignSuperBlobMagic)
+	binary.BigEndian.PutUint32(superBlob[8:12], uint32(len(slots)))
+	for index, slot := range slots {
+		binary.BigEndian.PutUint32(superBlob[12+index*8:16+index*8], uint32(slot))
+		binary.BigEndian.PutUint32(superBlob[16+index*8:20+index*8], uint32(len(superBlob)))
+		superBlob = append(superBlob, blobs[slot]...)
+	}
+	binary.BigEndian.PutUint32(superBlob[4:8], uint32(len(superBlob)))
+	return superBlob
+}
+
+func isZeroBytes(data []byte) bool {
+	for _, value := range data {
+		if value != 0 {
+			return false
+		}
+	}
+	return true
+}
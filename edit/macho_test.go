@@ -0,0 +1,168 @@
+package edit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+const (
+	machOTestSliceSize     = 0x3000
+	machOTestTextAddress   = 0x100000000
+	machOTestStringsOffset = 0x1100
+	machOTestSignature     = 0x2010
+)
+
+func TestExecutableSlicesSplitsUniversalMachO(t *testing.T) {
+	tibiaBinary := newUniversalMachOBinary(t, []byte("TIBIA-RSA-KEY\x00"))
+
+	slices := executableSlices(tibiaBinary)
+
+	if len(slices) != 2 {
+		t.Fatalf("expected two universal slices, got %+v", slices)
+	}
+	if slices[0].arch != "x86_64" || slices[0].start != 0x1000 || slices[0].end != 0x4000 {
+		t.Fatalf("unexpected x86_64 slice %+v", slices[0])
+	}
+	if slices[1].arch != "arm64" || slices[1].start != 0x4000 || slices[1].end != 0x7000 {
+		t.Fatalf("unexpected arm64 slice %+v", slices[1])
+	}
+}
+
+func TestInspectMachOUsesX86SliceWithAbsoluteOffsets(t *testing.T) {
+	tibiaBinary := newUniversalMachOBinary(t, []byte("clientcheck_disconnected\x00"))
+
+	peData := inspectExecutable(tibiaBinary)
+
+	if !peData.valid || peData.format != executableFormatMachO {
+		t.Fatalf("expected a valid Mach-O layout, got %+v", peData)
+	}
+	text, ok := peData.sectionForOffset(0x1000 + 0x1000)
+	if !ok || text.name != "__TEXT,__text" || !text.isCode || text.rvaStart != machOTestTextAddress+0x1000 {
+		t.Fatalf("expected x86_64 __text at absolute file offset 0x2000, got %+v ok=%t", text, ok)
+	}
+	function, ok := peData.runtimeFunctionContainingRVA(machOTestTextAddress + 0x1050)
+	if !ok || function.beginRVA != machOTestTextAddress+0x1040 || function.endRVA != machOTestTextAddress+0x1100 {
+		t.Fatalf("expected LC_FUNCTION_STARTS function ending with __text, got %+v ok=%t", function, ok)
+	}
+}
+
+func TestReplaceRSAKeyInSlicesRekeysEveryMachOSlice(t *testing.T) {
+	tibiaBinary := newUniversalMachOBinary(t, []byte("TIBIA-RSA-KEY\x00"))
+
+	patched, ok := replaceRSAKeyInSlices(tibiaBinary, []byte("TIBIA-RSA-KEY"), []byte("OTSRV-RSA-KEY"))
+
+	if !ok {
+		t.Fatal("expected the RSA key to be found")
+	}
+	if bytes.Contains(patched, []byte("TIBIA-RSA-KEY")) {
+		t.Fatal("expected every slice to be re-keyed")
+	}
+	if got := len(findAllOffsets(patched, []byte("OTSRV-RSA-KEY"))); got != 2 {
+		t.Fatalf("expected one replacement per slice, got %d", got)
+	}
+}
+
+func TestAdhocSignMachOSliceRestoresValidSignatureAfterPatching(t *testing.T) {
+	tibiaBinary := newMachOSlice(t, 0x01000007, []byte("[URLS]\nloginWebService=https://www.tibia.com/login\n"))
+	if err := adhocSignMachOSlice(tibiaBinary); err != nil {
+		t.Fatalf("unable to sign fixture: %s", err)
+	}
+	if status := verifyMachOCodeSignature(tibiaBinary); !status.valid() || !status.adhoc || status.pages != 3 {
+		t.Fatalf("expected a valid three-page ad-hoc signature, got %+v", status)
+	}
+
+	if !setPropertyByName(tibiaBinary, "loginWebService", "http://127.0.0.1/login") {
+		t.Fatal("expected loginWebService to be patched")
+	}
+	status := verifyMachOCodeSignature(tibiaBinary)
+	if status.valid() || status.mismatchedPages != 1 {
+		t.Fatalf("expected the patched page to invalidate the signature, got %+v", status)
+	}
+
+	if err := adhocSignMachOSlice(tibiaBinary); err != nil {
+		t.Fatalf("unable to re-sign fixture: %s", err)
+	}
+	if status := verifyMachOCodeSignature(tibiaBinary); !status.valid() || status.identifier != "client" {
+		t.Fatalf("expected re-signed slice to verify, got %+v", status)
+	}
+}
+
+func newUniversalMachOBinary(t *testing.T, strings []byte) []byte {
+	t.Helper()
+	tibiaBinary := make([]byte, 0x1000, 0x7000)
+	binary.BigEndian.PutUint32(tibiaBinary[0:4], machOFatMagic)
+	binary.BigEndian.PutUint32(tibiaBinary[4:8], 2)
+	for index, cpu := range []uint32{0x01000007, 0x0100000c} {
+		entry := tibiaBinary[8+index*20:]
+		binary.BigEndian.PutUint32(entry[0:4], cpu)
+		binary.BigEndian.PutUint32(entry[8:12], uint32(0x1000+index*machOTestSliceSize))
+		binary.BigEndian.PutUint32(entry[12:16], machOTestSliceSize)
+		binary.BigEndian.PutUint32(entry[16:20], 12)
+		tibiaBinary = append(tibiaBinary, newMachOSlice(t, cpu, strings)...)
+	}
+	return tibiaBinary
+}
+
+// newMachOSlice builds a 64-bit MH_EXECUTE slice with __TEXT,__text at 0x1000,
+// __TEXT,__cstring at 0x1100, function starts at 0x2000 and an empty
+// LC_CODE_SIGNATURE area at 0x2010 inside __LINKEDIT.
+func newMachOSlice(t *testing.T, cpu uint32, strings []byte) []byte {
+	t.Helper()
+	const segmentCommandSize = 72
+	const sectionSize = 80
+	slice := make([]byte, machOTestSliceSize)
+
+	binary.LittleEndian.PutUint32(slice[0:], 0xfeedfacf)
+	binary.LittleEndian.PutUint32(slice[4:], cpu)
+	binary.LittleEndian.PutUint32(slice[12:], 2)
+	binary.LittleEndian.PutUint32(slice[16:], 4)
+
+	offset := 32
+	writeSegment := func(name string, address uint64, fileOffset uint64, size uint64, protection uint32, sections int) {
+		command := slice[offset:]
+		binary.LittleEndian.PutUint32(command[0:], 0x19)
+		binary.LittleEndian.PutUint32(command[4:], uint32(segmentCommandSize+sections*sectionSize))
+		copy(command[8:24], name)
+		binary.LittleEndian.PutUint64(command[24:], address)
+		binary.LittleEndian.PutUint64(command[32:], size)
+		binary.LittleEndian.PutUint64(command[40:], fileOffset)
+		binary.LittleEndian.PutUint64(command[48:], size)
+		binary.LittleEndian.PutUint32(command[56:], protection)
+		binary.LittleEndian.PutUint32(command[60:], protection)
+		binary.LittleEndian.PutUint32(command[64:], uint32(sections))
+		offset += segmentCommandSize
+	}
+	writeSection := func(name string, fileOffset uint32, size uint64, flags uint32) {
+		section := slice[offset:]
+		copy(section[0:16], name)
+		copy(section[16:32], "__TEXT")
+		binary.LittleEndian.PutUint64(section[32:], machOTestTextAddress+uint64(fileOffset))
+		binary.LittleEndian.PutUint64(section[40:], size)
+		binary.LittleEndian.PutUint32(section[48:], fileOffset)
+		binary.LittleEndian.PutUint32(section[64:], flags)
+		offset += sectionSize
+	}
+	writeLinkEditData := func(command uint32, dataOffset uint32, dataSize uint32) {
+		binary.LittleEndian.PutUint32(slice[offset:], command)
+		binary.LittleEndian.PutUint32(slice[offset+4:], 16)
+		binary.LittleEndian.PutUint32(slice[offset+8:], dataOffset)
+		binary.LittleEndian.PutUint32(slice[offset+12:], dataSize)
+		offset += 16
+	}
+
+	writeSegment("__TEXT", machOTestTextAddress, 0, 0x2000, 5, 2)
+	writeSection("__text", 0x1000, 0x100, machOSectionCodeAttributes)
+	writeSection("__cstring", machOTestStringsOffset, 0x200, 0x2)
+	writeSegment("__LINKEDIT", machOTestTextAddress+0x2000, 0x2000, 0x1000, 1, 0)
+	writeLinkEditData(machOLoadFunctionStarts, 0x2000, 8)
+	writeLinkEditData(machOLoadCodeSignature, machOTestSignature, machOTestSliceSize-machOTestSignature)
+	binary.LittleEndian.PutUint32(slice[20:], uint32(offset-32))
+
+	for index := 0x1000; index < 0x1100; index++ {
+		slice[index] = 0x90
+	}
+	copy(slice[machOTestStringsOffset:], strings)
+	copy(slice[0x2000:], []byte{0x80, 0x20, 0x40, 0x00})
+	return slice
+}
@@ -0,0 +1,330 @@
+package edit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PatcherOptions configures a Patcher. Unlike the edit command it does not
+// read config.toml; every input is passed explicitly.
+type PatcherOptions struct {
+	// TargetExe is the client Apply writes and Diagnose inspects.
+	TargetExe string
+	// SourceExe is the pristine input for Plan and Apply. It defaults to
+	// "client - original.exe" beside TargetExe when present, else TargetExe.
+	SourceExe string
+	// TibiaRSAKeyPath and RSAKeyPath default to tibia_rsa.key and
+	// DefaultRSAKeyPath in the working directory.
+	TibiaRSAKeyPath string
+	RSAKeyPath      string
+	// ConfigValues overrides embedded config keys by name, whatever their
+	// section. Keys that are not set keep the client default.
+	ConfigValues map[string]string
+	// ConfigSections overrides embedded config keys of one [SECTION], keyed
+	// by section and then key. It wins over ConfigValues for the same key.
+	ConfigSections map[string]map[string]string
+	// Patches are applied after the BattlEye signatures, in order.
+	Patches []UserPatch
+	// Strings are replaced after the URLs, in order.
+	Strings []StringReplacement
+	// Branding rewrites the icon, manifest and version strings of Windows
+	// clients before the URLs are patched.
+	Branding Branding
+	// Signatures replaces the BattlEye signatures, client-check indicators
+	// and code patterns for this Patcher. Nil keeps the built-in set, or the
+	// set the CLI activated with LoadSignatureDatabase.
+	Signatures *Signatures
+	// IgnoreHosts are hosts, and their subdomains, the post-edit host audit
+	// accepts. StrictHostAudit makes any other official host fail the
+	// export.
+	IgnoreHosts           []string
+	StrictHostAudit       bool
+	StrictClientCheck     bool
+	AggressiveClientCheck bool
+	AdhocSignMachO        bool
+	RelocateURLs          bool
+	StripSignature        bool
+	// PatchPath, when set, receives a portable patch file after Apply.
+	PatchPath string
+}
+
+// Patcher runs the edit pipeline without exiting the process. Progress is
+// still printed to stdout; failures are returned as errors.
+type Patcher struct {
+	options PatcherOptions
+}
+
+// EditResult describes an edit. BackupPath and RecordPath are only set by
+// Apply; BackupPath may name an existing identical backup.
+type EditResult struct {
+	Plan       EditPlan
+	BackupPath string
+	RecordPath string
+}
+
+// ClientCheckError is returned by Apply when the client-check gate refuses
+// the export. Strict is set when only StrictClientCheck caused the refusal.
+type ClientCheckError struct {
+	Verdict string
+	Strict  bool
+}
+
+func (err *ClientCheckError) Error() string {
+	if err.Strict {
+		return "export refused by strict client-check validation: " + err.Verdict
+	}
+	return "export refused because strong client-check evidence remains: " + err.Verdict
+}
+
+// editBuild is the in-memory result of the edit pipeline before anything is
+// written.
+type editBuild struct {
+	tibiaPath    string
+	sourcePath   string
+	sourceBinary []byte
+	tibiaBinary  []byte
+	outputSize   int
+	diagnosis    diagnosisReport
+	configSync   configINISyncPlan
+	configSyncOK bool
+	configValues map[string]string
+	hosts        []hostAuditFinding
+	plan         EditPlan
+}
+
+// URLProperties returns the stock embedded URL keys.
+func URLProperties() []string {
+	return append([]string(nil), properties...)
+}
+
+func NewPatcher(options PatcherOptions) (*Patcher, error) {
+	if options.TargetExe == "" {
+		return nil, fmt.Errorf("no target executable")
+	}
+	return &Patcher{options: options}, nil
+}
+
+// Plan runs every patch in memory and returns what Apply would change.
+func (patcher *Patcher) Plan() (EditResult, error) {
+	build, err := patcher.build(true)
+	if err != nil {
+		return EditResult{}, err
+	}
+	return EditResult{Plan: build.plan}, nil
+}
+
+// Apply patches the source, backs up the target, writes the patched client,
+// the edit record and config.ini, and optionally the patch file.
+func (patcher *Patcher) Apply() (EditResult, error) {
+	options := patcher.options
+	build, err := patcher.build(false)
+	if err != nil {
+		return EditResult{}, err
+	}
+	result := EditResult{Plan: build.plan}
+
+	backupBinary, err := backupSourceBinary(build.tibiaPath, build.sourcePath, build.sourceBinary)
+	if err != nil {
+		return result, err
+	}
+	if result.BackupPath, err = backupTibiaExecutable(build.tibiaPath, backupBinary, options.AggressiveClientCheck); err != nil {
+		return result, err
+	}
+	if err := exportModifiedFile(build.tibiaPath, build.tibiaBinary, build.outputSize); err != nil {
+		return result, err
+	}
+	result.RecordPath = writeEditRecord(build.tibiaPath, build.sourceBinary, build.tibiaBinary, build.configValues)
+	if build.configSyncOK {
+		if err := applyConfigINISync(build.configSync); err != nil {
+			return result, err
+		}
+	}
+	if options.PatchPath != "" {
+		if err := writePatchFile(options.PatchPath, newPatchFile(build.tibiaPath, build.sourceBinary, build.tibiaBinary, build.configValues)); err != nil {
+			return result, err
+		}
+	}
+	logEditSuccess(build.diagnosis, options.StrictClientCheck)
+	return result, nil
+}
+
+// Diagnose analyzes TargetExe as it is on disk. A non-empty baselineExe adds
+// a comparison with that client.
+func (patcher *Patcher) Diagnose(baselineExe string) (DiagnosisDocument, error) {
+	target, baseline, err := patcher.diagnose(baselineExe)
+	if err != nil {
+		return DiagnosisDocument{}, err
+	}
+	return newDiagnosisDocument(target, baseline), nil
+}
+
+func (patcher *Patcher) diagnose(baselineExe string) (diagnosisReport, *diagnosisReport, error) {
+	tibiaBinary, err := os.ReadFile(patcher.options.TargetExe)
+	if err != nil {
+		return diagnosisReport{}, nil, err
+	}
+	target := analyzeTibiaBinary(patcher.signatures(), patcher.options.TargetExe, tibiaBinary)
+	if baselineExe == "" {
+		return target, nil, nil
+	}
+	baselineBinary, err := os.ReadFile(baselineExe)
+	if err != nil {
+		return diagnosisReport{}, nil, err
+	}
+	baseline := analyzeTibiaBinary(patcher.signatures(), baselineExe, baselineBinary)
+	return target, &baseline, nil
+}
+
+func (patcher *Patcher) signatures() loadedSignatures {
+	if patcher.options.Signatures != nil {
+		return patcher.options.Signatures.signatures
+	}
+	return activeSignatures()
+}
+
+func (patcher *Patcher) build(dryRun bool) (editBuild, error) {
+	options := patcher.options
+	build := editBuild{tibiaPath: options.TargetExe}
+	build.sourcePath = resolveSourceExecutable(build.tibiaPath, options.SourceExe)
+	sourceBinary, err := os.ReadFile(build.sourcePath)
+	if err != nil {
+		return build, err
+	}
+	build.sourceBinary = sourceBinary
+	build.outputSize = len(sourceBinary)
+	tibiaBinary := append([]byte(nil), sourceBinary...)
+
+	if build.sourcePath != build.tibiaPath {
+		fmt.Printf("[INFO] Using source client executable for patch input: %s\n", filepath.Base(build.sourcePath))
+		fmt.Printf("[INFO] Writing patched client to target executable: %s\n", filepath.Base(build.tibiaPath))
+	}
+
+	if build.configValues, err = resolveConfigOverrides(tibiaBinary, options.ConfigValues, options.ConfigSections); err != nil {
+		return build, err
+	}
+	configValues := build.configValues
+	if tooLong := reportConfigValues(tibiaBinary, configValues); len(tooLong) > 0 && !options.RelocateURLs && !hasRelocatedURLBlock(tibiaBinary) {
+		return build, fmt.Errorf("config values longer than the stock value: %s; shorten them or use --relocate-urls", strings.Join(tooLong, ", "))
+	}
+
+	if tibiaBinary, err = rekeyClient(tibiaBinary, options.TibiaRSAKeyPath, options.RSAKeyPath); err != nil {
+		return build, err
+	}
+	if tibiaBinary, err = removeBattlEye(patcher.signatures(), build.tibiaPath, tibiaBinary, options.AggressiveClientCheck); err != nil {
+		return build, err
+	}
+	if tibiaBinary, err = applyUserPatches(tibiaBinary, options.Patches); err != nil {
+		return build, err
+	}
+	build.diagnosis = analyzeTibiaBinary(patcher.signatures(), build.tibiaPath, tibiaBinary)
+	fmt.Printf("[INFO] Client version: %s\n", build.diagnosis.version.describe())
+	logClientCheckSupportSummary(build.diagnosis)
+	if !dryRun {
+		if err := enforceEditClientCheckPolicy(build.diagnosis, options.StrictClientCheck); err != nil {
+			return build, err
+		}
+	}
+
+	// Branding runs before the URL relocation so a resource section it
+	// appends stays in front of the relocated block, which must come last.
+	brandedSize := len(tibiaBinary)
+	if tibiaBinary, err = applyBranding(tibiaBinary, options.Branding); err != nil {
+		return build, err
+	}
+	if len(tibiaBinary) != brandedSize {
+		build.outputSize = len(tibiaBinary)
+	}
+
+	substitutions := make([]propertySubstitution, 0)
+	substitutionSlices := make([]machOSlice, 0)
+	relocateURLs := hasRelocatedURLBlock(tibiaBinary)
+	if relocateURLs {
+		fmt.Printf("[INFO] Client already has a relocated URL block in %s; rebuilding it\n", urlRelocationSectionName)
+	} else if options.RelocateURLs {
+		relocateURLs = !urlsFitInPlace(tibiaBinary, configValues)
+		if !relocateURLs {
+			fmt.Printf("[INFO] Every URL fits the stock value; relocation not needed\n")
+		}
+	}
+	if relocateURLs {
+		relocatedBinary, relocation, err := relocateURLBlock(tibiaBinary, configValues)
+		if err != nil {
+			return build, fmt.Errorf("URL block relocation failed structural verification: %w", err)
+		}
+		fmt.Printf("[PATCH] URL block @0x%X (%d bytes) relocated to %s @0x%X (RVA 0x%X, %d bytes); %d reference(s) rewritten\n",
+			relocation.blockOffset, len(relocation.before), urlRelocationSectionName, relocation.sectionOffset, relocation.sectionRVA, len(relocation.after), len(relocation.references))
+		for _, substitution := range relocation.substitutions {
+			fmt.Printf("[INFO] %s=%s -> %s\n", substitution.name, substitution.before, substitution.after)
+			substitution.offset += relocation.sectionOffset
+			substitutions = append(substitutions, substitution)
+			substitutionSlices = append(substitutionSlices, machOSlice{})
+		}
+		// Appended sections and a stripped certificate table are the only
+		// size changes an edit may make.
+		build.outputSize = len(relocatedBinary)
+		tibiaBinary = relocatedBinary
+	}
+	for _, slice := range executableSlices(tibiaBinary) {
+		if relocateURLs {
+			break
+		}
+		if slice.arch != "" {
+			fmt.Printf("[INFO] Patching URLs in Mach-O slice %s\n", slice.label())
+		}
+		for _, prop := range sortedKeys(configValues) {
+			substitution, ok := replacePropertyByName(tibiaBinary[slice.start:slice.end], prop, configValues[prop])
+			if !ok {
+				fmt.Printf("[ERROR] Unable to replace %s\n", prop)
+				continue
+			}
+			substitutions = append(substitutions, substitution)
+			substitutionSlices = append(substitutionSlices, slice)
+		}
+	}
+	var stringSubstitutions []stringSubstitution
+	if tibiaBinary, stringSubstitutions, err = applyStringReplacements(tibiaBinary, options.Strings); err != nil {
+		return build, err
+	}
+	if isWindowsExecutable(build.tibiaPath, tibiaBinary) {
+		stripped := 0
+		if tibiaBinary, stripped, err = finalizePEImage(tibiaBinary, options.StripSignature); err != nil {
+			return build, err
+		}
+		build.outputSize -= stripped
+	}
+	if isMachOExecutable(tibiaBinary) {
+		if err := finalizeMachOCodeSignature(tibiaBinary, options.AdhocSignMachO); err != nil {
+			return build, err
+		}
+	}
+	build.tibiaBinary = tibiaBinary
+
+	build.configSync, build.configSyncOK, err = planConfigINISync(build.tibiaPath, build.sourceBinary, configValues)
+	if err != nil {
+		return build, err
+	}
+	configINIPath, configINI := "", []byte(nil)
+	if build.configSyncOK {
+		configINIPath, configINI = build.configSync.path, build.configSync.updated
+	}
+	build.hosts = auditEditedHosts(tibiaBinary, configINIPath, configINI, configuredHosts(configValues, options.Strings), options.IgnoreHosts)
+	logHostAudit(build.hosts)
+	if leftover := officialHosts(build.hosts); len(leftover) > 0 && options.StrictHostAudit && !dryRun {
+		return build, fmt.Errorf("export refused by strict host audit: official host(s) remain: %s; replace them or list them under [audit] ignore", strings.Join(leftover, ", "))
+	}
+
+	build.plan = newEditPlan(build.tibiaPath, build.sourcePath, dryRun, options.StrictClientCheck, build.sourceBinary, tibiaBinary, build.diagnosis)
+	for index, substitution := range substitutions {
+		build.plan.addURLSubstitution(substitutionSlices[index], substitution)
+	}
+	for _, substitution := range stringSubstitutions {
+		build.plan.addStringSubstitution(substitution)
+	}
+	if build.configSyncOK {
+		build.plan.setConfigINI(build.configSync)
+	}
+	build.plan.setHosts(build.hosts, options.StrictHostAudit)
+	return build, nil
+}
@@ -0,0 +1,66 @@
+package edit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPatcherApplyReturnsResultAndErrors(t *testing.T) {
+	workDir := t.TempDir()
+	tibiaRsa := bytes.Repeat([]byte("A"), 32)
+	otservRsa := bytes.Repeat([]byte("B"), 32)
+	tibiaKeyPath := filepath.Join(workDir, "tibia.key")
+	otservKeyPath := filepath.Join(workDir, "otserv.key")
+	writeTestFile(t, tibiaKeyPath, tibiaRsa)
+	writeTestFile(t, otservKeyPath, otservRsa)
+
+	tibiaBinary := append([]byte("header--"), tibiaRsa...)
+	tibiaBinary = append(tibiaBinary, []byte("--[URLS]\nloginWebService=https://www.tibia.com/login/service/endpoint\n\x00")...)
+	tibiaPath := filepath.Join(workDir, "client")
+	writeTestFile(t, tibiaPath, tibiaBinary)
+	urls := make(map[string]string)
+	for _, property := range URLProperties() {
+		urls[property] = "http://127.0.0.1"
+	}
+	options := PatcherOptions{TargetExe: tibiaPath, TibiaRSAKeyPath: tibiaKeyPath, RSAKeyPath: otservKeyPath, ConfigValues: urls}
+
+	if _, err := NewPatcher(PatcherOptions{}); err == nil {
+		t.Fatal("expected a missing target to be rejected")
+	}
+	incomplete, _ := NewPatcher(PatcherOptions{TargetExe: tibiaPath, TibiaRSAKeyPath: tibiaKeyPath, RSAKeyPath: otservKeyPath, ConfigValues: map[string]string{"tibiaPageUrl": "x"}})
+	if result, err := incomplete.Plan(); err != nil || len(result.Plan.URLSubstitutions) != 0 {
+		t.Fatalf("expected unset keys to keep the client default, got %+v err=%v", result.Plan.URLSubstitutions, err)
+	}
+	missingSource := options
+	missingSource.SourceExe = filepath.Join(workDir, "missing")
+	unreadable, _ := NewPatcher(missingSource)
+	if _, err := unreadable.Apply(); err == nil {
+		t.Fatal("expected an unreadable source to be reported as an error")
+	}
+
+	patcher, err := NewPatcher(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := patcher.Apply()
+	if err != nil {
+		t.Fatalf("expected the edit to succeed: %s", err)
+	}
+	patched, _ := os.ReadFile(tibiaPath)
+	if !bytes.Contains(patched, otservRsa) || !bytes.Contains(patched, []byte("loginWebService=http://127.0.0.1 ")) {
+		t.Fatalf("expected the RSA key and URL to be patched, got %q", patched)
+	}
+	if backup, _ := os.ReadFile(result.BackupPath); !bytes.Equal(backup, tibiaBinary) {
+		t.Fatalf("expected the backup %s to hold the original client", result.BackupPath)
+	}
+	if result.RecordPath != editRecordPath(tibiaPath) || result.Plan.SHA256After != sha256Hex(patched) {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	document, err := patcher.Diagnose("")
+	if err != nil || document.Target.SHA256 != sha256Hex(patched) || document.Baseline != nil {
+		t.Fatalf("expected a diagnosis of the patched client, got %+v err=%v", document.Target, err)
+	}
+}
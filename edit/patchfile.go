@@ -0,0 +1,212 @@
+package edit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	patchFileFormat  = "client-editor-patch"
+	patchFileVersion = 1
+)
+
+// patchFile is a self-describing record of one edit. It only applies to a
+// client whose SHA256 equals SourceSHA256 and must produce TargetSHA256.
+type patchFile struct {
+	Format       string              `json:"format"`
+	Version      int                 `json:"version"`
+	Executable   string              `json:"executable"`
+	Size         int                 `json:"size"`
+	TargetSize   int                 `json:"targetSize"`
+	SourceSHA256 string              `json:"sourceSha256"`
+	TargetSHA256 string              `json:"targetSha256"`
+	Runs         []patchFileRun      `json:"runs"`
+	ConfigINI    *patchFileConfigINI `json:"configIni,omitempty"`
+}
+
+type patchFileRun struct {
+	Offset int    `json:"offset"`
+	Old    string `json:"old"`
+	New    string `json:"new"`
+}
+
+// patchFileConfigINI keeps the URL values of the edit. config.ini is merged
+// again on apply because the local file can differ between machines.
+type patchFileConfigINI struct {
+	Values map[string]string `json:"values"`
+}
+
+func newPatchFile(tibiaPath string, sourceBinary []byte, tibiaBinary []byte, configValues map[string]string) patchFile {
+	sourceSum := sha256.Sum256(sourceBinary)
+	targetSum := sha256.Sum256(tibiaBinary)
+	patch := patchFile{
+		Format:       patchFileFormat,
+		Version:      patchFileVersion,
+		Executable:   filepath.Base(tibiaPath),
+		Size:         len(sourceBinary),
+		TargetSize:   len(tibiaBinary),
+		SourceSHA256: fmt.Sprintf("%x", sourceSum[:]),
+		TargetSHA256: fmt.Sprintf("%x", targetSum[:]),
+		Runs:         make([]patchFileRun, 0),
+	}
+	for _, changed := range changedByteRanges(sourceBinary, tibiaBinary, planByteChangeMergeGap) {
+		patch.Runs = append(patch.Runs, patchFileRun{
+			Offset: changed[0],
+			Old:    hex.EncodeToString(sourceBinary[changed[0]:minInt(changed[1], len(sourceBinary))]),
+			New:    hex.EncodeToString(tibiaBinary[changed[0]:minInt(changed[1], len(tibiaBinary))]),
+		})
+	}
+	if len(configValues) > 0 {
+		patch.ConfigINI = &patchFileConfigINI{Values: configValues}
+	}
+	return patch
+}
+
+func encodePatchFile(patch patchFile) ([]byte, error) {
+	patchData, err := json.MarshalIndent(patch, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode patch file: %w", err)
+	}
+	return append(patchData, '\n'), nil
+}
+
+func writePatchFile(patchPath string, patch patchFile) error {
+	patchData, err := encodePatchFile(patch)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(patchPath, patchData, 0644); err != nil {
+		return fmt.Errorf("unable to write patch file: %w", err)
+	}
+	fmt.Printf("[INFO] Patch file with %d byte run(s) exported to: %s\n", len(patch.Runs), patchPath)
+	return nil
+}
+
+func readPatchFile(patchPath string) (patchFile, error) {
+	var patch patchFile
+	patchData, err := os.ReadFile(patchPath)
+	if err != nil {
+		return patch, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(patchData))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patch); err != nil {
+		return patch, err
+	}
+	if patch.Format != patchFileFormat || patch.Version != patchFileVersion {
+		return patch, fmt.Errorf("unsupported patch format %q version %d", patch.Format, patch.Version)
+	}
+	if patch.Size <= 0 || patch.TargetSize <= 0 {
+		return patch, fmt.Errorf("patch file does not record the source and target sizes")
+	}
+	return patch, nil
+}
+
+// apply replays the byte runs onto sourceBinary. Every run must find its old
+// bytes in place and the result must hash to TargetSHA256. Only a run that
+// ends at the end of the file may change its length, which covers a section
+// appended by --relocate-urls.
+func (patch patchFile) apply(sourceBinary []byte) ([]byte, error) {
+	sourceSum := sha256.Sum256(sourceBinary)
+	if !strings.EqualFold(fmt.Sprintf("%x", sourceSum[:]), patch.SourceSHA256) {
+		return nil, fmt.Errorf("client SHA256 %x does not match patch source SHA256 %s", sourceSum[:], patch.SourceSHA256)
+	}
+	if len(sourceBinary) != patch.Size {
+		return nil, fmt.Errorf("client size %d does not match patch size %d", len(sourceBinary), patch.Size)
+	}
+
+	tibiaBinary := append([]byte(nil), sourceBinary...)
+	for index, run := range patch.Runs {
+		oldBytes, oldErr := hex.DecodeString(run.Old)
+		newBytes, newErr := hex.DecodeString(run.New)
+		if oldErr != nil || newErr != nil || (len(oldBytes) == 0 && len(newBytes) == 0) {
+			return nil, fmt.Errorf("run %d @0x%X has invalid byte data", index, run.Offset)
+		}
+		if run.Offset < 0 || run.Offset+len(oldBytes) > len(tibiaBinary) {
+			return nil, fmt.Errorf("run %d @0x%X is outside the client", index, run.Offset)
+		}
+		if len(oldBytes) != len(newBytes) && run.Offset+len(oldBytes) != len(tibiaBinary) {
+			return nil, fmt.Errorf("run %d @0x%X changes the client size before the end of the file", index, run.Offset)
+		}
+		if !bytes.Equal(tibiaBinary[run.Offset:run.Offset+len(oldBytes)], oldBytes) {
+			return nil, fmt.Errorf("run %d @0x%X does not match the expected original bytes", index, run.Offset)
+		}
+		tibiaBinary = append(tibiaBinary[:run.Offset], append(newBytes, tibiaBinary[run.Offset+len(oldBytes):]...)...)
+	}
+
+	targetSum := sha256.Sum256(tibiaBinary)
+	if !strings.EqualFold(fmt.Sprintf("%x", targetSum[:]), patch.TargetSHA256) {
+		return nil, fmt.Errorf("patched client SHA256 %x does not match patch target SHA256 %s", targetSum[:], patch.TargetSHA256)
+	}
+	return tibiaBinary, nil
+}
+
+// ApplyPatch replays a patch file exported by edit --export-patch onto another
+// copy of the same client build.
+func ApplyPatch(tibiaExe string, sourceTibiaExe string, patchPath string) {
+	patch, err := readPatchFile(patchPath)
+	if err != nil {
+		fmt.Printf("[ERROR] Unable to read patch file %s: %s\n", patchPath, err.Error())
+		os.Exit(1)
+	}
+	fmt.Printf("[INFO] Patch %s: %d byte run(s) for %s %s -> %s\n", filepath.Base(patchPath), len(patch.Runs), patch.Executable, patch.SourceSHA256, patch.TargetSHA256)
+
+	tibiaPath := tibiaExe
+	sourcePath := resolveSourceExecutable(tibiaPath, sourceTibiaExe)
+	_, sourceBinary := readFile(sourcePath)
+	if sourcePath != tibiaPath {
+		fmt.Printf("[INFO] Using source client executable for patch input: %s\n", filepath.Base(sourcePath))
+	}
+
+	sourceSum := sha256.Sum256(sourceBinary)
+	if strings.EqualFold(fmt.Sprintf("%x", sourceSum[:]), patch.TargetSHA256) {
+		fmt.Printf("[INFO] %s already matches the patch target SHA256; client left unchanged\n", filepath.Base(sourcePath))
+	} else {
+		tibiaBinary, err := patch.apply(sourceBinary)
+		if err != nil {
+			fmt.Printf("[ERROR] Patch does not apply to %s: %s\n", sourcePath, err.Error())
+			os.Exit(1)
+		}
+		fmt.Printf("[PATCH] Applied %d byte run(s); SHA256 verified %s\n", len(patch.Runs), patch.TargetSHA256)
+
+		backupBinary, err := backupSourceBinary(tibiaPath, sourcePath, sourceBinary)
+		if err == nil {
+			_, err = backupTibiaExecutable(tibiaPath, backupBinary, false)
+		}
+		if err == nil {
+			err = exportModifiedFile(tibiaPath, tibiaBinary, patch.TargetSize)
+		}
+		if err != nil {
+			fmt.Printf("[ERROR] %s\n", err.Error())
+			os.Exit(1)
+		}
+		writeEditRecord(tibiaPath, sourceBinary, tibiaBinary, patchConfigValues(patch))
+	}
+
+	if patch.ConfigINI != nil {
+		if err := syncConfigINI(tibiaPath, sourceBinary, patch.ConfigINI.Values); err != nil {
+			fmt.Printf("[ERROR] %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+}
+
+func patchConfigValues(patch patchFile) map[string]string {
+	if patch.ConfigINI == nil {
+		return nil
+	}
+	return patch.ConfigINI.Values
+}
+
+func minInt(left int, right int) int {
+	if left < right {
+		return left
+	}
+	return right
+}
@@ -0,0 +1,83 @@
+package edit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPatchFileReplaysEditAndVerifiesHashes(t *testing.T) {
+	sourceBinary := []byte("header--AAAA--[URLS]\nloginWebService=https://www.tibia.com/login\n")
+	tibiaBinary := append([]byte(nil), sourceBinary...)
+	copy(tibiaBinary[8:], "BBBB")
+	if !setPropertyByName(tibiaBinary, "loginWebService", "http://127.0.0.1") {
+		t.Fatal("expected the fixture URL to be patched")
+	}
+
+	patch := newPatchFile("client", sourceBinary, tibiaBinary, map[string]string{"loginWebService": "http://127.0.0.1"})
+	if len(patch.Runs) != 2 || patch.Runs[0].Offset != 8 || patch.Runs[0].Old != "41414141" || patch.Runs[0].New != "42424242" {
+		t.Fatalf("unexpected patch runs %+v", patch.Runs)
+	}
+
+	patched, err := patch.apply(sourceBinary)
+	if err != nil || !bytes.Equal(patched, tibiaBinary) {
+		t.Fatalf("expected the patch to reproduce the edited client, err=%v", err)
+	}
+	if _, err := patch.apply(tibiaBinary); err == nil || !strings.Contains(err.Error(), "does not match patch source SHA256") {
+		t.Fatalf("expected a source hash mismatch, got %v", err)
+	}
+
+	tampered := patch
+	tampered.Runs = append([]patchFileRun(nil), patch.Runs...)
+	tampered.Runs[0].New = "43434343"
+	if _, err := tampered.apply(sourceBinary); err == nil || !strings.Contains(err.Error(), "does not match patch target SHA256") {
+		t.Fatalf("expected a target hash mismatch, got %v", err)
+	}
+}
+
+func TestApplyPatchWritesClientBackupAndConfigINI(t *testing.T) {
+	workDir := t.TempDir()
+	sourceBinary := []byte("header--AAAA--[URLS]\nloginWebService=https://www.tibia.com/login\n\x00")
+	tibiaBinary := append([]byte(nil), sourceBinary...)
+	copy(tibiaBinary[8:], "BBBB")
+	tibiaPath := filepath.Join(workDir, "client")
+	patchPath := filepath.Join(workDir, "client.patch.json")
+	writeTestFile(t, tibiaPath, sourceBinary)
+	writePatchFile(patchPath, newPatchFile(tibiaPath, sourceBinary, tibiaBinary, map[string]string{"loginWebService": "http://127.0.0.1"}))
+
+	ApplyPatch(tibiaPath, "", patchPath)
+
+	if data, _ := os.ReadFile(tibiaPath); !bytes.Equal(data, tibiaBinary) {
+		t.Fatal("expected apply-patch to export the patched client")
+	}
+	backups, _ := filepath.Glob(filepath.Join(workDir, "BKP*-client"))
+	if len(backups) != 1 {
+		t.Fatalf("expected one backup, got %v", backups)
+	}
+	configINI, err := os.ReadFile(filepath.Join(workDir, configINIFileName))
+	if err != nil || !strings.Contains(string(configINI), "loginWebService=http://127.0.0.1") {
+		t.Fatalf("expected config.ini with the patched URL, got %q err=%v", configINI, err)
+	}
+
+	ApplyPatch(tibiaPath, "", patchPath)
+	if backups, _ := filepath.Glob(filepath.Join(workDir, "BKP*-client")); len(backups) != 1 {
+		t.Fatalf("expected an already patched client to be left alone, got backups %v", backups)
+	}
+}
+
+func TestReadPatchFileRequiresRecordedSizes(t *testing.T) {
+	sourceBinary := []byte("header--AAAA--")
+	tibiaBinary := append(append([]byte(nil), sourceBinary...), ".cedit"...)
+	patch := newPatchFile("client", sourceBinary, tibiaBinary, nil)
+	if patch.Size != len(sourceBinary) || patch.TargetSize != len(tibiaBinary) {
+		t.Fatalf("expected the source and target sizes to be recorded, got %d and %d", patch.Size, patch.TargetSize)
+	}
+
+	patchPath := filepath.Join(t.TempDir(), "client.patch.json")
+	writeTestFile(t, patchPath, []byte(`{"format":"client-editor-patch","version":1,"executable":"client","size":14,"sourceSha256":"","targetSha256":"","runs":[]}`))
+	if _, err := readPatchFile(patchPath); err == nil || !strings.Contains(err.Error(), "target sizes") {
+		t.Fatalf("expected a patch file without targetSize to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package edit
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// peChecksumFieldOffset is the offset of CheckSum in both optional header
+// layouts.
+const peChecksumFieldOffset = 64
+
+// peIntegrity records the PE checksum and the Authenticode certificate table
+// of a Windows executable.
+type peIntegrity struct {
+	valid             bool
+	storedChecksum    uint32
+	computedChecksum  uint32
+	certificateOffset int
+	certificateSize   int
+}
+
+func inspectPEIntegrity(tibiaBinary []byte) peIntegrity {
+	layout, err := readPEHeaderLayout(tibiaBinary)
+	if err != nil {
+		return peIntegrity{}
+	}
+	checksumOffset := layout.optionalHeaderOffset + peChecksumFieldOffset
+	integrity := peIntegrity{
+		valid:            true,
+		storedChecksum:   binary.LittleEndian.Uint32(tibiaBinary[checksumOffset:]),
+		computedChecksum: peChecksum(tibiaBinary, checksumOffset),
+	}
+	integrity.certificateOffset, integrity.certificateSize, _ = layout.dataDirectory(tibiaBinary, peSecurityDirectoryIndex)
+	return integrity
+}
+
+// checksumValid reports whether the stored checksum matches the file. A
+// zero checksum means the linker never set one and is not checked.
+func (integrity peIntegrity) checksumValid() bool {
+	return integrity.storedChecksum == 0 || integrity.storedChecksum == integrity.computedChecksum
+}
+
+func (integrity peIntegrity) signed() bool {
+	return integrity.certificateSize > 0
+}
+
+func (integrity peIntegrity) describeChecksum() string {
+	switch {
+	case integrity.storedChecksum == 0:
+		return fmt.Sprintf("not set (computed 0x%08X)", integrity.computedChecksum)
+	case integrity.checksumValid():
+		return fmt.Sprintf("valid (0x%08X)", integrity.storedChecksum)
+	default:
+		return fmt.Sprintf("stale (stored 0x%08X, computed 0x%08X)", integrity.storedChecksum, integrity.computedChecksum)
+	}
+}
+
+func (integrity peIntegrity) describeSignature() string {
+	if !integrity.signed() {
+		return "not signed"
+	}
+	return fmt.Sprintf("certificate table present (%d bytes @0x%X)", integrity.certificateSize, integrity.certificateOffset)
+}
+
+// peChecksum computes the image checksum the way the Windows loader does: a
+// 16-bit ones' complement sum of the file with the CheckSum field skipped,
+// plus the file length.
+func peChecksum(tibiaBinary []byte, checksumOffset int) uint32 {
+	var sum uint32
+	for offset := 0; offset < len(tibiaBinary); offset += 2 {
+		if offset == checksumOffset || offset == checksumOffset+2 {
+			continue
+		}
+		word := uint32(tibiaBinary[offset])
+		if offset+1 < len(tibiaBinary) {
+			word |= uint32(tibiaBinary[offset+1]) << 8
+		}
+		sum += word
+		sum = (sum & 0xffff) + (sum >> 16)
+	}
+	return sum + uint32(len(tibiaBinary))
+}
+
+// updatePEChecksum rewrites a stale checksum in place and returns the old and
+// new values. Checksums the linker left at zero are kept.
+func updatePEChecksum(tibiaBinary []byte) (uint32, uint32, bool) {
+	layout, err := readPEHeaderLayout(tibiaBinary)
+	if err != nil {
+		return 0, 0, false
+	}
+	checksumOffset := layout.optionalHeaderOffset + peChecksumFieldOffset
+	stored := binary.LittleEndian.Uint32(tibiaBinary[checksumOffset:])
+	computed := peChecksum(tibiaBinary, checksumOffset)
+	if stored == 0 || stored == computed {
+		return stored, stored, false
+	}
+	binary.LittleEndian.PutUint32(tibiaBinary[checksumOffset:], computed)
+	return stored, computed, true
+}
+
+// stripAuthenticodeSignature removes the certificate table from the end of
+// the file and clears the security directory. It returns the number of bytes
+// removed; a certificate table that is not the last thing in the file is
+// refused so no overlay data is lost.
+func stripAuthenticodeSignature(tibiaBinary []byte) ([]byte, int, error) {
+	layout, err := readPEHeaderLayout(tibiaBinary)
+	if err != nil {
+		return nil, 0, err
+	}
+	certificateOffset, certificateSize, entryOffset := layout.dataDirectory(tibiaBinary, peSecurityDirectoryIndex)
+	if certificateSize == 0 {
+		return tibiaBinary, 0, nil
+	}
+	if certificateOffset+certificateSize != len(tibiaBinary) {
+		return nil, 0, fmt.Errorf("certificate table @0x%X (%d bytes) is not at the end of the file", certificateOffset, certificateSize)
+	}
+	copy(tibiaBinary[entryOffset:entryOffset+8], make([]byte, 8))
+	return tibiaBinary[:certificateOffset], certificateSize, nil
+}
+
+// finalizePEImage runs after every byte patch. It strips the certificate
+// table when asked, warns about a signature the edit invalidated and
+// recomputes the checksum. It returns the number of bytes stripped.
+func finalizePEImage(tibiaBinary []byte, stripSignature bool) ([]byte, int, error) {
+	stripped := 0
+	if integrity := inspectPEIntegrity(tibiaBinary); integrity.signed() {
+		if !stripSignature {
+			fmt.Printf("[WARN] The Authenticode signature (%d bytes @0x%X) no longer matches the edited client; use --strip-signature to remove it\n", integrity.certificateSize, integrity.certificateOffset)
+		} else {
+			var err error
+			if tibiaBinary, stripped, err = stripAuthenticodeSignature(tibiaBinary); err != nil {
+				return nil, 0, fmt.Errorf("unable to strip the Authenticode signature: %w", err)
+			}
+			fmt.Printf("[PATCH] Authenticode certificate table @0x%X (%d bytes) stripped\n", integrity.certificateOffset, stripped)
+		}
+	}
+	if before, after, ok := updatePEChecksum(tibiaBinary); ok {
+		fmt.Printf("[PATCH] PE checksum 0x%08X -> 0x%08X\n", before, after)
+	}
+	return tibiaBinary, stripped, nil
+}
@@ -0,0 +1,52 @@
+package edit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestPEChecksumSkipsFieldAndFoldsCarries(t *testing.T) {
+	data := []byte{0xff, 0xff, 0x01, 0x00, 0xaa, 0xbb, 0xcc, 0xdd, 0x02}
+	// 0xFFFF + 0x0001 folds to 0x0001; the field at 4 is skipped; the odd
+	// trailing byte counts as 0x0002; the length adds 9.
+	if checksum := peChecksum(data, 4); checksum != 0x0003+9 {
+		t.Fatalf("expected checksum 0x%X, got 0x%X", 0x0003+9, checksum)
+	}
+}
+
+func TestFinalizePEImageStripsCertificateAndRecomputesChecksum(t *testing.T) {
+	tibiaBinary := newRelocationFixture(t)
+	tibiaBinary = append(tibiaBinary, bytes.Repeat([]byte{0xcc}, 0x10)...)
+	setFixtureDataDirectory(tibiaBinary, peSecurityDirectoryIndex, 0x800, 0x10)
+	binary.LittleEndian.PutUint32(tibiaBinary[0x98+peChecksumFieldOffset:], 0x1234)
+
+	integrity := inspectPEIntegrity(tibiaBinary)
+	if !integrity.valid || integrity.checksumValid() || !integrity.signed() || integrity.certificateOffset != 0x800 {
+		t.Fatalf("expected a stale checksum and a certificate @0x800, got %+v", integrity)
+	}
+
+	unsigned, stripped, err := finalizePEImage(append([]byte(nil), tibiaBinary...), false)
+	if err != nil || stripped != 0 || len(unsigned) != len(tibiaBinary) || !inspectPEIntegrity(unsigned).checksumValid() {
+		t.Fatalf("expected only the checksum to change without --strip-signature, stripped=%d err=%v", stripped, err)
+	}
+
+	finalized, stripped, err := finalizePEImage(tibiaBinary, true)
+	if err != nil || stripped != 0x10 || len(finalized) != 0x800 {
+		t.Fatalf("expected the 16-byte certificate table to be stripped, got %d bytes stripped, length 0x%X, err=%v", stripped, len(finalized), err)
+	}
+	integrity = inspectPEIntegrity(finalized)
+	if integrity.signed() || !integrity.checksumValid() || integrity.storedChecksum != peChecksum(finalized, 0x98+peChecksumFieldOffset) {
+		t.Fatalf("expected an unsigned client with a valid checksum, got %+v", integrity)
+	}
+}
+
+func TestStripAuthenticodeSignatureRefusesTrailingOverlay(t *testing.T) {
+	tibiaBinary := newRelocationFixture(t)
+	tibiaBinary = append(tibiaBinary, bytes.Repeat([]byte{0xcc}, 0x20)...)
+	setFixtureDataDirectory(tibiaBinary, peSecurityDirectoryIndex, 0x800, 0x10)
+
+	if _, _, err := stripAuthenticodeSignature(tibiaBinary); err == nil {
+		t.Fatalf("expected a certificate table followed by overlay data to be refused")
+	}
+}
@@ -0,0 +1,325 @@
+package edit
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+const (
+	planByteChangeMergeGap = 8
+	planMaxWindowBytes     = 512
+)
+
+// EditPlan is everything an edit run changes, collected in memory before any
+// file is written. It is printed for --dry-run and written as JSON for
+// --plan-json.
+type EditPlan struct {
+	TibiaExe         string                    `json:"tibiaExe"`
+	SourceExe        string                    `json:"sourceExe"`
+	ClientVersion    string                    `json:"clientVersion,omitempty"`
+	DryRun           bool                      `json:"dryRun"`
+	SHA256Before     string                    `json:"sha256Before"`
+	SHA256After      string                    `json:"sha256After"`
+	Verdict          string                    `json:"verdict"`
+	ExportAllowed    bool                      `json:"exportAllowed"`
+	BackupPath       string                    `json:"backupPath"`
+	ByteChanges      []EditPlanByteChange      `json:"byteChanges"`
+	URLSubstitutions []EditPlanURLSubstitution `json:"urlSubstitutions"`
+	Strings          []EditPlanString          `json:"strings"`
+	ConfigINI        *EditPlanConfigINI        `json:"configIni,omitempty"`
+	Hosts            []EditPlanHost            `json:"hosts"`
+	// HostAuditRefused is set when only official hosts left in the client
+	// refuse the export under --strict.
+	HostAuditRefused bool `json:"hostAuditRefused,omitempty"`
+}
+
+type EditPlanByteChange struct {
+	Offset      int    `json:"offset"`
+	Length      int    `json:"length"`
+	Section     string `json:"section,omitempty"`
+	WindowStart int    `json:"windowStart"`
+	Before      string `json:"before"`
+	After       string `json:"after"`
+	Truncated   bool   `json:"truncated,omitempty"`
+}
+
+type EditPlanURLSubstitution struct {
+	Slice    string `json:"slice,omitempty"`
+	Property string `json:"property"`
+	Offset   int    `json:"offset"`
+	Before   string `json:"before"`
+	After    string `json:"after"`
+	Padding  int    `json:"padding"`
+}
+
+type EditPlanString struct {
+	Find     string `json:"find"`
+	Replace  string `json:"replace"`
+	Encoding string `json:"encoding"`
+	Offset   int    `json:"offset"`
+	Section  string `json:"section,omitempty"`
+	Padding  int    `json:"padding"`
+}
+
+type EditPlanConfigINI struct {
+	Path    string   `json:"path"`
+	Exists  bool     `json:"exists"`
+	Changed int      `json:"changed"`
+	Added   int      `json:"added"`
+	Removed int      `json:"removed"`
+	Diff    []string `json:"diff"`
+}
+
+// EditPlanHost is a host the post-edit audit found in the client or
+// config.ini. Category is "official", "other", "configured" or "ignored".
+type EditPlanHost struct {
+	Host        string                   `json:"host"`
+	Category    string                   `json:"category"`
+	Occurrences []EditPlanHostOccurrence `json:"occurrences"`
+}
+
+type EditPlanHostOccurrence struct {
+	File     string `json:"file"`
+	Offset   int    `json:"offset"`
+	Section  string `json:"section,omitempty"`
+	Encoding string `json:"encoding"`
+	Text     string `json:"text"`
+}
+
+func newEditPlan(tibiaPath string, sourcePath string, dryRun bool, strictClientCheck bool, sourceBinary []byte, tibiaBinary []byte, diagnosis diagnosisReport) EditPlan {
+	before := sha256.Sum256(sourceBinary)
+	after := sha256.Sum256(tibiaBinary)
+	plan := EditPlan{
+		TibiaExe:         tibiaPath,
+		SourceExe:        sourcePath,
+		ClientVersion:    diagnosis.version.version,
+		DryRun:           dryRun,
+		SHA256Before:     fmt.Sprintf("%x", before[:]),
+		SHA256After:      fmt.Sprintf("%x", after[:]),
+		Verdict:          diagnosis.clientCheckVerdict(),
+		ExportAllowed:    !editExportRefused(diagnosis, strictClientCheck),
+		BackupPath:       backupPathFor(tibiaPath),
+		ByteChanges:      make([]EditPlanByteChange, 0),
+		URLSubstitutions: make([]EditPlanURLSubstitution, 0),
+		Strings:          make([]EditPlanString, 0),
+		Hosts:            make([]EditPlanHost, 0),
+	}
+
+	peData := inspectExecutable(tibiaBinary)
+	for _, changed := range changedByteRanges(sourceBinary, tibiaBinary, planByteChangeMergeGap) {
+		change := EditPlanByteChange{Offset: changed[0], Length: changed[1] - changed[0]}
+		if section, ok := peData.sectionForOffset(change.Offset); ok {
+			change.Section = section.name
+		}
+		windowLength := change.Length
+		if windowLength > planMaxWindowBytes {
+			windowLength = planMaxWindowBytes
+			change.Truncated = true
+		}
+		windowStart, beforeBytes := bytesAroundRange(sourceBinary, change.Offset, windowLength, patchContextRadius)
+		_, afterBytes := bytesAroundRange(tibiaBinary, change.Offset, windowLength, patchContextRadius)
+		change.WindowStart = windowStart
+		change.Before = formatBytes(beforeBytes)
+		change.After = formatBytes(afterBytes)
+		plan.ByteChanges = append(plan.ByteChanges, change)
+	}
+
+	return plan
+}
+
+func (plan *EditPlan) setHosts(findings []hostAuditFinding, strict bool) {
+	for _, finding := range findings {
+		host := EditPlanHost{Host: finding.host, Category: finding.category, Occurrences: make([]EditPlanHostOccurrence, 0, len(finding.occurrences))}
+		for _, occurrence := range finding.occurrences {
+			host.Occurrences = append(host.Occurrences, EditPlanHostOccurrence{
+				File:     occurrence.file,
+				Offset:   occurrence.offset,
+				Section:  occurrence.section,
+				Encoding: occurrence.encoding,
+				Text:     occurrence.text,
+			})
+		}
+		plan.Hosts = append(plan.Hosts, host)
+	}
+	if strict && plan.ExportAllowed && len(officialHosts(findings)) > 0 {
+		plan.ExportAllowed = false
+		plan.HostAuditRefused = true
+	}
+}
+
+// changedByteRanges returns the [start, end) ranges where before and after
+// differ. Ranges separated by at most mergeGap equal bytes are merged.
+func changedByteRanges(before []byte, after []byte, mergeGap int) [][2]int {
+	ranges := make([][2]int, 0)
+	length := len(before)
+	if len(after) < length {
+		length = len(after)
+	}
+	for offset := 0; offset < length; offset++ {
+		if before[offset] == after[offset] {
+			continue
+		}
+		if len(ranges) > 0 && offset-ranges[len(ranges)-1][1] <= mergeGap {
+			ranges[len(ranges)-1][1] = offset + 1
+			continue
+		}
+		ranges = append(ranges, [2]int{offset, offset + 1})
+	}
+	if len(before) != len(after) {
+		end := len(before)
+		if len(after) > end {
+			end = len(after)
+		}
+		ranges = append(ranges, [2]int{length, end})
+	}
+	return ranges
+}
+
+func (plan *EditPlan) addURLSubstitution(slice machOSlice, substitution propertySubstitution) {
+	plan.URLSubstitutions = append(plan.URLSubstitutions, EditPlanURLSubstitution{
+		Slice:    slice.arch,
+		Property: substitution.name,
+		Offset:   slice.start + substitution.offset,
+		Before:   substitution.before,
+		After:    substitution.after,
+		Padding:  substitution.padding,
+	})
+}
+
+func (plan *EditPlan) addStringSubstitution(substitution stringSubstitution) {
+	plan.Strings = append(plan.Strings, EditPlanString{
+		Find:     substitution.find,
+		Replace:  substitution.replace,
+		Encoding: substitution.encoding,
+		Offset:   substitution.offset,
+		Section:  substitution.section,
+		Padding:  substitution.padding,
+	})
+}
+
+func (plan *EditPlan) setConfigINI(sync configINISyncPlan) {
+	plan.ConfigINI = &EditPlanConfigINI{
+		Path:    sync.path,
+		Exists:  sync.exists,
+		Changed: sync.changedCount,
+		Added:   sync.addedCount,
+		Removed: sync.removedCount,
+		Diff:    diffConfigINILines(sync.original, sync.updated),
+	}
+}
+
+func (plan EditPlan) print() {
+	fmt.Printf("[PLAN] Edit plan for %s (source %s)\n", plan.TibiaExe, plan.SourceExe)
+	fmt.Printf("[PLAN] SHA256 %s -> %s\n", plan.SHA256Before, plan.SHA256After)
+	if plan.ClientVersion != "" {
+		fmt.Printf("[PLAN] Client version %s\n", plan.ClientVersion)
+	}
+	for _, change := range plan.ByteChanges {
+		section := ""
+		if change.Section != "" {
+			section = ", section " + change.Section
+		}
+		truncated := ""
+		if change.Truncated {
+			truncated = fmt.Sprintf(" (window truncated to %d bytes)", planMaxWindowBytes)
+		}
+		fmt.Printf("[PLAN] Byte change @0x%X (%d byte(s)%s)%s\n", change.Offset, change.Length, section, truncated)
+		fmt.Printf("[PLAN]   before @0x%X: %s\n", change.WindowStart, change.Before)
+		fmt.Printf("[PLAN]   after  @0x%X: %s\n", change.WindowStart, change.After)
+	}
+	for _, substitution := range plan.URLSubstitutions {
+		slice := ""
+		if substitution.Slice != "" {
+			slice = " in slice " + substitution.Slice
+		}
+		fmt.Printf("[PLAN] URL %s @0x%X%s: %q -> %q (+%d padding byte(s))\n", substitution.Property, substitution.Offset, slice, substitution.Before, substitution.After, substitution.Padding)
+	}
+	for _, replacement := range plan.Strings {
+		section := "no section"
+		if replacement.Section != "" {
+			section = replacement.Section
+		}
+		fmt.Printf("[PLAN] String %q @0x%X (%s, %s): -> %q (+%d padding byte(s))\n", replacement.Find, replacement.Offset, replacement.Encoding, section, replacement.Replace, replacement.Padding)
+	}
+	fmt.Printf("[PLAN] Backup of %s would be written to %s\n", plan.TibiaExe, plan.BackupPath)
+	if plan.ConfigINI != nil {
+		action := "updated"
+		if !plan.ConfigINI.Exists {
+			action = "created"
+		}
+		if len(plan.ConfigINI.Diff) == 0 {
+			fmt.Printf("[PLAN] %s at %s is already up to date\n", configINIFileName, plan.ConfigINI.Path)
+		} else {
+			fmt.Printf("[PLAN] %s at %s would be %s (%d outdated value(s), %d new key(s), %d obsolete key(s) removed)\n", configINIFileName, plan.ConfigINI.Path, action, plan.ConfigINI.Changed, plan.ConfigINI.Added, plan.ConfigINI.Removed)
+			for _, line := range plan.ConfigINI.Diff {
+				fmt.Printf("[PLAN]   %s\n", line)
+			}
+		}
+	}
+	for _, host := range plan.Hosts {
+		if host.Category == hostAuditOfficial {
+			fmt.Printf("[PLAN] Official host %s remains (%d occurrence(s))\n", host.Host, len(host.Occurrences))
+		}
+	}
+	if plan.ExportAllowed {
+		fmt.Printf("[PLAN] Export would be allowed: %s\n", plan.Verdict)
+	} else if plan.HostAuditRefused {
+		fmt.Printf("[PLAN] Export would be refused: official host(s) remain and --strict is enabled\n")
+	} else {
+		fmt.Printf("[PLAN] Export would be refused: %s\n", plan.Verdict)
+	}
+}
+
+func (plan EditPlan) writeJSON(planPath string) error {
+	planData, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode edit plan: %w", err)
+	}
+	if err := os.WriteFile(planPath, append(planData, '\n'), 0644); err != nil {
+		return fmt.Errorf("unable to write edit plan: %w", err)
+	}
+	fmt.Printf("[INFO] Edit plan written to %s\n", planPath)
+	return nil
+}
+
+// diffConfigINILines returns a minimal line diff between two config.ini
+// contents, with removed lines prefixed by "-" and added lines by "+".
+func diffConfigINILines(before []byte, after []byte) []string {
+	beforeLines := splitConfigINILines(before)
+	afterLines := splitConfigINILines(after)
+
+	common := make([][]int, len(beforeLines)+1)
+	for index := range common {
+		common[index] = make([]int, len(afterLines)+1)
+	}
+	for beforeIndex := len(beforeLines) - 1; beforeIndex >= 0; beforeIndex-- {
+		for afterIndex := len(afterLines) - 1; afterIndex >= 0; afterIndex-- {
+			if beforeLines[beforeIndex] == afterLines[afterIndex] {
+				common[beforeIndex][afterIndex] = common[beforeIndex+1][afterIndex+1] + 1
+			} else if common[beforeIndex+1][afterIndex] >= common[beforeIndex][afterIndex+1] {
+				common[beforeIndex][afterIndex] = common[beforeIndex+1][afterIndex]
+			} else {
+				common[beforeIndex][afterIndex] = common[beforeIndex][afterIndex+1]
+			}
+		}
+	}
+
+	diff := make([]string, 0)
+	beforeIndex, afterIndex := 0, 0
+	for beforeIndex < len(beforeLines) || afterIndex < len(afterLines) {
+		switch {
+		case beforeIndex < len(beforeLines) && afterIndex < len(afterLines) && beforeLines[beforeIndex] == afterLines[afterIndex]:
+			beforeIndex++
+			afterIndex++
+		case beforeIndex < len(beforeLines) && (afterIndex == len(afterLines) || common[beforeIndex+1][afterIndex] >= common[beforeIndex][afterIndex+1]):
+			diff = append(diff, "-"+beforeLines[beforeIndex])
+			beforeIndex++
+		default:
+			diff = append(diff, "+"+afterLines[afterIndex])
+			afterIndex++
+		}
+	}
+	return diff
+}
@@ -0,0 +1,119 @@
+package edit
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestEditDryRunWritesOnlyThePlan(t *testing.T) {
+	workDir := t.TempDir()
+	chdirForTest(t, workDir)
+	tibiaRsa := bytes.Repeat([]byte("A"), 32)
+	otservRsa := bytes.Repeat([]byte("B"), 32)
+	writeTestFile(t, filepath.Join(workDir, "tibia_rsa.key"), tibiaRsa)
+	writeTestFile(t, filepath.Join(workDir, "otserv_rsa.key"), otservRsa)
+
+	configLines := make([]string, 0, len(properties))
+	for _, property := range properties {
+		configLines = append(configLines, property+` = "http://127.0.0.1/`+property+`"`)
+	}
+	configPath := filepath.Join(workDir, "config.toml")
+	writeTestFile(t, configPath, []byte(strings.Join(configLines, "\n")+"\n"))
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.SetConfigFile(configPath)
+
+	tibiaBinary := append([]byte("header--"), tibiaRsa...)
+	tibiaBinary = append(tibiaBinary, []byte("--[URLS]\nloginWebService=https://www.tibia.com/login/service/endpoint\n\x00")...)
+	tibiaPath := filepath.Join(workDir, "client")
+	writeTestFile(t, tibiaPath, tibiaBinary)
+	planPath := filepath.Join(workDir, "plan.json")
+
+	Edit(EditOptions{TibiaExe: tibiaPath, DryRun: true, PlanJSONPath: planPath})
+
+	if data, _ := os.ReadFile(tibiaPath); !bytes.Equal(data, tibiaBinary) {
+		t.Fatal("expected the client to stay untouched in dry-run mode")
+	}
+	entries, _ := os.ReadDir(workDir)
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), "BKP") || entry.Name() == configINIFileName {
+			t.Fatalf("expected no backup or config.ini in dry-run mode, found %s", entry.Name())
+		}
+	}
+
+	var plan EditPlan
+	planData, err := os.ReadFile(planPath)
+	if err != nil || json.Unmarshal(planData, &plan) != nil {
+		t.Fatalf("expected a JSON plan, got %v", err)
+	}
+	if !plan.DryRun || len(plan.ByteChanges) != 2 || plan.ByteChanges[0].Offset != 8 || plan.ByteChanges[0].Length != 32 {
+		t.Fatalf("expected RSA and URL byte changes, got %+v", plan.ByteChanges)
+	}
+	if len(plan.URLSubstitutions) != 1 {
+		t.Fatalf("expected one URL substitution, got %+v", plan.URLSubstitutions)
+	}
+	substitution := plan.URLSubstitutions[0]
+	if substitution.Property != "loginWebService" || substitution.Before != "https://www.tibia.com/login/service/endpoint" ||
+		substitution.After != "http://127.0.0.1/loginWebService" || substitution.Padding != 12 {
+		t.Fatalf("unexpected URL substitution %+v", substitution)
+	}
+	if plan.ConfigINI == nil || plan.ConfigINI.Exists || plan.ConfigINI.Path != filepath.Join(workDir, configINIFileName) {
+		t.Fatalf("expected config.ini creation beside the client, got %+v", plan.ConfigINI)
+	}
+	expectedDiff := []string{"+[URLS]", "+loginWebService=http://127.0.0.1/loginWebService"}
+	if !reflect.DeepEqual(plan.ConfigINI.Diff, expectedDiff) {
+		t.Fatalf("expected config.ini diff %q, got %q", expectedDiff, plan.ConfigINI.Diff)
+	}
+}
+
+func TestDiffConfigINILinesListsRemovalsBeforeAdditions(t *testing.T) {
+	before := []byte("; keep\n[URLS]\nloginWebService=old\nobsolete=1\n[Custom]\na=b\n")
+	after := []byte("; keep\n[URLS]\nloginWebService=new\n[Custom]\na=b\nadded=1\n")
+
+	diff := diffConfigINILines(before, after)
+
+	expected := []string{"-loginWebService=old", "-obsolete=1", "+loginWebService=new", "+added=1"}
+	if !reflect.DeepEqual(diff, expected) {
+		t.Fatalf("expected %q, got %q", expected, diff)
+	}
+}
+
+func TestChangedByteRangesMergesNearbyChanges(t *testing.T) {
+	before := make([]byte, 64)
+	after := append([]byte(nil), before...)
+	after[4], after[10], after[40] = 1, 1, 1
+
+	ranges := changedByteRanges(before, after, planByteChangeMergeGap)
+
+	if !reflect.DeepEqual(ranges, [][2]int{{4, 11}, {40, 41}}) {
+		t.Fatalf("unexpected changed ranges %v", ranges)
+	}
+}
+
+func chdirForTest(t *testing.T, dir string) {
+	t.Helper()
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("unable to read working directory: %s", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("unable to change directory: %s", err)
+	}
+	t.Cleanup(func() {
+		_ = os.Chdir(previous)
+	})
+}
+
+func writeTestFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("unable to write %s: %s", path, err)
+	}
+}
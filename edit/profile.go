@@ -0,0 +1,120 @@
+package edit
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// configTemplateData is what a config value template can refer to.
+type configTemplateData struct {
+	// BaseURL is the resolved baseUrl without a trailing slash.
+	BaseURL string
+	Profile string
+}
+
+// applyConfigProfile merges the [profile.<name>] table over the top-level
+// settings. A [SECTION] table inside the profile is merged key by key. The
+// profile tables themselves are dropped from the result.
+func applyConfigProfile(settings map[string]interface{}, profile string) (map[string]interface{}, error) {
+	merged := make(map[string]interface{}, len(settings))
+	for name, setting := range settings {
+		if name != "profile" {
+			merged[name] = setting
+		}
+	}
+	if profile == "" {
+		return merged, nil
+	}
+
+	profiles, _ := settings["profile"].(map[string]interface{})
+	selected, ok := profiles[strings.ToLower(profile)].(map[string]interface{})
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for name := range profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return nil, fmt.Errorf("profile %q is not defined; the config has no [profile.<name>] tables", profile)
+		}
+		return nil, fmt.Errorf("profile %q is not defined; available: %s", profile, strings.Join(names, ", "))
+	}
+	for name, setting := range selected {
+		table, isTable := setting.(map[string]interface{})
+		base, baseIsTable := merged[name].(map[string]interface{})
+		if !isTable || !baseIsTable {
+			merged[name] = setting
+			continue
+		}
+		combined := make(map[string]interface{}, len(base)+len(table))
+		for key, value := range base {
+			combined[key] = value
+		}
+		for key, value := range table {
+			combined[key] = value
+		}
+		merged[name] = combined
+	}
+	return merged, nil
+}
+
+// expandConfigTemplates resolves baseUrl and then expands every value as a
+// Go template, so URLs can be written as {{.BaseURL}}/api/login. The env
+// function reads an environment variable and fails when it is not set.
+func expandConfigTemplates(settings map[string]interface{}, values map[string]string, sections map[string]map[string]string, profile string) error {
+	data := configTemplateData{Profile: profile}
+	if baseURL, ok := settings["baseurl"]; ok {
+		expanded, err := expandConfigTemplate("baseUrl", fmt.Sprint(baseURL), data)
+		if err != nil {
+			return err
+		}
+		data.BaseURL = strings.TrimRight(expanded, "/")
+	}
+
+	for key, value := range values {
+		expanded, err := expandConfigTemplate(key, value, data)
+		if err != nil {
+			return err
+		}
+		values[key] = expanded
+	}
+	for name, section := range sections {
+		for key, value := range section {
+			expanded, err := expandConfigTemplate(fmt.Sprintf("[%s] %s", name, key), value, data)
+			if err != nil {
+				return err
+			}
+			section[key] = expanded
+		}
+	}
+	return nil
+}
+
+func expandConfigTemplate(name string, value string, data configTemplateData) (string, error) {
+	if !strings.Contains(value, "{{") {
+		return value, nil
+	}
+	parsed, err := template.New(name).Option("missingkey=error").Funcs(template.FuncMap{
+		"env": func(variable string) (string, error) {
+			value, ok := os.LookupEnv(variable)
+			if !ok {
+				return "", fmt.Errorf("environment variable %s is not set", variable)
+			}
+			return value, nil
+		},
+	}).Parse(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid template in %s: %w", name, err)
+	}
+	if strings.Contains(value, ".BaseURL") && data.BaseURL == "" {
+		return "", fmt.Errorf("%s uses {{.BaseURL}} but baseUrl is not set", name)
+	}
+	var expanded strings.Builder
+	if err := parsed.Execute(&expanded, data); err != nil {
+		return "", fmt.Errorf("unable to expand %s: %w", name, err)
+	}
+	return expanded.String(), nil
+}
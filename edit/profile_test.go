@@ -0,0 +1,65 @@
+package edit
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyConfigProfileMergesOverTopLevelValues(t *testing.T) {
+	settings := map[string]interface{}{
+		"baseurl":         "https://example.com/",
+		"loginwebservice": "{{.BaseURL}}/api/login",
+		"game":            map[string]interface{}{"motd": "Welcome", "port": "7171"},
+		"profile": map[string]interface{}{
+			"local": map[string]interface{}{
+				"baseurl": "http://127.0.0.1:5173",
+				"game":    map[string]interface{}{"port": "7172"},
+			},
+		},
+	}
+
+	merged, err := applyConfigProfile(settings, "Local")
+	if err != nil {
+		t.Fatalf("expected the profile to apply: %s", err)
+	}
+	values, sections := configOverridesFromSettings(merged)
+	if err := expandConfigTemplates(merged, values, sections, "Local"); err != nil {
+		t.Fatalf("expected the templates to expand: %s", err)
+	}
+	if !reflect.DeepEqual(values, map[string]string{"loginwebservice": "http://127.0.0.1:5173/api/login"}) {
+		t.Fatalf("expected the profile base URL in the login URL, got %v", values)
+	}
+	if !reflect.DeepEqual(sections, map[string]map[string]string{"game": {"motd": "Welcome", "port": "7172"}}) {
+		t.Fatalf("expected section keys to be merged one by one, got %v", sections)
+	}
+
+	if _, err := applyConfigProfile(settings, "staging"); err == nil || !strings.Contains(err.Error(), "available: local") {
+		t.Fatalf("expected an unknown profile to list the defined ones, got %v", err)
+	}
+}
+
+func TestExpandConfigTemplateReadsEnvironment(t *testing.T) {
+	t.Setenv("CLIENT_EDITOR_HOST", "ot.example")
+	data := configTemplateData{BaseURL: "https://ot.example", Profile: "prod"}
+
+	value, err := expandConfigTemplate("cipSoftUrl", `https://{{env "CLIENT_EDITOR_HOST"}}/{{.Profile}}`, data)
+	if err != nil || value != "https://ot.example/prod" {
+		t.Fatalf("expected the environment variable and profile to expand, got %q err=%v", value, err)
+	}
+	if _, err := expandConfigTemplate("faqUrl", `{{env "CLIENT_EDITOR_UNSET"}}`, data); err == nil || !strings.Contains(err.Error(), "CLIENT_EDITOR_UNSET is not set") {
+		t.Fatalf("expected an unset variable to fail, got %v", err)
+	}
+	if _, err := expandConfigTemplate("faqUrl", "{{.BaseURL}}/faq", configTemplateData{}); err == nil || !strings.Contains(err.Error(), "baseUrl is not set") {
+		t.Fatalf("expected a missing baseUrl to fail, got %v", err)
+	}
+}
+
+func TestReportConfigValuesListsValuesThatDoNotFit(t *testing.T) {
+	tibiaBinary := []byte("[URLS]\nloginWebService=https://short\nfaqUrl=https://www.tibia.com/faq\n\x00")
+
+	tooLong := reportConfigValues(tibiaBinary, map[string]string{"loginWebService": "https://much-longer.example", "faqUrl": "https://ot/faq"})
+	if !reflect.DeepEqual(tooLong, []string{"loginWebService (27 > 13 bytes)"}) {
+		t.Fatalf("expected only the login URL to be too long, got %v", tooLong)
+	}
+}
@@ -0,0 +1,571 @@
+package edit
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	qtResourceCompressed     = 0x01
+	qtResourceDirectory      = 0x02
+	qtResourceCompressedZstd = 0x04
+
+	qtRegisterResourceDataName = "qRegisterResourceData"
+	// qtResourceMaxDepth and qtResourceMaxChildren bound the walk, so a
+	// misread pointer fails instead of looping over random bytes.
+	qtResourceMaxDepth    = 64
+	qtResourceMaxChildren = 0x10000
+	qtResourceMaxNameSize = 1024
+	// qtResourceMaxUnpackedSize bounds what a zstd frame header may ask the
+	// decoder to allocate.
+	qtResourceMaxUnpackedSize = 1 << 30
+)
+
+// QtResourceOptions selects the client and the resources the qtres commands
+// work on. Resource is a :/ path for replace and a path.Match pattern for
+// extract.
+type QtResourceOptions struct {
+	TibiaExe  string
+	Resource  string
+	File      string
+	OutputDir string
+	DryRun    bool
+}
+
+// qtResourceTree is one tree passed to qRegisterResourceData. The tree,
+// names and data blobs are file offsets.
+type qtResourceTree struct {
+	registration int
+	version      int
+	tree         int
+	names        int
+	data         int
+	resources    []qtResource
+}
+
+// qtResource is a file entry of a resource tree. nodeOffset is the file
+// offset of its tree node and dataOffset that of its big-endian size prefix;
+// size is the stored payload length, which is the room a replacement has.
+type qtResource struct {
+	path       string
+	flags      uint16
+	language   uint16
+	territory  uint16
+	nodeOffset int
+	dataOffset int
+	size       int
+}
+
+func (resource qtResource) compression() string {
+	switch {
+	case resource.flags&qtResourceCompressedZstd != 0:
+		return "zstd"
+	case resource.flags&qtResourceCompressed != 0:
+		return "zlib"
+	}
+	return "none"
+}
+
+func (resource qtResource) payload(tibiaBinary []byte) []byte {
+	start := resource.dataOffset + 4
+	return tibiaBinary[start : start+resource.size]
+}
+
+// contents returns the resource as Qt hands it to the client. zlib entries
+// are stored as qCompress writes them: a big-endian length, then the stream.
+// zstd entries are a single frame that records its content size.
+func (resource qtResource) contents(tibiaBinary []byte) ([]byte, error) {
+	payload := resource.payload(tibiaBinary)
+	switch resource.compression() {
+	case "zstd":
+		var header zstd.Header
+		if err := header.Decode(payload); err != nil {
+			return nil, fmt.Errorf("%s: %w", resource.path, err)
+		}
+		decoder, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(qtResourceMaxUnpackedSize))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", resource.path, err)
+		}
+		defer decoder.Close()
+		contents, err := decoder.DecodeAll(payload, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", resource.path, err)
+		}
+		if header.HasFCS && header.FrameContentSize != uint64(len(contents)) {
+			return nil, fmt.Errorf("%s: unpacked %d bytes, the frame header says %d", resource.path, len(contents), header.FrameContentSize)
+		}
+		return contents, nil
+	case "zlib":
+		if len(payload) < 4 {
+			return nil, fmt.Errorf("%s: compressed payload of %d bytes has no length prefix", resource.path, len(payload))
+		}
+		reader, err := zlib.NewReader(bytes.NewReader(payload[4:]))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", resource.path, err)
+		}
+		defer reader.Close()
+		contents, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", resource.path, err)
+		}
+		if expected := binary.BigEndian.Uint32(payload); int(expected) != len(contents) {
+			return nil, fmt.Errorf("%s: unpacked %d bytes, the length prefix says %d", resource.path, len(contents), expected)
+		}
+		return contents, nil
+	}
+	return payload, nil
+}
+
+func (resource qtResource) describe(tibiaBinary []byte) string {
+	text := fmt.Sprintf("%s %d bytes", resource.path, resource.size)
+	switch resource.compression() {
+	case "zlib":
+		if resource.size >= 4 {
+			text += fmt.Sprintf(" zlib (%d bytes unpacked)", binary.BigEndian.Uint32(resource.payload(tibiaBinary)))
+		}
+	case "zstd":
+		var header zstd.Header
+		if header.Decode(resource.payload(tibiaBinary)) == nil && header.HasFCS {
+			text += fmt.Sprintf(" zstd (%d bytes unpacked)", header.FrameContentSize)
+		} else {
+			text += " zstd"
+		}
+	}
+	if resource.language > 1 || resource.territory != 0 {
+		text += fmt.Sprintf(" language %d territory %d", resource.language, resource.territory)
+	}
+	return text + fmt.Sprintf(" @0x%X", resource.dataOffset)
+}
+
+// findQtResourceTrees locates every qRegisterResourceData call, through the
+// import on clients that link Qt dynamically or the function symbol on
+// static ELF builds, and parses the trees its arguments point at.
+func findQtResourceTrees(tibiaBinary []byte, peData peInfo) []qtResourceTree {
+	index := buildXrefIndex(tibiaBinary, peData)
+	callOffsets := make(map[int]struct{})
+	for _, edges := range index.importCallers(tibiaBinary, qtRegisterResourceDataName) {
+		for _, edge := range edges {
+			if edge.kind == xrefImportCall || edge.kind == xrefCall || edge.kind == xrefJump {
+				callOffsets[edge.offset] = struct{}{}
+			}
+		}
+	}
+	lowerName := strings.ToLower(qtRegisterResourceDataName)
+	for _, symbol := range peData.symbols {
+		if !strings.Contains(strings.ToLower(symbol.name), lowerName) {
+			continue
+		}
+		for _, edge := range index.referencesTo(symbol.beginRVA) {
+			if edge.kind == xrefCall || edge.kind == xrefJump {
+				callOffsets[edge.offset] = struct{}{}
+			}
+		}
+	}
+
+	offsets := make([]int, 0, len(callOffsets))
+	for offset := range callOffsets {
+		offsets = append(offsets, offset)
+	}
+	sort.Ints(offsets)
+
+	trees := make([]qtResourceTree, 0)
+	seen := make(map[int]struct{})
+	for _, offset := range offsets {
+		tree, ok := qtResourceTreeAt(tibiaBinary, peData, offset)
+		if !ok {
+			fmt.Printf("[WARN] qRegisterResourceData call @0x%X: unable to resolve a resource tree from its arguments\n", offset)
+			continue
+		}
+		if _, ok := seen[tree.tree]; ok {
+			continue
+		}
+		seen[tree.tree] = struct{}{}
+		trees = append(trees, tree)
+	}
+	return trees
+}
+
+// qtResourceTreeAt reads the arguments of the call at callOffset from the
+// LEA and MOV instructions before it: version, tree, names and data in ecx,
+// rdx, r8 and r9 on Windows and in edi, rsi, rdx and rcx in the System V ABI.
+func qtResourceTreeAt(tibiaBinary []byte, peData peInfo, callOffset int) (qtResourceTree, bool) {
+	registers := [4]int{7, 6, 2, 1}
+	if peData.format == executableFormatPE {
+		registers = [4]int{1, 2, 8, 9}
+	}
+	start, reached := syncX86Sweep(tibiaBinary, peData.x86SyncStart(callOffset), []int{callOffset})
+	if reached != callOffset {
+		return qtResourceTree{}, false
+	}
+
+	values := make(map[int]int)
+	for _, instruction := range disassembleX86(tibiaBinary, start, callOffset) {
+		switch {
+		case instruction.invalid:
+			continue
+		case instruction.isCall():
+			values = make(map[int]int)
+		case instruction.isAddressLoad() && instruction.ripRelative():
+			if target, ok := peData.x86TargetRVA(instruction); ok {
+				values[instruction.reg()|int(instruction.rex&0x04)<<1] = target
+			}
+		case instruction.opcodeMap == x86MapPrimary && instruction.opcode >= 0xb8 && instruction.opcode <= 0xbf:
+			values[int(instruction.opcode&7)|int(instruction.rex&0x01)<<3] = int(instruction.immediate)
+		}
+	}
+
+	tree := qtResourceTree{registration: callOffset, version: values[registers[0]]}
+	blobs := []*int{&tree.tree, &tree.names, &tree.data}
+	for argument, blob := range blobs {
+		rva, ok := values[registers[argument+1]]
+		if !ok {
+			return qtResourceTree{}, false
+		}
+		if *blob, ok = peData.offsetForRVA(rva); !ok {
+			return qtResourceTree{}, false
+		}
+	}
+
+	versions := []int{tree.version}
+	if tree.version < 1 || tree.version > 3 {
+		versions = []int{3, 1}
+	}
+	for _, version := range versions {
+		tree.version = version
+		if resources, err := parseQtResourceTree(tibiaBinary, tree); err == nil {
+			tree.resources = resources
+			return tree, true
+		}
+	}
+	return qtResourceTree{}, false
+}
+
+// parseQtResourceTree walks the rcc tree from its root directory. Nodes are
+// 14 bytes in format 1 and carry a 64-bit modification time from format 2.
+func parseQtResourceTree(tibiaBinary []byte, tree qtResourceTree) ([]qtResource, error) {
+	nodeSize := 14
+	if tree.version >= 2 {
+		nodeSize = 22
+	}
+	resources := make([]qtResource, 0)
+	visited := make(map[int]struct{})
+
+	var walk func(node int, prefix string, depth int) error
+	walk = func(node int, prefix string, depth int) error {
+		if depth > qtResourceMaxDepth {
+			return fmt.Errorf("tree is deeper than %d levels", qtResourceMaxDepth)
+		}
+		if _, ok := visited[node]; ok {
+			return fmt.Errorf("node %d is reached twice", node)
+		}
+		visited[node] = struct{}{}
+		offset := tree.tree + node*nodeSize
+		if offset < 0 || offset+nodeSize > len(tibiaBinary) {
+			return fmt.Errorf("node %d is outside the file", node)
+		}
+		flags := binary.BigEndian.Uint16(tibiaBinary[offset+4:])
+		name := ""
+		if node != 0 {
+			var err error
+			if name, err = qtResourceName(tibiaBinary, tree.names+int(binary.BigEndian.Uint32(tibiaBinary[offset:]))); err != nil {
+				return err
+			}
+		}
+
+		if flags&qtResourceDirectory == 0 {
+			if node == 0 {
+				return fmt.Errorf("the root node is not a directory")
+			}
+			dataOffset := tree.data + int(binary.BigEndian.Uint32(tibiaBinary[offset+10:]))
+			if dataOffset+4 > len(tibiaBinary) {
+				return fmt.Errorf("%s%s: data is outside the file", prefix, name)
+			}
+			size := int(binary.BigEndian.Uint32(tibiaBinary[dataOffset:]))
+			if dataOffset+4+size > len(tibiaBinary) {
+				return fmt.Errorf("%s%s: %d bytes of data run past the end of the file", prefix, name, size)
+			}
+			resources = append(resources, qtResource{
+				path:       prefix + name,
+				flags:      flags,
+				territory:  binary.BigEndian.Uint16(tibiaBinary[offset+6:]),
+				language:   binary.BigEndian.Uint16(tibiaBinary[offset+8:]),
+				nodeOffset: offset,
+				dataOffset: dataOffset,
+				size:       size,
+			})
+			return nil
+		}
+
+		count := int(binary.BigEndian.Uint32(tibiaBinary[offset+6:]))
+		first := int(binary.BigEndian.Uint32(tibiaBinary[offset+10:]))
+		if count > qtResourceMaxChildren || (count > 0 && first <= node) {
+			return fmt.Errorf("node %d has an implausible child range %d+%d", node, first, count)
+		}
+		childPrefix := ":/"
+		if node != 0 {
+			childPrefix = prefix + name + "/"
+		}
+		for child := first; child < first+count; child++ {
+			if err := walk(child, childPrefix, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(0, "", 0); err != nil {
+		return nil, err
+	}
+	return resources, nil
+}
+
+// qtResourceName reads a names entry: a big-endian UTF-16 length, the name
+// hash and the UTF-16BE name. Names that could leave the extract directory,
+// such as "..", or hold a path separator are refused.
+func qtResourceName(tibiaBinary []byte, offset int) (string, error) {
+	if offset < 0 || offset+6 > len(tibiaBinary) {
+		return "", fmt.Errorf("name @0x%X is outside the file", offset)
+	}
+	length := int(binary.BigEndian.Uint16(tibiaBinary[offset:]))
+	if length == 0 || length > qtResourceMaxNameSize || offset+6+length*2 > len(tibiaBinary) {
+		return "", fmt.Errorf("name @0x%X has an implausible length %d", offset, length)
+	}
+	units := make([]uint16, length)
+	for index := range units {
+		units[index] = binary.BigEndian.Uint16(tibiaBinary[offset+6+index*2:])
+	}
+	name := string(utf16.Decode(units))
+	if name == "." || name == ".." || strings.ContainsAny(name, "/\\\x00") {
+		return "", fmt.Errorf("name @0x%X is not a file name: %q", offset, name)
+	}
+	return name, nil
+}
+
+// encodeQtResource stores contents in at most capacity bytes, keeping the
+// original compression when it fits and otherwise trying the others. zstd is
+// only used for entries that were zstd compressed, since the client's Qt may
+// have been built without it, and is written as a single segment frame so the
+// header carries the content size Qt allocates from. It returns the payload
+// and the node flags to write with it.
+func encodeQtResource(contents []byte, capacity int, original qtResource) ([]byte, uint16, error) {
+	compressed := bytes.NewBuffer(binary.BigEndian.AppendUint32(nil, uint32(len(contents))))
+	writer, _ := zlib.NewWriterLevel(compressed, zlib.BestCompression)
+	writer.Write(contents)
+	writer.Close()
+
+	flags := original.flags &^ (qtResourceCompressed | qtResourceCompressedZstd)
+	raw := func() ([]byte, uint16) { return contents, flags }
+	zlibbed := func() ([]byte, uint16) { return compressed.Bytes(), flags | qtResourceCompressed }
+	encodings := []func() ([]byte, uint16){raw, zlibbed}
+	sizes := fmt.Sprintf("%d bytes uncompressed and %d bytes with zlib", len(contents), compressed.Len())
+	switch original.compression() {
+	case "zlib":
+		encodings = []func() ([]byte, uint16){zlibbed, raw}
+	case "zstd":
+		encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBestCompression), zstd.WithEncoderConcurrency(1), zstd.WithSingleSegment(true), zstd.WithZeroFrames(true))
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", original.path, err)
+		}
+		frame := encoder.EncodeAll(contents, nil)
+		encoder.Close()
+		zstdded := func() ([]byte, uint16) { return frame, flags | qtResourceCompressedZstd }
+		encodings = []func() ([]byte, uint16){zstdded, zlibbed, raw}
+		sizes = fmt.Sprintf("%d bytes uncompressed, %d bytes with zlib and %d bytes with zstd", len(contents), compressed.Len(), len(frame))
+	}
+	for _, encoding := range encodings {
+		if payload, flags := encoding(); len(payload) <= capacity {
+			return payload, flags, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("%s holds %d bytes but the replacement needs %s", original.path, capacity, sizes)
+}
+
+// replaceQtResource writes contents over resource in place. The size prefix
+// is updated, the rest of the old payload is zeroed and the node flags
+// follow the new compression, so nothing else in the tree moves.
+func replaceQtResource(tibiaBinary []byte, resource qtResource, contents []byte) ([]byte, string, error) {
+	payload, flags, err := encodeQtResource(contents, resource.size, resource)
+	if err != nil {
+		return nil, "", err
+	}
+	patched := append([]byte(nil), tibiaBinary...)
+	binary.BigEndian.PutUint32(patched[resource.dataOffset:], uint32(len(payload)))
+	start := resource.dataOffset + 4
+	copy(patched[start:start+resource.size], make([]byte, resource.size))
+	copy(patched[start:], payload)
+	binary.BigEndian.PutUint16(patched[resource.nodeOffset+4:], flags)
+	replaced := resource
+	replaced.flags = flags
+	return patched, replaced.compression(), nil
+}
+
+// normalizeQtResourcePath accepts :/images/logo.png, /images/logo.png and
+// images/logo.png alike.
+func normalizeQtResourcePath(resourcePath string) string {
+	return ":" + path.Clean("/"+strings.TrimPrefix(resourcePath, ":"))
+}
+
+func readQtResourceTrees(tibiaExe string) ([]byte, []qtResourceTree) {
+	tibiaBinary, err := os.ReadFile(tibiaExe)
+	if err != nil {
+		fmt.Printf("[ERROR] Unable to read %s: %s\n", tibiaExe, err)
+		os.Exit(1)
+	}
+	peData := inspectExecutable(tibiaBinary)
+	if !peData.valid {
+		fmt.Printf("[ERROR] Unable to parse %s: %s\n", tibiaExe, peData.errorText)
+		os.Exit(1)
+	}
+	trees := findQtResourceTrees(tibiaBinary, peData)
+	if len(trees) == 0 {
+		fmt.Printf("[WARN] No qRegisterResourceData call with a readable resource tree found in %s\n", tibiaExe)
+	}
+	return tibiaBinary, trees
+}
+
+// ListQtResources prints every registered Qt resource tree and its files.
+func ListQtResources(options QtResourceOptions) {
+	tibiaBinary, trees := readQtResourceTrees(options.TibiaExe)
+	for number, tree := range trees {
+		fmt.Printf("[INFO] Resource tree %d @0x%X (format %d, registered @0x%X): %d file(s)\n", number+1, tree.tree, tree.version, tree.registration, len(tree.resources))
+		for _, resource := range tree.resources {
+			fmt.Printf("[INFO]   %s\n", resource.describe(tibiaBinary))
+		}
+	}
+}
+
+// ExtractQtResources writes the resources matching options.Resource, every
+// one by default, unpacked below options.OutputDir.
+func ExtractQtResources(options QtResourceOptions) {
+	pattern := "*"
+	if options.Resource != "" {
+		pattern = normalizeQtResourcePath(options.Resource)
+		if _, err := path.Match(pattern, ""); err != nil {
+			fmt.Printf("[ERROR] Invalid resource pattern %q: %s\n", options.Resource, err)
+			os.Exit(1)
+		}
+	}
+	tibiaBinary, trees := readQtResourceTrees(options.TibiaExe)
+
+	written := make(map[string]struct{})
+	extracted := 0
+	for _, tree := range trees {
+		for _, resource := range tree.resources {
+			if pattern != "*" {
+				if matched, _ := path.Match(pattern, resource.path); !matched {
+					continue
+				}
+			}
+			outputPath, err := qtResourceOutputPath(options.OutputDir, resource.path)
+			if err != nil {
+				fmt.Printf("[ERROR] %s\n", err.Error())
+				os.Exit(1)
+			}
+			contents, err := resource.contents(tibiaBinary)
+			if err != nil {
+				fmt.Printf("[ERROR] %s\n", err.Error())
+				os.Exit(1)
+			}
+			if _, ok := written[outputPath]; ok {
+				fmt.Printf("[WARN] %s occurs more than once; keeping the first copy\n", resource.path)
+				continue
+			}
+			written[outputPath] = struct{}{}
+			if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+				fmt.Printf("[ERROR] %s\n", err.Error())
+				os.Exit(1)
+			}
+			if err := os.WriteFile(outputPath, contents, 0644); err != nil {
+				fmt.Printf("[ERROR] %s\n", err.Error())
+				os.Exit(1)
+			}
+			fmt.Printf("[INFO] %s -> %s (%d bytes)\n", resource.path, outputPath, len(contents))
+			extracted++
+		}
+	}
+	if extracted == 0 && pattern != "*" {
+		fmt.Printf("[ERROR] No resource matches %s\n", pattern)
+		os.Exit(1)
+	}
+	fmt.Printf("[INFO] Extracted %d resource(s) to %s\n", extracted, options.OutputDir)
+}
+
+// qtResourceOutputPath maps a :/ resource path below outputDir and refuses
+// any path that would end up outside it.
+func qtResourceOutputPath(outputDir string, resourcePath string) (string, error) {
+	relative := filepath.FromSlash(strings.TrimPrefix(resourcePath, ":/"))
+	outputPath := filepath.Join(outputDir, relative)
+	if inside, err := filepath.Rel(outputDir, outputPath); err != nil || filepath.IsAbs(relative) || inside == "." || inside == ".." || strings.HasPrefix(inside, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("resource %s does not map to a file below %s", resourcePath, outputDir)
+	}
+	return outputPath, nil
+}
+
+// ReplaceQtResource writes options.File over every copy of the resource at
+// options.Resource. The client is backed up first and keeps its size.
+func ReplaceQtResource(options QtResourceOptions) {
+	contents, err := os.ReadFile(options.File)
+	if err != nil {
+		fmt.Printf("[ERROR] Unable to read %s: %s\n", options.File, err)
+		os.Exit(1)
+	}
+	resourcePath := normalizeQtResourcePath(options.Resource)
+	sourceBinary, trees := readQtResourceTrees(options.TibiaExe)
+
+	tibiaBinary := sourceBinary
+	replaced := 0
+	for _, tree := range trees {
+		for _, resource := range tree.resources {
+			if resource.path != resourcePath {
+				continue
+			}
+			var encoding string
+			if tibiaBinary, encoding, err = replaceQtResource(tibiaBinary, resource, contents); err != nil {
+				fmt.Printf("[ERROR] %s\n", err.Error())
+				os.Exit(1)
+			}
+			fmt.Printf("[PATCH] %s @0x%X: %d -> %d bytes stored (%s, %d bytes unpacked)\n", resource.path, resource.dataOffset, resource.size, binary.BigEndian.Uint32(tibiaBinary[resource.dataOffset:]), encoding, len(contents))
+			replaced++
+		}
+	}
+	if replaced == 0 {
+		fmt.Printf("[ERROR] No resource %s found in %s\n", resourcePath, options.TibiaExe)
+		os.Exit(1)
+	}
+	if options.DryRun {
+		fmt.Printf("[INFO] Dry run: %s left unchanged\n", options.TibiaExe)
+		return
+	}
+
+	if isWindowsExecutable(options.TibiaExe, tibiaBinary) {
+		if tibiaBinary, _, err = finalizePEImage(tibiaBinary, false); err != nil {
+			fmt.Printf("[ERROR] %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+	if isMachOExecutable(tibiaBinary) {
+		if err := finalizeMachOCodeSignature(tibiaBinary, false); err != nil {
+			fmt.Printf("[ERROR] %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+	if _, err := backupTibiaExecutable(options.TibiaExe, sourceBinary, false); err != nil {
+		fmt.Printf("[ERROR] %s\n", err.Error())
+		os.Exit(1)
+	}
+	if err := exportModifiedFile(options.TibiaExe, tibiaBinary, len(sourceBinary)); err != nil {
+		fmt.Printf("[ERROR] %s\n", err.Error())
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,219 @@
+package edit
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	qtResourceFixtureTree  = 0x690
+	qtResourceFixtureNames = 0x6f0
+	qtResourceFixtureData  = 0x730
+)
+
+// newQtResourceFixture registers a format 2 tree holding :/images/logo.png,
+// zlib compressed, and :/images/motd.txt, stored raw, through a
+// qRegisterResourceData import the way rcc's generated initializer does.
+func newQtResourceFixture(t *testing.T, logo []byte) []byte {
+	t.Helper()
+	tibiaBinary := newRelocationFixture(t)
+	copy(tibiaBinary[0x400:0x600], bytes.Repeat([]byte{0xcc}, 0x200))
+	copy(tibiaBinary[0x600:0x800], make([]byte, 0x200))
+
+	binary.LittleEndian.PutUint32(tibiaBinary[0x600:], 0x2030)
+	binary.LittleEndian.PutUint32(tibiaBinary[0x60c:], 0x2080)
+	binary.LittleEndian.PutUint32(tibiaBinary[0x610:], 0x2040)
+	binary.LittleEndian.PutUint64(tibiaBinary[0x630:], 0x2050)
+	binary.LittleEndian.PutUint64(tibiaBinary[0x640:], 0x2050)
+	copy(tibiaBinary[0x652:], "?qRegisterResourceData@@YA_NHPEBE00@Z\x00")
+	copy(tibiaBinary[0x680:], "Qt6Core.dll\x00")
+	setFixtureDataDirectory(tibiaBinary, 1, 0x2000, 40)
+
+	writeXrefInstruction(tibiaBinary, 0x400, []byte{0x4c, 0x8d, 0x0d}, 0x2000+qtResourceFixtureData-0x600)
+	writeXrefInstruction(tibiaBinary, 0x407, []byte{0x4c, 0x8d, 0x05}, 0x2000+qtResourceFixtureNames-0x600)
+	writeXrefInstruction(tibiaBinary, 0x40e, []byte{0x48, 0x8d, 0x15}, 0x2000+qtResourceFixtureTree-0x600)
+	copy(tibiaBinary[0x415:], []byte{0xb9, 0x03, 0x00, 0x00, 0x00})
+	writeXrefInstruction(tibiaBinary, 0x41a, []byte{0xff, 0x15}, 0x2040)
+	tibiaBinary[0x420] = 0xc3
+
+	writeQtResourceNode := func(index int, name int, flags uint16, first int, second int) {
+		node := tibiaBinary[qtResourceFixtureTree+index*22:]
+		binary.BigEndian.PutUint32(node, uint32(name))
+		binary.BigEndian.PutUint16(node[4:], flags)
+		if flags&qtResourceDirectory != 0 {
+			binary.BigEndian.PutUint32(node[6:], uint32(first))
+		} else {
+			binary.BigEndian.PutUint16(node[8:], uint16(first))
+		}
+		binary.BigEndian.PutUint32(node[10:], uint32(second))
+	}
+	writeQtResourceNode(0, 0, qtResourceDirectory, 1, 1)
+	writeQtResourceNode(1, 0, qtResourceDirectory, 2, 2)
+	writeQtResourceNode(2, 18, qtResourceCompressed, 1, 0)
+	writeQtResourceNode(3, 40, 0, 1, 0x40)
+
+	names := tibiaBinary[qtResourceFixtureNames:qtResourceFixtureNames]
+	for _, name := range []string{"images", "logo.png", "motd.txt"} {
+		names = binary.BigEndian.AppendUint16(names, uint16(len(name)))
+		names = binary.BigEndian.AppendUint32(names, 0x1234)
+		for _, unit := range utf16.Encode([]rune(name)) {
+			names = binary.BigEndian.AppendUint16(names, unit)
+		}
+	}
+
+	var compressed bytes.Buffer
+	writer := zlib.NewWriter(&compressed)
+	writer.Write(logo)
+	writer.Close()
+	data := tibiaBinary[qtResourceFixtureData:qtResourceFixtureData]
+	data = binary.BigEndian.AppendUint32(data, uint32(4+compressed.Len()))
+	data = binary.BigEndian.AppendUint32(data, uint32(len(logo)))
+	data = append(data, compressed.Bytes()...)
+	if len(data) > 0x40 {
+		t.Fatalf("logo needs %d bytes of fixture data", len(data))
+	}
+	motd := tibiaBinary[qtResourceFixtureData+0x40 : qtResourceFixtureData+0x40]
+	motd = binary.BigEndian.AppendUint32(motd, 17)
+	motd = append(motd, "Welcome to Tibia\n"...)
+	return tibiaBinary
+}
+
+func TestFindQtResourceTreesFollowsRegistration(t *testing.T) {
+	logo := bytes.Repeat([]byte("tibia logo "), 16)
+	tibiaBinary := newQtResourceFixture(t, logo)
+
+	trees := findQtResourceTrees(tibiaBinary, inspectExecutable(tibiaBinary))
+	if len(trees) != 1 || trees[0].registration != 0x41a || trees[0].version != 3 || trees[0].tree != qtResourceFixtureTree {
+		t.Fatalf("expected one format 3 tree registered @0x41A, got %+v", trees)
+	}
+	resources := trees[0].resources
+	if len(resources) != 2 || resources[0].path != ":/images/logo.png" || resources[1].path != ":/images/motd.txt" {
+		t.Fatalf("expected logo.png and motd.txt below images, got %+v", resources)
+	}
+	if contents, err := resources[0].contents(tibiaBinary); err != nil || !bytes.Equal(contents, logo) {
+		t.Fatalf("expected the logo to unpack, got %q err=%v", contents, err)
+	}
+	if contents, err := resources[1].contents(tibiaBinary); err != nil || string(contents) != "Welcome to Tibia\n" {
+		t.Fatalf("expected the raw motd, got %q err=%v", contents, err)
+	}
+}
+
+func TestReplaceQtResourceKeepsSlotSize(t *testing.T) {
+	tibiaBinary := newQtResourceFixture(t, bytes.Repeat([]byte("tibia logo "), 16))
+	resources := findQtResourceTrees(tibiaBinary, inspectExecutable(tibiaBinary))[0].resources
+
+	logo := bytes.Repeat([]byte("ot"), 100)
+	patched, encoding, err := replaceQtResource(tibiaBinary, resources[0], logo)
+	if err != nil || encoding != "zlib" {
+		t.Fatalf("expected the larger logo to fit compressed, got %q err=%v", encoding, err)
+	}
+	if len(patched) != len(tibiaBinary) {
+		t.Fatalf("expected the client size to be kept, got %d", len(patched))
+	}
+	replaced := findQtResourceTrees(patched, inspectExecutable(patched))[0].resources
+	if contents, err := replaced[0].contents(patched); err != nil || !bytes.Equal(contents, logo) {
+		t.Fatalf("expected the new logo to unpack, got %q err=%v", contents, err)
+	}
+	if contents, _ := replaced[1].contents(patched); string(contents) != "Welcome to Tibia\n" {
+		t.Fatalf("expected the neighbouring resource to be untouched, got %q", contents)
+	}
+
+	patched, encoding, err = replaceQtResource(tibiaBinary, resources[1], []byte("Hello OT\n"))
+	if err != nil || encoding != "none" {
+		t.Fatalf("expected the shorter motd to be stored raw, got %q err=%v", encoding, err)
+	}
+	if contents, _ := findQtResourceTrees(patched, inspectExecutable(patched))[0].resources[1].contents(patched); string(contents) != "Hello OT\n" {
+		t.Fatalf("expected the new motd, got %q", contents)
+	}
+
+	noise := make([]byte, 64)
+	for index := range noise {
+		noise[index] = byte(index * 73)
+	}
+	if _, _, err := replaceQtResource(tibiaBinary, resources[1], noise); err == nil || !strings.Contains(err.Error(), "holds 17 bytes") {
+		t.Fatalf("expected an incompressible replacement that does not fit to fail, got %v", err)
+	}
+}
+
+func TestQtResourceZstdEntriesUnpackAndReencode(t *testing.T) {
+	tibiaBinary := newQtResourceFixture(t, []byte("logo"))
+	logo := bytes.Repeat([]byte("tibia logo "), 16)
+	encoder, _ := zstd.NewWriter(nil, zstd.WithSingleSegment(true))
+	frame := encoder.EncodeAll(logo, nil)
+	if len(frame) > 0x3c {
+		t.Fatalf("logo needs %d bytes of fixture data", len(frame))
+	}
+	data := tibiaBinary[qtResourceFixtureData : qtResourceFixtureData+0x40]
+	copy(data, make([]byte, len(data)))
+	binary.BigEndian.PutUint32(data, uint32(len(frame)))
+	copy(data[4:], frame)
+	binary.BigEndian.PutUint16(tibiaBinary[qtResourceFixtureTree+2*22+4:], qtResourceCompressedZstd)
+
+	resources := findQtResourceTrees(tibiaBinary, inspectExecutable(tibiaBinary))[0].resources
+	if contents, err := resources[0].contents(tibiaBinary); err != nil || !bytes.Equal(contents, logo) {
+		t.Fatalf("expected the zstd logo to unpack, got %q err=%v", contents, err)
+	}
+	if description := resources[0].describe(tibiaBinary); !strings.Contains(description, "zstd (176 bytes unpacked)") {
+		t.Fatalf("expected the unpacked size in %q", description)
+	}
+
+	replacement := bytes.Repeat([]byte("ot "), 60)
+	patched, encoding, err := replaceQtResource(tibiaBinary, resources[0], replacement)
+	if err != nil || encoding != "zstd" {
+		t.Fatalf("expected the replacement to be zstd compressed, got %q err=%v", encoding, err)
+	}
+	replaced := findQtResourceTrees(patched, inspectExecutable(patched))[0].resources[0]
+	var header zstd.Header
+	if err := header.Decode(replaced.payload(patched)); err != nil || !header.HasFCS || header.FrameContentSize != uint64(len(replacement)) {
+		t.Fatalf("expected a frame that records its content size for Qt, got %+v err=%v", header, err)
+	}
+	if contents, err := replaced.contents(patched); err != nil || !bytes.Equal(contents, replacement) {
+		t.Fatalf("expected the new logo to unpack, got %q err=%v", contents, err)
+	}
+}
+
+func TestQtResourcePathsStayBelowTheOutputDirectory(t *testing.T) {
+	for _, name := range []string{".", "..", "images/logo.png", "images\\logo.png"} {
+		entry := binary.BigEndian.AppendUint16(nil, uint16(len(name)))
+		entry = binary.BigEndian.AppendUint32(entry, 0x1234)
+		for _, unit := range utf16.Encode([]rune(name)) {
+			entry = binary.BigEndian.AppendUint16(entry, unit)
+		}
+		if _, err := qtResourceName(entry, 0); err == nil {
+			t.Fatalf("expected the resource name %q to be refused", name)
+		}
+	}
+
+	outputDir := filepath.Join(t.TempDir(), "out")
+	if outputPath, err := qtResourceOutputPath(outputDir, ":/images/logo.png"); err != nil || outputPath != filepath.Join(outputDir, "images", "logo.png") {
+		t.Fatalf("expected the resource below the output directory, got %s err=%v", outputPath, err)
+	}
+	for _, resourcePath := range []string{":/../logo.png", ":/images/../../logo.png", ":/"} {
+		if _, err := qtResourceOutputPath(outputDir, resourcePath); err == nil {
+			t.Fatalf("expected %s to be refused", resourcePath)
+		}
+	}
+}
+
+func TestExtractQtResourcesWritesMatchingFiles(t *testing.T) {
+	workDir := t.TempDir()
+	tibiaPath := filepath.Join(workDir, "client.exe")
+	writeTestFile(t, tibiaPath, newQtResourceFixture(t, []byte("logo")))
+
+	ExtractQtResources(QtResourceOptions{TibiaExe: tibiaPath, Resource: "images/*.txt", OutputDir: filepath.Join(workDir, "out")})
+
+	if contents, err := os.ReadFile(filepath.Join(workDir, "out", "images", "motd.txt")); err != nil || string(contents) != "Welcome to Tibia\n" {
+		t.Fatalf("expected motd.txt to be extracted, got %q err=%v", contents, err)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, "out", "images", "logo.png")); !os.IsNotExist(err) {
+		t.Fatalf("expected logo.png not to match the pattern, got %v", err)
+	}
+}
@@ -0,0 +1,440 @@
+package edit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+)
+
+const (
+	urlRelocationSectionName            = ".cedit"
+	urlRelocationSectionCharacteristics = 0x40000040 // initialized data, readable
+	peSectionHeaderSize                 = 40
+	peSecurityDirectoryIndex            = 4
+	urlRelocationLengthSearchRadius     = 32
+)
+
+// peHeaderLayout holds the file offsets and values of the PE headers that a
+// section-level rewrite has to update.
+type peHeaderLayout struct {
+	optionalHeaderOffset int
+	sectionTableOffset   int
+	numberOfSections     int
+	pe32Plus             bool
+	sectionAlignment     int
+	fileAlignment        int
+	sizeOfHeaders        int
+	dataDirectoryOffset  int
+	dataDirectoryCount   int
+}
+
+type peSectionHeader struct {
+	headerOffset     int
+	name             string
+	virtualSize      int
+	virtualAddress   int
+	sizeOfRawData    int
+	pointerToRawData int
+}
+
+// urlRelocation describes the embedded URL block moved into its own section
+// and the RIP-relative instructions that were pointed at the copy.
+type urlRelocation struct {
+	blockOffset   int
+	blockRVA      int
+	sectionOffset int
+	sectionRVA    int
+	references    []x86Instruction
+	before        []byte
+	after         []byte
+	substitutions []propertySubstitution
+}
+
+func readPEHeaderLayout(tibiaBinary []byte) (peHeaderLayout, error) {
+	var layout peHeaderLayout
+	if len(tibiaBinary) < 0x40 || !bytes.HasPrefix(tibiaBinary, []byte("MZ")) {
+		return layout, fmt.Errorf("missing DOS header")
+	}
+	peOffset := int(binary.LittleEndian.Uint32(tibiaBinary[0x3c:]))
+	if peOffset < 0 || peOffset+24 > len(tibiaBinary) || !bytes.Equal(tibiaBinary[peOffset:peOffset+4], []byte("PE\x00\x00")) {
+		return layout, fmt.Errorf("missing PE signature")
+	}
+	layout.numberOfSections = int(binary.LittleEndian.Uint16(tibiaBinary[peOffset+6:]))
+	optionalHeaderSize := int(binary.LittleEndian.Uint16(tibiaBinary[peOffset+20:]))
+	layout.optionalHeaderOffset = peOffset + 24
+	layout.sectionTableOffset = layout.optionalHeaderOffset + optionalHeaderSize
+	if layout.optionalHeaderOffset+68 > len(tibiaBinary) || layout.sectionTableOffset+layout.numberOfSections*peSectionHeaderSize > len(tibiaBinary) {
+		return layout, fmt.Errorf("truncated PE headers")
+	}
+
+	optionalHeader := tibiaBinary[layout.optionalHeaderOffset:]
+	switch binary.LittleEndian.Uint16(optionalHeader) {
+	case 0x20b:
+		layout.pe32Plus = true
+		layout.dataDirectoryOffset = layout.optionalHeaderOffset + 112
+		layout.dataDirectoryCount = int(binary.LittleEndian.Uint32(optionalHeader[108:]))
+	case 0x10b:
+		layout.dataDirectoryOffset = layout.optionalHeaderOffset + 96
+		layout.dataDirectoryCount = int(binary.LittleEndian.Uint32(optionalHeader[92:]))
+	default:
+		return layout, fmt.Errorf("unknown optional header magic 0x%X", binary.LittleEndian.Uint16(optionalHeader))
+	}
+	layout.sectionAlignment = int(binary.LittleEndian.Uint32(optionalHeader[32:]))
+	layout.fileAlignment = int(binary.LittleEndian.Uint32(optionalHeader[36:]))
+	layout.sizeOfHeaders = int(binary.LittleEndian.Uint32(optionalHeader[60:]))
+	if layout.sectionAlignment <= 0 || layout.fileAlignment <= 0 {
+		return layout, fmt.Errorf("invalid section or file alignment")
+	}
+	return layout, nil
+}
+
+func (layout peHeaderLayout) sections(tibiaBinary []byte) []peSectionHeader {
+	sections := make([]peSectionHeader, 0, layout.numberOfSections)
+	for index := 0; index < layout.numberOfSections; index++ {
+		headerOffset := layout.sectionTableOffset + index*peSectionHeaderSize
+		header := tibiaBinary[headerOffset : headerOffset+peSectionHeaderSize]
+		sections = append(sections, peSectionHeader{
+			headerOffset:     headerOffset,
+			name:             strings.TrimRight(string(header[:8]), "\x00"),
+			virtualSize:      int(binary.LittleEndian.Uint32(header[8:])),
+			virtualAddress:   int(binary.LittleEndian.Uint32(header[12:])),
+			sizeOfRawData:    int(binary.LittleEndian.Uint32(header[16:])),
+			pointerToRawData: int(binary.LittleEndian.Uint32(header[20:])),
+		})
+	}
+	return sections
+}
+
+// dataDirectory returns the RVA (or file offset for the security directory)
+// and size of a data directory entry.
+func (layout peHeaderLayout) dataDirectory(tibiaBinary []byte, index int) (int, int, int) {
+	if index >= layout.dataDirectoryCount {
+		return 0, 0, -1
+	}
+	entryOffset := layout.dataDirectoryOffset + index*8
+	if entryOffset+8 > len(tibiaBinary) {
+		return 0, 0, -1
+	}
+	return int(binary.LittleEndian.Uint32(tibiaBinary[entryOffset:])), int(binary.LittleEndian.Uint32(tibiaBinary[entryOffset+4:])), entryOffset
+}
+
+func alignUp(value int, alignment int) int {
+	return (value + alignment - 1) / alignment * alignment
+}
+
+func hasRelocatedURLBlock(tibiaBinary []byte) bool {
+	if !isWindowsExecutable("", tibiaBinary) {
+		return false
+	}
+	for _, section := range inspectPE(tibiaBinary).sections {
+		if section.name == urlRelocationSectionName {
+			return true
+		}
+	}
+	return false
+}
+
+// urlsFitInPlace reports whether every configured value fits the space of the
+// stock value, so the in-place rewrite can be used.
+func urlsFitInPlace(tibiaBinary []byte, configValues map[string]string) bool {
+	for property, value := range configValues {
+		if capacity, ok := configValueCapacity(tibiaBinary, property); ok && len(value) > capacity {
+			return false
+		}
+	}
+	return true
+}
+
+// locateURLBlock returns the file offset and length of the string literal
+// holding the embedded config. A previous relocation takes precedence over
+// the stock literal, which is then no longer referenced.
+func locateURLBlock(tibiaBinary []byte, peData peInfo) (int, int, error) {
+	for _, section := range peData.sections {
+		if section.name != urlRelocationSectionName {
+			continue
+		}
+		end := bytes.IndexByte(tibiaBinary[section.rawStart:section.rawEnd], 0)
+		if end <= 0 {
+			return 0, 0, fmt.Errorf("%s section does not hold a URL block", urlRelocationSectionName)
+		}
+		return section.rawStart, end, nil
+	}
+	return locateStockURLBlock(tibiaBinary, peData)
+}
+
+// locateStockURLBlock returns the file offset and length of the URL block the
+// client shipped with, whether or not it is still referenced.
+func locateStockURLBlock(tibiaBinary []byte, peData peInfo) (int, int, error) {
+	markerOffset := bytes.Index(tibiaBinary, []byte(configINIStartMarker))
+	if markerOffset == -1 {
+		return 0, 0, fmt.Errorf("embedded %s block not found", configINIStartMarker)
+	}
+	section, ok := peData.sectionForOffset(markerOffset)
+	if !ok || section.isCode {
+		return 0, 0, fmt.Errorf("embedded %s block @0x%X is not in a data section", configINIStartMarker, markerOffset)
+	}
+	start := markerOffset
+	for start > section.rawStart && isConfigINITextByte(tibiaBinary[start-1]) {
+		start--
+	}
+	block, ok := extractEmbeddedConfigINIBlock(tibiaBinary[markerOffset:section.rawEnd])
+	if !ok || markerOffset+len(block) >= section.rawEnd || tibiaBinary[markerOffset+len(block)] != 0 {
+		return 0, 0, fmt.Errorf("embedded %s block @0x%X is not a NUL-terminated string", configINIStartMarker, markerOffset)
+	}
+	return start, markerOffset + len(block) - start, nil
+}
+
+func isConfigINITextByte(value byte) bool {
+	return value == '\r' || value == '\n' || value == '\t' || (value >= 0x20 && value <= 0x7e)
+}
+
+// verifyURLBlockReferences applies the structural checks that gate the
+// relocation: every reference must be an address load inside a known
+// function, no code near it may carry the block length as an immediate, and
+// no absolute pointer may target the block.
+func verifyURLBlockReferences(tibiaBinary []byte, peData peInfo, blockRVA int, blockLength int, references []x86Instruction) error {
+	if len(references) == 0 {
+		return fmt.Errorf("no RIP-relative reference to the URL block at RVA 0x%X", blockRVA)
+	}
+	lengthImmediates := [][]byte{
+		binary.LittleEndian.AppendUint32(nil, uint32(blockLength)),
+		binary.LittleEndian.AppendUint32(nil, uint32(blockLength+1)),
+	}
+	for _, reference := range references {
+		if !reference.isAddressLoad() {
+			return fmt.Errorf("reference @0x%X is %q, not an address load", reference.offset, reference.text())
+		}
+		if len(peData.runtimeFunctions) > 0 && !peData.codeRangeWithinRuntimeFunction(reference.offset, reference.length, false) {
+			return fmt.Errorf("reference @0x%X is outside the runtime function table", reference.offset)
+		}
+		windowStart, window := bytesAroundRange(tibiaBinary, reference.offset, reference.length, urlRelocationLengthSearchRadius)
+		for _, immediate := range lengthImmediates {
+			if index := bytes.Index(window, immediate); index != -1 {
+				return fmt.Errorf("reference @0x%X has the block length %d as an immediate @0x%X", reference.offset, blockLength, windowStart+index)
+			}
+		}
+	}
+
+	absoluteTarget := binary.LittleEndian.AppendUint64(nil, peData.imageBase+uint64(blockRVA))
+	for _, section := range peData.sections {
+		if section.isCode {
+			continue
+		}
+		if index := bytes.Index(tibiaBinary[section.rawStart:section.rawEnd], absoluteTarget); index != -1 {
+			return fmt.Errorf("absolute pointer to the URL block @0x%X in %s", section.rawStart+index, section.name)
+		}
+	}
+	return nil
+}
+
+// rewriteURLBlock replaces the value of every configured key in the block.
+// Values keep their key order and line endings and are never padded.
+func rewriteURLBlock(block []byte, configValues map[string]string) ([]byte, []propertySubstitution, error) {
+	lines := bytes.SplitAfter(block, []byte("\n"))
+	rewritten := make([]byte, 0, len(block)+256)
+	substitutions := make([]propertySubstitution, 0, len(configValues))
+	found := make(map[string]bool)
+	for _, line := range lines {
+		content := bytes.TrimRight(line, "\r\n")
+		lineEnding := line[len(content):]
+		key, value, ok := splitConfigINILine(string(content))
+		newValue, configured := configValues[key]
+		if !ok || !configured || found[key] {
+			rewritten = append(rewritten, line...)
+			continue
+		}
+		found[key] = true
+		substitution := propertySubstitution{
+			name:   key,
+			offset: len(rewritten) + len(key) + 1,
+			before: strings.TrimRight(value, string(paddingByte)),
+			after:  newValue,
+		}
+		substitutions = append(substitutions, substitution)
+		rewritten = append(rewritten, key+"="+newValue...)
+		rewritten = append(rewritten, lineEnding...)
+	}
+	for _, property := range sortedKeys(configValues) {
+		if !found[property] {
+			return nil, nil, fmt.Errorf("%s is not part of the embedded URL block", property)
+		}
+	}
+	return rewritten, substitutions, nil
+}
+
+// relocateURLBlock copies the embedded URL block with the configured values
+// into a dedicated section at the end of the image and points every verified
+// reference at the copy. The stock literal stays untouched.
+func relocateURLBlock(tibiaBinary []byte, configValues map[string]string) ([]byte, urlRelocation, error) {
+	var relocation urlRelocation
+	if !isWindowsExecutable("", tibiaBinary) {
+		return nil, relocation, fmt.Errorf("URL relocation is only supported for PE clients")
+	}
+	peData := inspectPE(tibiaBinary)
+	if !peData.valid {
+		return nil, relocation, fmt.Errorf("PE parsing failed: %s", peData.errorText)
+	}
+	layout, err := readPEHeaderLayout(tibiaBinary)
+	if err != nil {
+		return nil, relocation, err
+	}
+	if !layout.pe32Plus {
+		return nil, relocation, fmt.Errorf("URL relocation needs a 64-bit client with RIP-relative references")
+	}
+
+	blockOffset, blockLength, err := locateURLBlock(tibiaBinary, peData)
+	if err != nil {
+		return nil, relocation, err
+	}
+	blockRVA, _ := peData.rvaForOffset(blockOffset)
+	references := findRIPRelativeReferences(tibiaBinary, peData, blockRVA)
+	if err := verifyURLBlockReferences(tibiaBinary, peData, blockRVA, blockLength, references); err != nil {
+		return nil, relocation, err
+	}
+	relocation.blockOffset = blockOffset
+	relocation.blockRVA = blockRVA
+	relocation.references = references
+	relocation.before = append([]byte(nil), tibiaBinary[blockOffset:blockOffset+blockLength]...)
+	relocation.after, relocation.substitutions, err = rewriteURLBlock(relocation.before, configValues)
+	if err != nil {
+		return nil, relocation, err
+	}
+
+	relocated, err := dropTrailingCertificate(append([]byte(nil), tibiaBinary...), layout)
+	if err != nil {
+		return nil, relocation, err
+	}
+	relocated, layout, err = removeURLRelocationSection(relocated, layout)
+	if err != nil {
+		return nil, relocation, err
+	}
+	relocated, relocation.sectionOffset, relocation.sectionRVA, err = appendPESection(relocated, layout, urlRelocationSectionName, append(append([]byte(nil), relocation.after...), 0))
+	if err != nil {
+		return nil, relocation, err
+	}
+
+	for _, reference := range references {
+		instructionRVA, _ := peData.rvaForOffset(reference.offset)
+		displacement := int64(relocation.sectionRVA) - int64(instructionRVA+reference.length)
+		if displacement < math.MinInt32 || displacement > math.MaxInt32 {
+			return nil, relocation, fmt.Errorf("reference @0x%X cannot reach the relocated block", reference.offset)
+		}
+		binary.LittleEndian.PutUint32(relocated[reference.offset+reference.displacementOffset:], uint32(int32(displacement)))
+	}
+
+	relocatedPE := inspectPE(relocated)
+	if !relocatedPE.valid {
+		return nil, relocation, fmt.Errorf("relocated client failed PE parsing: %s", relocatedPE.errorText)
+	}
+	if verified := findRIPRelativeReferences(relocated, relocatedPE, relocation.sectionRVA); len(verified) != len(references) {
+		return nil, relocation, fmt.Errorf("relocated block has %d reference(s), expected %d", len(verified), len(references))
+	}
+	return relocated, relocation, nil
+}
+
+// removeURLRelocationSection drops a section left by a previous relocation so
+// the block is rebuilt in the same place. It must be the last section and
+// dropTrailingCertificate must have removed any overlay first.
+func removeURLRelocationSection(tibiaBinary []byte, layout peHeaderLayout) ([]byte, peHeaderLayout, error) {
+	return removeTrailingPESection(tibiaBinary, layout, urlRelocationSectionName)
+}
+
+// removeTrailingPESection drops the section called name, which must be the
+// last one. A missing section is not an error.
+func removeTrailingPESection(tibiaBinary []byte, layout peHeaderLayout, name string) ([]byte, peHeaderLayout, error) {
+	sections := layout.sections(tibiaBinary)
+	for index, section := range sections {
+		if section.name != name {
+			continue
+		}
+		if index != len(sections)-1 {
+			return nil, layout, fmt.Errorf("%s section is not the last section", name)
+		}
+		tibiaBinary = tibiaBinary[:section.pointerToRawData]
+		copy(tibiaBinary[section.headerOffset:section.headerOffset+peSectionHeaderSize], make([]byte, peSectionHeaderSize))
+		layout.numberOfSections--
+		binary.LittleEndian.PutUint16(tibiaBinary[layout.optionalHeaderOffset-18:], uint16(layout.numberOfSections))
+		adjustSizeOfInitializedData(tibiaBinary, layout, -section.sizeOfRawData)
+		return tibiaBinary, layout, nil
+	}
+	return tibiaBinary, layout, nil
+}
+
+// dropTrailingCertificate removes an Authenticode certificate at the end of
+// the file. Any edit already invalidates it, and a section cannot be appended
+// in front of it. Other overlay data is refused.
+func dropTrailingCertificate(tibiaBinary []byte, layout peHeaderLayout) ([]byte, error) {
+	rawEnd := 0
+	for _, section := range layout.sections(tibiaBinary) {
+		if end := section.pointerToRawData + section.sizeOfRawData; end > rawEnd {
+			rawEnd = end
+		}
+	}
+	certificateOffset, certificateSize, entryOffset := layout.dataDirectory(tibiaBinary, peSecurityDirectoryIndex)
+	overlayEnd := len(tibiaBinary)
+	if certificateSize > 0 {
+		if certificateOffset < rawEnd || certificateOffset+certificateSize != len(tibiaBinary) {
+			return nil, fmt.Errorf("certificate table @0x%X is not at the end of the file", certificateOffset)
+		}
+		fmt.Printf("[WARN] Dropping the Authenticode certificate; it no longer matches the edited client\n")
+		copy(tibiaBinary[entryOffset:entryOffset+8], make([]byte, 8))
+		overlayEnd = certificateOffset
+	}
+	for _, value := range tibiaBinary[rawEnd:overlayEnd] {
+		if value != 0 {
+			return nil, fmt.Errorf("overlay data follows the last section @0x%X", rawEnd)
+		}
+	}
+	return tibiaBinary[:rawEnd], nil
+}
+
+// appendPESection adds a readable data section holding data after the last
+// section and returns its file offset and RVA.
+func appendPESection(tibiaBinary []byte, layout peHeaderLayout, name string, data []byte) ([]byte, int, int, error) {
+	headerOffset := layout.sectionTableOffset + layout.numberOfSections*peSectionHeaderSize
+	if headerOffset+peSectionHeaderSize > layout.sizeOfHeaders {
+		return nil, 0, 0, fmt.Errorf("no room for another section header")
+	}
+	for _, value := range tibiaBinary[headerOffset : headerOffset+peSectionHeaderSize] {
+		if value != 0 {
+			return nil, 0, 0, fmt.Errorf("no free section header slot @0x%X", headerOffset)
+		}
+	}
+
+	virtualEnd := 0
+	for _, section := range layout.sections(tibiaBinary) {
+		size := section.virtualSize
+		if section.sizeOfRawData > size {
+			size = section.sizeOfRawData
+		}
+		if end := section.virtualAddress + size; end > virtualEnd {
+			virtualEnd = end
+		}
+	}
+	sectionRVA := alignUp(virtualEnd, layout.sectionAlignment)
+	sectionOffset := alignUp(len(tibiaBinary), layout.fileAlignment)
+	rawSize := alignUp(len(data), layout.fileAlignment)
+
+	header := tibiaBinary[headerOffset : headerOffset+peSectionHeaderSize]
+	copy(header, name)
+	binary.LittleEndian.PutUint32(header[8:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(header[12:], uint32(sectionRVA))
+	binary.LittleEndian.PutUint32(header[16:], uint32(rawSize))
+	binary.LittleEndian.PutUint32(header[20:], uint32(sectionOffset))
+	binary.LittleEndian.PutUint32(header[36:], urlRelocationSectionCharacteristics)
+	binary.LittleEndian.PutUint16(tibiaBinary[layout.optionalHeaderOffset-18:], uint16(layout.numberOfSections+1))
+	binary.LittleEndian.PutUint32(tibiaBinary[layout.optionalHeaderOffset+56:], uint32(alignUp(sectionRVA+len(data), layout.sectionAlignment)))
+	adjustSizeOfInitializedData(tibiaBinary, layout, rawSize)
+
+	tibiaBinary = append(tibiaBinary, make([]byte, sectionOffset-len(tibiaBinary))...)
+	tibiaBinary = append(tibiaBinary, data...)
+	tibiaBinary = append(tibiaBinary, make([]byte, rawSize-len(data))...)
+	return tibiaBinary, sectionOffset, sectionRVA, nil
+}
+
+func adjustSizeOfInitializedData(tibiaBinary []byte, layout peHeaderLayout, delta int) {
+	field := tibiaBinary[layout.optionalHeaderOffset+8:]
+	binary.LittleEndian.PutUint32(field, uint32(int(binary.LittleEndian.Uint32(field))+delta))
+}
@@ -0,0 +1,135 @@
+package edit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+const (
+	relocationFixtureBlockOffset     = 0x620
+	relocationFixtureReferenceOffset = 0x420
+)
+
+func TestRelocateURLBlockAppendsSectionAndRewritesReferences(t *testing.T) {
+	tibiaBinary := newRelocationFixture(t)
+	certificate := bytes.Repeat([]byte{0xcc}, 0x10)
+	tibiaBinary = append(tibiaBinary, certificate...)
+	setFixtureDataDirectory(tibiaBinary, peSecurityDirectoryIndex, 0x800, len(certificate))
+	longURL := "https://login.example-production-server.com/api/v1/login.php"
+
+	relocated, relocation, err := relocateURLBlock(tibiaBinary, map[string]string{"loginWebService": longURL, "clientWebService": "http://127.0.0.1"})
+	if err != nil {
+		t.Fatalf("expected relocation to pass verification: %s", err)
+	}
+
+	peData := inspectPE(relocated)
+	section := peData.sections[len(peData.sections)-1]
+	if !peData.valid || section.name != urlRelocationSectionName || relocation.sectionRVA != 0x3000 || relocation.sectionOffset != 0x800 {
+		t.Fatalf("expected a %s section at RVA 0x3000, got %+v relocation=%+v", urlRelocationSectionName, peData.sections, relocation)
+	}
+	expectedBlock := "[URLS]\nloginWebService=" + longURL + "\nclientWebService=http://127.0.0.1\n\x00"
+	if !bytes.HasPrefix(relocated[section.rawStart:], []byte(expectedBlock)) {
+		t.Fatalf("unexpected relocated block %q", relocated[section.rawStart:section.rawStart+len(expectedBlock)])
+	}
+	if references := findRIPRelativeReferences(relocated, peData, relocation.sectionRVA); len(references) != 1 || references[0].offset != relocationFixtureReferenceOffset {
+		t.Fatalf("expected the LEA to target the relocated block, got %+v", references)
+	}
+	if !bytes.Equal(relocated[0x600:0x800], tibiaBinary[0x600:0x800]) {
+		t.Fatal("expected the stock literal to stay untouched")
+	}
+	layout, err := readPEHeaderLayout(relocated)
+	if err != nil {
+		t.Fatalf("expected valid PE headers: %s", err)
+	}
+	if _, size, _ := layout.dataDirectory(relocated, peSecurityDirectoryIndex); size != 0 || len(relocated) != 0xa00 {
+		t.Fatalf("expected the certificate to be dropped, got %d bytes", len(relocated))
+	}
+	if len(relocation.substitutions) != 2 || relocation.substitutions[0].before != "https://www.tibia.com/login" {
+		t.Fatalf("unexpected substitutions %+v", relocation.substitutions)
+	}
+
+	rebuilt, second, err := relocateURLBlock(relocated, map[string]string{"loginWebService": "http://127.0.0.1", "clientWebService": longURL})
+	if err != nil {
+		t.Fatalf("expected a relocated client to be rebuilt: %s", err)
+	}
+	rebuiltPE := inspectPE(rebuilt)
+	if len(rebuiltPE.sections) != len(peData.sections) || second.sectionRVA != relocation.sectionRVA || second.substitutions[0].before != longURL {
+		t.Fatalf("expected the %s section to be replaced in place, got %+v", urlRelocationSectionName, rebuiltPE.sections)
+	}
+
+	patch := newPatchFile("client.exe", tibiaBinary, relocated, nil)
+	if patched, err := patch.apply(tibiaBinary); err != nil || !bytes.Equal(patched, relocated) {
+		t.Fatalf("expected the patch file to reproduce the grown client, err=%v", err)
+	}
+	if reverted, err := patch.invert().apply(relocated); err != nil || !bytes.Equal(reverted, tibiaBinary) {
+		t.Fatalf("expected the inverted patch to shrink the client back, err=%v", err)
+	}
+}
+
+func TestRelocateURLBlockFailsClosedOnUnverifiedReferences(t *testing.T) {
+	values := map[string]string{"loginWebService": "http://127.0.0.1", "clientWebService": "http://127.0.0.1"}
+
+	lengthImmediate := newRelocationFixture(t)
+	blockLength := strings.Index(string(lengthImmediate[relocationFixtureBlockOffset:]), "\x00")
+	lengthImmediate[relocationFixtureReferenceOffset+7] = 0x41
+	lengthImmediate[relocationFixtureReferenceOffset+8] = 0xb8
+	binary.LittleEndian.PutUint32(lengthImmediate[relocationFixtureReferenceOffset+9:], uint32(blockLength))
+
+	load := newRelocationFixture(t)
+	load[relocationFixtureReferenceOffset+1] = 0x8b
+
+	unreferenced := newRelocationFixture(t)
+	copy(unreferenced[relocationFixtureReferenceOffset:], make([]byte, 7))
+
+	for name, tibiaBinary := range map[string][]byte{"length immediate": lengthImmediate, "memory load": load, "no reference": unreferenced} {
+		if _, _, err := relocateURLBlock(tibiaBinary, values); err == nil {
+			t.Fatalf("%s: expected relocation to be refused", name)
+		}
+	}
+}
+
+func newRelocationFixture(t *testing.T) []byte {
+	t.Helper()
+	tibiaBinary := make([]byte, 0x800)
+	copy(tibiaBinary, "MZ")
+	binary.LittleEndian.PutUint32(tibiaBinary[0x3c:], 0x80)
+	copy(tibiaBinary[0x80:], "PE\x00\x00")
+	binary.LittleEndian.PutUint16(tibiaBinary[0x84:], 0x8664)
+	binary.LittleEndian.PutUint16(tibiaBinary[0x86:], 2)
+	binary.LittleEndian.PutUint16(tibiaBinary[0x94:], 240)
+	optionalHeader := tibiaBinary[0x98:]
+	binary.LittleEndian.PutUint16(optionalHeader, 0x20b)
+	binary.LittleEndian.PutUint64(optionalHeader[24:], 0x140000000)
+	binary.LittleEndian.PutUint32(optionalHeader[32:], 0x1000)
+	binary.LittleEndian.PutUint32(optionalHeader[36:], 0x200)
+	binary.LittleEndian.PutUint32(optionalHeader[56:], 0x3000)
+	binary.LittleEndian.PutUint32(optionalHeader[60:], 0x400)
+	binary.LittleEndian.PutUint32(optionalHeader[108:], 16)
+	writeFixtureSection(tibiaBinary, 0, ".text", 0x1000, 0x400, 0x60000020)
+	writeFixtureSection(tibiaBinary, 1, ".rdata", 0x2000, 0x600, 0x40000040)
+
+	copy(tibiaBinary[relocationFixtureBlockOffset:], "[URLS]\nloginWebService=https://www.tibia.com/login\nclientWebService=https://www.tibia.com/client\n\x00")
+	copy(tibiaBinary[relocationFixtureReferenceOffset:], []byte{0x48, 0x8d, 0x15})
+	referenceRVA := 0x1000 + relocationFixtureReferenceOffset - 0x400
+	blockRVA := 0x2000 + relocationFixtureBlockOffset - 0x600
+	binary.LittleEndian.PutUint32(tibiaBinary[relocationFixtureReferenceOffset+3:], uint32(int32(blockRVA-(referenceRVA+7))))
+	return tibiaBinary
+}
+
+func writeFixtureSection(tibiaBinary []byte, index int, name string, virtualAddress int, rawOffset int, characteristics uint32) {
+	header := tibiaBinary[0x98+240+index*peSectionHeaderSize:]
+	copy(header, name)
+	binary.LittleEndian.PutUint32(header[8:], 0x200)
+	binary.LittleEndian.PutUint32(header[12:], uint32(virtualAddress))
+	binary.LittleEndian.PutUint32(header[16:], 0x200)
+	binary.LittleEndian.PutUint32(header[20:], uint32(rawOffset))
+	binary.LittleEndian.PutUint32(header[36:], characteristics)
+}
+
+func setFixtureDataDirectory(tibiaBinary []byte, index int, address int, size int) {
+	entry := tibiaBinary[0x98+112+index*8:]
+	binary.LittleEndian.PutUint32(entry, uint32(address))
+	binary.LittleEndian.PutUint32(entry[4:], uint32(size))
+}
@@ -0,0 +1,575 @@
+package edit
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	DiagnoseFormatText  = "text"
+	DiagnoseFormatJSON  = "json"
+	DiagnoseFormatSARIF = "sarif"
+
+	diagnosisSchemaName    = "client-editor-diagnosis"
+	diagnosisSchemaVersion = 1
+	sarifSchemaURI         = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion           = "2.1.0"
+	clientEditorURI        = "https://github.com/opentibiabr/client-editor"
+
+	evidenceStrong     = "strong"
+	evidenceSuspicious = "suspicious"
+	evidenceWeak       = "weak"
+)
+
+// DiagnosisDocument is the JSON form of diagnose. Fields are only added within
+// a schema version; renames or removals bump SchemaVersion.
+type DiagnosisDocument struct {
+	Schema            string                   `json:"schema"`
+	SchemaVersion     int                      `json:"schemaVersion"`
+	SignatureDatabase string                   `json:"signatureDatabase"`
+	Target            DiagnosisJSON            `json:"target"`
+	Baseline          *DiagnosisJSON           `json:"baseline,omitempty"`
+	Comparison        *DiagnosisComparisonJSON `json:"comparison,omitempty"`
+}
+
+type DiagnosisJSON struct {
+	Path                 string                  `json:"path"`
+	Size                 int                     `json:"size"`
+	SHA256               string                  `json:"sha256"`
+	Version              string                  `json:"version,omitempty"`
+	VersionSource        string                  `json:"versionSource,omitempty"`
+	Format               string                  `json:"format"`
+	FormatValid          bool                    `json:"formatValid"`
+	FormatError          string                  `json:"formatError,omitempty"`
+	ImageBase            uint64                  `json:"imageBase"`
+	Sections             []DiagnosisSectionJSON  `json:"sections"`
+	RuntimeFunctionCount int                     `json:"runtimeFunctionCount"`
+	ImportCount          int                     `json:"importCount"`
+	MachOSlices          []DiagnosisMachOJSON    `json:"machoSlices,omitempty"`
+	PEIntegrity          *DiagnosisPEIntegrity   `json:"peIntegrity,omitempty"`
+	Resources            []DiagnosisResourceJSON `json:"resources,omitempty"`
+	Signatures           []DiagnosisPatchJSON    `json:"signatures"`
+	Findings             []DiagnosisFindingJSON  `json:"findings"`
+	QtIndicators         []string                `json:"qtIndicators"`
+	Coverage             DiagnosisCoverageJSON   `json:"coverage"`
+	Evidence             DiagnosisEvidenceCounts `json:"evidence"`
+	Verdict              string                  `json:"verdict"`
+	VerdictLevel         string                  `json:"verdictLevel"`
+	Unsafe               bool                    `json:"unsafe"`
+}
+
+type DiagnosisSectionJSON struct {
+	Name     string `json:"name"`
+	RawStart int    `json:"rawStart"`
+	RawEnd   int    `json:"rawEnd"`
+	RVAStart int    `json:"rvaStart"`
+	RVAEnd   int    `json:"rvaEnd"`
+	Code     bool   `json:"code"`
+	Writable bool   `json:"writable"`
+}
+
+type DiagnosisMachOJSON struct {
+	Arch          string `json:"arch"`
+	Offset        int    `json:"offset"`
+	Size          int    `json:"size"`
+	CodeSignature string `json:"codeSignature"`
+}
+
+// DiagnosisResourceJSON is one leaf of the PE resource tree. Type is the
+// RT_ name of a standard type, else its id or string name.
+type DiagnosisResourceJSON struct {
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	Language int    `json:"language"`
+	Size     int    `json:"size"`
+}
+
+// DiagnosisPEIntegrity is the PE checksum and Authenticode certificate table
+// state. ChecksumValid is also true when the linker left the checksum at 0.
+type DiagnosisPEIntegrity struct {
+	StoredChecksum    uint32 `json:"storedChecksum"`
+	ComputedChecksum  uint32 `json:"computedChecksum"`
+	ChecksumValid     bool   `json:"checksumValid"`
+	Signed            bool   `json:"signed"`
+	CertificateOffset int    `json:"certificateOffset,omitempty"`
+	CertificateSize   int    `json:"certificateSize,omitempty"`
+}
+
+type DiagnosisPatchJSON struct {
+	Name                 string                  `json:"name"`
+	State                string                  `json:"state"`
+	DiagnosticOnly       bool                    `json:"diagnosticOnly"`
+	HighRiskClientCheck  bool                    `json:"highRiskClientCheck"`
+	StructuralGuard      string                  `json:"structuralGuard,omitempty"`
+	Original             string                  `json:"original"`
+	Patched              string                  `json:"patched"`
+	OriginalOffsets      []int                   `json:"originalOffsets"`
+	PatchedOffsets       []int                   `json:"patchedOffsets"`
+	ExpectedOffsetHits   []DiagnosisExpectedJSON `json:"expectedOffsetHits"`
+	ExpectedOffsetMisses []DiagnosisExpectedJSON `json:"expectedOffsetMisses"`
+}
+
+type DiagnosisExpectedJSON struct {
+	SHA256  string `json:"sha256,omitempty"`
+	Version string `json:"version,omitempty"`
+	Offset  int    `json:"offset"`
+	Note    string `json:"note,omitempty"`
+}
+
+type DiagnosisFindingJSON struct {
+	Name       string                   `json:"name"`
+	Encoding   string                   `json:"encoding"`
+	Offsets    []int                    `json:"offsets"`
+	References []DiagnosisReferenceJSON `json:"references"`
+}
+
+type DiagnosisReferenceJSON struct {
+	Offset           int                         `json:"offset"`
+	Section          string                      `json:"section"`
+	Instruction      string                      `json:"instruction"`
+	Classification   string                      `json:"classification"`
+	Reason           string                      `json:"reason"`
+	BranchOffsets    []int                       `json:"branchOffsets"`
+	CallOffsets      []int                       `json:"callOffsets"`
+	PatternMatches   []DiagnosisPatternMatchJSON `json:"patternMatches"`
+	KnownPatchNearby bool                        `json:"knownPatchNearby"`
+	ContextStart     int                         `json:"contextStart"`
+	Context          string                      `json:"context"`
+	Disassembly      []string                    `json:"disassembly"`
+}
+
+type DiagnosisPatternMatchJSON struct {
+	Name   string `json:"name"`
+	Offset int    `json:"offset"`
+}
+
+type DiagnosisCoverageJSON struct {
+	Covered   int `json:"covered"`
+	Patchable int `json:"patchable"`
+	Original  int `json:"original"`
+	Patched   int `json:"patched"`
+}
+
+type DiagnosisEvidenceCounts struct {
+	Strong     int `json:"strong"`
+	Suspicious int `json:"suspicious"`
+	Indicators int `json:"indicators"`
+	References int `json:"references"`
+}
+
+type DiagnosisComparisonJSON struct {
+	SizeDelta             int                          `json:"sizeDelta"`
+	SHA256Identical       bool                         `json:"sha256Identical"`
+	Signatures            []DiagnosisComparedPatchJSON `json:"signatures"`
+	NewIndicators         []string                     `json:"newIndicators"`
+	NewStrongEvidence     []string                     `json:"newStrongEvidence"`
+	NewSuspiciousEvidence []string                     `json:"newSuspiciousEvidence"`
+}
+
+type DiagnosisComparedPatchJSON struct {
+	Name     string `json:"name"`
+	Baseline string `json:"baseline"`
+	Target   string `json:"target"`
+}
+
+func newDiagnosisDocument(target diagnosisReport, baseline *diagnosisReport) DiagnosisDocument {
+	document := DiagnosisDocument{
+		Schema:            diagnosisSchemaName,
+		SchemaVersion:     diagnosisSchemaVersion,
+		SignatureDatabase: target.signatures.database.describe(),
+		Target:            target.toJSON(),
+	}
+	if baseline != nil {
+		baselineJSON := baseline.toJSON()
+		document.Baseline = &baselineJSON
+		document.Comparison = newDiagnosisComparison(*baseline, target)
+	}
+	return document
+}
+
+func (diagnosis diagnosisReport) formatName() string {
+	switch {
+	case diagnosis.isWindowsExe:
+		return "pe"
+	case diagnosis.isELF:
+		return "elf"
+	case diagnosis.isMachO:
+		return "macho"
+	default:
+		return "unknown"
+	}
+}
+
+func (diagnosis diagnosisReport) toJSON() DiagnosisJSON {
+	verdict := diagnosis.clientCheckVerdict()
+	report := DiagnosisJSON{
+		Path:                 diagnosis.path,
+		Size:                 diagnosis.size,
+		SHA256:               diagnosis.sha256,
+		Version:              diagnosis.version.version,
+		VersionSource:        diagnosis.version.source,
+		Format:               diagnosis.formatName(),
+		FormatValid:          diagnosis.pe.valid,
+		FormatError:          diagnosis.pe.errorText,
+		ImageBase:            diagnosis.pe.imageBase,
+		Sections:             make([]DiagnosisSectionJSON, 0, len(diagnosis.pe.sections)),
+		RuntimeFunctionCount: len(diagnosis.pe.runtimeFunctions),
+		ImportCount:          len(diagnosis.pe.imports),
+		Signatures:           make([]DiagnosisPatchJSON, 0, len(diagnosis.patchStatuses)),
+		Findings:             make([]DiagnosisFindingJSON, 0, len(diagnosis.clientCheckFindings)),
+		QtIndicators:         append([]string{}, diagnosis.qtIndicators...),
+		Coverage: DiagnosisCoverageJSON{
+			Covered:   diagnosis.knownPatchCoverage(),
+			Patchable: diagnosis.patchableSignatureCount(),
+			Original:  diagnosis.originalPatchSignatureCount(),
+			Patched:   diagnosis.patchedPatchSignatureCount(),
+		},
+		Evidence: DiagnosisEvidenceCounts{
+			Strong:     diagnosis.strongUnsupportedEvidenceCount(),
+			Suspicious: diagnosis.suspiciousActiveEvidenceCount(),
+			Indicators: diagnosis.clientCheckIndicatorCount(),
+			References: diagnosis.clientCheckCodeReferenceCount(),
+		},
+		Verdict:      verdict,
+		VerdictLevel: strings.SplitN(verdict, ":", 2)[0],
+		Unsafe:       diagnosis.hasUnsafeClientCheckRemainder(),
+	}
+
+	for _, section := range diagnosis.pe.sections {
+		report.Sections = append(report.Sections, DiagnosisSectionJSON{
+			Name:     section.name,
+			RawStart: section.rawStart,
+			RawEnd:   section.rawEnd,
+			RVAStart: section.rvaStart,
+			RVAEnd:   section.rvaEnd,
+			Code:     section.isCode,
+			Writable: section.isWritable,
+		})
+	}
+	for _, sliceReport := range diagnosis.machOSlices {
+		report.MachOSlices = append(report.MachOSlices, DiagnosisMachOJSON{
+			Arch:          sliceReport.slice.arch,
+			Offset:        sliceReport.slice.start,
+			Size:          sliceReport.slice.end - sliceReport.slice.start,
+			CodeSignature: sliceReport.codeSignature.describe(),
+		})
+	}
+	if diagnosis.integrity.valid {
+		report.PEIntegrity = &DiagnosisPEIntegrity{
+			StoredChecksum:    diagnosis.integrity.storedChecksum,
+			ComputedChecksum:  diagnosis.integrity.computedChecksum,
+			ChecksumValid:     diagnosis.integrity.checksumValid(),
+			Signed:            diagnosis.integrity.signed(),
+			CertificateOffset: diagnosis.integrity.certificateOffset,
+			CertificateSize:   diagnosis.integrity.certificateSize,
+		}
+	}
+	for _, resource := range diagnosis.resources {
+		report.Resources = append(report.Resources, DiagnosisResourceJSON{
+			Type:     resource.typeText(),
+			Name:     resource.name.text(),
+			Language: resource.language,
+			Size:     len(resource.data),
+		})
+	}
+	for _, status := range diagnosis.patchStatuses {
+		report.Signatures = append(report.Signatures, status.toJSON())
+	}
+	for _, finding := range diagnosis.clientCheckFindings {
+		findingJSON := DiagnosisFindingJSON{
+			Name:       finding.name,
+			Encoding:   finding.encoding,
+			Offsets:    append([]int{}, finding.offsets...),
+			References: make([]DiagnosisReferenceJSON, 0, len(finding.references)),
+		}
+		for _, reference := range finding.references {
+			findingJSON.References = append(findingJSON.References, reference.toJSON(finding.name))
+		}
+		report.Findings = append(report.Findings, findingJSON)
+	}
+	return report
+}
+
+func (status battleyePatchStatus) state() string {
+	switch {
+	case len(status.originalOffset) > 0 && len(status.patchedOffset) > 0:
+		return "mixed"
+	case len(status.originalOffset) > 0:
+		return "original"
+	case len(status.patchedOffset) > 0:
+		return "patched"
+	default:
+		return "absent"
+	}
+}
+
+func (status battleyePatchStatus) toJSON() DiagnosisPatchJSON {
+	patchJSON := DiagnosisPatchJSON{
+		Name:                 status.patch.name,
+		State:                status.state(),
+		DiagnosticOnly:       status.patch.diagnosticOnly,
+		HighRiskClientCheck:  status.patch.highRiskClientCheck,
+		Original:             status.patch.original.formatAOB(),
+		Patched:              status.patch.effectivePatchedPattern().formatAOB(),
+		OriginalOffsets:      append([]int{}, status.originalOffset...),
+		PatchedOffsets:       append([]int{}, status.patchedOffset...),
+		ExpectedOffsetHits:   expectedOffsetsJSON(status.expectedOffsetHits),
+		ExpectedOffsetMisses: expectedOffsetsJSON(status.expectedOffsetMisses),
+	}
+	if status.patch.structuralGuard != nil {
+		patchJSON.StructuralGuard = string(status.patch.structuralGuard.kind)
+	}
+	return patchJSON
+}
+
+func expectedOffsetsJSON(offsets []knownPatchOffset) []DiagnosisExpectedJSON {
+	expected := make([]DiagnosisExpectedJSON, 0, len(offsets))
+	for _, offset := range offsets {
+		expected = append(expected, DiagnosisExpectedJSON{SHA256: offset.sha256, Version: offset.version, Offset: offset.offset, Note: offset.note})
+	}
+	return expected
+}
+
+// classification returns the evidence class of a reference and why it was
+// placed there, matching the text report.
+func (reference clientCheckReference) classification(indicatorName string) (string, string) {
+	switch {
+	case reference.strongUnsupported:
+		return evidenceStrong, "critical indicator with nearby branch, call and recognized branch/call pattern and no known patch nearby"
+	case reference.suspiciousActive:
+		return evidenceSuspicious, suspiciousEvidenceReason(indicatorName, reference)
+	default:
+		return evidenceWeak, weakEvidenceReason(indicatorName, reference)
+	}
+}
+
+func (reference clientCheckReference) toJSON(indicatorName string) DiagnosisReferenceJSON {
+	classification, reason := reference.classification(indicatorName)
+	referenceJSON := DiagnosisReferenceJSON{
+		Offset:           reference.offset,
+		Section:          reference.section,
+		Instruction:      reference.instruction,
+		Classification:   classification,
+		Reason:           reason,
+		BranchOffsets:    append([]int{}, reference.branchOffsets...),
+		CallOffsets:      append([]int{}, reference.callOffsets...),
+		PatternMatches:   make([]DiagnosisPatternMatchJSON, 0, len(reference.patternMatches)),
+		KnownPatchNearby: reference.knownPatchNearby,
+		ContextStart:     reference.contextStart,
+		Context:          hex.EncodeToString(reference.contextBytes),
+		Disassembly:      append([]string{}, reference.disassembly...),
+	}
+	for _, match := range reference.patternMatches {
+		referenceJSON.PatternMatches = append(referenceJSON.PatternMatches, DiagnosisPatternMatchJSON{Name: match.name, Offset: match.offset})
+	}
+	return referenceJSON
+}
+
+func newDiagnosisComparison(baseline diagnosisReport, target diagnosisReport) *DiagnosisComparisonJSON {
+	comparison := &DiagnosisComparisonJSON{
+		SizeDelta:             target.size - baseline.size,
+		SHA256Identical:       baseline.sha256 == target.sha256,
+		Signatures:            make([]DiagnosisComparedPatchJSON, 0, len(target.signatures.patches)),
+		NewIndicators:         append([]string{}, differenceStrings(target.clientCheckIndicatorKeys(), baseline.clientCheckIndicatorKeys())...),
+		NewStrongEvidence:     append([]string{}, differenceStrings(target.strongUnsupportedEvidenceKeys(), baseline.strongUnsupportedEvidenceKeys())...),
+		NewSuspiciousEvidence: append([]string{}, differenceStrings(target.suspiciousActiveIndicatorKeys(), baseline.suspiciousActiveIndicatorKeys())...),
+	}
+	for _, patch := range target.signatures.patches {
+		comparison.Signatures = append(comparison.Signatures, DiagnosisComparedPatchJSON{
+			Name:     patch.name,
+			Baseline: baseline.patchStateByName(patch.name),
+			Target:   target.patchStateByName(patch.name),
+		})
+	}
+	return comparison
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool       sarifTool              `json:"tool"`
+	Artifacts  []sarifArtifact        `json:"artifacts"`
+	Results    []sarifResult          `json:"results"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string            `json:"id"`
+	Name                 string            `json:"name"`
+	ShortDescription     sarifMessage      `json:"shortDescription"`
+	DefaultConfiguration sarifRuleDefaults `json:"defaultConfiguration"`
+}
+
+type sarifRuleDefaults struct {
+	Level string `json:"level"`
+}
+
+type sarifArtifact struct {
+	Location sarifArtifactLocation `json:"location"`
+	Length   int                   `json:"length"`
+	Hashes   map[string]string     `json:"hashes"`
+}
+
+type sarifArtifactLocation struct {
+	URI   string `json:"uri"`
+	Index int    `json:"index"`
+}
+
+type sarifResult struct {
+	RuleID     string                 `json:"ruleId"`
+	Level      string                 `json:"level"`
+	Message    sarifMessage           `json:"message"`
+	Locations  []sarifLocation        `json:"locations"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifRegion struct {
+	ByteOffset int `json:"byteOffset"`
+	ByteLength int `json:"byteLength"`
+}
+
+// sarifRules are the stable rule IDs of the SARIF report.
+var sarifRules = []sarifRule{
+	{ID: "CE001", Name: "StrongClientCheckEvidence", ShortDescription: sarifMessage{Text: "Strong unsupported client-check evidence remains"}, DefaultConfiguration: sarifRuleDefaults{Level: "error"}},
+	{ID: "CE002", Name: "SuspiciousClientCheckCandidate", ShortDescription: sarifMessage{Text: "Suspicious active client-check candidate"}, DefaultConfiguration: sarifRuleDefaults{Level: "warning"}},
+	{ID: "CE003", Name: "WeakClientCheckIndicator", ShortDescription: sarifMessage{Text: "Weak client-check indicator"}, DefaultConfiguration: sarifRuleDefaults{Level: "note"}},
+	{ID: "CE004", Name: "UnpatchedBattlEyeSignature", ShortDescription: sarifMessage{Text: "Patchable BattlEye signature is still in its original state"}, DefaultConfiguration: sarifRuleDefaults{Level: "warning"}},
+	{ID: "CE005", Name: "ClientCheckVerdict", ShortDescription: sarifMessage{Text: "Client-check support verdict"}, DefaultConfiguration: sarifRuleDefaults{Level: "note"}},
+}
+
+func newSARIFLog(diagnosis diagnosisReport) sarifLog {
+	artifact := sarifArtifactLocation{URI: strings.ReplaceAll(diagnosis.path, "\\", "/")}
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{Name: "client-editor", InformationURI: clientEditorURI, Rules: sarifRules}},
+		Artifacts: []sarifArtifact{{
+			Location: artifact,
+			Length:   diagnosis.size,
+			Hashes:   map[string]string{"sha-256": diagnosis.sha256},
+		}},
+		Results: make([]sarifResult, 0),
+		Properties: map[string]interface{}{
+			"signatureDatabase": diagnosis.signatures.database.describe(),
+			"verdict":           diagnosis.clientCheckVerdict(),
+		},
+	}
+
+	for _, finding := range diagnosis.clientCheckFindings {
+		if len(finding.references) == 0 {
+			for _, offset := range finding.offsets {
+				run.Results = append(run.Results, sarifResult{
+					RuleID:    "CE003",
+					Level:     "note",
+					Message:   sarifMessage{Text: fmt.Sprintf("%q (%s) has no code reference", finding.name, finding.encoding)},
+					Locations: []sarifLocation{sarifByteLocation(artifact, offset, len(finding.name))},
+				})
+			}
+			continue
+		}
+		for _, reference := range finding.references {
+			classification, reason := reference.classification(finding.name)
+			ruleID, level := "CE003", "note"
+			switch classification {
+			case evidenceStrong:
+				ruleID, level = "CE001", "error"
+			case evidenceSuspicious:
+				ruleID, level = "CE002", "warning"
+			}
+			run.Results = append(run.Results, sarifResult{
+				RuleID:    ruleID,
+				Level:     level,
+				Message:   sarifMessage{Text: fmt.Sprintf("%q (%s) referenced by %s at 0x%X in %s: %s", finding.name, finding.encoding, reference.instruction, reference.offset, reference.section, reason)},
+				Locations: []sarifLocation{sarifByteLocation(artifact, reference.offset, 7)},
+				Properties: map[string]interface{}{
+					"classification":   classification,
+					"knownPatchNearby": reference.knownPatchNearby,
+				},
+			})
+		}
+	}
+
+	for _, status := range diagnosis.patchStatuses {
+		if status.patch.diagnosticOnly || len(status.originalOffset) == 0 {
+			continue
+		}
+		for _, offset := range status.originalOffset {
+			run.Results = append(run.Results, sarifResult{
+				RuleID:    "CE004",
+				Level:     "warning",
+				Message:   sarifMessage{Text: fmt.Sprintf("BattlEye signature %q is unpatched at 0x%X", status.patch.name, offset)},
+				Locations: []sarifLocation{sarifByteLocation(artifact, offset, len(status.patch.original.data))},
+			})
+		}
+	}
+
+	verdictLevel := "note"
+	switch {
+	case diagnosis.strongUnsupportedEvidenceCount() > 0:
+		verdictLevel = "error"
+	case diagnosis.hasUnsafeClientCheckRemainder():
+		verdictLevel = "warning"
+	}
+	run.Results = append(run.Results, sarifResult{
+		RuleID:    "CE005",
+		Level:     verdictLevel,
+		Message:   sarifMessage{Text: diagnosis.clientCheckVerdict()},
+		Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: artifact}}},
+	})
+
+	return sarifLog{Schema: sarifSchemaURI, Version: sarifVersion, Runs: []sarifRun{run}}
+}
+
+func sarifByteLocation(artifact sarifArtifactLocation, offset int, length int) sarifLocation {
+	return sarifLocation{PhysicalLocation: sarifPhysicalLocation{
+		ArtifactLocation: artifact,
+		Region:           &sarifRegion{ByteOffset: offset, ByteLength: length},
+	}}
+}
+
+// writeDiagnosisOutput encodes value as indented JSON to outputPath, or to
+// stdout when outputPath is empty.
+func writeDiagnosisOutput(outputPath string, value interface{}) {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		fmt.Printf("[ERROR] Unable to encode diagnosis: %s\n", err.Error())
+		os.Exit(1)
+	}
+	data = append(data, '\n')
+	if outputPath == "" {
+		_, _ = os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		fmt.Printf("[ERROR] Unable to write diagnosis: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,86 @@
+package edit
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiagnosisDocumentClassifiesReferences(t *testing.T) {
+	tibiaBinary, peData, referenceOffset := newDecodedClientCheckReferenceFixture("clientcheck_disconnected")
+	diagnosis := diagnosisReport{
+		path:                "client.exe",
+		size:                len(tibiaBinary),
+		sha256:              sha256Hex(tibiaBinary),
+		isWindowsExe:        true,
+		pe:                  peData,
+		patchStatuses:       []battleyePatchStatus{{patch: battleyePatches[0], originalOffset: []int{0x180}}},
+		clientCheckFindings: scanClientCheckFindings(activeSignatures(), tibiaBinary, peData, nil),
+		signatures:          activeSignatures(),
+	}
+
+	document := newDiagnosisDocument(diagnosis, nil)
+
+	if document.Schema != diagnosisSchemaName || document.SchemaVersion != diagnosisSchemaVersion || document.Baseline != nil {
+		t.Fatalf("unexpected document header %+v", document)
+	}
+	target := document.Target
+	if target.Format != "pe" || len(target.Sections) != 2 || target.Sections[0].Name != ".text" || !target.Sections[0].Code {
+		t.Fatalf("unexpected sections %+v", target.Sections)
+	}
+	if len(target.Signatures) != 1 || target.Signatures[0].State != "original" || target.Signatures[0].OriginalOffsets[0] != 0x180 {
+		t.Fatalf("unexpected signatures %+v", target.Signatures)
+	}
+	if len(target.Findings) != 1 || len(target.Findings[0].References) != 1 {
+		t.Fatalf("expected one finding with one reference, got %+v", target.Findings)
+	}
+	reference := target.Findings[0].References[0]
+	if reference.Offset != referenceOffset || reference.Classification != evidenceStrong || len(reference.BranchOffsets) == 0 {
+		t.Fatalf("unexpected reference %+v", reference)
+	}
+	if target.VerdictLevel != "UNSUPPORTED" || !target.Unsafe || target.Evidence.Strong != 1 {
+		t.Fatalf("unexpected verdict %q unsafe=%t evidence=%+v", target.Verdict, target.Unsafe, target.Evidence)
+	}
+
+	sarif := newSARIFLog(diagnosis)
+	results := sarif.Runs[0].Results
+	if sarif.Version != sarifVersion || len(results) != 3 {
+		t.Fatalf("expected strong evidence, unpatched signature and verdict results, got %+v", results)
+	}
+	if results[0].RuleID != "CE001" || results[0].Level != "error" || results[0].Locations[0].PhysicalLocation.Region.ByteOffset != referenceOffset {
+		t.Fatalf("unexpected strong evidence result %+v", results[0])
+	}
+	if results[1].RuleID != "CE004" || results[2].RuleID != "CE005" || results[2].Level != "error" {
+		t.Fatalf("unexpected signature and verdict results %+v", results[1:])
+	}
+}
+
+func TestDiagnoseWritesJSONComparisonDocument(t *testing.T) {
+	workDir := t.TempDir()
+	targetPath := filepath.Join(workDir, "client")
+	baselinePath := filepath.Join(workDir, "client-old")
+	outputPath := filepath.Join(workDir, "diagnosis.json")
+	writeTestFile(t, targetPath, []byte("new client clientcheck_disconnected"))
+	writeTestFile(t, baselinePath, []byte("old client"))
+
+	Diagnose(DiagnoseOptions{TibiaExe: targetPath, CompareWith: baselinePath, Format: DiagnoseFormatJSON, OutputPath: outputPath})
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("expected a JSON report: %s", err)
+	}
+	var document map[string]interface{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		t.Fatalf("expected valid JSON: %s", err)
+	}
+	for _, key := range []string{"schema", "schemaVersion", "signatureDatabase", "target", "baseline", "comparison"} {
+		if _, ok := document[key]; !ok {
+			t.Fatalf("expected key %q in %s", key, data)
+		}
+	}
+	comparison := document["comparison"].(map[string]interface{})
+	if comparison["sizeDelta"].(float64) != 25 || len(comparison["newIndicators"].([]interface{})) != 1 {
+		t.Fatalf("unexpected comparison %+v", comparison)
+	}
+}
@@ -0,0 +1,744 @@
+package edit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	peResourceDirectoryIndex = 2
+	peResourceDirectorySize  = 16
+	peResourceEntrySize      = 8
+	peResourceDataEntrySize  = 16
+	peResourceSubdirectory   = 0x80000000
+
+	resourceTypeIcon      = 3
+	resourceTypeGroupIcon = 14
+	resourceTypeVersion   = 16
+	resourceTypeManifest  = 24
+
+	// brandingSectionName holds a resource directory that outgrew .rsrc.
+	brandingSectionName = ".crsrc"
+	// resourceDefaultLanguage is used for resources the client did not have.
+	resourceDefaultLanguage = 0x409
+)
+
+var resourceTypeNames = map[int]string{
+	1:  "RT_CURSOR",
+	2:  "RT_BITMAP",
+	3:  "RT_ICON",
+	4:  "RT_MENU",
+	5:  "RT_DIALOG",
+	6:  "RT_STRING",
+	9:  "RT_ACCELERATOR",
+	10: "RT_RCDATA",
+	11: "RT_MESSAGETABLE",
+	12: "RT_GROUP_CURSOR",
+	14: "RT_GROUP_ICON",
+	16: "RT_VERSION",
+	24: "RT_MANIFEST",
+}
+
+// versionStringKeys are the StringFileInfo keys Windows knows, used to spell
+// a key the client does not have yet.
+var versionStringKeys = []string{
+	"Comments", "CompanyName", "FileDescription", "FileVersion", "InternalName", "LegalCopyright",
+	"LegalTrademarks", "OriginalFilename", "PrivateBuild", "ProductName", "ProductVersion", "SpecialBuild",
+}
+
+// peResourceID is a resource type or name: a string when name is set, else
+// the numeric id.
+type peResourceID struct {
+	id   int
+	name string
+}
+
+func (resourceID peResourceID) less(other peResourceID) bool {
+	if (resourceID.name != "") != (other.name != "") {
+		return resourceID.name != ""
+	}
+	if resourceID.name != "" {
+		return resourceID.name < other.name
+	}
+	return resourceID.id < other.id
+}
+
+func (resourceID peResourceID) text() string {
+	if resourceID.name != "" {
+		return resourceID.name
+	}
+	return fmt.Sprint(resourceID.id)
+}
+
+// peResource is one leaf of the three-level resource tree.
+type peResource struct {
+	resourceType peResourceID
+	name         peResourceID
+	language     int
+	codePage     uint32
+	data         []byte
+}
+
+func (resource peResource) is(resourceType int) bool {
+	return resource.resourceType.name == "" && resource.resourceType.id == resourceType
+}
+
+func (resource peResource) typeText() string {
+	if name, ok := resourceTypeNames[resource.resourceType.id]; ok && resource.resourceType.name == "" {
+		return name
+	}
+	return resource.resourceType.text()
+}
+
+// describe summarizes a resource for diagnose: icon groups list their size,
+// version resources their product name and file version.
+func (resource peResource) describe() string {
+	text := fmt.Sprintf("%s %s (language %d): %d bytes", resource.typeText(), resource.name.text(), resource.language, len(resource.data))
+	switch {
+	case resource.is(resourceTypeGroupIcon):
+		if entries, err := parseIconGroup(resource.data); err == nil {
+			text += fmt.Sprintf(", %d image(s)", len(entries))
+		}
+	case resource.is(resourceTypeVersion):
+		if root, err := parseVersionNode(resource.data, 0); err == nil {
+			values := make([]string, 0, 2)
+			for _, key := range []string{"ProductName", "FileVersion"} {
+				if value, ok := root.versionString(key); ok {
+					values = append(values, fmt.Sprintf("%s=%q", key, value))
+				}
+			}
+			if len(values) > 0 {
+				text += ", " + strings.Join(values, " ")
+			}
+		}
+	}
+	return text
+}
+
+func logPEResources(diagnosis diagnosisReport) {
+	if diagnosis.resourceError != "" {
+		fmt.Printf("[INFO] Resources: %s\n", diagnosis.resourceError)
+		return
+	}
+	fmt.Printf("[INFO] Resources: %d in %s @0x%X (%d bytes)\n", len(diagnosis.resources), diagnosis.resourceDirectory.section.name, diagnosis.resourceDirectory.offset, diagnosis.resourceDirectory.size)
+	for _, resource := range diagnosis.resources {
+		fmt.Printf("[INFO]   %s\n", resource.describe())
+	}
+}
+
+// peResourceDirectory is where the resource tree of a PE client lives.
+type peResourceDirectory struct {
+	offset  int
+	rva     int
+	size    int
+	section peSectionHeader
+}
+
+// readPEResources flattens the resource tree of a PE client, sorted the way
+// it is written back.
+func readPEResources(tibiaBinary []byte) ([]peResource, peResourceDirectory, error) {
+	var directory peResourceDirectory
+	layout, err := readPEHeaderLayout(tibiaBinary)
+	if err != nil {
+		return nil, directory, err
+	}
+	directory.rva, directory.size, _ = layout.dataDirectory(tibiaBinary, peResourceDirectoryIndex)
+	if directory.rva == 0 || directory.size == 0 {
+		return nil, directory, fmt.Errorf("the client has no resource directory")
+	}
+	found := false
+	for _, section := range layout.sections(tibiaBinary) {
+		if directory.rva >= section.virtualAddress && directory.rva < section.virtualAddress+section.sizeOfRawData {
+			directory.section = section
+			directory.offset = section.pointerToRawData + directory.rva - section.virtualAddress
+			found = true
+		}
+	}
+	if !found || directory.offset+peResourceDirectorySize > len(tibiaBinary) {
+		return nil, directory, fmt.Errorf("resource directory RVA 0x%X is outside every section", directory.rva)
+	}
+
+	peData := inspectPE(tibiaBinary)
+	resources := make([]peResource, 0)
+	var walk func(offset int, level int, path []peResourceID) error
+	walk = func(offset int, level int, path []peResourceID) error {
+		start := directory.offset + offset
+		if offset < 0 || start+peResourceDirectorySize > len(tibiaBinary) {
+			return fmt.Errorf("resource directory @0x%X is outside the file", start)
+		}
+		count := int(binary.LittleEndian.Uint16(tibiaBinary[start+12:])) + int(binary.LittleEndian.Uint16(tibiaBinary[start+14:]))
+		if start+peResourceDirectorySize+count*peResourceEntrySize > len(tibiaBinary) {
+			return fmt.Errorf("resource directory @0x%X has %d entries past the end of the file", start, count)
+		}
+		for index := 0; index < count; index++ {
+			entry := tibiaBinary[start+peResourceDirectorySize+index*peResourceEntrySize:]
+			nameField := binary.LittleEndian.Uint32(entry)
+			target := binary.LittleEndian.Uint32(entry[4:])
+			entryID := peResourceID{id: int(nameField)}
+			if nameField&peResourceSubdirectory != 0 {
+				name, err := readResourceName(tibiaBinary, directory.offset+int(nameField&^peResourceSubdirectory))
+				if err != nil {
+					return err
+				}
+				entryID = peResourceID{name: name}
+			}
+			entryPath := append(append([]peResourceID(nil), path...), entryID)
+
+			if target&peResourceSubdirectory != 0 {
+				if level == 2 {
+					return fmt.Errorf("resource tree is deeper than type, name and language")
+				}
+				if err := walk(int(target&^peResourceSubdirectory), level+1, entryPath); err != nil {
+					return err
+				}
+				continue
+			}
+			if level != 2 {
+				return fmt.Errorf("resource data entry at level %d", level+1)
+			}
+			dataEntry := directory.offset + int(target)
+			if dataEntry+peResourceDataEntrySize > len(tibiaBinary) {
+				return fmt.Errorf("resource data entry @0x%X is outside the file", dataEntry)
+			}
+			dataRVA := int(binary.LittleEndian.Uint32(tibiaBinary[dataEntry:]))
+			size := int(binary.LittleEndian.Uint32(tibiaBinary[dataEntry+4:]))
+			dataOffset, ok := peData.offsetForRVA(dataRVA)
+			if !ok || dataOffset+size > len(tibiaBinary) {
+				return fmt.Errorf("resource %s/%s data RVA 0x%X (%d bytes) is outside the file", entryPath[0].text(), entryPath[1].text(), dataRVA, size)
+			}
+			resources = append(resources, peResource{
+				resourceType: entryPath[0],
+				name:         entryPath[1],
+				language:     entryID.id,
+				codePage:     binary.LittleEndian.Uint32(tibiaBinary[dataEntry+8:]),
+				data:         append([]byte(nil), tibiaBinary[dataOffset:dataOffset+size]...),
+			})
+		}
+		return nil
+	}
+	if err := walk(0, 0, nil); err != nil {
+		return nil, directory, err
+	}
+	sortPEResources(resources)
+	return resources, directory, nil
+}
+
+func readResourceName(tibiaBinary []byte, offset int) (string, error) {
+	if offset+2 > len(tibiaBinary) {
+		return "", fmt.Errorf("resource name @0x%X is outside the file", offset)
+	}
+	length := int(binary.LittleEndian.Uint16(tibiaBinary[offset:]))
+	if offset+2+length*2 > len(tibiaBinary) {
+		return "", fmt.Errorf("resource name @0x%X runs past the end of the file", offset)
+	}
+	units := make([]uint16, length)
+	for index := range units {
+		units[index] = binary.LittleEndian.Uint16(tibiaBinary[offset+2+index*2:])
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+// sortPEResources orders resources as the loader expects each directory:
+// named entries first, then ids in ascending order.
+func sortPEResources(resources []peResource) {
+	sort.SliceStable(resources, func(left int, right int) bool {
+		a, b := resources[left], resources[right]
+		if a.resourceType != b.resourceType {
+			return a.resourceType.less(b.resourceType)
+		}
+		if a.name != b.name {
+			return a.name.less(b.name)
+		}
+		return a.language < b.language
+	})
+}
+
+// buildPEResourceDirectory serializes sorted resources as a resource
+// section starting at baseRVA: the directories, then the data entries, the
+// name strings and the 8-byte aligned data.
+func buildPEResourceDirectory(resources []peResource, baseRVA int) []byte {
+	type nameGroup struct {
+		name      peResourceID
+		languages []int
+	}
+	type typeGroup struct {
+		resourceType peResourceID
+		names        []nameGroup
+	}
+	groups := make([]typeGroup, 0)
+	for index, resource := range resources {
+		if len(groups) == 0 || groups[len(groups)-1].resourceType != resource.resourceType {
+			groups = append(groups, typeGroup{resourceType: resource.resourceType})
+		}
+		current := &groups[len(groups)-1]
+		if len(current.names) == 0 || current.names[len(current.names)-1].name != resource.name {
+			current.names = append(current.names, nameGroup{name: resource.name})
+		}
+		names := &current.names[len(current.names)-1]
+		names.languages = append(names.languages, index)
+	}
+
+	directorySize := func(entries int) int {
+		return peResourceDirectorySize + entries*peResourceEntrySize
+	}
+	directoriesEnd := directorySize(len(groups))
+	for _, group := range groups {
+		directoriesEnd += directorySize(len(group.names))
+		for _, names := range group.names {
+			directoriesEnd += directorySize(len(names.languages))
+		}
+	}
+	dataEntriesEnd := directoriesEnd + len(resources)*peResourceDataEntrySize
+
+	stringOffsets := make(map[string]int)
+	var stringsBlob []byte
+	addString := func(name string) {
+		if _, ok := stringOffsets[name]; ok || name == "" {
+			return
+		}
+		stringOffsets[name] = dataEntriesEnd + len(stringsBlob)
+		units := utf16.Encode([]rune(name))
+		stringsBlob = binary.LittleEndian.AppendUint16(stringsBlob, uint16(len(units)))
+		for _, unit := range units {
+			stringsBlob = binary.LittleEndian.AppendUint16(stringsBlob, unit)
+		}
+	}
+	for _, resource := range resources {
+		addString(resource.resourceType.name)
+		addString(resource.name.name)
+	}
+	dataStart := alignUp(dataEntriesEnd+len(stringsBlob), 8)
+	dataOffsets := make([]int, len(resources))
+	end := dataStart
+	for index, resource := range resources {
+		dataOffsets[index] = end
+		end = alignUp(end+len(resource.data), 8)
+	}
+
+	section := make([]byte, end)
+	copy(section[dataEntriesEnd:], stringsBlob)
+	nextDirectory := 0
+	writeDirectory := func(entries int) int {
+		offset := nextDirectory
+		nextDirectory += directorySize(entries)
+		return offset
+	}
+	writeEntry := func(directory int, index int, entryID peResourceID, target uint32) {
+		entry := section[directory+peResourceDirectorySize+index*peResourceEntrySize:]
+		counts := section[directory+12:]
+		if entryID.name != "" {
+			binary.LittleEndian.PutUint32(entry, uint32(stringOffsets[entryID.name])|peResourceSubdirectory)
+			binary.LittleEndian.PutUint16(counts, binary.LittleEndian.Uint16(counts)+1)
+		} else {
+			binary.LittleEndian.PutUint32(entry, uint32(entryID.id))
+			binary.LittleEndian.PutUint16(counts[2:], binary.LittleEndian.Uint16(counts[2:])+1)
+		}
+		binary.LittleEndian.PutUint32(entry[4:], target)
+	}
+
+	root := writeDirectory(len(groups))
+	nextDataEntry := directoriesEnd
+	for typeIndex, group := range groups {
+		typeDirectory := writeDirectory(len(group.names))
+		writeEntry(root, typeIndex, group.resourceType, uint32(typeDirectory)|peResourceSubdirectory)
+		for nameIndex, names := range group.names {
+			nameDirectory := writeDirectory(len(names.languages))
+			writeEntry(typeDirectory, nameIndex, names.name, uint32(nameDirectory)|peResourceSubdirectory)
+			for languageIndex, resourceIndex := range names.languages {
+				resource := resources[resourceIndex]
+				writeEntry(nameDirectory, languageIndex, peResourceID{id: resource.language}, uint32(nextDataEntry))
+				binary.LittleEndian.PutUint32(section[nextDataEntry:], uint32(baseRVA+dataOffsets[resourceIndex]))
+				binary.LittleEndian.PutUint32(section[nextDataEntry+4:], uint32(len(resource.data)))
+				binary.LittleEndian.PutUint32(section[nextDataEntry+8:], resource.codePage)
+				copy(section[dataOffsets[resourceIndex]:], resource.data)
+				nextDataEntry += peResourceDataEntrySize
+			}
+		}
+	}
+	return section
+}
+
+// writePEResources replaces the resource tree of a PE client. The tree is
+// rebuilt where it is when it fits the mapped part of its section; a larger
+// tree moves to a new section at the end of the image, leaving the old one
+// unreferenced. It returns a description of where the tree went.
+func writePEResources(tibiaBinary []byte, resources []peResource) ([]byte, string, error) {
+	_, directory, err := readPEResources(tibiaBinary)
+	if err != nil {
+		return nil, "", err
+	}
+	layout, err := readPEHeaderLayout(tibiaBinary)
+	if err != nil {
+		return nil, "", err
+	}
+	sortPEResources(resources)
+	size := len(buildPEResourceDirectory(resources, 0))
+
+	section := directory.section
+	start := directory.rva - section.virtualAddress
+	capacity := section.sizeOfRawData
+	if mapped := alignUp(section.virtualSize, layout.sectionAlignment); mapped < capacity {
+		capacity = mapped
+	}
+	capacity -= start
+	rebuilt := append([]byte(nil), tibiaBinary...)
+	if size <= capacity {
+		cleared := size
+		if directory.size > cleared && directory.size <= capacity {
+			cleared = directory.size
+		}
+		copy(rebuilt[directory.offset:directory.offset+cleared], make([]byte, cleared))
+		copy(rebuilt[directory.offset:], buildPEResourceDirectory(resources, directory.rva))
+		if start+size > section.virtualSize {
+			binary.LittleEndian.PutUint32(rebuilt[section.headerOffset+8:], uint32(start+size))
+		}
+		_, _, entryOffset := layout.dataDirectory(rebuilt, peResourceDirectoryIndex)
+		binary.LittleEndian.PutUint32(rebuilt[entryOffset+4:], uint32(size))
+		return rebuilt, fmt.Sprintf("rebuilt in %s @0x%X (%d of %d bytes)", section.name, directory.offset, size, capacity), nil
+	}
+
+	sections := layout.sections(rebuilt)
+	last := sections[len(sections)-1]
+	if section.name == brandingSectionName && section.headerOffset != last.headerOffset {
+		return nil, "", fmt.Errorf("%s section is not the last section; edit the original client instead", brandingSectionName)
+	}
+	if last.name == urlRelocationSectionName {
+		return nil, "", fmt.Errorf("resources cannot grow behind the relocated URL block in %s; edit the original client instead", urlRelocationSectionName)
+	}
+	if rebuilt, err = dropTrailingCertificate(rebuilt, layout); err != nil {
+		return nil, "", err
+	}
+	if rebuilt, layout, err = removeTrailingPESection(rebuilt, layout, brandingSectionName); err != nil {
+		return nil, "", err
+	}
+	rebuilt, sectionOffset, sectionRVA, err := appendPESection(rebuilt, layout, brandingSectionName, make([]byte, size))
+	if err != nil {
+		return nil, "", err
+	}
+	copy(rebuilt[sectionOffset:], buildPEResourceDirectory(resources, sectionRVA))
+	_, _, entryOffset := layout.dataDirectory(rebuilt, peResourceDirectoryIndex)
+	binary.LittleEndian.PutUint32(rebuilt[entryOffset:], uint32(sectionRVA))
+	binary.LittleEndian.PutUint32(rebuilt[entryOffset+4:], uint32(size))
+	return rebuilt, fmt.Sprintf("moved to %s @0x%X (RVA 0x%X, %d bytes; %s holds %d)", brandingSectionName, sectionOffset, sectionRVA, size, section.name, capacity), nil
+}
+
+// iconGroupEntry is a GRPICONDIRENTRY: the ICONDIRENTRY fields without the
+// file offset, and the RT_ICON id holding the image.
+type iconGroupEntry struct {
+	header []byte
+	id     int
+}
+
+func parseIconGroup(data []byte) ([]iconGroupEntry, error) {
+	if len(data) < 6 || binary.LittleEndian.Uint16(data[2:]) != 1 {
+		return nil, fmt.Errorf("not an icon group")
+	}
+	count := int(binary.LittleEndian.Uint16(data[4:]))
+	if len(data) < 6+count*14 {
+		return nil, fmt.Errorf("icon group of %d bytes is too short for %d image(s)", len(data), count)
+	}
+	entries := make([]iconGroupEntry, 0, count)
+	for index := 0; index < count; index++ {
+		entry := data[6+index*14:]
+		entries = append(entries, iconGroupEntry{header: append([]byte(nil), entry[:12]...), id: int(binary.LittleEndian.Uint16(entry[12:]))})
+	}
+	return entries, nil
+}
+
+// parseICOFile splits an .ico file into its directory entries and images.
+func parseICOFile(data []byte) ([]iconGroupEntry, [][]byte, error) {
+	if len(data) < 6 || binary.LittleEndian.Uint16(data) != 0 || binary.LittleEndian.Uint16(data[2:]) != 1 {
+		return nil, nil, fmt.Errorf("not an .ico file")
+	}
+	count := int(binary.LittleEndian.Uint16(data[4:]))
+	if count == 0 || len(data) < 6+count*16 {
+		return nil, nil, fmt.Errorf(".ico file has %d image(s) and %d bytes", count, len(data))
+	}
+	entries := make([]iconGroupEntry, 0, count)
+	images := make([][]byte, 0, count)
+	for index := 0; index < count; index++ {
+		entry := data[6+index*16:]
+		size := int(binary.LittleEndian.Uint32(entry[8:]))
+		offset := int(binary.LittleEndian.Uint32(entry[12:]))
+		if offset < 6+count*16 || offset+size > len(data) {
+			return nil, nil, fmt.Errorf(".ico image %d (%d bytes @0x%X) is outside the file", index+1, size, offset)
+		}
+		entries = append(entries, iconGroupEntry{header: append([]byte(nil), entry[:12]...)})
+		images = append(images, data[offset:offset+size])
+	}
+	return entries, images, nil
+}
+
+// replaceIcon swaps the images of the first icon group, the one Explorer
+// shows. The group's RT_ICON ids are reused and new ids follow the highest
+// one in use.
+func replaceIcon(resources []peResource, ico []byte) ([]peResource, string, error) {
+	entries, images, err := parseICOFile(ico)
+	if err != nil {
+		return nil, "", err
+	}
+	groupIndex := -1
+	for index, resource := range resources {
+		if resource.is(resourceTypeGroupIcon) {
+			groupIndex = index
+			break
+		}
+	}
+	if groupIndex == -1 {
+		return nil, "", fmt.Errorf("the client has no RT_GROUP_ICON resource")
+	}
+	group := resources[groupIndex]
+	oldEntries, err := parseIconGroup(group.data)
+	if err != nil {
+		return nil, "", fmt.Errorf("RT_GROUP_ICON %s: %w", group.name.text(), err)
+	}
+
+	oldIDs := make(map[int]struct{}, len(oldEntries))
+	ids := make([]int, 0, len(entries))
+	for _, entry := range oldEntries {
+		oldIDs[entry.id] = struct{}{}
+		ids = append(ids, entry.id)
+	}
+	nextID := 1
+	kept := make([]peResource, 0, len(resources))
+	for _, resource := range resources {
+		if resource.is(resourceTypeIcon) && resource.name.name == "" {
+			if resource.name.id >= nextID {
+				nextID = resource.name.id + 1
+			}
+			if _, ok := oldIDs[resource.name.id]; ok && resource.language == group.language {
+				continue
+			}
+		}
+		kept = append(kept, resource)
+	}
+	for len(ids) < len(entries) {
+		ids = append(ids, nextID)
+		nextID++
+	}
+
+	groupData := append([]byte(nil), ico[:6]...)
+	for index, entry := range entries {
+		groupData = append(groupData, entry.header...)
+		groupData = binary.LittleEndian.AppendUint16(groupData, uint16(ids[index]))
+		kept = append(kept, peResource{
+			resourceType: peResourceID{id: resourceTypeIcon},
+			name:         peResourceID{id: ids[index]},
+			language:     group.language,
+			codePage:     group.codePage,
+			data:         images[index],
+		})
+	}
+	for index := range kept {
+		if kept[index].resourceType == group.resourceType && kept[index].name == group.name && kept[index].language == group.language {
+			kept[index].data = groupData
+		}
+	}
+	sortPEResources(kept)
+	return kept, fmt.Sprintf("RT_GROUP_ICON %s: %d image(s) -> %d image(s)", group.name.text(), len(oldEntries), len(entries)), nil
+}
+
+// versionNode is a VS_VERSIONINFO block: VS_VERSION_INFO, StringFileInfo,
+// a string table, a string, VarFileInfo or a Var.
+type versionNode struct {
+	key      string
+	text     bool
+	value    []byte
+	children []versionNode
+}
+
+func parseVersionNode(data []byte, offset int) (versionNode, error) {
+	var node versionNode
+	if offset+6 > len(data) {
+		return node, fmt.Errorf("version block @0x%X is truncated", offset)
+	}
+	end := offset + int(binary.LittleEndian.Uint16(data[offset:]))
+	valueLength := int(binary.LittleEndian.Uint16(data[offset+2:]))
+	node.text = binary.LittleEndian.Uint16(data[offset+4:]) == 1
+	if end > len(data) || end < offset+6 {
+		return node, fmt.Errorf("version block @0x%X has an invalid length", offset)
+	}
+	position := offset + 6
+	units := make([]uint16, 0)
+	for ; position+1 < end; position += 2 {
+		unit := binary.LittleEndian.Uint16(data[position:])
+		if unit == 0 {
+			break
+		}
+		units = append(units, unit)
+	}
+	node.key = string(utf16.Decode(units))
+	position = alignUp(position+2, 4)
+	if node.text {
+		valueLength *= 2
+	}
+	if position+valueLength > end {
+		valueLength = end - position
+	}
+	if valueLength > 0 {
+		node.value = append([]byte(nil), data[position:position+valueLength]...)
+	}
+	for position = alignUp(position+valueLength, 4); position+6 <= end; {
+		child, err := parseVersionNode(data, position)
+		if err != nil {
+			return node, err
+		}
+		node.children = append(node.children, child)
+		position = alignUp(position+int(binary.LittleEndian.Uint16(data[position:])), 4)
+	}
+	return node, nil
+}
+
+func (node versionNode) bytes() []byte {
+	block := make([]byte, 6)
+	for _, unit := range utf16.Encode([]rune(node.key + "\x00")) {
+		block = binary.LittleEndian.AppendUint16(block, unit)
+	}
+	block = append(block, make([]byte, alignUp(len(block), 4)-len(block))...)
+	block = append(block, node.value...)
+	valueLength := len(node.value)
+	if node.text {
+		valueLength /= 2
+		binary.LittleEndian.PutUint16(block[4:], 1)
+	}
+	binary.LittleEndian.PutUint16(block[2:], uint16(valueLength))
+	for _, child := range node.children {
+		block = append(block, make([]byte, alignUp(len(block), 4)-len(block))...)
+		block = append(block, child.bytes()...)
+	}
+	binary.LittleEndian.PutUint16(block, uint16(len(block)))
+	return block
+}
+
+func (node versionNode) textValue() string {
+	units := make([]uint16, 0, len(node.value)/2)
+	for position := 0; position+1 < len(node.value); position += 2 {
+		unit := binary.LittleEndian.Uint16(node.value[position:])
+		if unit == 0 {
+			break
+		}
+		units = append(units, unit)
+	}
+	return string(utf16.Decode(units))
+}
+
+// versionString returns a StringFileInfo value from the first string table
+// that has it.
+func (node versionNode) versionString(key string) (string, bool) {
+	for _, block := range node.children {
+		if block.key != "StringFileInfo" {
+			continue
+		}
+		for _, table := range block.children {
+			for _, entry := range table.children {
+				if strings.EqualFold(entry.key, key) {
+					return entry.textValue(), true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// setVersionStrings writes values into every string table of every
+// RT_VERSION resource. Keys match the existing ones case-insensitively; a key
+// the table lacks is added when it is a standard StringFileInfo key.
+func setVersionStrings(resources []peResource, values map[string]string) ([]string, error) {
+	changes := make([]string, 0)
+	found := false
+	for index, resource := range resources {
+		if !resource.is(resourceTypeVersion) {
+			continue
+		}
+		found = true
+		root, err := parseVersionNode(resource.data, 0)
+		if err != nil {
+			return nil, fmt.Errorf("RT_VERSION %s: %w", resource.name.text(), err)
+		}
+		for blockIndex := range root.children {
+			block := &root.children[blockIndex]
+			if block.key != "StringFileInfo" {
+				continue
+			}
+			for tableIndex := range block.children {
+				table := &block.children[tableIndex]
+				for _, key := range sortedKeys(values) {
+					change, err := table.setVersionString(key, values[key])
+					if err != nil {
+						return nil, err
+					}
+					changes = append(changes, fmt.Sprintf("%s [%s] %s", resource.name.text(), table.key, change))
+				}
+			}
+		}
+		resources[index].data = root.bytes()
+	}
+	if !found {
+		return nil, fmt.Errorf("the client has no RT_VERSION resource")
+	}
+	return changes, nil
+}
+
+func (table *versionNode) setVersionString(key string, value string) (string, error) {
+	encoded := make([]byte, 0, len(value)*2+2)
+	for _, unit := range utf16.Encode([]rune(value + "\x00")) {
+		encoded = binary.LittleEndian.AppendUint16(encoded, unit)
+	}
+	for index := range table.children {
+		entry := &table.children[index]
+		if strings.EqualFold(entry.key, key) {
+			before := entry.textValue()
+			entry.value = encoded
+			entry.text = true
+			return fmt.Sprintf("%s=%q -> %q", entry.key, before, value), nil
+		}
+	}
+	for _, name := range versionStringKeys {
+		if strings.EqualFold(name, key) {
+			table.children = append(table.children, versionNode{key: name, text: true, value: encoded})
+			return fmt.Sprintf("%s=%q (added)", name, value), nil
+		}
+	}
+	return "", fmt.Errorf("unknown version string %q; known keys: %s", key, strings.Join(versionStringKeys, ", "))
+}
+
+// replaceManifest swaps the data of every RT_MANIFEST resource, or adds
+// manifest 1 when the client has none.
+func replaceManifest(resources []peResource, manifest []byte) ([]peResource, string) {
+	replaced := 0
+	for index, resource := range resources {
+		if resource.is(resourceTypeManifest) {
+			resources[index].data = manifest
+			replaced++
+		}
+	}
+	if replaced > 0 {
+		return resources, fmt.Sprintf("%d RT_MANIFEST resource(s) replaced (%d bytes)", replaced, len(manifest))
+	}
+	resources = append(resources, peResource{
+		resourceType: peResourceID{id: resourceTypeManifest},
+		name:         peResourceID{id: 1},
+		language:     resourceDefaultLanguage,
+		data:         manifest,
+	})
+	sortPEResources(resources)
+	return resources, fmt.Sprintf("RT_MANIFEST 1 added (%d bytes)", len(manifest))
+}
+
+// samePEResources reports whether two sorted resource lists are identical.
+func samePEResources(left []peResource, right []peResource) bool {
+	if len(left) != len(right) {
+		return false
+	}
+	for index := range left {
+		if left[index].resourceType != right[index].resourceType || left[index].name != right[index].name ||
+			left[index].language != right[index].language || !bytes.Equal(left[index].data, right[index].data) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,187 @@
+package edit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+const (
+	resourceFixtureOffset = 0x800
+	resourceFixtureRVA    = 0x3000
+	resourceFixtureSize   = 0x400
+)
+
+func newVersionResource(values map[string]string) []byte {
+	fixed := make([]byte, 52)
+	binary.LittleEndian.PutUint32(fixed, 0xfeef04bd)
+	table := versionNode{key: "040904B0", text: true}
+	for _, key := range sortedKeys(values) {
+		if _, err := table.setVersionString(key, values[key]); err != nil {
+			panic(err)
+		}
+	}
+	root := versionNode{key: "VS_VERSION_INFO", value: fixed, children: []versionNode{
+		{key: "StringFileInfo", text: true, children: []versionNode{table}},
+		{key: "VarFileInfo", text: true, children: []versionNode{{key: "Translation", value: []byte{0x09, 0x04, 0xb0, 0x04}}}},
+	}}
+	return root.bytes()
+}
+
+func newIconGroup(ids ...int) []byte {
+	group := []byte{0, 0, 1, 0, byte(len(ids)), 0}
+	for _, id := range ids {
+		group = append(group, 16, 16, 0, 0, 1, 0, 32, 0, 40, 0, 0, 0)
+		group = binary.LittleEndian.AppendUint16(group, uint16(id))
+	}
+	return group
+}
+
+func newICOFile(images ...[]byte) []byte {
+	ico := []byte{0, 0, 1, 0, byte(len(images)), 0}
+	offset := 6 + 16*len(images)
+	for _, image := range images {
+		ico = append(ico, 32, 32, 0, 0, 1, 0, 32, 0)
+		ico = binary.LittleEndian.AppendUint32(ico, uint32(len(image)))
+		ico = binary.LittleEndian.AppendUint32(ico, uint32(offset))
+		offset += len(image)
+	}
+	for _, image := range images {
+		ico = append(ico, image...)
+	}
+	return ico
+}
+
+// newResourceFixture adds a .rsrc section to the relocation fixture holding
+// an icon, its group, a version resource, a manifest and a resource with a
+// string type and name.
+func newResourceFixture(t *testing.T) []byte {
+	t.Helper()
+	tibiaBinary := append(newRelocationFixture(t), make([]byte, resourceFixtureSize)...)
+	binary.LittleEndian.PutUint16(tibiaBinary[0x86:], 3)
+	binary.LittleEndian.PutUint32(tibiaBinary[0x98+56:], 0x4000)
+	writeFixtureSection(tibiaBinary, 2, ".rsrc", resourceFixtureRVA, resourceFixtureOffset, 0x40000040)
+	header := tibiaBinary[0x98+240+2*peSectionHeaderSize:]
+	binary.LittleEndian.PutUint32(header[8:], resourceFixtureSize)
+	binary.LittleEndian.PutUint32(header[16:], resourceFixtureSize)
+
+	resources := []peResource{
+		{resourceType: peResourceID{id: resourceTypeIcon}, name: peResourceID{id: 1}, language: 1033, data: bytes.Repeat([]byte{0x11}, 40)},
+		{resourceType: peResourceID{id: resourceTypeGroupIcon}, name: peResourceID{id: 101}, language: 1033, data: newIconGroup(1)},
+		{resourceType: peResourceID{id: resourceTypeVersion}, name: peResourceID{id: 1}, language: 1033, data: newVersionResource(map[string]string{"ProductName": "Tibia", "FileVersion": "15.30.0.f3a1"})},
+		{resourceType: peResourceID{id: resourceTypeManifest}, name: peResourceID{id: 1}, language: 1033, data: []byte("<assembly/>")},
+		{resourceType: peResourceID{name: "TIBIADATA"}, name: peResourceID{name: "CONFIG"}, language: 0, data: []byte("data")},
+	}
+	sortPEResources(resources)
+	directory := buildPEResourceDirectory(resources, resourceFixtureRVA)
+	if len(directory) > resourceFixtureSize {
+		t.Fatalf("fixture resources need %d bytes", len(directory))
+	}
+	copy(tibiaBinary[resourceFixtureOffset:], directory)
+	setFixtureDataDirectory(tibiaBinary, peResourceDirectoryIndex, resourceFixtureRVA, len(directory))
+	return tibiaBinary
+}
+
+func TestReadPEResourcesFlattensTree(t *testing.T) {
+	tibiaBinary := newResourceFixture(t)
+
+	resources, directory, err := readPEResources(tibiaBinary)
+	if err != nil {
+		t.Fatalf("expected the resource tree to parse: %s", err)
+	}
+	if directory.section.name != ".rsrc" || directory.offset != resourceFixtureOffset {
+		t.Fatalf("expected the tree at the start of .rsrc, got %+v", directory)
+	}
+	if binary.LittleEndian.Uint16(tibiaBinary[resourceFixtureOffset+12:]) != 1 || binary.LittleEndian.Uint16(tibiaBinary[resourceFixtureOffset+14:]) != 4 {
+		t.Fatalf("expected one named and four id types in the root directory")
+	}
+	if len(resources) != 5 || resources[0].typeText() != "TIBIADATA" || resources[0].name.text() != "CONFIG" {
+		t.Fatalf("expected the named type first, got %+v", resources)
+	}
+	described := make([]string, 0, len(resources))
+	for _, resource := range resources {
+		described = append(described, resource.describe())
+	}
+	for _, expected := range []string{"RT_GROUP_ICON 101 (language 1033): 20 bytes, 1 image(s)", `ProductName="Tibia" FileVersion="15.30.0.f3a1"`} {
+		if !strings.Contains(strings.Join(described, "\n"), expected) {
+			t.Fatalf("expected %q in %v", expected, described)
+		}
+	}
+	if version, ok := resourceFileVersion(tibiaBinary); !ok || version != "15.30.0.f3a1" {
+		t.Fatalf("expected the fixture version resource to be readable, got %q", version)
+	}
+}
+
+func TestSetVersionStringsRebuildsInPlace(t *testing.T) {
+	tibiaBinary := newResourceFixture(t)
+	resources, _, _ := readPEResources(tibiaBinary)
+
+	changes, err := setVersionStrings(resources, map[string]string{"productname": "My OT", "companyname": "OT Team"})
+	if err != nil || len(changes) != 2 {
+		t.Fatalf("expected two version changes, got %v err=%v", changes, err)
+	}
+	branded, location, err := writePEResources(tibiaBinary, resources)
+	if err != nil || !strings.HasPrefix(location, "rebuilt in .rsrc") || len(branded) != len(tibiaBinary) {
+		t.Fatalf("expected the tree to be rebuilt in place, got %q err=%v", location, err)
+	}
+	written, _, err := readPEResources(branded)
+	if err != nil {
+		t.Fatalf("expected the rebuilt tree to parse: %s", err)
+	}
+	root, err := parseVersionNode(written[3].data, 0)
+	if err != nil {
+		t.Fatalf("expected the version resource to parse: %s", err)
+	}
+	for key, expected := range map[string]string{"ProductName": "My OT", "CompanyName": "OT Team", "FileVersion": "15.30.0.f3a1"} {
+		if value, ok := root.versionString(key); !ok || value != expected {
+			t.Fatalf("expected %s=%q, got %q", key, expected, value)
+		}
+	}
+
+	if _, err := setVersionStrings(resources, map[string]string{"servername": "x"}); err == nil || !strings.Contains(err.Error(), "unknown version string") {
+		t.Fatalf("expected an unknown version key to fail, got %v", err)
+	}
+}
+
+func TestReplaceIconGrowsIntoNewSection(t *testing.T) {
+	tibiaBinary := newResourceFixture(t)
+	resources, _, _ := readPEResources(tibiaBinary)
+
+	large := bytes.Repeat([]byte{0x22}, 0x300)
+	small := bytes.Repeat([]byte{0x33}, 0x40)
+	resources, change, err := replaceIcon(resources, newICOFile(large, small))
+	if err != nil || change != "RT_GROUP_ICON 101: 1 image(s) -> 2 image(s)" {
+		t.Fatalf("expected the icon group to be replaced, got %q err=%v", change, err)
+	}
+	branded, location, err := writePEResources(tibiaBinary, resources)
+	if err != nil || !strings.HasPrefix(location, "moved to "+brandingSectionName) {
+		t.Fatalf("expected the tree to move to a new section, got %q err=%v", location, err)
+	}
+	peData := inspectPE(branded)
+	if !peData.valid || len(peData.sections) != 4 || peData.sections[3].name != brandingSectionName {
+		t.Fatalf("expected a fourth %s section, got %+v", brandingSectionName, peData.sections)
+	}
+	layout, _ := readPEHeaderLayout(branded)
+	if rva, _, _ := layout.dataDirectory(branded, peResourceDirectoryIndex); rva != peData.sections[3].rvaStart {
+		t.Fatalf("expected the resource directory to point at the new section, got RVA 0x%X", rva)
+	}
+
+	written, _, err := readPEResources(branded)
+	if err != nil {
+		t.Fatalf("expected the moved tree to parse: %s", err)
+	}
+	entries, _ := parseIconGroup(written[3].data)
+	if len(entries) != 2 || entries[0].id != 1 || entries[1].id != 2 {
+		t.Fatalf("expected the old icon id reused and a new one added, got %+v", entries)
+	}
+	if !bytes.Equal(written[1].data, large) || !bytes.Equal(written[2].data, small) {
+		t.Fatalf("expected the icon images in RT_ICON 1 and 2")
+	}
+
+	// A second run fits the section it left behind.
+	rebranded, location, err := writePEResources(branded, written)
+	if err != nil || !strings.HasPrefix(location, "rebuilt in "+brandingSectionName) || !bytes.Equal(rebranded, branded) {
+		t.Fatalf("expected a repeated edit to rebuild the same tree in place, got %q err=%v", location, err)
+	}
+}
@@ -0,0 +1,317 @@
+package edit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const editRecordSuffix = ".client-editor.json"
+
+// revertReconstruction is the result of undoing known edits without a record.
+// unresolved lists edits that could not be undone byte for byte.
+type revertReconstruction struct {
+	tibiaBinary []byte
+	restored    []string
+	unresolved  []string
+}
+
+// editRecordPath is where edit keeps the patch file of the last export so
+// revert can restore the exact source bytes.
+func editRecordPath(tibiaPath string) string {
+	return tibiaPath + editRecordSuffix
+}
+
+// Revert restores a patched client to its pristine bytes. It prefers the edit
+// record written beside the client, then rebuilds the original bytes from the
+// known signature, RSA and URL pairs, and finally falls back to the newest
+// backup that matches the recorded source SHA256. A rebuilt client is only
+// written when a hash or an identical backup confirms it.
+func Revert(tibiaExe string, recordPath string, expectedSHA256 string) {
+	tibiaPath, tibiaBinary := readFile(tibiaExe)
+	currentSHA256 := sha256Hex(tibiaBinary)
+
+	if recordPath == "" {
+		recordPath = editRecordPath(tibiaPath)
+	}
+	record, err := readPatchFile(recordPath)
+	hasRecord := err == nil
+	switch {
+	case hasRecord:
+		fmt.Printf("[INFO] Using edit record %s (source SHA256 %s)\n", recordPath, record.SourceSHA256)
+		if expectedSHA256 == "" {
+			expectedSHA256 = record.SourceSHA256
+		}
+	case !os.IsNotExist(err):
+		fmt.Printf("[WARN] Ignoring unreadable edit record %s: %s\n", recordPath, err.Error())
+	}
+	expectedSHA256 = strings.ToLower(expectedSHA256)
+
+	if expectedSHA256 != "" && currentSHA256 == expectedSHA256 {
+		fmt.Printf("[INFO] %s already matches the source SHA256; nothing to revert\n", filepath.Base(tibiaPath))
+		return
+	}
+
+	if hasRecord && strings.EqualFold(currentSHA256, record.TargetSHA256) {
+		pristine, err := record.invert().apply(tibiaBinary)
+		if err == nil {
+			fmt.Printf("[PATCH] Reverted %d byte run(s) from the edit record; SHA256 verified %s\n", len(record.Runs), record.SourceSHA256)
+			writeRevertedClient(tibiaPath, tibiaBinary, pristine)
+			return
+		}
+		fmt.Printf("[WARN] Edit record could not be replayed in reverse: %s\n", err.Error())
+	}
+
+	reconstruction := reconstructPristineClient(tibiaBinary)
+	for _, restored := range reconstruction.restored {
+		fmt.Printf("[INFO] Reconstructed %s\n", restored)
+	}
+	for _, unresolved := range reconstruction.unresolved {
+		fmt.Printf("[WARN] Unable to reconstruct %s\n", unresolved)
+	}
+	reconstructedSHA256 := sha256Hex(reconstruction.tibiaBinary)
+	switch {
+	case expectedSHA256 != "" && reconstructedSHA256 == expectedSHA256:
+		fmt.Printf("[PATCH] Reconstructed client verified against source SHA256 %s\n", expectedSHA256)
+		writeRevertedClient(tibiaPath, tibiaBinary, reconstruction.tibiaBinary)
+		return
+	case expectedSHA256 == "" && len(reconstruction.unresolved) == 0 && len(reconstruction.restored) > 0:
+		// The rebuild only undoes byte pairs it recognizes and cannot see
+		// [[patch]], [[strings]], branding or qtres edits, so on its own it
+		// proves nothing. An identical backup confirms it.
+		if backupPath, backupBinary, ok := findPristineBackup(tibiaPath, len(tibiaBinary), reconstructedSHA256); ok {
+			fmt.Printf("[PATCH] Reconstructed client matches backup %s (SHA256 %s)\n", filepath.Base(backupPath), reconstructedSHA256)
+			writeRevertedClient(tibiaPath, tibiaBinary, backupBinary)
+			return
+		}
+		fmt.Printf("[WARN] No source SHA256 is recorded and no backup matches the reconstructed client (SHA256 %s); looking for a backup\n", reconstructedSHA256)
+	case expectedSHA256 != "":
+		fmt.Printf("[WARN] Reconstructed SHA256 %s does not match source SHA256 %s; looking for a backup\n", reconstructedSHA256, expectedSHA256)
+	default:
+		fmt.Printf("[WARN] Reconstruction is incomplete; looking for a backup\n")
+	}
+
+	backupPath, backupBinary, ok := findPristineBackup(tibiaPath, len(tibiaBinary), expectedSHA256)
+	if !ok {
+		fmt.Printf("[ERROR] No backup of %s matches the original client; revert aborted\n", filepath.Base(tibiaPath))
+		if expectedSHA256 == "" {
+			fmt.Printf("[ERROR] Pass --source-sha256 with the SHA256 of the original client to verify the reconstruction\n")
+		}
+		os.Exit(1)
+	}
+	fmt.Printf("[PATCH] Restoring %s from backup %s (SHA256 %s)\n", filepath.Base(tibiaPath), filepath.Base(backupPath), sha256Hex(backupBinary))
+	writeRevertedClient(tibiaPath, tibiaBinary, backupBinary)
+}
+
+// writeRevertedClient backs up the patched client and overwrites it. The
+// backup takes the first free BKP<unix> name from now on, so it never
+// replaces the backup being restored.
+func writeRevertedClient(tibiaPath string, tibiaBinary []byte, pristineBinary []byte) {
+	if existingBackupPath, ok := findIdenticalBackup(tibiaPath, tibiaBinary); ok {
+		fmt.Printf("[INFO] %s is already backed up as %s\n", filepath.Base(tibiaPath), filepath.Base(existingBackupPath))
+	} else {
+		backupPath := uniqueBackupPathFor(tibiaPath)
+		fmt.Printf("[INFO] Backing up %s to %s\n", filepath.Base(tibiaPath), filepath.Base(backupPath))
+		if err := os.WriteFile(backupPath, tibiaBinary, 0644); err != nil {
+			fmt.Printf("[ERROR] %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+	if err := os.WriteFile(tibiaPath, pristineBinary, 0644); err != nil {
+		fmt.Printf("[ERROR] %s\n", err.Error())
+		os.Exit(1)
+	}
+	fmt.Printf("[INFO] Reverted client written to: %s\n", tibiaPath)
+}
+
+// writeEditRecord stores the patch file of an export beside the client. When
+// the source was itself produced by the previous record, the records are
+// chained so revert still leads back to the pristine client. The record is
+// best effort: a write failure is reported and an empty path returned.
+func writeEditRecord(tibiaPath string, sourceBinary []byte, tibiaBinary []byte, configValues map[string]string) string {
+	recordPath := editRecordPath(tibiaPath)
+	if previous, err := readPatchFile(recordPath); err == nil && strings.EqualFold(previous.TargetSHA256, sha256Hex(sourceBinary)) {
+		if pristineBinary, err := previous.invert().apply(sourceBinary); err == nil {
+			sourceBinary = pristineBinary
+		}
+	}
+	patchData, err := encodePatchFile(newPatchFile(tibiaPath, sourceBinary, tibiaBinary, configValues))
+	if err == nil {
+		err = os.WriteFile(recordPath, patchData, 0644)
+	}
+	if err != nil {
+		fmt.Printf("[WARN] Unable to write edit record %s: %s\n", recordPath, err.Error())
+		return ""
+	}
+	fmt.Printf("[INFO] Edit record written to: %s\n", recordPath)
+	return recordPath
+}
+
+// invert swaps the old and new bytes of every run and the two hashes. Size
+// becomes the target size, which differs when a section was appended.
+func (patch patchFile) invert() patchFile {
+	inverted := patch
+	inverted.SourceSHA256, inverted.TargetSHA256 = patch.TargetSHA256, patch.SourceSHA256
+	inverted.Runs = make([]patchFileRun, len(patch.Runs))
+	for index, run := range patch.Runs {
+		inverted.Runs[index] = patchFileRun{Offset: run.Offset, Old: run.New, New: run.Old}
+		inverted.Size += (len(run.New) - len(run.Old)) / 2
+	}
+	return inverted
+}
+
+// reconstructPristineClient undoes the RSA replacement, every applied BattlEye
+// signature whose original bytes survive the replacement, and URL rewrites for
+// which an unmodified copy of the default value is still embedded.
+func reconstructPristineClient(tibiaBinary []byte) revertReconstruction {
+	reconstruction := revertReconstruction{tibiaBinary: append([]byte(nil), tibiaBinary...)}
+
+	tibiaKey := loadRSAKeyOrExit(tibiaRSAKeyPath)
+	otservKey := loadRSAKeyOrExit(DefaultRSAKeyPath)
+	for _, encoding := range tibiaKey.encodings() {
+		tibiaRsa, otservRsa := tibiaKey.text(encoding), otservKey.text(encoding)
+		if len(otservRsa) == 0 || !bytes.Contains(reconstruction.tibiaBinary, otservRsa) {
+			continue
+		}
+		if len(tibiaRsa) != len(otservRsa) {
+			reconstruction.unresolved = append(reconstruction.unresolved, "Tibia RSA because the key files differ in length")
+			break
+		}
+		for _, slice := range executableSlices(reconstruction.tibiaBinary) {
+			sliceData := reconstruction.tibiaBinary[slice.start:slice.end]
+			if offset := bytes.Index(sliceData, otservRsa); offset != -1 {
+				copy(sliceData[offset:], tibiaRsa)
+				reconstruction.restored = append(reconstruction.restored, fmt.Sprintf("Tibia RSA @0x%X", slice.start+offset))
+			}
+		}
+		break
+	}
+
+	for _, patch := range battleyePatches {
+		for _, patched := range patch.revertiblePatterns() {
+			for _, offset := range patched.findAll(reconstruction.tibiaBinary) {
+				if !patch.original.reversibleFrom(patched) {
+					reconstruction.unresolved = append(reconstruction.unresolved, fmt.Sprintf("BattlEye signature %q @0x%X because its replaced bytes are wildcards in the original pattern", patch.name, offset))
+					continue
+				}
+				for index, known := range patch.original.mask {
+					if known {
+						reconstruction.tibiaBinary[offset+index] = patch.original.data[index]
+					}
+				}
+				reconstruction.restored = append(reconstruction.restored, fmt.Sprintf("BattlEye signature %q @0x%X", patch.name, offset))
+			}
+		}
+	}
+
+	for _, slice := range executableSlices(reconstruction.tibiaBinary) {
+		sliceData := reconstruction.tibiaBinary[slice.start:slice.end]
+		for _, property := range embeddedConfigKeyNames(sliceData) {
+			start, end, ok := paddedPropertyValue(sliceData, property)
+			if !ok {
+				continue
+			}
+			if original, found := embeddedPropertyDefault(sliceData, property, end-start); found {
+				copy(sliceData[start:end], original)
+				reconstruction.restored = append(reconstruction.restored, fmt.Sprintf("%s @0x%X from an embedded default", property, slice.start+start))
+				continue
+			}
+			reconstruction.unresolved = append(reconstruction.unresolved, fmt.Sprintf("%s @0x%X because no embedded default of %d bytes remains", property, slice.start+start, end-start))
+		}
+	}
+
+	return reconstruction
+}
+
+// revertiblePatterns returns the patched shapes edit can leave behind for a
+// signature: the normal replacement and, outside legacy evidence, the
+// aggressive one.
+func (patch battleyePatch) revertiblePatterns() []bytePattern {
+	patterns := make([]bytePattern, 0, 2)
+	if !patch.diagnosticOnly && len(patch.patched.data) > 0 {
+		patterns = append(patterns, patch.patched)
+	}
+	if !patch.legacyEvidenceOnly && len(patch.aggressiveReplacement) > 0 {
+		patterns = append(patterns, newBytePattern(patch.name+" [aggressive]", patch.aggressiveReplacement...))
+	}
+	return patterns
+}
+
+// reversibleFrom reports whether every byte fixed by patched is also fixed by
+// the original pattern, so the original bytes can be written back.
+func (pattern bytePattern) reversibleFrom(patched bytePattern) bool {
+	if len(pattern.mask) != len(patched.mask) {
+		return false
+	}
+	for index, fixed := range patched.mask {
+		if fixed && !pattern.mask[index] {
+			return false
+		}
+	}
+	return true
+}
+
+// paddedPropertyValue finds the embedded config value of property when it
+// carries the space padding setPropertyByName adds, which marks it as
+// rewritten.
+func paddedPropertyValue(tibiaBinary []byte, property string) (int, int, bool) {
+	start, end, ok := locateEmbeddedConfigValue(tibiaBinary, property)
+	if !ok || end <= start || tibiaBinary[end-1] != paddingByte[0] {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+// embeddedPropertyDefault looks for an unpadded copy of property with the
+// stock value length outside the embedded config block.
+func embeddedPropertyDefault(tibiaBinary []byte, property string, length int) ([]byte, bool) {
+	key := []byte(property + "=")
+	blockValue, _, _ := locateEmbeddedConfigValue(tibiaBinary, property)
+	for _, offset := range findAllOffsets(tibiaBinary, key) {
+		start := offset + len(key)
+		if start == blockValue {
+			continue
+		}
+		lineEnd := bytes.IndexByte(tibiaBinary[start:], '\n')
+		if lineEnd == length && tibiaBinary[start+lineEnd-1] != paddingByte[0] {
+			return tibiaBinary[start : start+lineEnd], true
+		}
+	}
+	return nil, false
+}
+
+// findPristineBackup returns the newest BKP<unix>-<client> backup beside the
+// client that matches expectedSHA256, or, without a recorded hash, the newest
+// same-size backup that still carries the Tibia RSA key.
+func findPristineBackup(tibiaPath string, size int, expectedSHA256 string) (string, []byte, bool) {
+	backups := listBackups(tibiaPath)
+	var tibiaKey rsaKeyMaterial
+	if expectedSHA256 == "" {
+		tibiaKey = loadRSAKeyOrExit(tibiaRSAKeyPath)
+	}
+	for _, backup := range backups {
+		backupBinary, err := os.ReadFile(backup.path)
+		if err != nil {
+			continue
+		}
+		if expectedSHA256 != "" {
+			if sha256Hex(backupBinary) == expectedSHA256 {
+				return backup.path, backupBinary, true
+			}
+			continue
+		}
+		if len(backupBinary) == size && tibiaKey.foundIn(backupBinary) {
+			return backup.path, backupBinary, true
+		}
+	}
+	return "", nil, false
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,145 @@
+package edit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRevertUsesChainedEditRecord(t *testing.T) {
+	workDir := t.TempDir()
+	sourceBinary := []byte("header--AAAA--[URLS]\nloginWebService=https://www.tibia.com/login\n\x00")
+	firstEdit := append([]byte(nil), sourceBinary...)
+	copy(firstEdit[8:], "BBBB")
+	secondEdit := append([]byte(nil), firstEdit...)
+	if !setPropertyByName(secondEdit, "loginWebService", "http://127.0.0.1") {
+		t.Fatal("expected the fixture URL to be patched")
+	}
+	tibiaPath := filepath.Join(workDir, "client")
+	writeEditRecord(tibiaPath, sourceBinary, firstEdit, nil)
+	writeEditRecord(tibiaPath, firstEdit, secondEdit, map[string]string{"loginWebService": "http://127.0.0.1"})
+	writeTestFile(t, tibiaPath, secondEdit)
+
+	record, err := readPatchFile(editRecordPath(tibiaPath))
+	if err != nil || record.SourceSHA256 != sha256Hex(sourceBinary) {
+		t.Fatalf("expected the second record to chain back to the pristine client, got %+v err=%v", record, err)
+	}
+
+	Revert(tibiaPath, "", "")
+
+	if data, _ := os.ReadFile(tibiaPath); !bytes.Equal(data, sourceBinary) {
+		t.Fatalf("expected the pristine client, got %q", data)
+	}
+	backups := listBackups(tibiaPath)
+	if len(backups) != 1 {
+		t.Fatalf("expected revert to back up the edited client, got %+v", backups)
+	}
+	if data, _ := os.ReadFile(backups[0].path); !bytes.Equal(data, secondEdit) {
+		t.Fatalf("expected the backup to hold the edited client, got %q", data)
+	}
+}
+
+func TestRevertReconstructsSignaturesAndRSAKey(t *testing.T) {
+	workDir := t.TempDir()
+	chdirForTest(t, workDir)
+	tibiaRsa := bytes.Repeat([]byte("A"), 32)
+	otservRsa := bytes.Repeat([]byte("B"), 32)
+	writeTestFile(t, filepath.Join(workDir, "tibia_rsa.key"), tibiaRsa)
+	writeTestFile(t, filepath.Join(workDir, "otserv_rsa.key"), otservRsa)
+
+	sourceBinary := append([]byte("header--"), tibiaRsa...)
+	sourceBinary = append(sourceBinary, 0x90, 0x75, 0x0F, 0xE8, 0xD9, 0xD4, 0xED, 0xFF, 0x48, 0x90)
+	sourceBinary = append(sourceBinary, []byte("[URLS]\nloginWebService=https://www.tibia.com/login\n\x00")...)
+	tibiaBinary := append([]byte(nil), sourceBinary...)
+	copy(tibiaBinary[8:], otservRsa)
+	tibiaBinary[41] = 0xEB
+	tibiaPath := filepath.Join(workDir, "client")
+	writeTestFile(t, tibiaPath, tibiaBinary)
+
+	reconstruction := reconstructPristineClient(tibiaBinary)
+	if len(reconstruction.unresolved) != 0 || len(reconstruction.restored) != 2 {
+		t.Fatalf("expected RSA and one signature to be restored, got restored=%q unresolved=%q", reconstruction.restored, reconstruction.unresolved)
+	}
+
+	Revert(tibiaPath, "", sha256Hex(sourceBinary))
+
+	if data, _ := os.ReadFile(tibiaPath); !bytes.Equal(data, sourceBinary) {
+		t.Fatal("expected the reconstructed client to match the source SHA256")
+	}
+}
+
+func TestRevertFallsBackToNewestMatchingBackup(t *testing.T) {
+	workDir := t.TempDir()
+	chdirForTest(t, workDir)
+	tibiaRsa := bytes.Repeat([]byte("A"), 32)
+	otservRsa := bytes.Repeat([]byte("B"), 32)
+	writeTestFile(t, filepath.Join(workDir, "tibia_rsa.key"), tibiaRsa)
+	writeTestFile(t, filepath.Join(workDir, "otserv_rsa.key"), otservRsa)
+
+	sourceBinary := append([]byte("header--"), tibiaRsa...)
+	sourceBinary = append(sourceBinary, []byte("[URLS]\nloginWebService=https://www.tibia.com/login\n\x00")...)
+	tibiaBinary := append([]byte(nil), sourceBinary...)
+	copy(tibiaBinary[8:], otservRsa)
+	if !setPropertyByName(tibiaBinary, "loginWebService", "http://127.0.0.1") {
+		t.Fatal("expected the fixture URL to be patched")
+	}
+	tibiaPath := filepath.Join(workDir, "client")
+	writeTestFile(t, tibiaPath, tibiaBinary)
+	writeTestFile(t, filepath.Join(workDir, "BKP100-client"), sourceBinary)
+	writeTestFile(t, filepath.Join(workDir, "BKP200-client"), tibiaBinary)
+	writeTestFile(t, filepath.Join(workDir, "BKP300x-client"), sourceBinary)
+
+	reconstruction := reconstructPristineClient(tibiaBinary)
+	if len(reconstruction.unresolved) != 1 || !strings.Contains(reconstruction.unresolved[0], "loginWebService") {
+		t.Fatalf("expected the padded URL to stay unresolved, got %q", reconstruction.unresolved)
+	}
+	backups := listBackups(tibiaPath)
+	if len(backups) != 2 || backups[0].timestamp != 200 || backups[1].timestamp != 100 {
+		t.Fatalf("expected backups newest first without malformed names, got %+v", backups)
+	}
+
+	Revert(tibiaPath, "", "")
+
+	if data, _ := os.ReadFile(tibiaPath); !bytes.Equal(data, sourceBinary) {
+		t.Fatal("expected the newest backup carrying the Tibia RSA key to be restored")
+	}
+}
+
+func TestRevertConfirmsUnverifiedReconstructionWithBackup(t *testing.T) {
+	workDir := t.TempDir()
+	chdirForTest(t, workDir)
+	tibiaRsa := bytes.Repeat([]byte("A"), 32)
+	otservRsa := bytes.Repeat([]byte("B"), 32)
+	writeTestFile(t, filepath.Join(workDir, "tibia_rsa.key"), tibiaRsa)
+	writeTestFile(t, filepath.Join(workDir, "otserv_rsa.key"), otservRsa)
+
+	sourceBinary := append([]byte("header--"), tibiaRsa...)
+	sourceBinary = append(sourceBinary, 0x90, 0x75, 0x0F, 0xE8, 0xD9, 0xD4, 0xED, 0xFF, 0x48, 0x90)
+	tibiaBinary := append([]byte(nil), sourceBinary...)
+	copy(tibiaBinary[8:], otservRsa)
+	tibiaBinary[41] = 0xEB
+	tibiaPath := filepath.Join(workDir, "client")
+	writeTestFile(t, tibiaPath, tibiaBinary)
+	// A backup from this very second must not be overwritten by the backup
+	// of the edited client.
+	restoredBackupPath := backupPathFor(tibiaPath)
+	writeTestFile(t, restoredBackupPath, sourceBinary)
+
+	Revert(tibiaPath, "", "")
+
+	if data, _ := os.ReadFile(tibiaPath); !bytes.Equal(data, sourceBinary) {
+		t.Fatal("expected the reconstruction confirmed by the backup to be written")
+	}
+	backups := listBackups(tibiaPath)
+	if len(backups) != 2 {
+		t.Fatalf("expected the restored backup and a backup of the edited client, got %+v", backups)
+	}
+	if data, _ := os.ReadFile(restoredBackupPath); !bytes.Equal(data, sourceBinary) {
+		t.Fatal("expected the restored backup to be left intact")
+	}
+	if data, _ := os.ReadFile(backups[0].path); backups[0].path == restoredBackupPath || !bytes.Equal(data, tibiaBinary) {
+		t.Fatalf("expected the edited client in a newer backup, got %s", backups[0].path)
+	}
+}
@@ -0,0 +1,333 @@
+package edit
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	tibiaRSAKeyPath = "tibia_rsa.key"
+	// DefaultRSAKeyPath is the OTServ public key edit writes into the client.
+	DefaultRSAKeyPath = "otserv_rsa.key"
+	// DefaultRSAPEMPath is the private key file canary loads on startup.
+	DefaultRSAPEMPath = "key.pem"
+
+	// clientRSAKeyBits is the modulus size of every Tibia client; the key is
+	// patched in place, so its text must keep the same length.
+	clientRSAKeyBits = 1024
+
+	rsaEncodingRaw     = "raw"
+	rsaEncodingHex     = "hex"
+	rsaEncodingDecimal = "decimal"
+)
+
+// rsaKeyMaterial is a key file. modulus is nil when the file is neither a PEM
+// key nor a hexadecimal or decimal modulus; raw is then matched byte for byte.
+type rsaKeyMaterial struct {
+	path    string
+	raw     []byte
+	modulus *big.Int
+}
+
+// embeddedRSAModulus is a modulus found as text inside a client slice.
+type embeddedRSAModulus struct {
+	offset   int
+	encoding string
+	modulus  *big.Int
+}
+
+// loadRSAKey reads a PEM public or private key, or a modulus written in
+// hexadecimal or decimal.
+func loadRSAKey(path string) (rsaKeyMaterial, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return rsaKeyMaterial{}, err
+	}
+	key := rsaKeyMaterial{path: path, raw: data}
+	if block, _ := pem.Decode(data); block != nil {
+		modulus, err := pemRSAModulus(block)
+		if err != nil {
+			return rsaKeyMaterial{}, fmt.Errorf("%s: %w", path, err)
+		}
+		key.modulus = modulus
+		return key, nil
+	}
+	key.modulus, _ = parseRSAModulusText(strings.TrimSpace(string(data)))
+	return key, nil
+}
+
+func loadRSAKeyOrExit(path string) rsaKeyMaterial {
+	key, err := loadRSAKey(path)
+	if err != nil {
+		fmt.Printf("[ERROR] %s\n", err.Error())
+		os.Exit(1)
+	}
+	return key
+}
+
+func pemRSAModulus(block *pem.Block) (*big.Int, error) {
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return privateKey.N, nil
+	case "RSA PUBLIC KEY":
+		publicKey, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return publicKey.N, nil
+	case "PRIVATE KEY":
+		privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if rsaKey, ok := privateKey.(*rsa.PrivateKey); ok {
+			return rsaKey.N, nil
+		}
+	case "PUBLIC KEY":
+		publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if rsaKey, ok := publicKey.(*rsa.PublicKey); ok {
+			return rsaKey.N, nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	return nil, fmt.Errorf("PEM block %q does not hold an RSA key", block.Type)
+}
+
+// parseRSAModulusText reads a modulus written only with digits as decimal and
+// anything else as hexadecimal.
+func parseRSAModulusText(text string) (*big.Int, bool) {
+	if text == "" {
+		return nil, false
+	}
+	base := 10
+	for _, char := range text {
+		switch {
+		case char >= '0' && char <= '9':
+		case char >= 'a' && char <= 'f', char >= 'A' && char <= 'F':
+			base = 16
+		default:
+			return nil, false
+		}
+	}
+	return new(big.Int).SetString(text, base)
+}
+
+// text returns the key as it is embedded with the given encoding, or nil when
+// the key cannot be written that way.
+func (key rsaKeyMaterial) text(encoding string) []byte {
+	switch {
+	case key.modulus == nil && encoding == rsaEncodingRaw:
+		return key.raw
+	case key.modulus == nil:
+		return nil
+	case encoding == rsaEncodingHex:
+		return []byte(fmt.Sprintf("%X", key.modulus))
+	case encoding == rsaEncodingDecimal:
+		return []byte(key.modulus.String())
+	default:
+		return nil
+	}
+}
+
+func (key rsaKeyMaterial) encodings() []string {
+	if key.modulus == nil {
+		return []string{rsaEncodingRaw}
+	}
+	return []string{rsaEncodingHex, rsaEncodingDecimal}
+}
+
+// foundIn reports whether the key is embedded in data in any encoding.
+func (key rsaKeyMaterial) foundIn(data []byte) bool {
+	for _, encoding := range key.encodings() {
+		if text := key.text(encoding); len(text) > 0 && bytes.Contains(data, text) {
+			return true
+		}
+	}
+	return false
+}
+
+func (key rsaKeyMaterial) matches(modulus *big.Int) bool {
+	return key.modulus != nil && key.modulus.Cmp(modulus) == 0
+}
+
+// findEmbeddedRSAModuli scans for 1024-bit moduli written as 256 uppercase hex
+// digits or as 308 or 309 decimal digits. Longer or shorter runs of digits
+// are ignored, so hashes and other constants do not qualify.
+func findEmbeddedRSAModuli(data []byte) []embeddedRSAModulus {
+	moduli := make([]embeddedRSAModulus, 0)
+	for start := 0; start < len(data); {
+		if !isUpperHexDigit(data[start]) {
+			start++
+			continue
+		}
+		end := start
+		digitsOnly := true
+		for end < len(data) && isUpperHexDigit(data[end]) {
+			if data[end] > '9' {
+				digitsOnly = false
+			}
+			end++
+		}
+		text := string(data[start:end])
+		var modulus *big.Int
+		encoding := ""
+		switch {
+		case len(text) == clientRSAKeyBits/4:
+			modulus, _ = new(big.Int).SetString(text, 16)
+			encoding = rsaEncodingHex
+		case digitsOnly && (len(text) == 308 || len(text) == 309):
+			modulus, _ = new(big.Int).SetString(text, 10)
+			encoding = rsaEncodingDecimal
+		}
+		if modulus != nil && modulus.BitLen() == clientRSAKeyBits && modulus.Bit(0) == 1 {
+			moduli = append(moduli, embeddedRSAModulus{offset: start, encoding: encoding, modulus: modulus})
+		}
+		start = end
+	}
+	return moduli
+}
+
+func isUpperHexDigit(char byte) bool {
+	return (char >= '0' && char <= '9') || (char >= 'A' && char <= 'F')
+}
+
+func encodeRSAModulus(modulus *big.Int, encoding string) []byte {
+	if encoding == rsaEncodingDecimal {
+		return []byte(modulus.String())
+	}
+	return []byte(fmt.Sprintf("%X", modulus))
+}
+
+// rekeyEmbeddedRSAModulus replaces the single modulus embedded in each slice
+// with otservKey. It refuses slices that embed several different moduli.
+func rekeyEmbeddedRSAModulus(tibiaBinary []byte, otservKey rsaKeyMaterial) ([]byte, error) {
+	if otservKey.modulus == nil {
+		return nil, fmt.Errorf("%s is not a PEM key or an RSA modulus", otservKey.path)
+	}
+	tibiaBinary = append([]byte(nil), tibiaBinary...)
+	found := 0
+	for _, slice := range executableSlices(tibiaBinary) {
+		sliceLabel := ""
+		if slice.arch != "" {
+			sliceLabel = " in Mach-O slice " + slice.label()
+		}
+		sliceData := tibiaBinary[slice.start:slice.end]
+		replaceable := make([]embeddedRSAModulus, 0)
+		distinct := make(map[string]bool)
+		for _, embedded := range findEmbeddedRSAModuli(sliceData) {
+			if otservKey.matches(embedded.modulus) {
+				continue
+			}
+			replaceable = append(replaceable, embedded)
+			distinct[embedded.modulus.String()] = true
+		}
+		switch {
+		case len(distinct) > 1:
+			return nil, fmt.Errorf("found %d different RSA moduli%s; pass the current key as %s", len(distinct), sliceLabel, tibiaRSAKeyPath)
+		case len(replaceable) == 0 && otservKey.foundIn(sliceData):
+			fmt.Printf("[WARN] OTServ RSA already patched%s!\n", sliceLabel)
+			found++
+			continue
+		case len(replaceable) == 0:
+			continue
+		}
+		for _, embedded := range replaceable {
+			replacement := encodeRSAModulus(otservKey.modulus, embedded.encoding)
+			original := encodeRSAModulus(embedded.modulus, embedded.encoding)
+			if len(replacement) != len(original) {
+				return nil, fmt.Errorf("the client embeds a %d-character %s modulus at 0x%X but %s has %d characters; generate a new key", len(original), embedded.encoding, slice.start+embedded.offset, otservKey.path, len(replacement))
+			}
+			copy(sliceData[embedded.offset:], replacement)
+			fmt.Printf("[PATCH] Detected %s RSA modulus at 0x%X replaced with OTServ RSA%s!\n", embedded.encoding, slice.start+embedded.offset, sliceLabel)
+		}
+		found++
+	}
+	if found == 0 {
+		return nil, fmt.Errorf("no RSA modulus found")
+	}
+	return tibiaBinary, nil
+}
+
+// GenerateRSAKey writes a new 1024-bit key pair: the private key as PKCS#1
+// PEM for the server and the modulus as hexadecimal for edit --rsa-key.
+func GenerateRSAKey(pemPath string, modulusPath string, force bool) {
+	for _, path := range []string{pemPath, modulusPath} {
+		if _, err := os.Stat(path); err == nil && !force {
+			fmt.Printf("[ERROR] %s already exists; pass --force to overwrite it\n", path)
+			os.Exit(1)
+		}
+	}
+
+	// Decimal clients embed 309 digits, so keep generating until the modulus
+	// can replace the stock key in either encoding.
+	var privateKey *rsa.PrivateKey
+	for privateKey == nil || len(privateKey.N.String()) != 309 {
+		var err error
+		privateKey, err = rsa.GenerateKey(rand.Reader, clientRSAKeyBits)
+		if err != nil {
+			fmt.Printf("[ERROR] Unable to generate RSA key: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+	if err := os.WriteFile(pemPath, pemData, 0600); err != nil {
+		fmt.Printf("[ERROR] %s\n", err.Error())
+		os.Exit(1)
+	}
+	if err := os.WriteFile(modulusPath, encodeRSAModulus(privateKey.N, rsaEncodingHex), 0644); err != nil {
+		fmt.Printf("[ERROR] %s\n", err.Error())
+		os.Exit(1)
+	}
+	fmt.Printf("[INFO] Private key written to %s; copy it to the server as key.pem\n", pemPath)
+	fmt.Printf("[INFO] Public modulus written to %s\n", modulusPath)
+}
+
+// InspectRSAKeys prints every RSA modulus embedded in tibiaExe and whether it
+// is the Tibia key, the configured OTServ key or an unknown one.
+func InspectRSAKeys(tibiaExe string, keyPath string) {
+	tibiaPath, tibiaBinary := readFile(tibiaExe)
+	tibiaKey, _ := loadRSAKey(tibiaRSAKeyPath)
+	otservKey, err := loadRSAKey(keyPath)
+	if err != nil {
+		fmt.Printf("[WARN] Unable to read %s: %s\n", keyPath, err.Error())
+	}
+
+	count := 0
+	for _, slice := range executableSlices(tibiaBinary) {
+		sliceLabel := ""
+		if slice.arch != "" {
+			sliceLabel = " (" + slice.label() + ")"
+		}
+		for _, embedded := range findEmbeddedRSAModuli(tibiaBinary[slice.start:slice.end]) {
+			owner := "unknown"
+			switch {
+			case tibiaKey.matches(embedded.modulus):
+				owner = "tibia"
+			case otservKey.matches(embedded.modulus):
+				owner = "otserv"
+			}
+			fmt.Printf("[INFO] %s modulus at 0x%X%s: %s %s\n", embedded.encoding, slice.start+embedded.offset, sliceLabel, owner, encodeRSAModulus(embedded.modulus, rsaEncodingHex))
+			count++
+		}
+	}
+	if count == 0 {
+		fmt.Printf("[WARN] No RSA modulus found in %s\n", filepath.Base(tibiaPath))
+	}
+}
@@ -0,0 +1,65 @@
+package edit
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"path/filepath"
+	"testing"
+)
+
+const testOTServModulus = "9B646903B45B07AC956568D87353BD7165139DD7940703B03E6DD079399661B4A837AA60561D7CCB9452FA0080594909882AB5BCA58A1A1B35F8B1059B72B1212611C6152AD3DBB3CFBEE7ADC142A75D3D75971509C321C5C24A5BD51FD460F01B4E15BEB0DE1930528A5D3F15C1E3CBF5C401D6777E10ACAAB33DBE8D5B7FF5"
+
+func TestReplaceTibiaRSAKeyRekeysDetectedDecimalModulus(t *testing.T) {
+	workDir := t.TempDir()
+	chdirForTest(t, workDir)
+	writeTestFile(t, filepath.Join(workDir, tibiaRSAKeyPath), []byte("not embedded in this client"))
+
+	var privateKey *rsa.PrivateKey
+	for privateKey == nil || len(privateKey.N.String()) != 309 {
+		var err error
+		if privateKey, err = rsa.GenerateKey(rand.Reader, clientRSAKeyBits); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pemPath := filepath.Join(workDir, "key.pem")
+	writeTestFile(t, pemPath, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)}))
+	decimalPath := filepath.Join(workDir, "otserv_decimal.key")
+	writeTestFile(t, decimalPath, []byte(privateKey.N.String()+"\n"))
+
+	pemKey, err := loadRSAKey(pemPath)
+	if err != nil || !pemKey.matches(privateKey.N) {
+		t.Fatalf("expected the PEM modulus, got %+v err=%v", pemKey.modulus, err)
+	}
+	if decimalKey, err := loadRSAKey(decimalPath); err != nil || !decimalKey.matches(privateKey.N) {
+		t.Fatalf("expected the decimal modulus, got %+v err=%v", decimalKey.modulus, err)
+	}
+
+	previousKey, _ := parseRSAModulusText(testOTServModulus)
+	tibiaBinary := []byte("header\x00" + previousKey.String() + "\x00trailer 0123456789ABCDEF")
+	rekeyed, err := rekeyClient(tibiaBinary, "", pemPath)
+	if err != nil {
+		t.Fatalf("expected the detected modulus to be replaced: %s", err)
+	}
+
+	if !bytes.Equal(rekeyed, []byte("header\x00"+privateKey.N.String()+"\x00trailer 0123456789ABCDEF")) {
+		t.Fatalf("expected the decimal modulus to be replaced in place, got %q", rekeyed)
+	}
+	if again, err := rekeyEmbeddedRSAModulus(rekeyed, pemKey); err != nil || !bytes.Equal(again, rekeyed) {
+		t.Fatalf("expected a re-keyed client to be left unchanged, err=%v", err)
+	}
+}
+
+func TestRekeyEmbeddedRSAModulusRefusesSeveralModuli(t *testing.T) {
+	previousKey, _ := parseRSAModulusText(testOTServModulus)
+	otherKey := new(big.Int).Add(previousKey, big.NewInt(2))
+	tibiaBinary := []byte(testOTServModulus + "\x00" + string(encodeRSAModulus(otherKey, rsaEncodingHex)) + "\x00")
+	target := rsaKeyMaterial{path: "key.pem", modulus: new(big.Int).Add(previousKey, big.NewInt(4))}
+
+	if _, err := rekeyEmbeddedRSAModulus(tibiaBinary, target); err == nil {
+		t.Fatal("expected two different moduli to be refused")
+	}
+}
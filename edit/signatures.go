@@ -0,0 +1,367 @@
+package edit
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+)
+
+const (
+	signatureDatabaseSchema   = 1
+	builtinSignatureVersion   = "builtin"
+	builtinSignatureSource    = "built-in signature set"
+	signatureAOBWildcard      = "??"
+	signatureShortAOBWildcard = "?"
+)
+
+// signatureDatabase records where the active signature set came from so that
+// diagnose output can be tied back to a signature file release.
+type signatureDatabase struct {
+	source  string
+	version string
+	schema  int
+}
+
+var activeSignatureDatabase = signatureDatabase{
+	source:  builtinSignatureSource,
+	version: builtinSignatureVersion,
+	schema:  signatureDatabaseSchema,
+}
+
+// signatureFile is the on-disk layout of a TOML or JSON signature database.
+// Byte sequences are written as AOB strings such as "75 0F E8 ?? ?? ?? ?? 48".
+type signatureFile struct {
+	Schema       int                      `mapstructure:"schema"`
+	Version      string                   `mapstructure:"version"`
+	Signatures   []signatureFileEntry     `mapstructure:"signature"`
+	Indicators   []signatureFileIndicator `mapstructure:"indicator"`
+	CodePatterns []signatureFilePattern   `mapstructure:"codePattern"`
+}
+
+type signatureFileEntry struct {
+	Name                  string                    `mapstructure:"name"`
+	Original              string                    `mapstructure:"original"`
+	Patched               string                    `mapstructure:"patched"`
+	Replacement           string                    `mapstructure:"replacement"`
+	AggressiveReplacement string                    `mapstructure:"aggressiveReplacement"`
+	DiagnosticOnly        bool                      `mapstructure:"diagnosticOnly"`
+	HighRiskClientCheck   bool                      `mapstructure:"highRiskClientCheck"`
+	LegacyEvidenceOnly    bool                      `mapstructure:"legacyEvidenceOnly"`
+	StructuralGuard       string                    `mapstructure:"structuralGuard"`
+	ExpectedOffsets       []signatureFileKnownPatch `mapstructure:"expectedOffsets"`
+	FalsePositiveCheck    string                    `mapstructure:"falsePositiveCheck"`
+}
+
+type signatureFileKnownPatch struct {
+	SHA256 string `mapstructure:"sha256"`
+	// Version is a client version or a pattern such as "14.12.*".
+	Version string `mapstructure:"version"`
+	Offset  int    `mapstructure:"offset"`
+	Note    string `mapstructure:"note"`
+}
+
+type signatureFileIndicator struct {
+	Name  string `mapstructure:"name"`
+	Value string `mapstructure:"value"`
+}
+
+type signatureFilePattern struct {
+	Name string `mapstructure:"name"`
+	AOB  string `mapstructure:"aob"`
+}
+
+// loadedSignatures is a validated signature file converted to the in-memory
+// representation used by the patcher and the diagnostics.
+type loadedSignatures struct {
+	database     signatureDatabase
+	patches      []battleyePatch
+	indicators   []clientCheckIndicator
+	codePatterns []bytePattern
+}
+
+// structuralGuardPatternLengths pins every structural guard kind to the pattern
+// length its validator was written for, because the validators read operands
+// at fixed positions inside the match.
+var structuralGuardPatternLengths = map[structuralPatchKind]int{
+	structuralClientCheckDisconnected: len(structuralClientCheckDisconnectedPattern.data),
+	structuralEnableClientCheck:       len(structuralEnableClientCheckPattern.data),
+}
+
+// Signatures is a validated signature database. Passing it in
+// PatcherOptions.Signatures uses it for that Patcher only.
+type Signatures struct {
+	signatures loadedSignatures
+}
+
+// ReadSignatures reads and validates a TOML or JSON signature file. Indicators
+// and code patterns the file leaves out keep the built-in ones.
+func ReadSignatures(signaturesPath string) (*Signatures, error) {
+	signatures, err := readSignatureDatabase(signaturesPath)
+	if err != nil {
+		return nil, err
+	}
+	return &Signatures{signatures: signatures}, nil
+}
+
+// Describe names the signature file and release the set was read from.
+func (signatures *Signatures) Describe() string {
+	return signatures.signatures.database.describe()
+}
+
+// LoadSignatureDatabase replaces the built-in BattlEye signatures, client-check
+// indicators and code patterns with the contents of a TOML or JSON signature
+// file for the whole process and exits when the file is invalid. An empty path
+// keeps the built-in set. Library callers use ReadSignatures instead.
+func LoadSignatureDatabase(signaturesPath string) {
+	if signaturesPath == "" {
+		return
+	}
+
+	signatures, err := readSignatureDatabase(signaturesPath)
+	if err != nil {
+		fmt.Printf("[ERROR] Invalid signature database %s: %s\n", signaturesPath, err.Error())
+		os.Exit(1)
+	}
+
+	signatures.activate()
+	fmt.Printf("[INFO] Loaded %d BattlEye signature(s) from %s\n", len(signatures.patches), activeSignatureDatabase.describe())
+}
+
+func readSignatureDatabase(signaturesPath string) (loadedSignatures, error) {
+	signatureConfig := viper.New()
+	signatureConfig.SetConfigFile(signaturesPath)
+	// signatures.toml.dist can be used as-is, so the format comes from the
+	// extension in front of .dist.
+	signatureConfig.SetConfigType(strings.TrimPrefix(filepath.Ext(strings.TrimSuffix(signaturesPath, ".dist")), "."))
+	if err := signatureConfig.ReadInConfig(); err != nil {
+		return loadedSignatures{}, err
+	}
+
+	var file signatureFile
+	if err := signatureConfig.Unmarshal(&file, func(config *mapstructure.DecoderConfig) {
+		config.ErrorUnused = true
+	}); err != nil {
+		return loadedSignatures{}, err
+	}
+
+	signatures, err := file.validate()
+	if err != nil {
+		return loadedSignatures{}, err
+	}
+	signatures.database.source = signaturesPath
+	if len(signatures.indicators) == 0 {
+		signatures.indicators = clientCheckIndicators
+	}
+	if len(signatures.codePatterns) == 0 {
+		signatures.codePatterns = clientCheckCodePatterns
+	}
+	return signatures, nil
+}
+
+// activeSignatures returns the process-wide signature set: the built-in one,
+// or the one the CLI activated with LoadSignatureDatabase.
+func activeSignatures() loadedSignatures {
+	return loadedSignatures{
+		database:     activeSignatureDatabase,
+		patches:      battleyePatches,
+		indicators:   clientCheckIndicators,
+		codePatterns: clientCheckCodePatterns,
+	}
+}
+
+func (signatures loadedSignatures) activate() {
+	activeSignatureDatabase = signatures.database
+	battleyePatches = signatures.patches
+	clientCheckIndicators = signatures.indicators
+	clientCheckCodePatterns = signatures.codePatterns
+}
+
+func (database signatureDatabase) describe() string {
+	if database.version == builtinSignatureVersion {
+		return database.source
+	}
+	return fmt.Sprintf("%s version %s (schema %d)", database.source, database.version, database.schema)
+}
+
+// validate checks the signature file against the schema and converts it. The
+// first violation is returned with the index and name of the offending entry.
+func (file signatureFile) validate() (loadedSignatures, error) {
+	signatures := loadedSignatures{
+		database: signatureDatabase{version: strings.TrimSpace(file.Version), schema: file.Schema},
+	}
+
+	if file.Schema != signatureDatabaseSchema {
+		return signatures, fmt.Errorf("unsupported schema %d, expected %d", file.Schema, signatureDatabaseSchema)
+	}
+	if signatures.database.version == "" || signatures.database.version == builtinSignatureVersion {
+		return signatures, fmt.Errorf("version must be set to a release identifier other than %q", builtinSignatureVersion)
+	}
+	if len(file.Signatures) == 0 {
+		return signatures, fmt.Errorf("at least one [[signature]] entry is required")
+	}
+
+	names := make(map[string]struct{}, len(file.Signatures))
+	guardKinds := make(map[structuralPatchKind]int)
+	for index, entry := range file.Signatures {
+		patch, err := entry.battleyePatch()
+		if err != nil {
+			return signatures, fmt.Errorf("signature[%d] %q: %w", index, entry.Name, err)
+		}
+		if _, ok := names[patch.name]; ok {
+			return signatures, fmt.Errorf("signature[%d] %q: duplicate signature name", index, entry.Name)
+		}
+		names[patch.name] = struct{}{}
+		if patch.structuralGuard != nil {
+			guardKinds[patch.structuralGuard.kind]++
+		}
+		signatures.patches = append(signatures.patches, patch)
+	}
+	if len(guardKinds) > 0 {
+		for kind := range structuralGuardPatternLengths {
+			if guardKinds[kind] != 1 {
+				return signatures, fmt.Errorf("structural guard %q must be declared exactly once when structural signatures are used, found %d", kind, guardKinds[kind])
+			}
+		}
+	}
+
+	for index, indicator := range file.Indicators {
+		if indicator.Name == "" || indicator.Value == "" {
+			return signatures, fmt.Errorf("indicator[%d] %q: name and value are required", index, indicator.Name)
+		}
+		signatures.indicators = append(signatures.indicators, clientCheckIndicator{name: indicator.Name, value: []byte(indicator.Value)})
+	}
+
+	for index, pattern := range file.CodePatterns {
+		values, err := parseSignatureAOB(pattern.AOB)
+		if pattern.Name == "" || err != nil || len(values) == 0 {
+			return signatures, fmt.Errorf("codePattern[%d] %q: a name and a non-empty aob are required: %v", index, pattern.Name, err)
+		}
+		signatures.codePatterns = append(signatures.codePatterns, newBytePattern(pattern.Name, values...))
+	}
+
+	return signatures, nil
+}
+
+func (entry signatureFileEntry) battleyePatch() (battleyePatch, error) {
+	if strings.TrimSpace(entry.Name) == "" {
+		return battleyePatch{}, fmt.Errorf("name is required")
+	}
+	original, err := parseSignatureAOB(entry.Original)
+	if err != nil || len(original) == 0 {
+		return battleyePatch{}, fmt.Errorf("original must be a non-empty AOB: %v", err)
+	}
+
+	patch := battleyePatch{
+		name:                entry.Name,
+		original:            newBytePattern(entry.Name+" original", original...),
+		diagnosticOnly:      entry.DiagnosticOnly,
+		highRiskClientCheck: entry.HighRiskClientCheck,
+		legacyEvidenceOnly:  entry.LegacyEvidenceOnly,
+		falsePositiveCheck:  entry.FalsePositiveCheck,
+	}
+
+	for _, field := range []struct {
+		name   string
+		text   string
+		target *[]int
+	}{
+		{name: "replacement", text: entry.Replacement, target: &patch.replacement},
+		{name: "aggressiveReplacement", text: entry.AggressiveReplacement, target: &patch.aggressiveReplacement},
+	} {
+		values, err := parseSignatureAOB(field.text)
+		if err != nil {
+			return battleyePatch{}, fmt.Errorf("%s: %w", field.name, err)
+		}
+		if len(values) > 0 && len(values) != len(original) {
+			return battleyePatch{}, fmt.Errorf("%s length %d differs from original length %d", field.name, len(values), len(original))
+		}
+		*field.target = values
+	}
+
+	patched, err := parseSignatureAOB(entry.Patched)
+	if err != nil {
+		return battleyePatch{}, fmt.Errorf("patched: %w", err)
+	}
+	if len(patched) == 0 {
+		patched = patch.replacement
+	}
+	if len(patched) > 0 {
+		if len(patched) != len(original) {
+			return battleyePatch{}, fmt.Errorf("patched length %d differs from original length %d", len(patched), len(original))
+		}
+		patch.patched = newBytePattern(entry.Name+" patched", patched...)
+	}
+
+	if !patch.diagnosticOnly && len(patch.replacement) == 0 {
+		return battleyePatch{}, fmt.Errorf("patchable signatures require a replacement; mark the entry diagnosticOnly otherwise")
+	}
+	if patch.legacyEvidenceOnly && !patch.diagnosticOnly {
+		return battleyePatch{}, fmt.Errorf("legacyEvidenceOnly signatures must also be diagnosticOnly")
+	}
+
+	if entry.StructuralGuard != "" {
+		kind := structuralPatchKind(entry.StructuralGuard)
+		length, ok := structuralGuardPatternLengths[kind]
+		if !ok {
+			return battleyePatch{}, fmt.Errorf("unknown structuralGuard %q, expected %q or %q", entry.StructuralGuard, structuralClientCheckDisconnected, structuralEnableClientCheck)
+		}
+		if len(original) != length {
+			return battleyePatch{}, fmt.Errorf("structuralGuard %q requires a %d byte original, got %d", kind, length, len(original))
+		}
+		if patch.diagnosticOnly {
+			return battleyePatch{}, fmt.Errorf("structurally guarded signatures cannot be diagnosticOnly")
+		}
+		patch.structuralGuard = &structuralPatchGuard{group: structuralClientCheckGroup, kind: kind}
+	}
+
+	for index, expected := range entry.ExpectedOffsets {
+		if expected.SHA256 != "" {
+			if decoded, err := hex.DecodeString(expected.SHA256); err != nil || len(decoded) != 32 {
+				return battleyePatch{}, fmt.Errorf("expectedOffsets[%d]: sha256 must be 64 hex characters", index)
+			}
+		}
+		if _, err := path.Match(expected.Version, ""); err != nil {
+			return battleyePatch{}, fmt.Errorf("expectedOffsets[%d]: invalid version pattern %q", index, expected.Version)
+		}
+		if expected.Offset < 0 {
+			return battleyePatch{}, fmt.Errorf("expectedOffsets[%d]: offset must not be negative", index)
+		}
+		patch.expectedOffsets = append(patch.expectedOffsets, knownPatchOffset{
+			sha256:  strings.ToLower(expected.SHA256),
+			version: strings.TrimSpace(expected.Version),
+			offset:  expected.Offset,
+			note:    expected.Note,
+		})
+	}
+
+	return patch, nil
+}
+
+// parseSignatureAOB parses space separated hex bytes where "??" or "?" is a
+// wildcard. An empty string yields an empty pattern.
+func parseSignatureAOB(text string) ([]int, error) {
+	fields := strings.Fields(text)
+	values := make([]int, 0, len(fields))
+	for _, field := range fields {
+		if field == signatureAOBWildcard || field == signatureShortAOBWildcard {
+			values = append(values, wildcardByte)
+			continue
+		}
+		if len(field) != 2 {
+			return nil, fmt.Errorf("invalid AOB byte %q", field)
+		}
+		value, err := strconv.ParseUint(field, 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AOB byte %q", field)
+		}
+		values = append(values, int(value))
+	}
+	return values, nil
+}
@@ -0,0 +1,217 @@
+package edit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSignatureDistMatchesBuiltinSignatures(t *testing.T) {
+	signatures, err := readSignatureDatabase(filepath.Join("..", "signatures.toml.dist"))
+	if err != nil {
+		t.Fatalf("unable to load signatures.toml.dist: %s", err)
+	}
+
+	if len(signatures.patches) != len(battleyePatches) {
+		t.Fatalf("expected %d signatures, got %d", len(battleyePatches), len(signatures.patches))
+	}
+	for index, builtin := range battleyePatches {
+		loaded := signatures.patches[index]
+		if loaded.name != builtin.name ||
+			loaded.original.formatAOB() != builtin.original.formatAOB() ||
+			loaded.effectivePatchedPattern().formatAOB() != builtin.effectivePatchedPattern().formatAOB() ||
+			newBytePattern("", loaded.replacement...).formatAOB() != newBytePattern("", builtin.replacement...).formatAOB() ||
+			newBytePattern("", loaded.aggressiveReplacement...).formatAOB() != newBytePattern("", builtin.aggressiveReplacement...).formatAOB() ||
+			loaded.diagnosticOnly != builtin.diagnosticOnly ||
+			loaded.highRiskClientCheck != builtin.highRiskClientCheck ||
+			loaded.legacyEvidenceOnly != builtin.legacyEvidenceOnly ||
+			loaded.falsePositiveCheck != builtin.falsePositiveCheck ||
+			(loaded.structuralGuard == nil) != (builtin.structuralGuard == nil) ||
+			len(loaded.expectedOffsets) != len(builtin.expectedOffsets) {
+			t.Fatalf("signature %d differs from the built-in set:\nloaded  %+v\nbuiltin %+v", index, loaded, builtin)
+		}
+		if builtin.structuralGuard != nil && *loaded.structuralGuard != *builtin.structuralGuard {
+			t.Fatalf("signature %q has guard %+v, expected %+v", builtin.name, loaded.structuralGuard, builtin.structuralGuard)
+		}
+		for offsetIndex, expected := range builtin.expectedOffsets {
+			if loaded.expectedOffsets[offsetIndex] != expected {
+				t.Fatalf("signature %q expected offset %d is %+v, expected %+v", builtin.name, offsetIndex, loaded.expectedOffsets[offsetIndex], expected)
+			}
+		}
+	}
+	if len(signatures.indicators) != len(clientCheckIndicators) || len(signatures.codePatterns) != len(clientCheckCodePatterns) {
+		t.Fatalf("expected %d indicators and %d code patterns, got %d and %d", len(clientCheckIndicators), len(clientCheckCodePatterns), len(signatures.indicators), len(signatures.codePatterns))
+	}
+}
+
+func TestReadSignatureDatabaseAcceptsJSON(t *testing.T) {
+	signaturesPath := writeSignatureFile(t, "signatures.json", `{
+		"schema": 1,
+		"version": "2026.10.1",
+		"signature": [{
+			"name": "json launch check",
+			"original": "8D 4D B4 75 0E E8 B4 53",
+			"replacement": "8D 4D B4 EB 0E E8 B4 53",
+			"expectedOffsets": [{"sha256": "", "offset": 4096, "note": "any build"}]
+		}]
+	}`)
+
+	signatures, err := readSignatureDatabase(signaturesPath)
+	if err != nil {
+		t.Fatalf("unable to load JSON signatures: %s", err)
+	}
+	if signatures.database.version != "2026.10.1" || len(signatures.patches) != 1 || signatures.patches[0].expectedOffsets[0].offset != 0x1000 {
+		t.Fatalf("unexpected JSON signature database %+v", signatures)
+	}
+	if signatures.patches[0].patched.formatAOB() != "8D 4D B4 EB 0E E8 B4 53" {
+		t.Fatalf("expected patched pattern to default to the replacement, got %s", signatures.patches[0].patched.formatAOB())
+	}
+}
+
+func TestReadSignatureDatabaseRejectsSchemaViolations(t *testing.T) {
+	tests := map[string]struct {
+		body string
+		err  string
+	}{
+		"unknown key": {
+			body: "schema = 1\nversion = \"1\"\n[[signature]]\nname = \"a\"\noriginal = \"75\"\nreplacment = \"EB\"\n",
+			err:  "replacment",
+		},
+		"schema": {
+			body: "schema = 2\nversion = \"1\"\n",
+			err:  "unsupported schema 2",
+		},
+		"version": {
+			body: "schema = 1\n[[signature]]\nname = \"a\"\noriginal = \"75\"\nreplacement = \"EB\"\n",
+			err:  "version must be set",
+		},
+		"replacement length": {
+			body: "schema = 1\nversion = \"1\"\n[[signature]]\nname = \"a\"\noriginal = \"75 0F\"\nreplacement = \"EB\"\n",
+			err:  "replacement length 1 differs from original length 2",
+		},
+		"missing replacement": {
+			body: "schema = 1\nversion = \"1\"\n[[signature]]\nname = \"a\"\noriginal = \"75 0F\"\n",
+			err:  "require a replacement",
+		},
+		"invalid aob": {
+			body: "schema = 1\nversion = \"1\"\n[[signature]]\nname = \"a\"\noriginal = \"75 0G\"\ndiagnosticOnly = true\n",
+			err:  "invalid AOB byte \"0G\"",
+		},
+		"unknown guard": {
+			body: "schema = 1\nversion = \"1\"\n[[signature]]\nname = \"a\"\noriginal = \"75\"\nreplacement = \"EB\"\nstructuralGuard = \"somethingElse\"\n",
+			err:  "unknown structuralGuard",
+		},
+		"guard length": {
+			body: "schema = 1\nversion = \"1\"\n[[signature]]\nname = \"a\"\noriginal = \"75\"\nreplacement = \"EB\"\nstructuralGuard = \"enableClientCheck\"\n",
+			err:  "requires a 44 byte original",
+		},
+		"duplicate": {
+			body: "schema = 1\nversion = \"1\"\n[[signature]]\nname = \"a\"\noriginal = \"75\"\nreplacement = \"EB\"\n[[signature]]\nname = \"a\"\noriginal = \"74\"\nreplacement = \"EB\"\n",
+			err:  "duplicate signature name",
+		},
+		"sha256": {
+			body: "schema = 1\nversion = \"1\"\n[[signature]]\nname = \"a\"\noriginal = \"75\"\nreplacement = \"EB\"\n[[signature.expectedOffsets]]\nsha256 = \"abc\"\noffset = 0x10\n",
+			err:  "sha256 must be 64 hex characters",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := readSignatureDatabase(writeSignatureFile(t, "signatures.toml", test.body))
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestActivatedSignatureDatabaseDrivesPatching(t *testing.T) {
+	restoreBuiltinSignatures(t)
+	signatures, err := readSignatureDatabase(writeSignatureFile(t, "signatures.toml", `schema = 1
+version = "2026.10.1"
+
+[[signature]]
+name = "external branch"
+original = "74 05 E8 ?? ?? ?? ?? 90"
+replacement = "EB 05 E8 ?? ?? ?? ?? 90"
+`))
+	if err != nil {
+		t.Fatalf("unable to load signatures: %s", err)
+	}
+	signatures.activate()
+
+	tibiaBinary := append(newPEBinary(), 0x74, 0x05, 0xe8, 0x11, 0x22, 0x33, 0x44, 0x90)
+	patched, err := removeBattlEye(activeSignatures(), "client.exe", tibiaBinary, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasSuffix(string(patched), string([]byte{0xeb, 0x05, 0xe8, 0x11, 0x22, 0x33, 0x44, 0x90})) {
+		t.Fatal("expected the external signature to be patched with wildcard bytes preserved")
+	}
+	if activeSignatureDatabase.describe() != signatures.database.source+" version 2026.10.1 (schema 1)" {
+		t.Fatalf("unexpected signature database description %q", activeSignatureDatabase.describe())
+	}
+	if len(clientCheckIndicators) == 0 {
+		t.Fatal("expected built-in indicators to stay active when the file declares none")
+	}
+}
+
+func TestPatcherSignaturesOptionLeavesActiveSetUntouched(t *testing.T) {
+	signatures, err := ReadSignatures(writeSignatureFile(t, "signatures.toml", `schema = 1
+version = "2026.10.2"
+
+[[signature]]
+name = "external branch"
+original = "74 05 E8 ?? ?? ?? ?? 90"
+replacement = "EB 05 E8 ?? ?? ?? ?? 90"
+`))
+	if err != nil {
+		t.Fatalf("unable to read signatures: %s", err)
+	}
+	if _, err := ReadSignatures(writeSignatureFile(t, "invalid.toml", "schema = 2\n")); err == nil {
+		t.Fatal("expected an invalid signature file to be returned as an error")
+	}
+
+	workDir := t.TempDir()
+	tibiaRsa := bytes.Repeat([]byte("A"), 32)
+	tibiaKeyPath := filepath.Join(workDir, "tibia.key")
+	otservKeyPath := filepath.Join(workDir, "otserv.key")
+	writeTestFile(t, tibiaKeyPath, tibiaRsa)
+	writeTestFile(t, otservKeyPath, bytes.Repeat([]byte("B"), 32))
+	tibiaBinary := append(newPEBinary(), tibiaRsa...)
+	tibiaBinary = append(tibiaBinary, 0x74, 0x05, 0xe8, 0x11, 0x22, 0x33, 0x44, 0x90)
+	tibiaPath := filepath.Join(workDir, "client.exe")
+	writeTestFile(t, tibiaPath, tibiaBinary)
+
+	patcher, _ := NewPatcher(PatcherOptions{TargetExe: tibiaPath, TibiaRSAKeyPath: tibiaKeyPath, RSAKeyPath: otservKeyPath, Signatures: signatures})
+	if _, err := patcher.Apply(); err != nil {
+		t.Fatalf("expected the edit to succeed: %s", err)
+	}
+	patched, _ := os.ReadFile(tibiaPath)
+	if !bytes.HasSuffix(patched, []byte{0xeb, 0x05, 0xe8, 0x11, 0x22, 0x33, 0x44, 0x90}) {
+		t.Fatal("expected the Patcher signature set to be applied")
+	}
+	if activeSignatureDatabase.version != builtinSignatureVersion || len(battleyePatches) == 1 {
+		t.Fatalf("expected the process-wide signature set to stay built-in, got %s", activeSignatureDatabase.describe())
+	}
+}
+
+func writeSignatureFile(t *testing.T, name string, body string) string {
+	t.Helper()
+	signaturesPath := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(signaturesPath, []byte(body), 0644); err != nil {
+		t.Fatalf("unable to write signature file: %s", err)
+	}
+	return signaturesPath
+}
+
+func restoreBuiltinSignatures(t *testing.T) {
+	t.Helper()
+	database, patches, indicators, codePatterns := activeSignatureDatabase, battleyePatches, clientCheckIndicators, clientCheckCodePatterns
+	t.Cleanup(func() {
+		activeSignatureDatabase, battleyePatches, clientCheckIndicators, clientCheckCodePatterns = database, patches, indicators, codePatterns
+	})
+}
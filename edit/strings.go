@@ -0,0 +1,198 @@
+package edit
+
+import (
+	"bytes"
+	"fmt"
+)
+
+const (
+	stringEncodingPlain   = "plain"
+	stringEncodingUTF16LE = "utf16le"
+	stringEncodingBoth    = "both"
+	stringPaddingSpace    = "space"
+	stringPaddingNUL      = "nul"
+)
+
+// StringReplacement is a literal rewritten by a [[strings]] table of
+// config.toml. The client keeps its size: Replace may not be longer than
+// Find, and the rest of the original length is filled with Padding.
+type StringReplacement struct {
+	Find    string `mapstructure:"find"`
+	Replace string `mapstructure:"replace"`
+	// Encoding is "plain", "utf16le" or "both" (default).
+	Encoding string `mapstructure:"encoding"`
+	// Padding is "space" (default) or "nul". UTF-16LE padding uses the
+	// same character as a 2-byte unit.
+	Padding string `mapstructure:"padding"`
+	// Count, when set, is the number of occurrences that must match across
+	// every selected encoding.
+	Count int `mapstructure:"count"`
+}
+
+// stringEncodingForm is a [[strings]] literal and its padded replacement in
+// one encoding.
+type stringEncodingForm struct {
+	name    string
+	find    []byte
+	replace []byte
+	padding int
+}
+
+// stringSubstitution is one rewritten occurrence of a [[strings]] literal.
+type stringSubstitution struct {
+	find     string
+	replace  string
+	encoding string
+	offset   int
+	section  string
+	padding  int
+}
+
+func (entry StringReplacement) encodingForms() ([]stringEncodingForm, error) {
+	if entry.Find == "" {
+		return nil, fmt.Errorf("find is required")
+	}
+	if entry.Count < 0 {
+		return nil, fmt.Errorf("count must not be negative")
+	}
+	var paddingUnit []byte
+	switch entry.Padding {
+	case "", stringPaddingSpace:
+		paddingUnit = paddingByte
+	case stringPaddingNUL:
+		paddingUnit = []byte{0}
+	default:
+		return nil, fmt.Errorf("unknown padding %q; use %s or %s", entry.Padding, stringPaddingSpace, stringPaddingNUL)
+	}
+	var names []string
+	switch entry.Encoding {
+	case "", stringEncodingBoth:
+		names = []string{stringEncodingPlain, stringEncodingUTF16LE}
+	case stringEncodingPlain, stringEncodingUTF16LE:
+		names = []string{entry.Encoding}
+	default:
+		return nil, fmt.Errorf("unknown encoding %q; use %s, %s or %s", entry.Encoding, stringEncodingPlain, stringEncodingUTF16LE, stringEncodingBoth)
+	}
+
+	forms := make([]stringEncodingForm, 0, len(names))
+	for _, name := range names {
+		form := stringEncodingForm{name: name, find: []byte(entry.Find), replace: []byte(entry.Replace)}
+		unit := paddingUnit
+		if name == stringEncodingUTF16LE {
+			form.find = utf16LEBytes(entry.Find)
+			form.replace = utf16LEBytes(entry.Replace)
+			unit = append(append([]byte(nil), paddingUnit...), 0)
+		}
+		if len(form.replace) > len(form.find) {
+			return nil, fmt.Errorf("replace is %d byte(s) in %s but find is only %d", len(form.replace), name, len(form.find))
+		}
+		form.padding = len(form.find) - len(form.replace)
+		form.replace = append(form.replace, bytes.Repeat(unit, form.padding/len(unit))...)
+		forms = append(forms, form)
+	}
+	return forms, nil
+}
+
+// validateStringReplacements checks every entry before anything is replaced.
+func validateStringReplacements(entries []StringReplacement) ([][]stringEncodingForm, error) {
+	forms := make([][]stringEncodingForm, 0, len(entries))
+	seen := make(map[string]struct{}, len(entries))
+	for index, entry := range entries {
+		entryForms, err := entry.encodingForms()
+		if err != nil {
+			return nil, fmt.Errorf("strings[%d] %q: %w", index, entry.Find, err)
+		}
+		if _, ok := seen[entry.Find]; ok {
+			return nil, fmt.Errorf("strings[%d] %q: duplicate find value", index, entry.Find)
+		}
+		seen[entry.Find] = struct{}{}
+		forms = append(forms, entryForms)
+	}
+	return forms, nil
+}
+
+// applyStringReplacements rewrites every occurrence of every [[strings]]
+// literal, in order, and returns one substitution per occurrence. An entry
+// that matches nothing, or not exactly its Count, fails the edit unless only
+// its replacement is found, in which case it is already applied.
+func applyStringReplacements(tibiaBinary []byte, entries []StringReplacement) ([]byte, []stringSubstitution, error) {
+	substitutions := make([]stringSubstitution, 0)
+	if len(entries) == 0 {
+		return tibiaBinary, substitutions, nil
+	}
+	forms, err := validateStringReplacements(entries)
+	if err != nil {
+		return tibiaBinary, substitutions, err
+	}
+
+	peData := inspectExecutable(tibiaBinary)
+	for index, entry := range entries {
+		found := make([][]int, len(forms[index]))
+		total, replaced := 0, 0
+		for formIndex, form := range forms[index] {
+			found[formIndex] = indexAllBytes(tibiaBinary, form.find)
+			total += len(found[formIndex])
+			replaced += len(indexAllBytes(tibiaBinary, form.replace))
+		}
+		if total == 0 && replaced > 0 && (entry.Count == 0 || replaced == entry.Count) {
+			fmt.Printf("[INFO] String %q already replaced (%d occurrence(s))\n", entry.Find, replaced)
+			continue
+		}
+		if total == 0 {
+			return tibiaBinary, substitutions, fmt.Errorf("string %q was not found in %s", entry.Find, entry.encodingText())
+		}
+		if entry.Count != 0 && total != entry.Count {
+			return tibiaBinary, substitutions, fmt.Errorf("string %q expected %d occurrence(s), found %d", entry.Find, entry.Count, total)
+		}
+
+		for formIndex, form := range forms[index] {
+			for _, offset := range found[formIndex] {
+				copy(tibiaBinary[offset:], form.replace)
+				substitution := stringSubstitution{
+					find:     entry.Find,
+					replace:  entry.Replace,
+					encoding: form.name,
+					offset:   offset,
+					padding:  form.padding,
+				}
+				if section, ok := peData.sectionForOffset(offset); ok {
+					substitution.section = section.name
+				}
+				fmt.Printf("[PATCH] String %q -> %q (%s) @0x%X in %s (+%d padding byte(s))\n", entry.Find, entry.Replace, form.name, offset, substitution.sectionText(), form.padding)
+				substitutions = append(substitutions, substitution)
+			}
+		}
+	}
+	return tibiaBinary, substitutions, nil
+}
+
+func (entry StringReplacement) encodingText() string {
+	if entry.Encoding == "" {
+		return stringEncodingBoth + " encodings"
+	}
+	if entry.Encoding == stringEncodingBoth {
+		return entry.Encoding + " encodings"
+	}
+	return entry.Encoding + " encoding"
+}
+
+func (substitution stringSubstitution) sectionText() string {
+	if substitution.section == "" {
+		return "no section"
+	}
+	return substitution.section
+}
+
+// indexAllBytes returns the non-overlapping offsets of value in data.
+func indexAllBytes(data []byte, value []byte) []int {
+	offsets := make([]int, 0)
+	for start := 0; len(value) > 0 && start <= len(data)-len(value); {
+		index := bytes.Index(data[start:], value)
+		if index < 0 {
+			break
+		}
+		offsets = append(offsets, start+index)
+		start += index + len(value)
+	}
+	return offsets
+}
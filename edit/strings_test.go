@@ -0,0 +1,62 @@
+package edit
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestApplyStringReplacementsRewritesEveryEncodingAndReportsSections(t *testing.T) {
+	tibiaBinary := newRelocationFixture(t)
+	copy(tibiaBinary[0x640:], "Tibia Client\x00")
+	copy(tibiaBinary[0x680:], append(utf16LEBytes("Tibia Client"), 0, 0))
+	copy(tibiaBinary[0x700:], "login.tibia.com\x00")
+	copy(tibiaBinary[0x720:], "login.tibia.com\x00")
+	entries := []StringReplacement{
+		{Find: "Tibia Client", Replace: "My OT"},
+		{Find: "login.tibia.com", Replace: "ot.example", Encoding: stringEncodingPlain, Padding: stringPaddingNUL, Count: 2},
+	}
+
+	patched, substitutions, err := applyStringReplacements(append([]byte(nil), tibiaBinary...), entries)
+	if err != nil {
+		t.Fatalf("expected the replacements to apply: %s", err)
+	}
+	if !bytes.Equal(patched[0x640:0x64d], []byte("My OT       \x00")) {
+		t.Fatalf("expected space padding in the plain string, got %q", patched[0x640:0x64d])
+	}
+	if !bytes.Equal(patched[0x680:0x698], utf16LEBytes("My OT       ")) {
+		t.Fatalf("expected UTF-16LE space padding, got % X", patched[0x680:0x698])
+	}
+	if !bytes.Equal(patched[0x720:0x730], []byte("ot.example\x00\x00\x00\x00\x00\x00")) {
+		t.Fatalf("expected NUL padding, got %q", patched[0x720:0x730])
+	}
+	if len(substitutions) != 4 {
+		t.Fatalf("expected every occurrence to be reported, got %+v", substitutions)
+	}
+	if first := substitutions[1]; first.encoding != stringEncodingUTF16LE || first.offset != 0x680 || first.section != ".rdata" || first.padding != 14 {
+		t.Fatalf("unexpected UTF-16LE substitution %+v", first)
+	}
+
+	again, _, err := applyStringReplacements(append([]byte(nil), patched...), entries[:1])
+	if err != nil || !bytes.Equal(again, patched) {
+		t.Fatalf("expected a second run to find the string already replaced, err=%v", err)
+	}
+}
+
+func TestApplyStringReplacementsRejectsMissingAndOversizedValues(t *testing.T) {
+	tibiaBinary := newRelocationFixture(t)
+	copy(tibiaBinary[0x640:], "Tibia\x00")
+	for _, test := range []struct {
+		entry   StringReplacement
+		message string
+	}{
+		{StringReplacement{Find: "Tibia", Replace: "Longer"}, "replace is 6 byte(s) in plain but find is only 5"},
+		{StringReplacement{Find: "Tibia", Replace: "OT", Count: 2}, "expected 2 occurrence(s), found 1"},
+		{StringReplacement{Find: "Absent", Replace: "OT"}, `string "Absent" was not found in both encodings`},
+		{StringReplacement{Find: "Tibia", Replace: "OT", Padding: "tabs"}, `unknown padding "tabs"`},
+	} {
+		if _, _, err := applyStringReplacements(append([]byte(nil), tibiaBinary...), []StringReplacement{test.entry}); err == nil || !strings.Contains(err.Error(), test.message) {
+			t.Fatalf("expected %q, got %v", test.message, err)
+		}
+	}
+}
@@ -0,0 +1,425 @@
+package edit
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	suggestMinimumScore     = 0.6
+	suggestCandidateCount   = 3
+	suggestStringMaxLength  = 48
+	suggestStringMinLength  = 4
+	DefaultSuggestionOutput = "signatures.suggested.toml"
+)
+
+// SuggestOptions configures signatures suggest. CompareWith is an older
+// client the active signatures still match; TibiaExe is the update they broke.
+type SuggestOptions struct {
+	TibiaExe    string
+	CompareWith string
+	// OutputPath receives the suggested signature database; it defaults to
+	// DefaultSuggestionOutput.
+	OutputPath string
+}
+
+// functionProfile is the structural fingerprint used to pair a function of
+// the baseline with its counterpart in the new build.
+type functionProfile struct {
+	beginRVA int
+	size     int
+	calls    int
+	strings  map[string]struct{}
+	imports  map[string]struct{}
+}
+
+type functionCandidate struct {
+	profile functionProfile
+	score   float64
+}
+
+// signatureSuggestion is a rebuilt signature for one baseline patch site.
+type signatureSuggestion struct {
+	patch          battleyePatch
+	baselineOffset int
+	baselineLabel  string
+	candidate      functionCandidate
+	targetOffset   int
+	original       []int
+	replacement    []int
+	aggressive     []int
+}
+
+func SuggestSignatures(options SuggestOptions) {
+	if options.CompareWith == "" {
+		fmt.Printf("[ERROR] signatures suggest needs --compare-with pointing at a client the current signatures still match\n")
+		os.Exit(1)
+	}
+	outputPath := options.OutputPath
+	if outputPath == "" {
+		outputPath = DefaultSuggestionOutput
+	}
+	_, baselineBinary := readFile(options.CompareWith)
+	_, targetBinary := readFile(options.TibiaExe)
+	baselinePE := inspectExecutable(baselineBinary)
+	targetPE := inspectExecutable(targetBinary)
+	for _, parsed := range []struct {
+		path   string
+		peData peInfo
+	}{{options.CompareWith, baselinePE}, {options.TibiaExe, targetPE}} {
+		if !parsed.peData.valid || len(parsed.peData.runtimeFunctions) == 0 {
+			fmt.Printf("[ERROR] %s has no usable function boundaries: %s\n", parsed.path, parsed.peData.errorText)
+			os.Exit(1)
+		}
+	}
+	if baselinePE.format != targetPE.format {
+		fmt.Printf("[ERROR] Baseline is %s but the target is %s\n", baselinePE.format, targetPE.format)
+		os.Exit(1)
+	}
+
+	fmt.Printf("[INFO] Baseline: %s\n", options.CompareWith)
+	fmt.Printf("[INFO] Target: %s\n", options.TibiaExe)
+	baselineProfiles := functionProfiles(baselineBinary, baselinePE, buildXrefIndex(baselineBinary, baselinePE))
+	targetProfiles := functionProfiles(targetBinary, targetPE, buildXrefIndex(targetBinary, targetPE))
+	fmt.Printf("[INFO] Profiled %d baseline and %d target function(s)\n", len(baselineProfiles), len(targetProfiles))
+
+	baselineStatuses := scanBattlEyePatchStatus(battleyePatches, baselineBinary, sha256Hex(baselineBinary), detectClientVersion(options.CompareWith, baselineBinary).version, baselinePE)
+	targetStatuses := scanBattlEyePatchStatus(battleyePatches, targetBinary, sha256Hex(targetBinary), detectClientVersion(options.TibiaExe, targetBinary).version, targetPE)
+	suggestions := make(map[string]signatureSuggestion)
+	for index, status := range baselineStatuses {
+		patch := status.patch
+		targetStatus := targetStatuses[index]
+		if len(targetStatus.originalOffset) > 0 || len(targetStatus.patchedOffset) > 0 {
+			fmt.Printf("[INFO] Signature %q still matches the target (%d occurrence(s)); kept\n", patch.name, len(targetStatus.originalOffset)+len(targetStatus.patchedOffset))
+			continue
+		}
+		sites := append(append([]int(nil), status.originalOffset...), status.patchedOffset...)
+		if len(sites) == 0 {
+			fmt.Printf("[INFO] Signature %q matches neither client; kept\n", patch.name)
+			continue
+		}
+		if len(sites) > 1 {
+			fmt.Printf("[WARN] Signature %q matches %d baseline sites; only unique sites are rebuilt\n", patch.name, len(sites))
+			continue
+		}
+		suggestion, ok := suggestSignature(baselineBinary, baselinePE, baselineProfiles, targetBinary, targetPE, targetProfiles, patch, sites[0])
+		if ok {
+			suggestions[patch.name] = suggestion
+		}
+	}
+
+	document := formatSuggestedDatabase(options.CompareWith, baselineBinary, options.TibiaExe, targetBinary, suggestions)
+	if err := os.WriteFile(outputPath, []byte(document), 0644); err != nil {
+		fmt.Printf("[ERROR] Unable to write %s: %s\n", outputPath, err)
+		os.Exit(1)
+	}
+	fmt.Printf("[INFO] %d suggested signature(s) written to %s; review every entry before loading it with --signatures\n", len(suggestions), outputPath)
+}
+
+// suggestSignature pairs the baseline function around site with the target
+// functions that look most alike and searches them for the site bytes with
+// relocated displacements wildcarded.
+func suggestSignature(baselineBinary []byte, baselinePE peInfo, baselineProfiles map[int]functionProfile, targetBinary []byte, targetPE peInfo, targetProfiles map[int]functionProfile, patch battleyePatch, site int) (signatureSuggestion, bool) {
+	siteRVA, _ := baselinePE.rvaForOffset(site)
+	function, ok := baselinePE.runtimeFunctionContainingRVA(siteRVA)
+	if !ok {
+		fmt.Printf("[WARN] Signature %q: baseline site @0x%X is outside every known function\n", patch.name, site)
+		return signatureSuggestion{}, false
+	}
+	profile := baselineProfiles[function.beginRVA]
+	suggestion := signatureSuggestion{patch: patch, baselineOffset: site, baselineLabel: baselinePE.functionLabel(siteRVA)}
+	fmt.Printf("[WARN] Signature %q: baseline site @0x%X in %s (%d bytes, %d call(s), %d string(s), %d import(s))\n",
+		patch.name, site, suggestion.baselineLabel, profile.size, profile.calls, len(profile.strings), len(profile.imports))
+
+	suggestion.original = relocatablePattern(baselineBinary, baselinePE, function, site, patch.original)
+	suggestion.replacement = relocatableReplacement(baselineBinary, site, suggestion.original, patch.replacement)
+	suggestion.aggressive = relocatableReplacement(baselineBinary, site, suggestion.original, patch.aggressiveReplacement)
+	pattern := newBytePattern(patch.name+" suggested", suggestion.original...)
+
+	candidates := rankFunctionCandidates(profile, targetProfiles)
+	if len(candidates) == 0 {
+		fmt.Printf("[WARN]   no target function scores at least %.2f\n", suggestMinimumScore)
+		return suggestion, false
+	}
+	for _, candidate := range candidates {
+		start, startOK := targetPE.offsetForRVA(candidate.profile.beginRVA)
+		end := start + candidate.profile.size
+		if !startOK || end > len(targetBinary) {
+			continue
+		}
+		matches := pattern.findAll(targetBinary[start:end])
+		fmt.Printf("[INFO]   candidate %s score %.2f (%d bytes, %d call(s), %d string(s)): %d site match(es)\n",
+			targetPE.functionLabel(candidate.profile.beginRVA), candidate.score, candidate.profile.size, candidate.profile.calls, len(candidate.profile.strings), len(matches))
+		if len(matches) == 1 {
+			suggestion.candidate = candidate
+			suggestion.targetOffset = start + matches[0]
+			fmt.Printf("[PLAN]   suggest %s @0x%X: %s\n", patch.name, suggestion.targetOffset, pattern.formatAOB())
+			return suggestion, true
+		}
+	}
+	fmt.Printf("[WARN]   no candidate holds a unique copy of %s; rebuild this signature by hand\n", pattern.formatAOB())
+	return suggestion, false
+}
+
+// functionProfiles fingerprints every runtime function from the edges of the
+// xref index.
+func functionProfiles(tibiaBinary []byte, peData peInfo, index xrefIndex) map[int]functionProfile {
+	profiles := make(map[int]functionProfile, len(peData.runtimeFunctions))
+	for _, function := range peData.runtimeFunctions {
+		profiles[function.beginRVA] = functionProfile{
+			beginRVA: function.beginRVA,
+			size:     function.endRVA - function.beginRVA,
+			strings:  make(map[string]struct{}),
+			imports:  make(map[string]struct{}),
+		}
+	}
+	for _, edge := range index.edges {
+		function, ok := peData.runtimeFunctionContainingRVA(edge.rva)
+		if !ok {
+			continue
+		}
+		profile := profiles[function.beginRVA]
+		switch edge.kind {
+		case xrefCall:
+			profile.calls++
+		case xrefImportCall, xrefImportJump:
+			profile.calls++
+			profile.imports[peData.importSlots[edge.target]] = struct{}{}
+		case xrefAddress, xrefData:
+			if offset, ok := peData.offsetForRVA(edge.target); ok {
+				if value, ok := referencedStringAt(tibiaBinary, peData, offset); ok {
+					profile.strings[value] = struct{}{}
+				}
+			}
+		}
+		profiles[function.beginRVA] = profile
+	}
+	return profiles
+}
+
+// referencedStringAt reads an ASCII or UTF-16LE string literal at offset.
+func referencedStringAt(tibiaBinary []byte, peData peInfo, offset int) (string, bool) {
+	if value, ok := cStringAt(tibiaBinary, peData, offset); ok {
+		return value, true
+	}
+	section, ok := peData.sectionForOffset(offset)
+	if !ok || section.isCode {
+		return "", false
+	}
+	var builder strings.Builder
+	for position := offset; position+1 < section.rawEnd && builder.Len() < suggestStringMaxLength; position += 2 {
+		low, high := tibiaBinary[position], tibiaBinary[position+1]
+		switch {
+		case low == 0 && high == 0:
+			return builder.String(), builder.Len() >= suggestStringMinLength
+		case high != 0 || low < 0x20 || low > 0x7e:
+			return "", false
+		}
+		builder.WriteByte(low)
+	}
+	return builder.String(), builder.Len() >= suggestStringMinLength
+}
+
+// similarity scores two functions between 0 and 1 from their shared strings
+// and imports, call count and size. Empty string or import sets on both sides
+// carry no weight.
+func (profile functionProfile) similarity(other functionProfile) float64 {
+	score, weight := 0.0, 0.0
+	if len(profile.strings) > 0 || len(other.strings) > 0 {
+		score += 0.45 * jaccard(profile.strings, other.strings)
+		weight += 0.45
+	}
+	if len(profile.imports) > 0 || len(other.imports) > 0 {
+		score += 0.15 * jaccard(profile.imports, other.imports)
+		weight += 0.15
+	}
+	score += 0.2*closeness(profile.calls, other.calls) + 0.2*closeness(profile.size, other.size)
+	weight += 0.4
+	return score / weight
+}
+
+func jaccard(left map[string]struct{}, right map[string]struct{}) float64 {
+	shared := 0
+	for value := range left {
+		if _, ok := right[value]; ok {
+			shared++
+		}
+	}
+	union := len(left) + len(right) - shared
+	if union == 0 {
+		return 1
+	}
+	return float64(shared) / float64(union)
+}
+
+func closeness(left int, right int) float64 {
+	largest := left
+	if right > largest {
+		largest = right
+	}
+	if largest == 0 {
+		return 1
+	}
+	return 1 - float64(absDistance(left, right))/float64(largest)
+}
+
+// rankFunctionCandidates returns the best scoring target functions, highest
+// first, that reach suggestMinimumScore.
+func rankFunctionCandidates(profile functionProfile, targetProfiles map[int]functionProfile) []functionCandidate {
+	candidates := make([]functionCandidate, 0)
+	for _, target := range targetProfiles {
+		if score := profile.similarity(target); score >= suggestMinimumScore {
+			candidates = append(candidates, functionCandidate{profile: target, score: score})
+		}
+	}
+	sort.Slice(candidates, func(left, right int) bool {
+		if candidates[left].score != candidates[right].score {
+			return candidates[left].score > candidates[right].score
+		}
+		return candidates[left].profile.beginRVA < candidates[right].profile.beginRVA
+	})
+	if len(candidates) > suggestCandidateCount {
+		candidates = candidates[:suggestCandidateCount]
+	}
+	return candidates
+}
+
+// relocatablePattern rebuilds the signature at site with every rel32 branch
+// target and RIP-relative displacement it covers wildcarded, since those
+// change whenever code or data moves. Existing wildcards are kept. The
+// concrete bytes come from the signature so an already patched baseline
+// still yields the original form.
+func relocatablePattern(tibiaBinary []byte, peData peInfo, function peRuntimeFunction, site int, original bytePattern) []int {
+	values := make([]int, len(original.data))
+	for index := range values {
+		values[index] = wildcardByte
+		if original.mask[index] {
+			values[index] = int(original.data[index])
+		}
+	}
+	start, _ := peData.offsetForRVA(function.beginRVA)
+	end := start + function.endRVA - function.beginRVA
+	for _, instruction := range disassembleX86(tibiaBinary, start, end) {
+		if instruction.offset >= site+len(values) {
+			break
+		}
+		fields := make([][2]int, 0, 2)
+		if instruction.ripRelative() {
+			fields = append(fields, [2]int{instruction.displacementOffset, instruction.displacementSize})
+		}
+		if instruction.relativeBranch && instruction.immediateSize == 4 {
+			fields = append(fields, [2]int{instruction.immediateOffset, instruction.immediateSize})
+		}
+		for _, field := range fields {
+			for position := instruction.offset + field[0]; position < instruction.offset+field[0]+field[1]; position++ {
+				if position >= site && position < site+len(values) {
+					values[position-site] = wildcardByte
+				}
+			}
+		}
+	}
+	return values
+}
+
+// relocatableReplacement keeps the bytes a replacement rewrites and turns the
+// ones it copied from a now wildcarded position into wildcards as well.
+func relocatableReplacement(tibiaBinary []byte, site int, original []int, replacement []int) []int {
+	if len(replacement) == 0 {
+		return nil
+	}
+	values := append([]int(nil), replacement...)
+	for index, value := range values {
+		if original[index] == wildcardByte && value == int(tibiaBinary[site+index]) {
+			values[index] = wildcardByte
+		}
+	}
+	return values
+}
+
+// formatSuggestedDatabase writes the active signature set as a signature
+// database with the suggestions in place of the entries they rebuild.
+func formatSuggestedDatabase(baselinePath string, baselineBinary []byte, targetPath string, targetBinary []byte, suggestions map[string]signatureSuggestion) string {
+	targetSHA256 := sha256Hex(targetBinary)
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "# Suggested by signatures suggest from %s (%s)\n", baselinePath, sha256Hex(baselineBinary))
+	fmt.Fprintf(&builder, "# for %s (%s).\n", targetPath, targetSHA256)
+	fmt.Fprintf(&builder, "# Entries marked SUGGESTED were rebuilt automatically; review each one before use.\n")
+	fmt.Fprintf(&builder, "schema = %d\n", signatureDatabaseSchema)
+	fmt.Fprintf(&builder, "version = %q\n", "suggested-"+targetSHA256[:12])
+
+	for _, patch := range battleyePatches {
+		builder.WriteString("\n")
+		original := patternValues(patch.original)
+		replacement, aggressive := patch.replacement, patch.aggressiveReplacement
+		expectedOffsets := patch.expectedOffsets
+		if suggestion, ok := suggestions[patch.name]; ok {
+			fmt.Fprintf(&builder, "# SUGGESTED: baseline site @0x%X in %s matched sub_%X (score %.2f)\n",
+				suggestion.baselineOffset, suggestion.baselineLabel, suggestion.candidate.profile.beginRVA, suggestion.candidate.score)
+			original, replacement, aggressive = suggestion.original, suggestion.replacement, suggestion.aggressive
+			expectedOffsets = append(append([]knownPatchOffset(nil), expectedOffsets...), knownPatchOffset{
+				sha256: targetSHA256,
+				offset: suggestion.targetOffset,
+				note:   fmt.Sprintf("suggested from baseline site 0x%X; unreviewed", suggestion.baselineOffset),
+			})
+		}
+		fmt.Fprintf(&builder, "[[signature]]\nname = %q\noriginal = %q\n", patch.name, formatSignatureAOB(original))
+		if len(replacement) > 0 {
+			fmt.Fprintf(&builder, "replacement = %q\n", formatSignatureAOB(replacement))
+		}
+		if len(aggressive) > 0 {
+			fmt.Fprintf(&builder, "aggressiveReplacement = %q\n", formatSignatureAOB(aggressive))
+		}
+		for _, flag := range []struct {
+			name string
+			set  bool
+		}{{"diagnosticOnly", patch.diagnosticOnly}, {"highRiskClientCheck", patch.highRiskClientCheck}, {"legacyEvidenceOnly", patch.legacyEvidenceOnly}} {
+			if flag.set {
+				fmt.Fprintf(&builder, "%s = true\n", flag.name)
+			}
+		}
+		if patch.structuralGuard != nil {
+			fmt.Fprintf(&builder, "structuralGuard = %q\n", patch.structuralGuard.kind)
+		}
+		if patch.falsePositiveCheck != "" {
+			fmt.Fprintf(&builder, "falsePositiveCheck = %q\n", patch.falsePositiveCheck)
+		}
+		for _, expected := range expectedOffsets {
+			fmt.Fprintf(&builder, "\n[[signature.expectedOffsets]]\n")
+			if expected.sha256 != "" {
+				fmt.Fprintf(&builder, "sha256 = %q\n", expected.sha256)
+			}
+			if expected.version != "" {
+				fmt.Fprintf(&builder, "version = %q\n", expected.version)
+			}
+			fmt.Fprintf(&builder, "offset = 0x%X\n", expected.offset)
+			if expected.note != "" {
+				fmt.Fprintf(&builder, "note = %q\n", expected.note)
+			}
+		}
+	}
+	return builder.String()
+}
+
+func patternValues(pattern bytePattern) []int {
+	values := make([]int, len(pattern.data))
+	for index, value := range pattern.data {
+		values[index] = wildcardByte
+		if pattern.mask[index] {
+			values[index] = int(value)
+		}
+	}
+	return values
+}
+
+func formatSignatureAOB(values []int) string {
+	parts := make([]string, len(values))
+	for index, value := range values {
+		parts[index] = signatureAOBWildcard
+		if value != wildcardByte {
+			parts[index] = fmt.Sprintf("%02X", value)
+		}
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,99 @@
+package edit
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSuggestSignatureRebuildsMovedPatchSite(t *testing.T) {
+	restoreBuiltinSignatures(t)
+	baselineBinary, baselinePE := newSuggestFixture(t, 0x400, 0x620)
+	targetBinary, targetPE := newSuggestFixture(t, 0x480, 0x680)
+	code := suggestFixtureCode(t, baselineBinary, 0x400)
+	replacement := append([]int(nil), code...)
+	replacement[9] = 0xeb
+	patch := battleyePatch{
+		name:        "moved check",
+		original:    newBytePattern("moved check original", code...),
+		replacement: newPatchReplacement(replacement...),
+	}
+	battleyePatches = []battleyePatch{patch}
+	if len(patch.original.findAll(targetBinary)) != 0 {
+		t.Fatalf("expected the moved function to break the exact signature")
+	}
+
+	baselineProfiles := functionProfiles(baselineBinary, baselinePE, buildXrefIndex(baselineBinary, baselinePE))
+	targetProfiles := functionProfiles(targetBinary, targetPE, buildXrefIndex(targetBinary, targetPE))
+	if profile := baselineProfiles[0x1000]; profile.calls != 1 || len(profile.strings) != 1 {
+		t.Fatalf("expected the patched function to have one call and one string, got %+v", profile)
+	}
+	suggestion, ok := suggestSignature(baselineBinary, baselinePE, baselineProfiles, targetBinary, targetPE, targetProfiles, patch, 0x400)
+	if !ok || suggestion.targetOffset != 0x480 || suggestion.candidate.profile.beginRVA != 0x1080 {
+		t.Fatalf("expected the site to be found at 0x480 in sub_1080, got %+v ok=%t", suggestion, ok)
+	}
+	if original := formatSignatureAOB(suggestion.original); original != "48 8D 15 ?? ?? ?? ?? 84 C0 75 05 E8 ?? ?? ?? ?? C3" {
+		t.Fatalf("expected displacements to be wildcarded, got %s", original)
+	}
+	if replacement := formatSignatureAOB(suggestion.replacement); replacement != "48 8D 15 ?? ?? ?? ?? 84 C0 EB 05 E8 ?? ?? ?? ?? C3" {
+		t.Fatalf("expected the branch rewrite to survive, got %s", replacement)
+	}
+
+	document := formatSuggestedDatabase("old.exe", baselineBinary, "new.exe", targetBinary, map[string]signatureSuggestion{patch.name: suggestion})
+	if !strings.Contains(document, "# SUGGESTED: baseline site @0x400") {
+		t.Fatalf("expected the suggestion to be marked for review:\n%s", document)
+	}
+	signatures, err := readSignatureDatabase(writeSignatureFile(t, "suggested.toml", document))
+	if err != nil {
+		t.Fatalf("expected the suggested database to load: %s\n%s", err, document)
+	}
+	if offsets := signatures.patches[0].original.findAll(targetBinary); len(offsets) != 1 || offsets[0] != 0x480 {
+		t.Fatalf("expected the loaded suggestion to match the target at 0x480, got %v", offsets)
+	}
+	if expected := signatures.patches[0].expectedOffsets; len(expected) != 1 || expected[0].offset != 0x480 || expected[0].sha256 != sha256Hex(targetBinary) {
+		t.Fatalf("expected the target site to be recorded as an expected offset, got %+v", expected)
+	}
+}
+
+// newSuggestFixture places the patched function (load a string, test, branch
+// around a call) at codeOffset, a decoy that calls nothing at the other slot
+// and the callee at 0x500, with the string at stringOffset.
+func newSuggestFixture(t *testing.T, codeOffset int, stringOffset int) ([]byte, peInfo) {
+	t.Helper()
+	tibiaBinary := newRelocationFixture(t)
+	copy(tibiaBinary[0x400:0x600], bytes.Repeat([]byte{0xcc}, 0x200))
+	copy(tibiaBinary[0x600:0x800], make([]byte, 0x200))
+	copy(tibiaBinary[stringOffset:], "clientcheck_disconnected\x00")
+
+	decoyOffset := 0x480
+	if codeOffset == decoyOffset {
+		decoyOffset = 0x400
+	}
+	copy(tibiaBinary[decoyOffset:], []byte{0x31, 0xc0, 0x84, 0xc0, 0x75, 0x02, 0xff, 0xc0, 0xc3})
+	writeXrefInstruction(tibiaBinary, codeOffset, []byte{0x48, 0x8d, 0x15}, 0x2000+stringOffset-0x600)
+	copy(tibiaBinary[codeOffset+7:], []byte{0x84, 0xc0, 0x75, 0x05})
+	writeXrefInstruction(tibiaBinary, codeOffset+11, []byte{0xe8}, 0x1100)
+	tibiaBinary[codeOffset+16] = 0xc3
+	tibiaBinary[0x500] = 0xc3
+
+	peData := inspectExecutable(tibiaBinary)
+	if !peData.valid {
+		t.Fatalf("expected a valid fixture: %s", peData.errorText)
+	}
+	functions := []peRuntimeFunction{
+		{beginRVA: 0x1000 + codeOffset - 0x400, endRVA: 0x1000 + codeOffset - 0x400 + 17},
+		{beginRVA: 0x1000 + decoyOffset - 0x400, endRVA: 0x1000 + decoyOffset - 0x400 + 9},
+		{beginRVA: 0x1100, endRVA: 0x1101},
+	}
+	peData.runtimeFunctions = peData.codeRuntimeFunctions(functions)
+	return tibiaBinary, peData
+}
+
+func suggestFixtureCode(t *testing.T, tibiaBinary []byte, offset int) []int {
+	t.Helper()
+	values := make([]int, 17)
+	for index := range values {
+		values[index] = int(tibiaBinary[offset+index])
+	}
+	return values
+}
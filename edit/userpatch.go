@@ -0,0 +1,209 @@
+package edit
+
+import (
+	"fmt"
+	"strings"
+)
+
+const defaultUserPatchAnchorRadius = 256
+
+// UserPatch is a byte patch declared in a [[patch]] table of config.toml.
+// Original and Replacement are AOB strings where "??" is a wildcard; a
+// wildcard in Replacement keeps the client byte.
+type UserPatch struct {
+	Name        string `mapstructure:"name"`
+	Original    string `mapstructure:"original"`
+	Replacement string `mapstructure:"replacement"`
+	// Count is the number of occurrences that must match; 0 means 1.
+	Count int `mapstructure:"count"`
+	// Section, when set, only counts occurrences inside this section.
+	Section string `mapstructure:"section"`
+	// Anchor, when set, only counts occurrences within AnchorRadius bytes
+	// (default 256) of a RIP-relative reference to this ASCII or UTF-16
+	// string.
+	Anchor       string `mapstructure:"anchor"`
+	AnchorRadius int    `mapstructure:"anchorRadius"`
+}
+
+// userPatchSite is a validated user patch and the offsets it rewrote.
+type userPatchSite struct {
+	entry   UserPatch
+	patch   battleyePatch
+	offsets []int
+}
+
+func (entry UserPatch) battleyePatch() (battleyePatch, error) {
+	if strings.TrimSpace(entry.Name) == "" {
+		return battleyePatch{}, fmt.Errorf("name is required")
+	}
+	original, err := parseSignatureAOB(entry.Original)
+	if err != nil || len(original) == 0 {
+		return battleyePatch{}, fmt.Errorf("original must be a non-empty AOB: %v", err)
+	}
+	replacement, err := parseSignatureAOB(entry.Replacement)
+	if err != nil || len(replacement) != len(original) {
+		return battleyePatch{}, fmt.Errorf("replacement must be an AOB of %d byte(s): %v", len(original), err)
+	}
+	if entry.Count < 0 || entry.AnchorRadius < 0 {
+		return battleyePatch{}, fmt.Errorf("count and anchorRadius must not be negative")
+	}
+	// A wildcard in the replacement keeps the client byte, so the patched
+	// pattern inherits the concrete byte from the original where it has one.
+	patched := append([]int(nil), replacement...)
+	for index, value := range patched {
+		if value == wildcardByte {
+			patched[index] = original[index]
+		}
+	}
+	return battleyePatch{
+		name:        entry.Name,
+		original:    newBytePattern(entry.Name+" original", original...),
+		patched:     newBytePattern(entry.Name+" patched", patched...),
+		replacement: replacement,
+	}, nil
+}
+
+func (entry UserPatch) expectedCount() int {
+	if entry.Count == 0 {
+		return 1
+	}
+	return entry.Count
+}
+
+// validateUserPatches converts every entry up front so a typo in the last
+// table fails before anything is patched.
+func validateUserPatches(entries []UserPatch) ([]battleyePatch, error) {
+	patches := make([]battleyePatch, 0, len(entries))
+	names := make(map[string]struct{}, len(entries))
+	for index, entry := range entries {
+		patch, err := entry.battleyePatch()
+		if err != nil {
+			return nil, fmt.Errorf("patch[%d] %q: %w", index, entry.Name, err)
+		}
+		if _, ok := names[entry.Name]; ok {
+			return nil, fmt.Errorf("patch[%d] %q: duplicate patch name", index, entry.Name)
+		}
+		names[entry.Name] = struct{}{}
+		patches = append(patches, patch)
+	}
+	return patches, nil
+}
+
+// applyUserPatches applies the [[patch]] tables through applyBattleyePatch.
+// Every entry must match exactly its expected count, already patched entries
+// are left alone, and a failed post-patch verification rolls back every user
+// patch before the error is returned.
+func applyUserPatches(tibiaBinary []byte, entries []UserPatch) ([]byte, error) {
+	if len(entries) == 0 {
+		return tibiaBinary, nil
+	}
+	patches, err := validateUserPatches(entries)
+	if err != nil {
+		return tibiaBinary, err
+	}
+
+	fmt.Printf("[INFO] Applying %d user patch(es) from the config\n", len(entries))
+	beforeUserPatches := append([]byte(nil), tibiaBinary...)
+	peData := inspectExecutable(tibiaBinary)
+	sites := make([]userPatchSite, 0, len(entries))
+	for index, entry := range entries {
+		patch := patches[index]
+		originalOffsets := userPatchOffsets(tibiaBinary, peData, entry, patch.original)
+		patchedOffsets := userPatchOffsets(tibiaBinary, peData, entry, patch.patched)
+		if len(originalOffsets) == 0 && len(patchedOffsets) == entry.expectedCount() {
+			fmt.Printf("[INFO] User patch %q already applied (%d occurrence(s))\n", entry.Name, len(patchedOffsets))
+			continue
+		}
+		if len(originalOffsets) != entry.expectedCount() {
+			return beforeUserPatches, fmt.Errorf("user patch %q expected %d occurrence(s)%s, found %s", entry.Name, entry.expectedCount(), entry.scopeText(), formatOffsetsLimited(originalOffsets, 6))
+		}
+		patchedBinary, err := applyBattleyePatch(tibiaBinary, patch, originalOffsets)
+		if err != nil {
+			return beforeUserPatches, err
+		}
+		tibiaBinary = patchedBinary
+		fmt.Printf("[PATCH] User patch %q applied (%d occurrence(s))\n", entry.Name, len(originalOffsets))
+		sites = append(sites, userPatchSite{entry: entry, patch: patch, offsets: originalOffsets})
+	}
+
+	if err := verifyUserPatches(tibiaBinary, sites); err != nil {
+		fmt.Printf("[ERROR] User patch post-verification failed; rolling back all user patch byte changes\n")
+		return beforeUserPatches, err
+	}
+	return tibiaBinary, nil
+}
+
+// verifyUserPatches checks that every rewritten site still holds its
+// replacement, so a later patch overwriting an earlier one is caught, and
+// that no unpatched occurrence is left inside the entry's scope.
+func verifyUserPatches(tibiaBinary []byte, sites []userPatchSite) error {
+	peData := inspectExecutable(tibiaBinary)
+	for _, site := range sites {
+		for _, offset := range site.offsets {
+			if !site.patch.patched.matchesAt(tibiaBinary, offset) {
+				return fmt.Errorf("user patch %q: replacement @0x%X was overwritten", site.entry.Name, offset)
+			}
+		}
+		if remaining := userPatchOffsets(tibiaBinary, peData, site.entry, site.patch.original); len(remaining) != 0 {
+			return fmt.Errorf("user patch %q: original bytes still present%s after patching at %s", site.entry.Name, site.entry.scopeText(), formatOffsetsLimited(remaining, 6))
+		}
+	}
+	return nil
+}
+
+// userPatchOffsets returns the matches of pattern that satisfy the section
+// and anchor constraints of entry.
+func userPatchOffsets(tibiaBinary []byte, peData peInfo, entry UserPatch, pattern bytePattern) []int {
+	offsets := pattern.findAll(tibiaBinary)
+	if entry.Section != "" {
+		inSection := make([]int, 0, len(offsets))
+		for _, offset := range offsets {
+			if section, ok := peData.sectionForOffset(offset); ok && section.name == entry.Section && offset+len(pattern.data) <= section.rawEnd {
+				inSection = append(inSection, offset)
+			}
+		}
+		offsets = inSection
+	}
+	if entry.Anchor == "" {
+		return offsets
+	}
+
+	radius := entry.AnchorRadius
+	if radius == 0 {
+		radius = defaultUserPatchAnchorRadius
+	}
+	references := make([]int, 0)
+	for _, stringOffsets := range stringOccurrences(tibiaBinary, peData, entry.Anchor) {
+		for _, stringOffset := range stringOffsets {
+			if stringRVA, ok := peData.rvaForOffset(stringOffset); ok {
+				for _, reference := range findRIPRelativeReferences(tibiaBinary, peData, stringRVA) {
+					references = append(references, reference.offset)
+				}
+			}
+		}
+	}
+	anchored := make([]int, 0, len(offsets))
+	for _, offset := range offsets {
+		for _, reference := range references {
+			if absDistance(offset, reference) <= radius {
+				anchored = append(anchored, offset)
+				break
+			}
+		}
+	}
+	return anchored
+}
+
+func (entry UserPatch) scopeText() string {
+	scope := make([]string, 0, 2)
+	if entry.Section != "" {
+		scope = append(scope, "in "+entry.Section)
+	}
+	if entry.Anchor != "" {
+		scope = append(scope, fmt.Sprintf("near a reference to %q", entry.Anchor))
+	}
+	if len(scope) == 0 {
+		return ""
+	}
+	return " " + strings.Join(scope, " ")
+}
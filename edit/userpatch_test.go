@@ -0,0 +1,80 @@
+package edit
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestApplyUserPatchesHonoursSectionAndAnchor(t *testing.T) {
+	tibiaBinary, _ := newXrefFixture(t)
+	// A second copy outside .text and one far from the anchor must not count.
+	copy(tibiaBinary[0x7f0:], []byte{0x74, 0x02})
+	copy(tibiaBinary[0x5f0:], []byte{0x74, 0x02})
+	entries := []UserPatch{{
+		Name:         "skip check",
+		Original:     "74 02",
+		Replacement:  "EB ??",
+		Section:      ".text",
+		Anchor:       "clientcheck_disconnected",
+		AnchorRadius: 0x20,
+	}}
+
+	patched, err := applyUserPatches(append([]byte(nil), tibiaBinary...), entries)
+	if err != nil {
+		t.Fatalf("expected the anchored patch to apply: %s", err)
+	}
+	if patched[0x414] != 0xeb || patched[0x415] != 0x02 || patched[0x5f0] != 0x74 || patched[0x7f0] != 0x74 {
+		t.Fatalf("expected only the anchored branch @0x414 to change, got % X", patched[0x410:0x418])
+	}
+
+	again, err := applyUserPatches(append([]byte(nil), patched...), entries)
+	if err != nil || !bytes.Equal(again, patched) {
+		t.Fatalf("expected a second run to find the patch already applied, err=%v", err)
+	}
+}
+
+func TestApplyUserPatchesRequiresExpectedCount(t *testing.T) {
+	tibiaBinary, _ := newXrefFixture(t)
+	entries := []UserPatch{{Name: "two branches", Original: "74 02", Replacement: "EB 02", Count: 2, Section: ".text"}}
+
+	result, err := applyUserPatches(append([]byte(nil), tibiaBinary...), entries)
+	if err == nil || !strings.Contains(err.Error(), "expected 2 occurrence(s) in .text, found 0x414") {
+		t.Fatalf("expected a count mismatch, got %v", err)
+	}
+	if !bytes.Equal(result, tibiaBinary) {
+		t.Fatalf("expected the client to be left unchanged")
+	}
+}
+
+func TestApplyUserPatchesRollsBackWhenAPatchIsOverwritten(t *testing.T) {
+	tibiaBinary, _ := newXrefFixture(t)
+	entries := []UserPatch{
+		{Name: "skip check", Original: "74 02", Replacement: "EB 02", Section: ".text"},
+		{Name: "clobber", Original: "EB 02 EB 00", Replacement: "90 90 EB 00"},
+	}
+
+	result, err := applyUserPatches(append([]byte(nil), tibiaBinary...), entries)
+	if err == nil || !strings.Contains(err.Error(), `"skip check": replacement @0x414 was overwritten`) {
+		t.Fatalf("expected post-verification to catch the overwrite, got %v", err)
+	}
+	if !bytes.Equal(result, tibiaBinary) {
+		t.Fatalf("expected every user patch to be rolled back")
+	}
+}
+
+func TestValidateUserPatchesRejectsMalformedEntries(t *testing.T) {
+	for _, test := range []struct {
+		entries []UserPatch
+		message string
+	}{
+		{[]UserPatch{{Original: "74 02", Replacement: "EB 02"}}, "name is required"},
+		{[]UserPatch{{Name: "short", Original: "74 02", Replacement: "EB"}}, "replacement must be an AOB of 2 byte(s)"},
+		{[]UserPatch{{Name: "bad", Original: "74 0G", Replacement: "EB 02"}}, "original must be a non-empty AOB"},
+		{[]UserPatch{{Name: "twice", Original: "74", Replacement: "EB"}, {Name: "twice", Original: "75", Replacement: "EB"}}, "duplicate patch name"},
+	} {
+		if _, err := validateUserPatches(test.entries); err == nil || !strings.Contains(err.Error(), test.message) {
+			t.Fatalf("expected %q, got %v", test.message, err)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package edit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+)
+
+const (
+	versionSourceResource    = "PE VERSIONINFO"
+	versionSourceBuildString = "embedded build string"
+)
+
+// versionManifestNames are the files beside a client, or one directory up,
+// that may name its version; the first one with a version wins.
+var versionManifestNames = []string{"client.json", "package.json"}
+
+// buildVersionPattern matches the dotted version strings Tibia clients embed,
+// such as "Tibia 14.12.5a8f" or "tibia-15.30.0.f3a1". The version must follow
+// "Tibia" in the same string: toolchain and SDK strings such as 10.0.19041.0
+// have the same shape.
+var buildVersionPattern = regexp.MustCompile(`(?i)\btibia\b[^\x00\n]{0,32}?\b(1[0-9]\.[0-9]{1,2}(?:\.[0-9]+)?\.[0-9a-f]{4,40})\b`)
+
+// clientVersion is the Tibia version of a client and where it was read.
+type clientVersion struct {
+	version string
+	source  string
+}
+
+func (version clientVersion) known() bool {
+	return version.version != ""
+}
+
+// text returns the version, or "unknown" as the backup and history listings
+// print it.
+func (version clientVersion) text() string {
+	if !version.known() {
+		return "unknown"
+	}
+	return version.version
+}
+
+func (version clientVersion) describe() string {
+	if !version.known() {
+		return "unknown"
+	}
+	return fmt.Sprintf("%s (%s)", version.version, version.source)
+}
+
+// detectClientVersion reads the version from the PE version resource, then
+// from a build string in the read-only data of the binary, then from
+// client.json or package.json near tibiaPath. An empty tibiaPath skips the
+// files, for binaries such as backups that do not belong to their directory.
+func detectClientVersion(tibiaPath string, tibiaBinary []byte) clientVersion {
+	if version, ok := resourceFileVersion(tibiaBinary); ok {
+		return clientVersion{version: version, source: versionSourceResource}
+	}
+	if version, ok := embeddedBuildVersion(tibiaBinary); ok {
+		return clientVersion{version: version, source: versionSourceBuildString}
+	}
+	if tibiaPath == "" {
+		return clientVersion{}
+	}
+	directory := filepath.Dir(tibiaPath)
+	for _, candidate := range []string{directory, filepath.Dir(directory)} {
+		for _, name := range versionManifestNames {
+			manifestPath := filepath.Join(candidate, name)
+			if version, ok := readManifestVersion(manifestPath); ok {
+				return clientVersion{version: version, source: manifestPath}
+			}
+		}
+	}
+	return clientVersion{}
+}
+
+// resourceFileVersion returns the FileVersion string of the first RT_VERSION
+// resource. Only PE clients carry one.
+func resourceFileVersion(tibiaBinary []byte) (string, bool) {
+	resources, _, err := readPEResources(tibiaBinary)
+	if err != nil {
+		return "", false
+	}
+	for _, resource := range resources {
+		if !resource.is(resourceTypeVersion) {
+			continue
+		}
+		root, err := parseVersionNode(resource.data, 0)
+		if err != nil {
+			continue
+		}
+		if version, ok := root.versionString("FileVersion"); ok && version != "" {
+			return version, true
+		}
+	}
+	return "", false
+}
+
+// embeddedBuildVersion searches the read-only data sections of an executable
+// for a Tibia build string. Data that is not a recognized executable is
+// searched whole.
+func embeddedBuildVersion(tibiaBinary []byte) (string, bool) {
+	peData := inspectExecutable(tibiaBinary)
+	if !peData.valid {
+		return findBuildVersion(tibiaBinary)
+	}
+	for _, section := range peData.sections {
+		if section.isCode || section.isWritable || section.rawStart >= section.rawEnd || section.rawEnd > len(tibiaBinary) {
+			continue
+		}
+		if version, ok := findBuildVersion(tibiaBinary[section.rawStart:section.rawEnd]); ok {
+			return version, true
+		}
+	}
+	return "", false
+}
+
+func findBuildVersion(data []byte) (string, bool) {
+	match := buildVersionPattern.FindSubmatch(data)
+	if match == nil {
+		return "", false
+	}
+	return string(match[1]), true
+}
+
+func readManifestVersion(manifestPath string) (string, bool) {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return "", false
+	}
+	var manifest struct {
+		Version       string `json:"version"`
+		ClientVersion string `json:"clientVersion"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return "", false
+	}
+	if manifest.ClientVersion != "" {
+		return manifest.ClientVersion, true
+	}
+	return manifest.Version, manifest.Version != ""
+}
+
+// matchesVersion reports whether a client version satisfies a version
+// pattern from the signature database; "*" and "?" match as in path.Match.
+func matchesVersion(pattern string, version string) bool {
+	if version == "" {
+		return false
+	}
+	matched, err := path.Match(pattern, version)
+	return err == nil && matched
+}
@@ -0,0 +1,86 @@
+package edit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectClientVersionPrefersBinarySources(t *testing.T) {
+	workDir := t.TempDir()
+	binDir := filepath.Join(workDir, "bin")
+	tibiaPath := filepath.Join(binDir, "client.exe")
+	if err := os.Mkdir(binDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(workDir, "package.json"), []byte(`{"name": "tibia", "version": "14.12.1111"}`))
+
+	resource := append(newResourceFixture(t), "Tibia build 14.12.5a8f\x00"...)
+	if version := detectClientVersion(tibiaPath, resource); version.version != "15.30.0.f3a1" || version.source != versionSourceResource {
+		t.Fatalf("expected the version resource to win, got %+v", version)
+	}
+	if version := detectClientVersion(tibiaPath, []byte("Qt\x00Tibia build 14.12.5a8f\x00")); version.version != "14.12.5a8f" || version.source != versionSourceBuildString {
+		t.Fatalf("expected the embedded build string, got %+v", version)
+	}
+	if version := detectClientVersion(tibiaPath, []byte("no version")); version.version != "14.12.1111" || version.source != filepath.Join(workDir, "package.json") {
+		t.Fatalf("expected package.json one directory up, got %+v", version)
+	}
+	writeTestFile(t, filepath.Join(binDir, "client.json"), []byte(`{"clientVersion": "14.12.2222"}`))
+	if version := detectClientVersion(tibiaPath, []byte("no version")); version.version != "14.12.2222" {
+		t.Fatalf("expected client.json beside the client to win over package.json, got %+v", version)
+	}
+	if version := detectClientVersion("", []byte("no version")); version.known() || version.text() != "unknown" {
+		t.Fatalf("expected no version without a path, got %+v", version)
+	}
+}
+
+func TestDetectClientVersionIgnoresUnrelatedVersionStrings(t *testing.T) {
+	tibiaBinary := newRelocationFixture(t)
+	copy(tibiaBinary[0x480:], "Tibia 14.12.5a8f\x00")
+	copy(tibiaBinary[0x780:], "10.0.19041.0\x00")
+	copy(tibiaBinary[0x7a0:], utf16LEBytes("FileVersion\x0015.30.0.f3a1\x00"))
+	if version := detectClientVersion("", tibiaBinary); version.known() {
+		t.Fatalf("expected no version from an SDK string, a loose FileVersion or code bytes, got %+v", version)
+	}
+
+	copy(tibiaBinary[0x7d0:], "Tibia 14.12.5a8f\x00")
+	if version := detectClientVersion("", tibiaBinary); version.version != "14.12.5a8f" || version.source != versionSourceBuildString {
+		t.Fatalf("expected the build string from .rdata, got %+v", version)
+	}
+	if version := detectClientVersion("", []byte("Windows SDK 10.0.19041.0\x00")); version.known() {
+		t.Fatalf("expected the SDK version to be ignored, got %+v", version)
+	}
+	elfBinary := newELFBinary(t, newELFTestText(), utf16LEBytes("FileVersion\x0015.30.0.f3a1\x00"))
+	if version := detectClientVersion("", elfBinary); version.known() {
+		t.Fatalf("expected no version resource in an ELF client, got %+v", version)
+	}
+}
+
+func TestKnownPatchOffsetAppliesToVersionPattern(t *testing.T) {
+	entry := signatureFileEntry{
+		Name:            "version scoped",
+		Original:        "74 02",
+		Replacement:     "EB 02",
+		ExpectedOffsets: []signatureFileKnownPatch{{Version: "14.12.*", Offset: 0x10}},
+	}
+	patch, err := entry.battleyePatch()
+	if err != nil {
+		t.Fatalf("expected a version-scoped expected offset to load: %s", err)
+	}
+	data := make([]byte, 0x20)
+	copy(data[0x10:], []byte{0x74, 0x02})
+	if hits := patch.expectedOffsetHits(data, "", "14.12.5a8f"); len(hits) != 1 || hits[0].version != "14.12.*" {
+		t.Fatalf("expected the offset to apply to 14.12.5a8f, got %+v", hits)
+	}
+	if misses := patch.expectedOffsetMisses(make([]byte, 0x20), "", "15.30.0.f3a1"); len(misses) != 0 {
+		t.Fatalf("expected the offset not to apply to another version, got %+v", misses)
+	}
+	if misses := patch.expectedOffsetMisses(make([]byte, 0x20), "", ""); len(misses) != 0 {
+		t.Fatalf("expected the offset not to apply to an unknown version, got %+v", misses)
+	}
+
+	entry.ExpectedOffsets[0].Version = "14.12.["
+	if _, err := entry.battleyePatch(); err == nil {
+		t.Fatal("expected a malformed version pattern to be rejected")
+	}
+}
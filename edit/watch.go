@@ -0,0 +1,117 @@
+package edit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchSettleDelay is how long the client must stay unchanged before it is
+// hashed; launchers write the executable in several chunks.
+const watchSettleDelay = 2 * time.Second
+
+// clientWatch re-runs the edit whenever the client changes. Changes are
+// detected by SHA256, so the client written by the edit itself is ignored.
+type clientWatch struct {
+	options PatcherOptions
+	// lastSHA256 is the client as the last run left it, patched or refused.
+	lastSHA256 string
+	runs       int
+}
+
+// watchEdit runs the edit once and then watches the client directory until
+// the watcher fails. A launcher update is the new pristine client, so later
+// runs use the target itself as the source.
+func watchEdit(options PatcherOptions) error {
+	targetPath, err := filepath.Abs(options.TargetExe)
+	if err != nil {
+		return err
+	}
+	options.TargetExe = targetPath
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("unable to start the file watcher: %w", err)
+	}
+	defer watcher.Close()
+	if err := watcher.Add(filepath.Dir(targetPath)); err != nil {
+		return fmt.Errorf("unable to watch %s: %w", filepath.Dir(targetPath), err)
+	}
+
+	watch := clientWatch{options: options}
+	watch.check()
+	fmt.Printf("[INFO] Watching %s for client updates; press Ctrl+C to stop\n", filepath.Dir(targetPath))
+
+	settle := time.NewTimer(watchSettleDelay)
+	settle.Stop()
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if filepath.Clean(event.Name) == targetPath {
+				settle.Reset(watchSettleDelay)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Printf("[WARN] File watcher error: %s\n", err.Error())
+		case <-settle.C:
+			watch.check()
+		}
+	}
+}
+
+// check hashes the client and runs the edit when it differs from what the
+// last run left behind. It reports whether the edit pipeline ran.
+func (watch *clientWatch) check() bool {
+	tibiaBinary, err := os.ReadFile(watch.options.TargetExe)
+	if err != nil {
+		if os.IsNotExist(err) {
+			fmt.Printf("[INFO] %s is missing; waiting for the launcher\n", watch.options.TargetExe)
+		} else {
+			fmt.Printf("[WARN] Unable to read %s: %s\n", watch.options.TargetExe, err.Error())
+		}
+		return false
+	}
+	hash := sha256Hex(tibiaBinary)
+	if hash == watch.lastSHA256 {
+		return false
+	}
+
+	options := watch.options
+	if watch.runs > 0 {
+		fmt.Printf("[INFO] %s changed (SHA256 %s); re-running the edit\n", filepath.Base(options.TargetExe), hash)
+		options.SourceExe = options.TargetExe
+	}
+	watch.runs++
+	watch.lastSHA256 = hash
+
+	patcher, err := NewPatcher(options)
+	if err != nil {
+		fmt.Printf("[ERROR] %s\n", err.Error())
+		return true
+	}
+	result, err := patcher.Plan()
+	if err != nil {
+		fmt.Printf("[ERROR] %s; leaving the client untouched until it changes again\n", err.Error())
+		return true
+	}
+	if strings.SplitN(result.Plan.Verdict, ":", 2)[0] == "UNSUPPORTED" {
+		fmt.Printf("[ERROR] Diagnose verdict for %s is %s; leaving the client untouched until it changes again\n", filepath.Base(options.TargetExe), result.Plan.Verdict)
+		return true
+	}
+	if _, err := patcher.Apply(); err != nil {
+		fmt.Printf("[ERROR] %s; leaving the client untouched until it changes again\n", err.Error())
+		return true
+	}
+	if patched, err := os.ReadFile(options.TargetExe); err == nil {
+		watch.lastSHA256 = sha256Hex(patched)
+	}
+	return true
+}
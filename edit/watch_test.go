@@ -0,0 +1,73 @@
+package edit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClientWatchRepatchesUpdatesAndSkipsUnsupportedClients(t *testing.T) {
+	workDir := t.TempDir()
+	tibiaRsa := bytes.Repeat([]byte("A"), 32)
+	tibiaKeyPath := filepath.Join(workDir, "tibia.key")
+	otservKeyPath := filepath.Join(workDir, "otserv.key")
+	writeTestFile(t, tibiaKeyPath, tibiaRsa)
+	writeTestFile(t, otservKeyPath, bytes.Repeat([]byte("B"), 32))
+	tibiaPath := filepath.Join(workDir, "client")
+	newClient := func(login string) []byte {
+		tibiaBinary := append([]byte("header--"), tibiaRsa...)
+		return append(tibiaBinary, []byte("--[URLS]\nloginWebService="+login+"\n\x00")...)
+	}
+	writeTestFile(t, tibiaPath, newClient("https://www.tibia.com/login/service/endpoint"))
+	watch := clientWatch{options: PatcherOptions{
+		TargetExe:       tibiaPath,
+		TibiaRSAKeyPath: tibiaKeyPath,
+		RSAKeyPath:      otservKeyPath,
+		ConfigValues:    map[string]string{"loginWebService": "http://127.0.0.1"},
+	}}
+
+	if !watch.check() {
+		t.Fatal("expected the first check to run the edit")
+	}
+	patched, _ := os.ReadFile(tibiaPath)
+	if !bytes.Contains(patched, []byte("loginWebService=http://127.0.0.1 ")) || watch.lastSHA256 != sha256Hex(patched) {
+		t.Fatalf("expected the client to be patched and remembered, got %q", patched)
+	}
+	if watch.check() {
+		t.Fatal("expected the client written by the edit not to trigger another run")
+	}
+
+	// Backups are named by the second; drop the first one so the update
+	// does not collide with it.
+	backups, _ := filepath.Glob(filepath.Join(workDir, "BKP*"))
+	for _, backup := range backups {
+		os.Remove(backup)
+	}
+	writeTestFile(t, tibiaPath, newClient("https://www.tibia.com/login/service/endpoint/v2"))
+	if !watch.check() {
+		t.Fatal("expected a launcher update to re-run the edit")
+	}
+	if patched, _ = os.ReadFile(tibiaPath); !bytes.Contains(patched, []byte("loginWebService=http://127.0.0.1    ")) {
+		t.Fatalf("expected the updated client to be patched from itself, got %q", patched)
+	}
+
+	unsupported := newRelocationFixture(t)
+	for offset := 0x427; offset < 0x440; offset++ {
+		unsupported[offset] = 0x90
+	}
+	writeXrefInstruction(unsupported, 0x440, []byte{0x48, 0x8d, 0x0d}, 0x2100)
+	copy(unsupported[0x447:], []byte{0x90, 0x75, 0x05, 0xe8, 0x01, 0x02, 0x03, 0x04})
+	copy(unsupported[0x700:], "clientcheck_disconnected\x00")
+	copy(unsupported[0x780:], tibiaRsa)
+	writeTestFile(t, tibiaPath, unsupported)
+	if !watch.check() {
+		t.Fatal("expected the unsupported update to be diagnosed")
+	}
+	if current, _ := os.ReadFile(tibiaPath); !bytes.Equal(current, unsupported) {
+		t.Fatal("expected an UNSUPPORTED client to be left untouched")
+	}
+	if watch.check() {
+		t.Fatal("expected a refused client not to be retried until it changes")
+	}
+}
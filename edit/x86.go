@@ -0,0 +1,1247 @@
+package edit
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// The x86-64 decoder below finds instruction boundaries, RIP-relative memory
+// operands and relative branch targets for the structural guards, the code
+// reference scans and the diagnose listings. It covers the general-purpose,
+// x87 and legacy SSE encodings; VEX and EVEX instructions are length-decoded
+// and listed generically.
+
+const (
+	x86MaxInstructionLength = 15
+	// x86SyncWindow is how far before a known instruction a linear sweep
+	// starts when no runtime function gives an exact entry point.
+	x86SyncWindow = 64
+)
+
+const (
+	x86MapPrimary = iota
+	x86Map0F
+	x86Map0F38
+	x86Map0F3A
+)
+
+type x86Instruction struct {
+	offset        int
+	length        int
+	invalid       bool
+	opcodeMap     int
+	opcode        byte
+	rex           byte
+	operandSize16 bool
+	addressSize32 bool
+	lockPrefix    bool
+	repPrefix     byte
+	segmentPrefix byte
+	vex           bool
+	vexW          bool
+	hasModRM      bool
+	modRM         byte
+	hasSIB        bool
+	sib           byte
+	// displacementOffset and immediateOffset are relative to offset.
+	displacementOffset int
+	displacementSize   int
+	displacement       int64
+	immediateOffset    int
+	immediateSize      int
+	immediate          int64
+	relativeBranch     bool
+	form               x86Opcode
+}
+
+// x86Opcode describes one opcode. Operands use the Intel manual's addressing
+// letters (E, G, M, I, J, O, V, W, S) followed by a size letter, plus Z for a
+// register in the low opcode bits and literal register names.
+type x86Opcode struct {
+	mnemonic string
+	operands string
+	group    []string
+	specs    []string
+}
+
+func (form x86Opcode) valid() bool {
+	return form.mnemonic != "" || form.group != nil
+}
+
+var x86ConditionCodes = []string{"o", "no", "b", "ae", "e", "ne", "be", "a", "s", "ns", "p", "np", "l", "ge", "le", "g"}
+
+var (
+	x86Group1  = []string{"add", "or", "adc", "sbb", "and", "sub", "xor", "cmp"}
+	x86Group2  = []string{"rol", "ror", "rcl", "rcr", "shl", "shr", "sal", "sar"}
+	x86Group3  = []string{"test", "test", "not", "neg", "mul", "imul", "div", "idiv"}
+	x86Group4  = []string{"inc", "dec", "", "", "", "", "", ""}
+	x86Group5  = []string{"inc", "dec", "call", "callf", "jmp", "jmpf", "push", ""}
+	x86Group8  = []string{"", "", "", "", "bt", "bts", "btr", "btc"}
+	x86Group11 = []string{"mov", "", "", "", "", "", "", ""}
+	x86Group1A = []string{"pop", "", "", "", "", "", "", ""}
+	x86Group9  = []string{"", "cmpxchg8b", "", "", "", "", "", ""}
+	x86Group15 = []string{"fxsave", "fxrstor", "ldmxcsr", "stmxcsr", "xsave", "xrstor", "xsaveopt", "clflush"}
+	x86Group16 = []string{"prefetchnta", "prefetcht0", "prefetcht1", "prefetcht2", "nop", "nop", "nop", "nop"}
+	x86GroupFP = []string{"x87", "x87", "x87", "x87", "x87", "x87", "x87", "x87"}
+)
+
+var x86PrimaryOpcodes = buildX86PrimaryOpcodes()
+
+var x86SecondaryOpcodes = buildX86SecondaryOpcodes()
+
+func buildX86PrimaryOpcodes() [256]x86Opcode {
+	var table [256]x86Opcode
+	for index, mnemonic := range x86Group1 {
+		base := index * 8
+		table[base+0] = x86Opcode{mnemonic: mnemonic, operands: "Eb,Gb"}
+		table[base+1] = x86Opcode{mnemonic: mnemonic, operands: "Ev,Gv"}
+		table[base+2] = x86Opcode{mnemonic: mnemonic, operands: "Gb,Eb"}
+		table[base+3] = x86Opcode{mnemonic: mnemonic, operands: "Gv,Ev"}
+		table[base+4] = x86Opcode{mnemonic: mnemonic, operands: "AL,Ib"}
+		table[base+5] = x86Opcode{mnemonic: mnemonic, operands: "rAX,Iz"}
+	}
+	for register := 0; register < 8; register++ {
+		table[0x50+register] = x86Opcode{mnemonic: "push", operands: "Zq"}
+		table[0x58+register] = x86Opcode{mnemonic: "pop", operands: "Zq"}
+		table[0x91+register] = x86Opcode{mnemonic: "xchg", operands: "Zv,rAX"}
+		table[0xb0+register] = x86Opcode{mnemonic: "mov", operands: "Zb,Ib"}
+		table[0xb8+register] = x86Opcode{mnemonic: "mov", operands: "Zv,Iv"}
+		table[0xd8+register] = x86Opcode{operands: "Ev", group: x86GroupFP}
+	}
+	for condition, name := range x86ConditionCodes {
+		table[0x70+condition] = x86Opcode{mnemonic: "j" + name, operands: "Jb"}
+	}
+	for opcode, form := range map[int]x86Opcode{
+		0x63: {mnemonic: "movsxd", operands: "Gv,Ed"},
+		0x68: {mnemonic: "push", operands: "Iz"},
+		0x69: {mnemonic: "imul", operands: "Gv,Ev,Iz"},
+		0x6a: {mnemonic: "push", operands: "Ib"},
+		0x6b: {mnemonic: "imul", operands: "Gv,Ev,Ib"},
+		0x6c: {mnemonic: "insb"},
+		0x6d: {mnemonic: "ins", operands: "X"},
+		0x6e: {mnemonic: "outsb"},
+		0x6f: {mnemonic: "outs", operands: "X"},
+		0x80: {operands: "Eb,Ib", group: x86Group1},
+		0x81: {operands: "Ev,Iz", group: x86Group1},
+		0x83: {operands: "Ev,Ib", group: x86Group1},
+		0x84: {mnemonic: "test", operands: "Eb,Gb"},
+		0x85: {mnemonic: "test", operands: "Ev,Gv"},
+		0x86: {mnemonic: "xchg", operands: "Eb,Gb"},
+		0x87: {mnemonic: "xchg", operands: "Ev,Gv"},
+		0x88: {mnemonic: "mov", operands: "Eb,Gb"},
+		0x89: {mnemonic: "mov", operands: "Ev,Gv"},
+		0x8a: {mnemonic: "mov", operands: "Gb,Eb"},
+		0x8b: {mnemonic: "mov", operands: "Gv,Ev"},
+		0x8c: {mnemonic: "mov", operands: "Ew,Sw"},
+		0x8d: {mnemonic: "lea", operands: "Gv,M"},
+		0x8e: {mnemonic: "mov", operands: "Sw,Ew"},
+		0x8f: {operands: "Eq", group: x86Group1A},
+		0x90: {mnemonic: "nop"},
+		0x98: {mnemonic: "cwde"},
+		0x99: {mnemonic: "cdq"},
+		0x9b: {mnemonic: "fwait"},
+		0x9c: {mnemonic: "pushfq"},
+		0x9d: {mnemonic: "popfq"},
+		0x9e: {mnemonic: "sahf"},
+		0x9f: {mnemonic: "lahf"},
+		0xa0: {mnemonic: "mov", operands: "AL,Ob"},
+		0xa1: {mnemonic: "mov", operands: "rAX,Ov"},
+		0xa2: {mnemonic: "mov", operands: "Ob,AL"},
+		0xa3: {mnemonic: "mov", operands: "Ov,rAX"},
+		0xa4: {mnemonic: "movsb"},
+		0xa5: {mnemonic: "movs", operands: "X"},
+		0xa6: {mnemonic: "cmpsb"},
+		0xa7: {mnemonic: "cmps", operands: "X"},
+		0xa8: {mnemonic: "test", operands: "AL,Ib"},
+		0xa9: {mnemonic: "test", operands: "rAX,Iz"},
+		0xaa: {mnemonic: "stosb"},
+		0xab: {mnemonic: "stos", operands: "X"},
+		0xac: {mnemonic: "lodsb"},
+		0xad: {mnemonic: "lods", operands: "X"},
+		0xae: {mnemonic: "scasb"},
+		0xaf: {mnemonic: "scas", operands: "X"},
+		0xc0: {operands: "Eb,Ib", group: x86Group2},
+		0xc1: {operands: "Ev,Ib", group: x86Group2},
+		0xc2: {mnemonic: "ret", operands: "Iw"},
+		0xc3: {mnemonic: "ret"},
+		0xc6: {operands: "Eb,Ib", group: x86Group11},
+		0xc7: {operands: "Ev,Iz", group: x86Group11},
+		0xc8: {mnemonic: "enter", operands: "Iw,Ib"},
+		0xc9: {mnemonic: "leave"},
+		0xca: {mnemonic: "retf", operands: "Iw"},
+		0xcb: {mnemonic: "retf"},
+		0xcc: {mnemonic: "int3"},
+		0xcd: {mnemonic: "int", operands: "Ib"},
+		0xcf: {mnemonic: "iretq"},
+		0xd0: {operands: "Eb,1", group: x86Group2},
+		0xd1: {operands: "Ev,1", group: x86Group2},
+		0xd2: {operands: "Eb,CL", group: x86Group2},
+		0xd3: {operands: "Ev,CL", group: x86Group2},
+		0xd7: {mnemonic: "xlatb"},
+		0xe0: {mnemonic: "loopne", operands: "Jb"},
+		0xe1: {mnemonic: "loope", operands: "Jb"},
+		0xe2: {mnemonic: "loop", operands: "Jb"},
+		0xe3: {mnemonic: "jrcxz", operands: "Jb"},
+		0xe4: {mnemonic: "in", operands: "AL,Ib"},
+		0xe5: {mnemonic: "in", operands: "eAX,Ib"},
+		0xe6: {mnemonic: "out", operands: "Ib,AL"},
+		0xe7: {mnemonic: "out", operands: "Ib,eAX"},
+		0xe8: {mnemonic: "call", operands: "Jz"},
+		0xe9: {mnemonic: "jmp", operands: "Jz"},
+		0xeb: {mnemonic: "jmp", operands: "Jb"},
+		0xec: {mnemonic: "in", operands: "AL,DX"},
+		0xed: {mnemonic: "in", operands: "eAX,DX"},
+		0xee: {mnemonic: "out", operands: "DX,AL"},
+		0xef: {mnemonic: "out", operands: "DX,eAX"},
+		0xf1: {mnemonic: "int1"},
+		0xf4: {mnemonic: "hlt"},
+		0xf5: {mnemonic: "cmc"},
+		0xf6: {operands: "Eb", group: x86Group3},
+		0xf7: {operands: "Ev", group: x86Group3},
+		0xf8: {mnemonic: "clc"},
+		0xf9: {mnemonic: "stc"},
+		0xfa: {mnemonic: "cli"},
+		0xfb: {mnemonic: "sti"},
+		0xfc: {mnemonic: "cld"},
+		0xfd: {mnemonic: "std"},
+		0xfe: {operands: "Eb", group: x86Group4},
+		0xff: {operands: "Ev", group: x86Group5},
+	} {
+		table[opcode] = form
+	}
+	for opcode := range table {
+		table[opcode].specs = x86SplitOperands(table[opcode].operands)
+	}
+	return table
+}
+
+// x86SecondaryOpcodes holds the 0F map. SSE mnemonics list the forms for no
+// mandatory prefix, 66, F3 and F2 separated by "/"; an empty form is left to
+// the generic listing.
+func buildX86SecondaryOpcodes() [256]x86Opcode {
+	var table [256]x86Opcode
+	for condition, name := range x86ConditionCodes {
+		table[0x40+condition] = x86Opcode{mnemonic: "cmov" + name, operands: "Gv,Ev"}
+		table[0x80+condition] = x86Opcode{mnemonic: "j" + name, operands: "Jz"}
+		table[0x90+condition] = x86Opcode{mnemonic: "set" + name, operands: "Eb"}
+	}
+	for register := 0; register < 8; register++ {
+		table[0xc8+register] = x86Opcode{mnemonic: "bswap", operands: "Zv"}
+	}
+	for opcode, name := range map[int]string{0x51: "sqrt", 0x58: "add", 0x59: "mul", 0x5c: "sub", 0x5d: "min", 0x5e: "div", 0x5f: "max"} {
+		table[opcode] = x86Opcode{mnemonic: fmt.Sprintf("%[1]sps/%[1]spd/%[1]sss/%[1]ssd", name), operands: "V,W"}
+	}
+	for opcode, form := range map[int]x86Opcode{
+		0x05: {mnemonic: "syscall"},
+		0x0b: {mnemonic: "ud2"},
+		0x0d: {mnemonic: "nop", operands: "Ev"},
+		0x10: {mnemonic: "movups/movupd/movss/movsd", operands: "V,W"},
+		0x11: {mnemonic: "movups/movupd/movss/movsd", operands: "W,V"},
+		0x14: {mnemonic: "unpcklps/unpcklpd//", operands: "V,W"},
+		0x15: {mnemonic: "unpckhps/unpckhpd//", operands: "V,W"},
+		0x18: {operands: "Eb", group: x86Group16},
+		0x1f: {mnemonic: "nop", operands: "Ev"},
+		0x28: {mnemonic: "movaps/movapd//", operands: "V,W"},
+		0x29: {mnemonic: "movaps/movapd//", operands: "W,V"},
+		0x2a: {mnemonic: "//cvtsi2ss/cvtsi2sd", operands: "V,Ey"},
+		0x2c: {mnemonic: "//cvttss2si/cvttsd2si", operands: "Gy,W"},
+		0x2d: {mnemonic: "//cvtss2si/cvtsd2si", operands: "Gy,W"},
+		0x2e: {mnemonic: "ucomiss/ucomisd//", operands: "V,W"},
+		0x2f: {mnemonic: "comiss/comisd//", operands: "V,W"},
+		0x31: {mnemonic: "rdtsc"},
+		0x54: {mnemonic: "andps/andpd//", operands: "V,W"},
+		0x55: {mnemonic: "andnps/andnpd//", operands: "V,W"},
+		0x56: {mnemonic: "orps/orpd//", operands: "V,W"},
+		0x57: {mnemonic: "xorps/xorpd//", operands: "V,W"},
+		0x5a: {mnemonic: "cvtps2pd/cvtpd2ps/cvtss2sd/cvtsd2ss", operands: "V,W"},
+		0x5b: {mnemonic: "cvtdq2ps/cvtps2dq/cvttps2dq/", operands: "V,W"},
+		0x6e: {mnemonic: "/movd//", operands: "V,Ey"},
+		0x6f: {mnemonic: "/movdqa/movdqu/", operands: "V,W"},
+		0x7e: {mnemonic: "/movd/movq/", operands: "Ey,V"},
+		0x7f: {mnemonic: "/movdqa/movdqu/", operands: "W,V"},
+		0xa2: {mnemonic: "cpuid"},
+		0xa3: {mnemonic: "bt", operands: "Ev,Gv"},
+		0xa4: {mnemonic: "shld", operands: "Ev,Gv,Ib"},
+		0xa5: {mnemonic: "shld", operands: "Ev,Gv,CL"},
+		0xab: {mnemonic: "bts", operands: "Ev,Gv"},
+		0xac: {mnemonic: "shrd", operands: "Ev,Gv,Ib"},
+		0xad: {mnemonic: "shrd", operands: "Ev,Gv,CL"},
+		0xae: {operands: "M", group: x86Group15},
+		0xaf: {mnemonic: "imul", operands: "Gv,Ev"},
+		0xb0: {mnemonic: "cmpxchg", operands: "Eb,Gb"},
+		0xb1: {mnemonic: "cmpxchg", operands: "Ev,Gv"},
+		0xb3: {mnemonic: "btr", operands: "Ev,Gv"},
+		0xb6: {mnemonic: "movzx", operands: "Gv,Eb"},
+		0xb7: {mnemonic: "movzx", operands: "Gv,Ew"},
+		0xba: {operands: "Ev,Ib", group: x86Group8},
+		0xbb: {mnemonic: "btc", operands: "Ev,Gv"},
+		0xbc: {mnemonic: "bsf//tzcnt/", operands: "Gv,Ev"},
+		0xbd: {mnemonic: "bsr//lzcnt/", operands: "Gv,Ev"},
+		0xbe: {mnemonic: "movsx", operands: "Gv,Eb"},
+		0xbf: {mnemonic: "movsx", operands: "Gv,Ew"},
+		0xc0: {mnemonic: "xadd", operands: "Eb,Gb"},
+		0xc1: {mnemonic: "xadd", operands: "Ev,Gv"},
+		0xc7: {operands: "M", group: x86Group9},
+		0xd6: {mnemonic: "/movq//", operands: "W,V"},
+		0xef: {mnemonic: "/pxor//", operands: "V,W"},
+	} {
+		table[opcode] = form
+	}
+	for opcode := range table {
+		table[opcode].specs = x86SplitOperands(table[opcode].operands)
+	}
+	return table
+}
+
+// decodeX86 decodes the instruction at offset without reading at or past end.
+func decodeX86(data []byte, offset int, end int) (x86Instruction, bool) {
+	instruction := x86Instruction{offset: offset}
+	if end > len(data) {
+		end = len(data)
+	}
+	limit := offset + x86MaxInstructionLength
+	if limit > end {
+		limit = end
+	}
+	if offset < 0 || offset >= limit {
+		return instruction, false
+	}
+
+	position := offset
+prefixes:
+	for ; position < limit; position++ {
+		switch value := data[position]; value {
+		case 0xf0:
+			instruction.lockPrefix = true
+		case 0xf2, 0xf3:
+			instruction.repPrefix = value
+		case 0x26, 0x2e, 0x36, 0x3e, 0x64, 0x65:
+			instruction.segmentPrefix = value
+		case 0x66:
+			instruction.operandSize16 = true
+		case 0x67:
+			instruction.addressSize32 = true
+		default:
+			break prefixes
+		}
+	}
+	if position < limit && data[position]&0xf0 == 0x40 {
+		instruction.rex = data[position]
+		position++
+	}
+	if position >= limit {
+		return instruction, false
+	}
+
+	opcode := data[position]
+	position++
+	hasModRM, immediateSize := false, 0
+	switch opcode {
+	case 0x0f:
+		if position >= limit {
+			return instruction, false
+		}
+		instruction.opcodeMap = x86Map0F
+		opcode = data[position]
+		position++
+		if opcode == 0x38 || opcode == 0x3a {
+			if position >= limit {
+				return instruction, false
+			}
+			instruction.opcodeMap = x86Map0F38
+			if opcode == 0x3a {
+				instruction.opcodeMap = x86Map0F3A
+			}
+			opcode = data[position]
+			position++
+		}
+	case 0xc4, 0xc5, 0x62:
+		if instruction.rex != 0 || instruction.operandSize16 || instruction.repPrefix != 0 || instruction.lockPrefix {
+			return instruction, false
+		}
+		payloadLength := 1
+		switch opcode {
+		case 0xc4:
+			payloadLength = 2
+		case 0x62:
+			payloadLength = 3
+		}
+		if position+payloadLength >= limit {
+			return instruction, false
+		}
+		instruction.vex = true
+		instruction.opcodeMap = x86Map0F
+		switch opcode {
+		case 0xc4:
+			instruction.opcodeMap = int(data[position] & 0x1f)
+			instruction.vexW = data[position+1]&0x80 != 0
+		case 0x62:
+			instruction.opcodeMap = int(data[position] & 0x07)
+			instruction.vexW = data[position+1]&0x80 != 0
+		}
+		if instruction.opcodeMap < x86Map0F || instruction.opcodeMap > x86Map0F3A {
+			return instruction, false
+		}
+		position += payloadLength
+		opcode = data[position]
+		position++
+	}
+	instruction.opcode = opcode
+
+	switch {
+	case instruction.vex:
+		hasModRM = !(instruction.opcodeMap == x86Map0F && opcode == 0x77)
+		if instruction.opcodeMap == x86Map0F3A || (instruction.opcodeMap == x86Map0F && x86SecondaryTakesImm8(opcode)) {
+			immediateSize = 1
+		}
+	case instruction.opcodeMap == x86Map0F38:
+		hasModRM = true
+	case instruction.opcodeMap == x86Map0F3A:
+		hasModRM, immediateSize = true, 1
+	case instruction.opcodeMap == x86Map0F:
+		if x86SecondaryInvalid(opcode) {
+			return instruction, false
+		}
+		instruction.form = x86SecondaryOpcodes[opcode]
+		hasModRM = x86SecondaryTakesModRM(opcode)
+		if x86SecondaryTakesImm8(opcode) {
+			immediateSize = 1
+		}
+	default:
+		instruction.form = x86PrimaryOpcodes[opcode]
+		if !instruction.form.valid() {
+			return instruction, false
+		}
+	}
+	if instruction.opcodeMap == x86MapPrimary {
+		hasModRM = x86OperandsTakeModRM(instruction.form.specs)
+	}
+
+	if hasModRM {
+		if position >= limit {
+			return instruction, false
+		}
+		instruction.hasModRM = true
+		instruction.modRM = data[position]
+		position++
+		mod, rm := instruction.modRM>>6, instruction.modRM&7
+		if mod != 3 {
+			if rm == 4 {
+				if position >= limit {
+					return instruction, false
+				}
+				instruction.hasSIB = true
+				instruction.sib = data[position]
+				position++
+			}
+			switch {
+			case mod == 1:
+				instruction.displacementSize = 1
+			case mod == 2, mod == 0 && rm == 5, mod == 0 && instruction.hasSIB && instruction.sib&7 == 5:
+				instruction.displacementSize = 4
+			}
+		} else if instruction.form.operands == "M" && instruction.opcodeMap == x86Map0F {
+			// Register forms of the memory-only 0F AE and 0F C7 groups are
+			// fences and random-number instructions of the same length.
+			instruction.form = x86Opcode{mnemonic: x86RegisterGroupName(instruction)}
+		}
+		if instruction.form.group != nil && x86GroupName(instruction) == "" {
+			return instruction, false
+		}
+		if instruction.displacementSize > 0 {
+			if position+instruction.displacementSize > limit {
+				return instruction, false
+			}
+			instruction.displacementOffset = position - offset
+			instruction.displacement = x86SignedValue(data[position:], instruction.displacementSize)
+			position += instruction.displacementSize
+		}
+	}
+
+	if instruction.opcodeMap == x86MapPrimary || (instruction.opcodeMap == x86Map0F && !instruction.vex) {
+		size, relative := instruction.immediateLength()
+		if size > 0 {
+			immediateSize = size
+		}
+		instruction.relativeBranch = relative
+	}
+	if immediateSize > 0 {
+		if position+immediateSize > limit {
+			return instruction, false
+		}
+		instruction.immediateOffset = position - offset
+		instruction.immediateSize = immediateSize
+		if instruction.opcodeMap == x86MapPrimary && opcode == 0xc8 {
+			// ENTER packs its imm16 frame size and imm8 nesting level.
+			instruction.immediate = int64(binary.LittleEndian.Uint16(data[position:])) | int64(data[position+2])<<16
+		} else {
+			instruction.immediate = x86SignedValue(data[position:], immediateSize)
+		}
+		position += immediateSize
+	}
+
+	instruction.length = position - offset
+	return instruction, true
+}
+
+func x86SecondaryInvalid(opcode byte) bool {
+	switch opcode {
+	case 0x04, 0x0a, 0x0c, 0x0f, 0x24, 0x25, 0x26, 0x27, 0x36, 0x39, 0x3b, 0x3c, 0x3d, 0x3e, 0x3f, 0x7a, 0x7b, 0xa6, 0xa7:
+		return true
+	}
+	return false
+}
+
+func x86SecondaryTakesModRM(opcode byte) bool {
+	switch {
+	case opcode >= 0x05 && opcode <= 0x09, opcode == 0x0b, opcode == 0x0e,
+		opcode >= 0x30 && opcode <= 0x37, opcode == 0x77,
+		opcode >= 0x80 && opcode <= 0x8f,
+		opcode == 0xa0, opcode == 0xa1, opcode == 0xa2, opcode == 0xa8, opcode == 0xa9, opcode == 0xaa,
+		opcode >= 0xc8 && opcode <= 0xcf:
+		return false
+	}
+	return true
+}
+
+func x86SecondaryTakesImm8(opcode byte) bool {
+	switch opcode {
+	case 0x70, 0x71, 0x72, 0x73, 0xa4, 0xac, 0xba, 0xc2, 0xc4, 0xc5, 0xc6:
+		return true
+	}
+	return false
+}
+
+func x86OperandsTakeModRM(specs []string) bool {
+	for _, operand := range specs {
+		switch operand[0] {
+		case 'E', 'G', 'M', 'S', 'V', 'W':
+			return true
+		}
+	}
+	return false
+}
+
+func x86SplitOperands(operands string) []string {
+	if operands == "" {
+		return nil
+	}
+	return strings.Split(operands, ",")
+}
+
+// immediateLength returns the size of the immediate that follows the ModRM
+// bytes and whether it is a relative branch displacement.
+func (instruction x86Instruction) immediateLength() (int, bool) {
+	size, relative := 0, false
+	for _, operand := range instruction.form.specs {
+		switch operand {
+		case "Ib":
+			size++
+		case "Iw":
+			size += 2
+		case "Iz":
+			size += instruction.operandSizeZ()
+		case "Iv":
+			size += instruction.operandSizeV()
+		case "Jb":
+			size, relative = size+1, true
+		case "Jz":
+			size, relative = size+4, true
+		case "Ob", "Ov":
+			size += 8
+			if instruction.addressSize32 {
+				size -= 4
+			}
+		}
+	}
+	if instruction.opcodeMap == x86MapPrimary && (instruction.opcode == 0xf6 || instruction.opcode == 0xf7) && instruction.reg() < 2 {
+		size = 1
+		if instruction.opcode == 0xf7 {
+			size = instruction.operandSizeZ()
+		}
+	}
+	return size, relative
+}
+
+func x86SignedValue(data []byte, size int) int64 {
+	switch size {
+	case 1:
+		return int64(int8(data[0]))
+	case 2:
+		return int64(int16(binary.LittleEndian.Uint16(data)))
+	case 4:
+		return int64(int32(binary.LittleEndian.Uint32(data)))
+	case 8:
+		return int64(binary.LittleEndian.Uint64(data))
+	}
+	return 0
+}
+
+func (instruction x86Instruction) rexW() bool {
+	return instruction.rex&0x08 != 0 || instruction.vexW
+}
+
+func (instruction x86Instruction) reg() int {
+	return int(instruction.modRM>>3) & 7
+}
+
+func (instruction x86Instruction) operandSizeV() int {
+	switch {
+	case instruction.rexW():
+		return 8
+	case instruction.operandSize16:
+		return 2
+	}
+	return 4
+}
+
+func (instruction x86Instruction) operandSizeZ() int {
+	if instruction.operandSize16 && !instruction.rexW() {
+		return 2
+	}
+	return 4
+}
+
+// ripRelative reports whether the instruction has a RIP-relative memory
+// operand.
+func (instruction x86Instruction) ripRelative() bool {
+	return instruction.hasModRM && instruction.modRM&0xc7 == 0x05
+}
+
+func (instruction x86Instruction) hasMemoryOperand() bool {
+	return instruction.hasModRM && instruction.modRM>>6 != 3
+}
+
+// mnemonic returns the base mnemonic, or "" for instructions that are only
+// length-decoded.
+func (instruction x86Instruction) mnemonic() string {
+	if instruction.invalid || instruction.vex {
+		return ""
+	}
+	if instruction.form.group != nil {
+		return x86GroupName(instruction)
+	}
+	mnemonic := instruction.form.mnemonic
+	if strings.Contains(mnemonic, "/") {
+		forms := strings.Split(mnemonic, "/")
+		switch {
+		case instruction.repPrefix == 0xf3:
+			return forms[2]
+		case instruction.repPrefix == 0xf2:
+			return forms[3]
+		case instruction.operandSize16:
+			return forms[1]
+		}
+		return forms[0]
+	}
+	if instruction.opcodeMap == x86Map0F && instruction.opcode == 0x1e && instruction.repPrefix == 0xf3 && instruction.modRM == 0xfa {
+		return "endbr64"
+	}
+	if instruction.opcodeMap != x86MapPrimary {
+		return mnemonic
+	}
+
+	switch instruction.opcode {
+	case 0x90:
+		if instruction.rex&0x01 != 0 {
+			return "xchg"
+		}
+		if instruction.repPrefix == 0xf3 {
+			return "pause"
+		}
+	case 0x98:
+		return map[int]string{2: "cbw", 4: "cwde", 8: "cdqe"}[instruction.operandSizeV()]
+	case 0x99:
+		return map[int]string{2: "cwd", 4: "cdq", 8: "cqo"}[instruction.operandSizeV()]
+	case 0xe3:
+		if instruction.addressSize32 {
+			return "jecxz"
+		}
+	}
+	if instruction.form.operands == "X" {
+		return mnemonic + map[int]string{2: "w", 4: "d", 8: "q"}[instruction.operandSizeV()]
+	}
+	return mnemonic
+}
+
+func x86GroupName(instruction x86Instruction) string {
+	group := instruction.form.group
+	if group == nil {
+		return instruction.form.mnemonic
+	}
+	name := group[instruction.reg()]
+	if instruction.opcodeMap == x86Map0F && instruction.opcode == 0xc7 && name == "cmpxchg8b" && instruction.rexW() {
+		return "cmpxchg16b"
+	}
+	return name
+}
+
+func x86RegisterGroupName(instruction x86Instruction) string {
+	if instruction.opcode == 0xae {
+		switch instruction.reg() {
+		case 5:
+			return "lfence"
+		case 6:
+			return "mfence"
+		case 7:
+			return "sfence"
+		}
+	}
+	if instruction.opcode == 0xc7 {
+		switch instruction.reg() {
+		case 6:
+			return "rdrand"
+		case 7:
+			return "rdseed"
+		}
+	}
+	return ""
+}
+
+// isConditionalBranch reports a Jcc, the only branches that can fall through.
+func (instruction x86Instruction) isConditionalBranch() bool {
+	if instruction.invalid || instruction.vex {
+		return false
+	}
+	return (instruction.opcodeMap == x86MapPrimary && instruction.opcode >= 0x70 && instruction.opcode <= 0x7f) ||
+		(instruction.opcodeMap == x86Map0F && instruction.opcode >= 0x80 && instruction.opcode <= 0x8f)
+}
+
+func (instruction x86Instruction) isCall() bool {
+	return instruction.mnemonic() == "call"
+}
+
+// isAddressLoad reports a LEA, the only instruction that takes the address
+// of its memory operand rather than reading it.
+func (instruction x86Instruction) isAddressLoad() bool {
+	return instruction.mnemonic() == "lea"
+}
+
+func (instruction x86Instruction) isNop() bool {
+	return instruction.mnemonic() == "nop"
+}
+
+// text formats the instruction in Intel syntax. Relative branches are written
+// as "$+n" from the start of the instruction.
+func (instruction x86Instruction) text() string {
+	if instruction.invalid {
+		return "(bad)"
+	}
+	mnemonic := instruction.mnemonic()
+	if mnemonic == "" || (instruction.opcodeMap == x86MapPrimary && instruction.opcode >= 0xd8 && instruction.opcode <= 0xdf) {
+		return instruction.genericText()
+	}
+
+	prefix := ""
+	if instruction.lockPrefix {
+		prefix = "lock "
+	}
+	if instruction.isStringOperation() {
+		switch instruction.repPrefix {
+		case 0xf3:
+			prefix += "rep "
+		case 0xf2:
+			prefix += "repne "
+		}
+	}
+
+	operands := make([]string, 0, 3)
+	if instruction.opcodeMap == x86MapPrimary && instruction.opcode == 0x90 && mnemonic == "xchg" {
+		operands = append(operands, x86RegisterName(8, instruction.operandSizeV(), true), x86RegisterName(0, instruction.operandSizeV(), true))
+	} else if instruction.form.operands != "X" {
+		registerSize := 0
+		for _, spec := range instruction.form.specs {
+			if spec[0] == 'G' || spec[0] == 'Z' {
+				registerSize = instruction.operandBytes(spec)
+			}
+		}
+		for index, spec := range instruction.form.specs {
+			operands = append(operands, instruction.operandText(spec, index, registerSize))
+		}
+		if instruction.immediateSize > 0 && (instruction.opcode == 0xf6 || instruction.opcode == 0xf7) && instruction.opcodeMap == x86MapPrimary {
+			// TEST in group 3 is the only member with an immediate.
+			operands = append(operands, instruction.operandText("Iz", len(operands), registerSize))
+		}
+	}
+	if len(operands) == 0 {
+		return prefix + mnemonic
+	}
+	return prefix + mnemonic + " " + strings.Join(operands, ",")
+}
+
+func (instruction x86Instruction) isStringOperation() bool {
+	if instruction.opcodeMap != x86MapPrimary {
+		return false
+	}
+	opcode := instruction.opcode
+	return (opcode >= 0x6c && opcode <= 0x6f) || (opcode >= 0xa4 && opcode <= 0xa7) || (opcode >= 0xaa && opcode <= 0xaf)
+}
+
+func (instruction x86Instruction) genericText() string {
+	parts := make([]string, 0, 4)
+	if instruction.vex {
+		parts = append(parts, "vex")
+	}
+	switch instruction.opcodeMap {
+	case x86Map0F:
+		parts = append(parts, "0F")
+	case x86Map0F38:
+		parts = append(parts, "0F38")
+	case x86Map0F3A:
+		parts = append(parts, "0F3A")
+	}
+	opcode := fmt.Sprintf("%02X", instruction.opcode)
+	if instruction.hasModRM && instruction.form.group != nil {
+		opcode += fmt.Sprintf(" /%d", instruction.reg())
+	}
+	parts = append(parts, opcode)
+	text := "(" + strings.Join(parts, " ") + ")"
+	if instruction.hasMemoryOperand() {
+		text += " " + instruction.memoryText()
+	}
+	return text
+}
+
+// defaultsTo64Bit reports the indirect CALL, JMP and PUSH forms whose
+// operand is 64 bits without REX.W.
+func (instruction x86Instruction) defaultsTo64Bit() bool {
+	if instruction.opcodeMap != x86MapPrimary || instruction.opcode != 0xff {
+		return false
+	}
+	switch instruction.reg() {
+	case 2, 4, 6:
+		return true
+	}
+	return false
+}
+
+// operandBytes returns the width of a sized operand spec such as "Ev".
+func (instruction x86Instruction) operandBytes(spec string) int {
+	if len(spec) < 2 {
+		return 0
+	}
+	switch spec[len(spec)-1] {
+	case 'b':
+		return 1
+	case 'w':
+		return 2
+	case 'd':
+		return 4
+	case 'q':
+		return 8
+	case 'v':
+		if instruction.defaultsTo64Bit() && !instruction.operandSize16 {
+			return 8
+		}
+		return instruction.operandSizeV()
+	case 'z':
+		return instruction.operandSizeZ()
+	case 'y':
+		if instruction.rexW() {
+			return 8
+		}
+		return 4
+	}
+	return 0
+}
+
+func (instruction x86Instruction) operandText(spec string, index int, registerSize int) string {
+	rexR := int(instruction.rex>>2) & 1
+	rexB := int(instruction.rex) & 1
+	rm := int(instruction.modRM & 7)
+	switch spec {
+	case "AL":
+		return "al"
+	case "CL":
+		return "cl"
+	case "DX":
+		return "dx"
+	case "1":
+		return "1"
+	case "rAX":
+		return x86RegisterName(0, instruction.operandSizeV(), false)
+	case "eAX":
+		return x86RegisterName(0, instruction.operandSizeZ(), false)
+	case "M":
+		return instruction.memoryText()
+	case "V":
+		return fmt.Sprintf("xmm%d", instruction.reg()|rexR<<3)
+	case "W":
+		if !instruction.hasMemoryOperand() {
+			return fmt.Sprintf("xmm%d", rm|rexB<<3)
+		}
+		return instruction.memoryText()
+	case "Sw":
+		return []string{"es", "cs", "ss", "ds", "fs", "gs", "?", "?"}[instruction.reg()]
+	}
+
+	size := instruction.operandBytes(spec)
+	switch spec[0] {
+	case 'E':
+		if !instruction.hasMemoryOperand() {
+			return x86RegisterName(rm|rexB<<3, size, instruction.rex != 0)
+		}
+		if size == registerSize {
+			return instruction.memoryText()
+		}
+		return x86SizeName(size) + " ptr " + instruction.memoryText()
+	case 'G':
+		return x86RegisterName(instruction.reg()|rexR<<3, size, instruction.rex != 0)
+	case 'Z':
+		return x86RegisterName(int(instruction.opcode&7)|rexB<<3, size, instruction.rex != 0)
+	case 'O':
+		return fmt.Sprintf("[0x%X]", uint64(instruction.immediate))
+	case 'J':
+		relative := int64(instruction.length) + instruction.immediate
+		if relative < 0 {
+			return fmt.Sprintf("$-0x%X", -relative)
+		}
+		return fmt.Sprintf("$+0x%X", relative)
+	case 'I':
+		if instruction.opcodeMap == x86MapPrimary && instruction.opcode == 0xc8 {
+			if index == 0 {
+				return fmt.Sprintf("0x%X", instruction.immediate&0xffff)
+			}
+			return fmt.Sprintf("0x%X", instruction.immediate>>16)
+		}
+		value := instruction.immediate
+		if width := instruction.immediateWidth(spec); width < 8 {
+			value &= int64(1)<<(uint(width)*8) - 1
+		}
+		return fmt.Sprintf("0x%X", uint64(value))
+	}
+	return spec
+}
+
+// immediateWidth returns the width an immediate is printed at: that of the
+// destination it is sign-extended into, else its own encoded size.
+func (instruction x86Instruction) immediateWidth(spec string) int {
+	if instruction.opcodeMap == x86MapPrimary {
+		switch instruction.opcode {
+		case 0x68, 0x6a:
+			return 8
+		case 0xe4, 0xe5, 0xe6, 0xe7, 0xcd:
+			return 1
+		}
+	}
+	switch destination := instruction.form.specs[0]; {
+	case destination == "AL":
+		return 1
+	case destination == "rAX":
+		return instruction.operandSizeV()
+	case destination[0] == 'E' || destination[0] == 'G' || destination[0] == 'Z':
+		return instruction.operandBytes(destination)
+	}
+	return instruction.operandBytes(spec)
+}
+
+func (instruction x86Instruction) memoryText() string {
+	addressSize := 8
+	if instruction.addressSize32 {
+		addressSize = 4
+	}
+	mod, rm := instruction.modRM>>6, int(instruction.modRM&7)
+	rexX := int(instruction.rex>>1) & 1
+	rexB := int(instruction.rex) & 1
+
+	segment := map[byte]string{0x26: "es:", 0x2e: "cs:", 0x36: "ss:", 0x3e: "ds:", 0x64: "fs:", 0x65: "gs:"}[instruction.segmentPrefix]
+	terms := make([]string, 0, 2)
+	switch {
+	case mod == 0 && rm == 5:
+		if addressSize == 4 {
+			terms = append(terms, "eip")
+		} else {
+			terms = append(terms, "rip")
+		}
+	case instruction.hasSIB:
+		base := int(instruction.sib&7) | rexB<<3
+		index := int(instruction.sib>>3&7) | rexX<<3
+		scale := 1 << (instruction.sib >> 6)
+		if !(mod == 0 && base&7 == 5) {
+			terms = append(terms, x86RegisterName(base, addressSize, true))
+		}
+		if index != 4 {
+			term := x86RegisterName(index, addressSize, true)
+			if scale > 1 {
+				term += fmt.Sprintf("*%d", scale)
+			}
+			terms = append(terms, term)
+		}
+	default:
+		terms = append(terms, x86RegisterName(rm|rexB<<3, addressSize, true))
+	}
+
+	address := strings.Join(terms, "+")
+	switch {
+	case address == "":
+		address = fmt.Sprintf("0x%X", uint32(instruction.displacement))
+	case instruction.displacement > 0:
+		address += fmt.Sprintf("+0x%X", instruction.displacement)
+	case instruction.displacement < 0:
+		address += fmt.Sprintf("-0x%X", -instruction.displacement)
+	}
+	return segment + "[" + address + "]"
+}
+
+func x86SizeName(size int) string {
+	switch size {
+	case 1:
+		return "byte"
+	case 2:
+		return "word"
+	case 4:
+		return "dword"
+	case 8:
+		return "qword"
+	}
+	return "xmmword"
+}
+
+func x86RegisterName(number int, size int, rex bool) string {
+	general := []string{"ax", "cx", "dx", "bx", "sp", "bp", "si", "di"}
+	if number >= 8 {
+		switch size {
+		case 1:
+			return fmt.Sprintf("r%db", number)
+		case 2:
+			return fmt.Sprintf("r%dw", number)
+		case 4:
+			return fmt.Sprintf("r%dd", number)
+		}
+		return fmt.Sprintf("r%d", number)
+	}
+	switch size {
+	case 1:
+		if number >= 4 && !rex {
+			return []string{"ah", "ch", "dh", "bh"}[number-4]
+		}
+		return []string{"al", "cl", "dl", "bl", "spl", "bpl", "sil", "dil"}[number]
+	case 2:
+		return general[number]
+	case 4:
+		return "e" + general[number]
+	}
+	return "r" + general[number]
+}
+
+// disassembleX86 sweeps linearly from start to end. Bytes that do not decode
+// become one-byte invalid entries so the listing always covers the range.
+func disassembleX86(data []byte, start int, end int) []x86Instruction {
+	instructions := make([]x86Instruction, 0)
+	if end > len(data) {
+		end = len(data)
+	}
+	for offset := start; offset >= 0 && offset < end; {
+		instruction, ok := decodeX86(data, offset, end)
+		if !ok {
+			instruction = x86Instruction{offset: offset, length: 1, invalid: true}
+		}
+		instructions = append(instructions, instruction)
+		offset += instruction.length
+	}
+	return instructions
+}
+
+// decodeX86Body decodes exactly length bytes at offset and indexes the
+// instructions by their position in the body. It fails when any instruction
+// is invalid or runs past the end.
+func decodeX86Body(data []byte, offset int, length int) (map[int]x86Instruction, bool) {
+	body := make(map[int]x86Instruction)
+	end := offset + length
+	for position := offset; position < end; {
+		instruction, ok := decodeX86(data, position, end)
+		if !ok {
+			return nil, false
+		}
+		body[position-offset] = instruction
+		position += instruction.length
+	}
+	return body, true
+}
+
+// syncX86Sweep finds the earliest start in [from, candidates[0]] whose clean
+// linear sweep lands exactly on one of the ascending candidates, and returns
+// that start and the candidate reached. x86 decoding resynchronizes within a
+// few instructions, so an early start recovers the real boundary even when
+// prefix bytes could be read as part of several instructions.
+func syncX86Sweep(data []byte, from int, candidates []int) (int, int) {
+	first := candidates[0]
+	if from < 0 {
+		from = 0
+	}
+	for start := from; start < first; start++ {
+		position := start
+		for position < first {
+			instruction, ok := decodeX86(data, position, len(data))
+			if !ok {
+				break
+			}
+			position += instruction.length
+		}
+		for _, candidate := range candidates {
+			if position == candidate {
+				return start, candidate
+			}
+		}
+	}
+	return first, first
+}
+
+// x86SyncStart returns where a sweep towards offset should begin: the entry
+// of the runtime function containing it when one is known, else up to
+// x86SyncWindow bytes earlier within the same section.
+func (peData peInfo) x86SyncStart(offset int) int {
+	section, ok := peData.sectionForOffset(offset)
+	if !ok {
+		return offset
+	}
+	if rva, ok := peData.rvaForOffset(offset); ok {
+		if function, ok := peData.runtimeFunctionContainingRVA(rva); ok {
+			if begin, ok := peData.offsetForRVA(function.beginRVA); ok && begin >= section.rawStart && begin <= offset {
+				return begin
+			}
+		}
+	}
+	start := offset - x86SyncWindow
+	if start < section.rawStart {
+		start = section.rawStart
+	}
+	return start
+}
+
+// x86TargetRVA returns the RVA a decoded instruction points at: its
+// RIP-relative memory operand, else its relative branch target.
+func (peData peInfo) x86TargetRVA(instruction x86Instruction) (int, bool) {
+	if !instruction.ripRelative() && !instruction.relativeBranch {
+		return 0, false
+	}
+	rva, ok := peData.rvaForOffset(instruction.offset)
+	if !ok {
+		return 0, false
+	}
+	if instruction.ripRelative() {
+		return rva + instruction.length + int(instruction.displacement), true
+	}
+	return rva + instruction.length + int(instruction.immediate), true
+}
+
+// findRIPRelativeReferences scans code sections for instructions whose
+// RIP-relative memory operand targets targetRVA. Decodes that share a
+// displacement, such as a REX-prefixed hit and the hit one byte later, are
+// resolved to the boundary a linear sweep lands on.
+func findRIPRelativeReferences(tibiaBinary []byte, peData peInfo, targetRVA int) []x86Instruction {
+	references := make([]x86Instruction, 0)
+	for _, section := range peData.sections {
+		if !section.isCode {
+			continue
+		}
+		end := section.rawEnd
+		if end > len(tibiaBinary) {
+			end = len(tibiaBinary)
+		}
+		for modRMOffset := section.rawStart + 1; modRMOffset+5 <= end; modRMOffset++ {
+			if tibiaBinary[modRMOffset]&0xc7 != 0x05 {
+				continue
+			}
+			// The displacement is followed by at most four immediate bytes.
+			displacementRVA := section.rvaStart + modRMOffset + 1 - section.rawStart
+			reach := targetRVA - displacementRVA - 4 - int(int32(binary.LittleEndian.Uint32(tibiaBinary[modRMOffset+1:])))
+			if reach != 0 && reach != 1 && reach != 2 && reach != 4 {
+				continue
+			}
+
+			candidates := make([]int, 0, 2)
+			decoded := make(map[int]x86Instruction)
+			for start := modRMOffset - x86MaxInstructionLength + 5; start < modRMOffset; start++ {
+				if start < section.rawStart {
+					continue
+				}
+				instruction, ok := decodeX86(tibiaBinary, start, end)
+				if !ok || !instruction.ripRelative() || start+instruction.displacementOffset != modRMOffset+1 {
+					continue
+				}
+				if target, ok := peData.x86TargetRVA(instruction); !ok || target != targetRVA {
+					continue
+				}
+				candidates = append(candidates, start)
+				decoded[start] = instruction
+			}
+			if len(candidates) == 0 {
+				continue
+			}
+			_, chosen := syncX86Sweep(tibiaBinary, peData.x86SyncStart(candidates[0]), candidates)
+			references = append(references, decoded[chosen])
+		}
+	}
+	return references
+}
+
+// x86Listing formats instructions as "offset  bytes  text" lines. The
+// instruction at marker is flagged, and RIP-relative and branch targets are
+// resolved to file offsets, with C strings shown inline.
+func x86Listing(tibiaBinary []byte, peData peInfo, instructions []x86Instruction, marker int) []string {
+	lines := make([]string, 0, len(instructions))
+	for _, instruction := range instructions {
+		flag := "  "
+		if instruction.offset == marker {
+			flag = "=>"
+		}
+		encoded := make([]string, 0, instruction.length)
+		for _, value := range tibiaBinary[instruction.offset : instruction.offset+instruction.length] {
+			encoded = append(encoded, fmt.Sprintf("%02X", value))
+		}
+		line := fmt.Sprintf("%s 0x%X: %-24s %s", flag, instruction.offset, strings.Join(encoded, " "), instruction.text())
+		lines = append(lines, strings.TrimRight(line+x86TargetText(tibiaBinary, peData, instruction), " "))
+	}
+	return lines
+}
+
+// x86Summary formats instructions as "offset: text" entries for the
+// possibleInstructions field of the diagnose log lines, with targets
+// resolved as in x86Listing.
+func x86Summary(tibiaBinary []byte, peData peInfo, instructions []x86Instruction) []string {
+	entries := make([]string, 0, len(instructions))
+	for _, instruction := range instructions {
+		entries = append(entries, fmt.Sprintf("0x%X: %s%s", instruction.offset, instruction.text(), x86TargetText(tibiaBinary, peData, instruction)))
+	}
+	return entries
+}
+
+func x86TargetText(tibiaBinary []byte, peData peInfo, instruction x86Instruction) string {
+	targetRVA, ok := peData.x86TargetRVA(instruction)
+	if !ok {
+		return ""
+	}
+	targetOffset, ok := peData.offsetForRVA(targetRVA)
+	if !ok {
+		return fmt.Sprintf(" -> RVA 0x%X", targetRVA)
+	}
+	text := fmt.Sprintf(" -> 0x%X", targetOffset)
+	if value, ok := cStringAt(tibiaBinary, peData, targetOffset); ok {
+		text += fmt.Sprintf(" %q", value)
+	}
+	return text
+}
+
+// cStringAt returns the printable NUL-terminated string at offset in a
+// non-code section, shortened for listings.
+func cStringAt(tibiaBinary []byte, peData peInfo, offset int) (string, bool) {
+	const minimumLength, maximumLength = 4, 48
+	section, ok := peData.sectionForOffset(offset)
+	if !ok || section.isCode {
+		return "", false
+	}
+	for end := offset; end < section.rawEnd && end < len(tibiaBinary); end++ {
+		value := tibiaBinary[end]
+		switch {
+		case value == 0:
+			return string(tibiaBinary[offset:end]), end-offset >= minimumLength
+		case value < 0x20 || value > 0x7e:
+			return "", false
+		case end-offset == maximumLength:
+			return string(tibiaBinary[offset:end]) + "...", true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,133 @@
+package edit
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestDecodeX86LengthsAndText(t *testing.T) {
+	for _, test := range []struct {
+		encoded []byte
+		text    string
+	}{
+		{[]byte{0x48, 0x83, 0x45, 0x9f, 0x48}, "add qword ptr [rbp-0x61],0x48"},
+		{[]byte{0xeb, 0x10}, "jmp $+0x12"},
+		{[]byte{0x4c, 0x8d, 0x45, 0xb7}, "lea r8,[rbp-0x49]"},
+		{[]byte{0x48, 0x8b, 0xd3}, "mov rdx,rbx"},
+		{[]byte{0x48, 0x8b, 0xbf, 0x30, 0x0a, 0x00, 0x00}, "mov rdi,[rdi+0xA30]"},
+		{[]byte{0x41, 0xb8, 0xff, 0xff, 0xff, 0xff}, "mov r8d,0xFFFFFFFF"},
+		{[]byte{0xe8, 0xfb, 0xff, 0xff, 0xff}, "call $+0x0"},
+		{[]byte{0xff, 0x15, 0x10, 0x00, 0x00, 0x00}, "call qword ptr [rip+0x10]"},
+		{[]byte{0x48, 0xff, 0x25, 0xf0, 0xff, 0xff, 0xff}, "jmp qword ptr [rip-0x10]"},
+		{[]byte{0x0f, 0x84, 0x10, 0x00, 0x00, 0x00}, "je $+0x16"},
+		{[]byte{0x66, 0x0f, 0x1f, 0x44, 0x00, 0x00}, "nop word ptr [rax+rax]"},
+		{[]byte{0x48, 0xb8, 0x88, 0x77, 0x66, 0x55, 0x44, 0x33, 0x22, 0x11}, "mov rax,0x1122334455667788"},
+		{[]byte{0xf3, 0x0f, 0x10, 0x05, 0x00, 0x01, 0x00, 0x00}, "movss xmm0,[rip+0x100]"},
+		{[]byte{0x0f, 0xb6, 0x44, 0x24, 0x30}, "movzx eax,byte ptr [rsp+0x30]"},
+		{[]byte{0xf3, 0x48, 0xab}, "rep stosq"},
+		{[]byte{0xf7, 0xc1, 0x00, 0x01, 0x00, 0x00}, "test ecx,0x100"},
+		{[]byte{0x66, 0xc7, 0x45, 0xf0, 0x34, 0x12}, "mov word ptr [rbp-0x10],0x1234"},
+		{[]byte{0x48, 0x83, 0xf8, 0xff}, "cmp rax,0xFFFFFFFFFFFFFFFF"},
+		{[]byte{0x65, 0x48, 0x8b, 0x04, 0x25, 0x30, 0x00, 0x00, 0x00}, "mov rax,gs:[0x30]"},
+		{[]byte{0xf3, 0x0f, 0x1e, 0xfa}, "endbr64"},
+		{[]byte{0xc5, 0xf8, 0x77}, "(vex 0F 77)"},
+		{[]byte{0xc4, 0xe3, 0x7d, 0x18, 0xc1, 0x01}, "(vex 0F3A 18)"},
+	} {
+		instruction, ok := decodeX86(test.encoded, 0, len(test.encoded))
+		if !ok || instruction.length != len(test.encoded) || instruction.text() != test.text {
+			t.Fatalf("decoding % X: got %q length %d ok=%t, expected %q length %d", test.encoded, instruction.text(), instruction.length, ok, test.text, len(test.encoded))
+		}
+	}
+
+	for _, encoded := range [][]byte{
+		{0x06},
+		{0xff, 0xff},
+		{0x48, 0x8d, 0x05, 0x00},
+		{0x0f, 0x0c},
+		{0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x90},
+	} {
+		if instruction, ok := decodeX86(encoded, 0, len(encoded)); ok {
+			t.Fatalf("expected % X to be rejected, decoded %q", encoded, instruction.text())
+		}
+	}
+}
+
+func TestDecodeX86StructuralPatternsAtRecordedBoundaries(t *testing.T) {
+	body, ok := decodeX86Body(structuralClientCheckDisconnectedPattern.data, 0, 99)
+	if !ok || len(body) != 23 {
+		t.Fatalf("expected the dispatch path to decode into 23 instructions, got %d ok=%t", len(body), ok)
+	}
+	for position, mnemonic := range map[int]string{18: "call", 23: "mov", 36: "lea", 47: "call", 62: "lea", 73: "call", 93: "call"} {
+		if body[position].mnemonic() != mnemonic {
+			t.Fatalf("expected %s at +%d, got %q", mnemonic, position, body[position].text())
+		}
+	}
+	if !body[47].ripRelative() || !body[93].relativeBranch {
+		t.Fatalf("expected an indirect IAT call at +47 and a direct call at +93")
+	}
+
+	patched := make([]byte, len(structuralClientCheckDisconnectedReplacement))
+	for index, value := range structuralClientCheckDisconnectedReplacement {
+		if value != wildcardByte {
+			patched[index] = byte(value)
+		}
+	}
+	if body, ok := decodeX86Body(patched, 0, 99); !ok || !body[93].isNop() || !body[97].isNop() {
+		t.Fatalf("expected the neutralized dispatch call to decode as NOPs")
+	}
+
+	body, ok = decodeX86Body(structuralEnableClientCheckPattern.data, 0, 44)
+	if !ok || body[18].mnemonic() != "call" || body[35].mnemonic() != "jmp" || body[40].mnemonic() != "int3" {
+		t.Fatalf("unexpected enableClientCheck wrapper decode %+v", body)
+	}
+}
+
+func TestFindRIPRelativeReferencesFollowsInstructionBoundaries(t *testing.T) {
+	peData := peInfo{
+		valid: true,
+		sections: []peSectionInfo{
+			{name: ".text", rawStart: 0x100, rawEnd: 0x140, rvaStart: 0x1000, rvaEnd: 0x1040, isCode: true},
+			{name: ".rdata", rawStart: 0x200, rawEnd: 0x240, rvaStart: 0x2000, rvaEnd: 0x2040},
+		},
+	}
+	tibiaBinary := make([]byte, 0x240)
+	for index := 0x100; index < 0x140; index++ {
+		tibiaBinary[index] = 0xcc
+	}
+	copy(tibiaBinary[0x200:], []byte("clientcheck_disconnected\x00"))
+
+	// add eax,0x48 leaves a REX-looking byte right before an unprefixed LEA;
+	// the second reference is a real REX.W LEA after a NOP.
+	code := []byte{
+		0x83, 0xc0, 0x48, 0x8d, 0x0d, 0, 0, 0, 0,
+		0x90, 0x48, 0x8d, 0x15, 0, 0, 0, 0,
+		0x75, 0x02, 0xe8, 0x00, 0x00, 0x00, 0x00,
+	}
+	copy(tibiaBinary[0x100:], code)
+	binary.LittleEndian.PutUint32(tibiaBinary[0x105:], uint32(0x2000-(0x1003+6)))
+	binary.LittleEndian.PutUint32(tibiaBinary[0x10d:], uint32(0x2000-(0x100a+7)))
+
+	references := findRIPRelativeReferences(tibiaBinary, peData, 0x2000)
+	if len(references) != 2 || references[0].offset != 0x103 || references[1].offset != 0x10a {
+		t.Fatalf("expected references at 0x103 and 0x10A, got %+v", references)
+	}
+	if references[0].text() != "lea ecx,[rip+0xFF7]" || !references[1].isAddressLoad() || references[1].text() != "lea rdx,[rip+0xFEF]" {
+		t.Fatalf("unexpected reference text %q and %q", references[0].text(), references[1].text())
+	}
+
+	instructions := disassembleX86(tibiaBinary, 0x100, 0x118)
+	branches, calls := findBranchesAndCalls(instructions)
+	if len(branches) != 1 || branches[0] != 0x111 || len(calls) != 1 || calls[0] != 0x113 {
+		t.Fatalf("expected one branch at 0x111 and one call at 0x113, got %v %v", branches, calls)
+	}
+
+	listing := x86Listing(tibiaBinary, peData, instructions, 0x10a)
+	if len(listing) != len(instructions) || !strings.HasPrefix(listing[3], "=> 0x10A: 48 8D 15") || !strings.HasSuffix(listing[3], `-> 0x200 "clientcheck_disconnected"`) {
+		t.Fatalf("unexpected listing %q", listing)
+	}
+	summary := x86Summary(tibiaBinary, peData, instructions)
+	if len(summary) != len(instructions) || summary[3] != `0x10A: lea rdx,[rip+0xFEF] -> 0x200 "clientcheck_disconnected"` {
+		t.Fatalf("unexpected possible instructions %q", summary)
+	}
+}
@@ -0,0 +1,395 @@
+package edit
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type xrefKind uint8
+
+const (
+	xrefCall xrefKind = iota
+	xrefJump
+	xrefImportCall
+	xrefImportJump
+	xrefAddress
+	xrefData
+)
+
+func (kind xrefKind) String() string {
+	switch kind {
+	case xrefCall:
+		return "call"
+	case xrefJump:
+		return "jump"
+	case xrefImportCall:
+		return "import-call"
+	case xrefImportJump:
+		return "import-jump"
+	case xrefAddress:
+		return "address"
+	default:
+		return "data"
+	}
+}
+
+// xrefEdge is one instruction that calls, tail-jumps to or addresses target.
+type xrefEdge struct {
+	offset int
+	rva    int
+	target int
+	kind   xrefKind
+}
+
+// xrefIndex holds every code reference of a binary, sorted by target. It is
+// built once by decoding the code sections and answers string, function and
+// import queries without rescanning.
+type xrefIndex struct {
+	peData peInfo
+	edges  []xrefEdge
+}
+
+// XrefOptions selects what the xrefs command looks up. String, RVA and Import
+// are alternatives; RVA accepts decimal or 0x-prefixed hex and is a virtual
+// address for ELF and Mach-O clients.
+type XrefOptions struct {
+	TibiaExe string
+	String   string
+	RVA      string
+	Import   string
+}
+
+// buildXrefIndex decodes each code section linearly and restarts at every
+// runtime function entry, so functions are decoded from their real first
+// instruction while leaf functions without unwind data are still covered.
+// Conditional and intra-function branches are left out.
+func buildXrefIndex(tibiaBinary []byte, peData peInfo) xrefIndex {
+	index := xrefIndex{peData: peData, edges: make([]xrefEdge, 0)}
+	for _, section := range peData.sections {
+		if !section.isCode {
+			continue
+		}
+		end := section.rawEnd
+		if end > len(tibiaBinary) {
+			end = len(tibiaBinary)
+		}
+		starts := make([]int, 0)
+		for _, function := range peData.runtimeFunctions {
+			if start, ok := peData.offsetForRVA(function.beginRVA); ok && start >= section.rawStart && start < end {
+				starts = append(starts, start)
+			}
+		}
+		sort.Ints(starts)
+
+		next := 0
+		for position := section.rawStart; position < end; {
+			if next < len(starts) && starts[next] <= position {
+				position = starts[next]
+				next++
+				continue
+			}
+			instruction, ok := decodeX86(tibiaBinary, position, end)
+			if !ok {
+				position++
+				continue
+			}
+			rva := section.rvaStart + position - section.rawStart
+			if target, kind, ok := index.classify(instruction, rva); ok {
+				index.edges = append(index.edges, xrefEdge{offset: position, rva: rva, target: target, kind: kind})
+			}
+			position += instruction.length
+		}
+	}
+	sort.SliceStable(index.edges, func(left, right int) bool {
+		return index.edges[left].target < index.edges[right].target
+	})
+	return index
+}
+
+func (index xrefIndex) classify(instruction x86Instruction, rva int) (int, xrefKind, bool) {
+	if !instruction.ripRelative() && !instruction.relativeBranch {
+		return 0, 0, false
+	}
+	target := rva + instruction.length
+	if instruction.ripRelative() {
+		target += int(instruction.displacement)
+		_, isImport := index.peData.importSlots[target]
+		switch {
+		case isImport && instruction.isCall():
+			return target, xrefImportCall, true
+		case isImport && instruction.mnemonic() == "jmp":
+			return target, xrefImportJump, true
+		case instruction.isAddressLoad():
+			return target, xrefAddress, true
+		}
+		return target, xrefData, true
+	}
+
+	target += int(instruction.immediate)
+	switch {
+	case instruction.isCall():
+		return target, xrefCall, true
+	case instruction.mnemonic() == "jmp":
+		// Only jumps that leave the function are tail calls.
+		if function, ok := index.peData.runtimeFunctionContainingRVA(rva); ok && target >= function.beginRVA && target < function.endRVA {
+			return 0, 0, false
+		}
+		return target, xrefJump, true
+	}
+	return 0, 0, false
+}
+
+// referencesTo returns every edge whose target is rva.
+func (index xrefIndex) referencesTo(rva int) []xrefEdge {
+	first := sort.Search(len(index.edges), func(position int) bool {
+		return index.edges[position].target >= rva
+	})
+	last := first
+	for last < len(index.edges) && index.edges[last].target == rva {
+		last++
+	}
+	return index.edges[first:last]
+}
+
+// importCallers returns the import slots whose name contains name, each with
+// the instructions that call or load it. Callers of a jump thunk through the
+// slot are included as calls to the thunk.
+func (index xrefIndex) importCallers(tibiaBinary []byte, name string) map[int][]xrefEdge {
+	lowerName := strings.ToLower(name)
+	callers := make(map[int][]xrefEdge)
+	for slot, slotName := range index.peData.importSlots {
+		if !strings.Contains(strings.ToLower(slotName), lowerName) {
+			continue
+		}
+		edges := append([]xrefEdge(nil), index.referencesTo(slot)...)
+		for _, edge := range index.referencesTo(slot) {
+			if edge.kind != xrefImportJump {
+				continue
+			}
+			thunkRVA := edge.rva
+			if edge.offset >= 4 && bytes.Equal(tibiaBinary[edge.offset-4:edge.offset], []byte{0xf3, 0x0f, 0x1e, 0xfa}) {
+				thunkRVA -= 4
+			}
+			for _, caller := range index.referencesTo(thunkRVA) {
+				if caller.kind == xrefCall || caller.kind == xrefJump {
+					edges = append(edges, caller)
+				}
+			}
+		}
+		callers[slot] = edges
+	}
+	return callers
+}
+
+// functionLabel names the function containing rva, using a symbol when the
+// format provides one, with the distance from its entry.
+func (peData peInfo) functionLabel(rva int) string {
+	function, ok := peData.runtimeFunctionContainingRVA(rva)
+	if !ok {
+		return "no function"
+	}
+	label := fmt.Sprintf("sub_%X", function.beginRVA)
+	for _, symbol := range peData.symbols {
+		if symbol.beginRVA == function.beginRVA && symbol.name != "" {
+			label = symbol.name
+			break
+		}
+	}
+	if rva != function.beginRVA {
+		label += fmt.Sprintf("+0x%X", rva-function.beginRVA)
+	}
+	return label
+}
+
+// stringOccurrences returns the offsets of value as a NUL-terminated ASCII
+// and UTF-16LE string outside code, keyed by encoding.
+func stringOccurrences(tibiaBinary []byte, peData peInfo, value string) map[string][]int {
+	occurrences := make(map[string][]int)
+	needles := map[string][]byte{
+		"ascii":    append([]byte(value), 0),
+		"utf16-le": append(utf16LEBytes(value), 0, 0),
+	}
+	for encoding, needle := range needles {
+		for _, offset := range findAllOffsets(tibiaBinary, needle) {
+			if section, ok := peData.sectionForOffset(offset); ok && !section.isCode {
+				occurrences[encoding] = append(occurrences[encoding], offset)
+			}
+		}
+	}
+	return occurrences
+}
+
+// peImportSlots maps each import address table slot to "library!symbol",
+// or "library!#ordinal" for imports by ordinal.
+func peImportSlots(tibiaBinary []byte, peData peInfo, directoryRVA int, thunkSize int) map[int]string {
+	slots := make(map[int]string)
+	descriptorOffset, ok := peData.offsetForRVA(directoryRVA)
+	if directoryRVA == 0 || !ok {
+		return slots
+	}
+	ordinalFlag := uint64(1) << (uint(thunkSize)*8 - 1)
+	for ; descriptorOffset+20 <= len(tibiaBinary); descriptorOffset += 20 {
+		lookupRVA := int(binary.LittleEndian.Uint32(tibiaBinary[descriptorOffset:]))
+		nameRVA := int(binary.LittleEndian.Uint32(tibiaBinary[descriptorOffset+12:]))
+		firstThunkRVA := int(binary.LittleEndian.Uint32(tibiaBinary[descriptorOffset+16:]))
+		if lookupRVA == 0 && nameRVA == 0 && firstThunkRVA == 0 {
+			break
+		}
+		library := peCStringAtRVA(tibiaBinary, peData, nameRVA)
+		if lookupRVA == 0 {
+			lookupRVA = firstThunkRVA
+		}
+		lookupOffset, ok := peData.offsetForRVA(lookupRVA)
+		for entryIndex := 0; ok && lookupOffset+(entryIndex+1)*thunkSize <= len(tibiaBinary); entryIndex++ {
+			entryOffset := lookupOffset + entryIndex*thunkSize
+			entry := uint64(binary.LittleEndian.Uint32(tibiaBinary[entryOffset:]))
+			if thunkSize == 8 {
+				entry = binary.LittleEndian.Uint64(tibiaBinary[entryOffset:])
+			}
+			if entry == 0 {
+				break
+			}
+			symbol := fmt.Sprintf("#%d", entry&0xffff)
+			if entry&ordinalFlag == 0 {
+				symbol = peCStringAtRVA(tibiaBinary, peData, int(entry&0x7fffffff)+2)
+			}
+			slots[firstThunkRVA+entryIndex*thunkSize] = library + "!" + symbol
+		}
+	}
+	return slots
+}
+
+func peCStringAtRVA(tibiaBinary []byte, peData peInfo, rva int) string {
+	const maximumLength = 512
+	offset, ok := peData.offsetForRVA(rva)
+	if !ok || offset >= len(tibiaBinary) {
+		return ""
+	}
+	end := offset + maximumLength
+	if end > len(tibiaBinary) {
+		end = len(tibiaBinary)
+	}
+	if terminator := bytes.IndexByte(tibiaBinary[offset:end], 0); terminator != -1 {
+		end = offset + terminator
+	}
+	return string(tibiaBinary[offset:end])
+}
+
+// elfImportSlots maps each GOT slot filled by a JUMP_SLOT or GLOB_DAT
+// relocation to its dynamic symbol.
+func elfImportSlots(elfFile *elf.File) map[int]string {
+	slots := make(map[int]string)
+	symbols, err := elfFile.DynamicSymbols()
+	if err != nil || elfFile.Class != elf.ELFCLASS64 || elfFile.Machine != elf.EM_X86_64 {
+		return slots
+	}
+	for _, section := range elfFile.Sections {
+		if section.Type != elf.SHT_RELA {
+			continue
+		}
+		data, err := section.Data()
+		if err != nil {
+			continue
+		}
+		for offset := 0; offset+24 <= len(data); offset += 24 {
+			address := binary.LittleEndian.Uint64(data[offset:])
+			info := binary.LittleEndian.Uint64(data[offset+8:])
+			relocationType := elf.R_X86_64(info & 0xffffffff)
+			symbolIndex := int(info >> 32)
+			if (relocationType != elf.R_X86_64_JMP_SLOT && relocationType != elf.R_X86_64_GLOB_DAT) || symbolIndex == 0 || symbolIndex > len(symbols) {
+				continue
+			}
+			symbol := symbols[symbolIndex-1]
+			name := symbol.Name
+			if symbol.Library != "" {
+				name = symbol.Library + "!" + name
+			}
+			slots[int(address)] = name
+		}
+	}
+	return slots
+}
+
+func Xrefs(options XrefOptions) {
+	queries := 0
+	for _, query := range []string{options.String, options.RVA, options.Import} {
+		if query != "" {
+			queries++
+		}
+	}
+	if queries != 1 {
+		fmt.Printf("[ERROR] Pass exactly one of --string, --rva or --import\n")
+		os.Exit(1)
+	}
+
+	tibiaBinary, err := os.ReadFile(options.TibiaExe)
+	if err != nil {
+		fmt.Printf("[ERROR] Unable to read %s: %s\n", options.TibiaExe, err)
+		os.Exit(1)
+	}
+	peData := inspectExecutable(tibiaBinary)
+	if !peData.valid {
+		fmt.Printf("[ERROR] Unable to parse %s: %s\n", options.TibiaExe, peData.errorText)
+		os.Exit(1)
+	}
+	index := buildXrefIndex(tibiaBinary, peData)
+	fmt.Printf("[INFO] Indexed %d code reference(s) across %d function(s) and %d import slot(s)\n", len(index.edges), len(peData.runtimeFunctions), len(peData.importSlots))
+
+	switch {
+	case options.String != "":
+		occurrences := stringOccurrences(tibiaBinary, peData, options.String)
+		if len(occurrences) == 0 {
+			fmt.Printf("[WARN] %q does not occur as a string outside code\n", options.String)
+			return
+		}
+		for _, encoding := range []string{"ascii", "utf16-le"} {
+			for _, offset := range occurrences[encoding] {
+				rva, _ := peData.rvaForOffset(offset)
+				references := index.referencesTo(rva)
+				fmt.Printf("[INFO] %q (%s) @0x%X RVA 0x%X: %d reference(s)\n", options.String, encoding, offset, rva, len(references))
+				printXrefEdges(tibiaBinary, peData, references)
+			}
+		}
+	case options.RVA != "":
+		rva, err := strconv.ParseInt(options.RVA, 0, 64)
+		if err != nil {
+			fmt.Printf("[ERROR] Invalid RVA %q: %s\n", options.RVA, err)
+			os.Exit(1)
+		}
+		target := fmt.Sprintf("RVA 0x%X (%s)", rva, peData.functionLabel(int(rva)))
+		if name, ok := peData.importSlots[int(rva)]; ok {
+			target = fmt.Sprintf("import slot 0x%X (%s)", rva, name)
+		}
+		references := index.referencesTo(int(rva))
+		fmt.Printf("[INFO] %s: %d reference(s)\n", target, len(references))
+		printXrefEdges(tibiaBinary, peData, references)
+	default:
+		callers := index.importCallers(tibiaBinary, options.Import)
+		if len(callers) == 0 {
+			fmt.Printf("[WARN] No import slot matches %q\n", options.Import)
+			return
+		}
+		slots := make([]int, 0, len(callers))
+		for slot := range callers {
+			slots = append(slots, slot)
+		}
+		sort.Ints(slots)
+		for _, slot := range slots {
+			fmt.Printf("[INFO] %s (slot 0x%X): %d caller(s)\n", peData.importSlots[slot], slot, len(callers[slot]))
+			printXrefEdges(tibiaBinary, peData, callers[slot])
+		}
+	}
+}
+
+func printXrefEdges(tibiaBinary []byte, peData peInfo, edges []xrefEdge) {
+	for _, edge := range edges {
+		instruction, _ := decodeX86(tibiaBinary, edge.offset, len(tibiaBinary))
+		fmt.Printf("[INFO]   0x%X RVA 0x%X in %s %s: %s\n", edge.offset, edge.rva, peData.functionLabel(edge.rva), edge.kind, instruction.text())
+	}
+}
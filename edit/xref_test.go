@@ -0,0 +1,101 @@
+package edit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestXrefIndexResolvesStringsCallsAndImports(t *testing.T) {
+	tibiaBinary, peData := newXrefFixture(t)
+	if name := peData.importSlots[0x2160]; name != "KERNEL32.dll!GetProcAddress" {
+		t.Fatalf("expected the IAT slot to resolve to GetProcAddress, got %q in %v", name, peData.importSlots)
+	}
+	index := buildXrefIndex(tibiaBinary, peData)
+
+	occurrences := stringOccurrences(tibiaBinary, peData, "clientcheck_disconnected")
+	if len(occurrences["ascii"]) != 1 || len(occurrences["utf16-le"]) != 1 {
+		t.Fatalf("expected one ASCII and one UTF-16 occurrence, got %v", occurrences)
+	}
+	for encoding, referenceOffset := range map[string]int{"ascii": 0x400, "utf16-le": 0x460} {
+		stringRVA, _ := peData.rvaForOffset(occurrences[encoding][0])
+		references := index.referencesTo(stringRVA)
+		if len(references) != 1 || references[0].offset != referenceOffset || references[0].kind != xrefAddress {
+			t.Fatalf("expected the %s string to be loaded at 0x%X, got %+v", encoding, referenceOffset, references)
+		}
+	}
+
+	callers := index.referencesTo(0x1040)
+	if len(callers) != 2 || callers[0].kind != xrefCall || callers[1].kind != xrefCall || peData.functionLabel(callers[1].rva) != "sub_1060+0x7" {
+		t.Fatalf("expected two direct calls to the thunk, got %+v", callers)
+	}
+	for _, edge := range index.edges {
+		if edge.offset == 0x416 {
+			t.Fatalf("expected the jump inside the function to be left out, got %+v", edge)
+		}
+	}
+
+	importCallers := index.importCallers(tibiaBinary, "getprocaddress")
+	kinds := make([]xrefKind, 0)
+	for _, edge := range importCallers[0x2160] {
+		kinds = append(kinds, edge.kind)
+	}
+	if len(importCallers) != 1 || len(kinds) != 4 || kinds[0] != xrefImportCall || kinds[1] != xrefImportJump || kinds[2] != xrefCall || kinds[3] != xrefCall {
+		t.Fatalf("expected the IAT call, the thunk jump and both thunk callers, got %+v", importCallers)
+	}
+}
+
+func TestFindStringCodeReferencesUsesXrefIndex(t *testing.T) {
+	tibiaBinary, peData := newXrefFixture(t)
+	index := buildXrefIndex(tibiaBinary, peData)
+
+	references := findStringCodeReferences(tibiaBinary, peData, index, clientCheckCodePatterns, nil, "clientcheck_disconnected", 0x620)
+	if len(references) != 1 || references[0].offset != 0x400 || references[0].instruction != "lea rdx,[rip+0x1019]" {
+		t.Fatalf("expected the LEA at 0x400, got %+v", references)
+	}
+}
+
+// newXrefFixture builds a PE with three functions: 0x1000 loads the ASCII
+// string and calls both GetProcAddress directly and the jump thunk at 0x1040;
+// 0x1060 starts right after a stray call opcode, loads the UTF-16 string and
+// calls the thunk.
+func newXrefFixture(t *testing.T) ([]byte, peInfo) {
+	t.Helper()
+	tibiaBinary := newRelocationFixture(t)
+	copy(tibiaBinary[0x400:0x600], bytes.Repeat([]byte{0xcc}, 0x200))
+	copy(tibiaBinary[0x600:0x800], make([]byte, 0x200))
+
+	copy(tibiaBinary[0x620:], "clientcheck_disconnected\x00")
+	copy(tibiaBinary[0x660:], append(utf16LEBytes("clientcheck_disconnected"), 0, 0))
+	binary.LittleEndian.PutUint32(tibiaBinary[0x700:], 0x2140)
+	binary.LittleEndian.PutUint32(tibiaBinary[0x70c:], 0x2180)
+	binary.LittleEndian.PutUint32(tibiaBinary[0x710:], 0x2160)
+	binary.LittleEndian.PutUint64(tibiaBinary[0x740:], 0x21a0)
+	binary.LittleEndian.PutUint64(tibiaBinary[0x760:], 0x21a0)
+	copy(tibiaBinary[0x780:], "KERNEL32.dll\x00")
+	copy(tibiaBinary[0x7a2:], "GetProcAddress\x00")
+	setFixtureDataDirectory(tibiaBinary, 1, 0x2100, 40)
+
+	writeXrefInstruction(tibiaBinary, 0x400, []byte{0x48, 0x8d, 0x15}, 0x2020)
+	writeXrefInstruction(tibiaBinary, 0x407, []byte{0xe8}, 0x1040)
+	writeXrefInstruction(tibiaBinary, 0x40c, []byte{0xff, 0x15}, 0x2160)
+	copy(tibiaBinary[0x412:], []byte{0x85, 0xc0, 0x74, 0x02, 0xeb, 0x00, 0xc3})
+	writeXrefInstruction(tibiaBinary, 0x440, []byte{0xff, 0x25}, 0x2160)
+	tibiaBinary[0x45f] = 0xe8
+	writeXrefInstruction(tibiaBinary, 0x460, []byte{0x48, 0x8d, 0x0d}, 0x2060)
+	writeXrefInstruction(tibiaBinary, 0x467, []byte{0xe8}, 0x1040)
+	tibiaBinary[0x46c] = 0xc3
+
+	peData := inspectExecutable(tibiaBinary)
+	if !peData.valid {
+		t.Fatalf("expected a valid fixture: %s", peData.errorText)
+	}
+	peData.runtimeFunctions = []peRuntimeFunction{{beginRVA: 0x1000, endRVA: 0x1019}, {beginRVA: 0x1040, endRVA: 0x1046}, {beginRVA: 0x1060, endRVA: 0x106d}}
+	return tibiaBinary, peData
+}
+
+func writeXrefInstruction(tibiaBinary []byte, offset int, opcode []byte, targetRVA int) {
+	copy(tibiaBinary[offset:], opcode)
+	end := offset + len(opcode) + 4
+	binary.LittleEndian.PutUint32(tibiaBinary[offset+len(opcode):], uint32(int32(targetRVA-(0x1000+end-0x400))))
+}
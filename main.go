@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"time"
 
 	"github.com/opentibiabr/client-editor/appearances"
 	"github.com/opentibiabr/client-editor/edit"
@@ -21,16 +22,45 @@ var (
 	compareTibiaExe                       string
 	strictEditClientCheck                 bool
 	aggressiveEditClientCheck             bool
+	adhocSignMachO                        bool
+	dryRunEdit                            bool
+	relocateURLs                          bool
+	editPlanJSON                          string
+	editPatchFile                         string
+	patchFile                             string
+	revertSourceSHA256                    string
+	backupSelector                        string
+	backupKeepDistinct                    int
+	backupKeepWithin                      time.Duration
+	dryRunPrune                           bool
 	sourceTibiaExe                        string
+	signaturesFile                        string
 	strictDiagnoseClientCheck             bool
+	diagnoseFormat                        string
+	diagnoseOutput                        string
+	diagnoseDirectory                     string
+	diagnoseMatch                         string
+	rsaKeyFile                            string
+	rsaPEMFile                            string
+	forceKeyGenerate                      bool
+	xrefOptions                           edit.XrefOptions
+	stripSignature                        bool
+	suggestOutput                         string
+	editProfile                           string
+	watchEdit                             bool
+	qtResourceOptions                     edit.QtResourceOptions
 )
 
+// skipConfigAnnotation marks commands that run without config.toml.
+const skipConfigAnnotation = "client-editor/skip-config"
+
+var skipConfig = map[string]string{skipConfigAnnotation: "true"}
+
 var rootCmd = &cobra.Command{
 	Use:   "client-editor",
 	Short: "Edit or repack Tibia client",
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		switch cmd.Name() {
-		case "diagnose", "repack", "win2mac":
+		if _, skip := cmd.Annotations[skipConfigAnnotation]; skip {
 			return
 		}
 		if configFile != "" {
@@ -45,8 +75,9 @@ var rootCmd = &cobra.Command{
 
 func init() {
 	repackCmd := &cobra.Command{
-		Use:   "repack",
-		Short: "Repack client files",
+		Use:         "repack",
+		Annotations: skipConfig,
+		Short:       "Repack client files",
 		Run: func(cmd *cobra.Command, args []string) {
 			if err := repack.Repack(srcClient, dstClient, platform); err != nil {
 				fmt.Println(err)
@@ -60,8 +91,9 @@ func init() {
 	rootCmd.AddCommand(repackCmd)
 
 	win2macCmd := &cobra.Command{
-		Use:   "win2mac",
-		Short: "Convert windows asset manifest to mac",
+		Use:         "win2mac",
+		Annotations: skipConfig,
+		Short:       "Convert windows asset manifest to mac",
 		Run: func(cmd *cobra.Command, args []string) {
 			if err := win2mac.Win2Mac(srcFile, dstFile); err != nil {
 				fmt.Println(err)
@@ -77,12 +109,37 @@ func init() {
 		Use:   "edit",
 		Short: "Edit Tibia binary",
 		Run: func(cmd *cobra.Command, args []string) {
-			edit.Edit(tibiaExe, sourceTibiaExe, strictEditClientCheck, aggressiveEditClientCheck)
+			edit.LoadSignatureDatabase(signaturesFile)
+			edit.Edit(edit.EditOptions{
+				TibiaExe:              tibiaExe,
+				SourceTibiaExe:        sourceTibiaExe,
+				StrictClientCheck:     strictEditClientCheck,
+				AggressiveClientCheck: aggressiveEditClientCheck,
+				AdhocSignMachO:        adhocSignMachO,
+				DryRun:                dryRunEdit,
+				PlanJSONPath:          editPlanJSON,
+				PatchPath:             editPatchFile,
+				RelocateURLs:          relocateURLs,
+				StripSignature:        stripSignature,
+				RSAKeyPath:            rsaKeyFile,
+				Profile:               editProfile,
+				Watch:                 watchEdit,
+			})
 		},
 	}
 	editCmd.PersistentFlags().StringVarP(&tibiaExe, "tibia-exe", "t", getDefaultTibiaExe(), "Path to Tibia executable")
 	editCmd.PersistentFlags().StringVar(&sourceTibiaExe, "source-exe", "", "Optional pristine source executable to use as input; defaults to \"client - original.exe\" beside --tibia-exe when present")
+	editCmd.PersistentFlags().StringVar(&rsaKeyFile, "rsa-key", edit.DefaultRSAKeyPath, "OTServ RSA key to write into the client: a PEM key or a hexadecimal or decimal modulus")
+	editCmd.PersistentFlags().StringVar(&signaturesFile, "signatures", "", "Optional TOML or JSON signature database replacing the built-in BattlEye signatures")
 	editCmd.PersistentFlags().BoolVar(&aggressiveEditClientCheck, "aggressive", false, "Enable experimental client-check compatibility mode (structural safety checks still apply; keep backup and manual verify)")
+	editCmd.PersistentFlags().BoolVar(&adhocSignMachO, "macho-adhoc-sign", false, "Replace the code signature of every Mach-O slice with an ad-hoc signature after patching")
+	editCmd.PersistentFlags().BoolVar(&dryRunEdit, "dry-run", false, "Apply every patch in memory and print the plan without writing the client, backup or config.ini")
+	editCmd.PersistentFlags().StringVar(&editPlanJSON, "plan-json", "", "Write the edit plan (byte changes, URL substitutions, config.ini diff) as JSON to this path")
+	editCmd.PersistentFlags().BoolVar(&relocateURLs, "relocate-urls", false, "Move the embedded URL block into a new PE section when a URL is longer than the stock value")
+	editCmd.PersistentFlags().BoolVar(&stripSignature, "strip-signature", false, "Remove the Authenticode certificate table, which no longer matches the edited client")
+	editCmd.PersistentFlags().StringVar(&editProfile, "profile", "", "Merge the [profile.<name>] table of the config over its top-level values")
+	editCmd.PersistentFlags().BoolVar(&watchEdit, "watch", false, "Keep running and re-run the edit whenever the launcher replaces the client executable")
+	editCmd.PersistentFlags().StringVar(&editPatchFile, "export-patch", "", "After a successful edit, write a portable patch file that apply-patch can replay onto the same client build")
 	editCmd.PersistentFlags().BoolVar(&strictEditClientCheck, "strict", false, "Fail before export when client-check compatibility is partial, warning, or unsupported")
 	editCmd.PersistentFlags().BoolVar(&strictEditClientCheck, "fail-on-partial", false, "Alias for --strict")
 	editCmd.PersistentFlags().BoolVar(&strictEditClientCheck, "fail-on-unsupported-client-check", false, "Alias for --strict")
@@ -91,14 +148,29 @@ func init() {
 	rootCmd.AddCommand(editCmd)
 
 	diagnoseCmd := &cobra.Command{
-		Use:   "diagnose",
-		Short: "Diagnose Tibia binary patch compatibility",
+		Use:         "diagnose",
+		Annotations: skipConfig,
+		Short:       "Diagnose Tibia binary patch compatibility",
 		Run: func(cmd *cobra.Command, args []string) {
-			edit.Diagnose(tibiaExe, compareTibiaExe, strictDiagnoseClientCheck)
+			edit.Diagnose(edit.DiagnoseOptions{
+				TibiaExe:          tibiaExe,
+				CompareWith:       compareTibiaExe,
+				StrictClientCheck: strictDiagnoseClientCheck,
+				SignaturesPath:    signaturesFile,
+				Format:            diagnoseFormat,
+				OutputPath:        diagnoseOutput,
+				Directory:         diagnoseDirectory,
+				Match:             diagnoseMatch,
+			})
 		},
 	}
 	diagnoseCmd.PersistentFlags().StringVarP(&tibiaExe, "tibia-exe", "t", getDefaultTibiaExe(), "Path to Tibia executable")
 	diagnoseCmd.PersistentFlags().StringVar(&compareTibiaExe, "compare-with", "", "Path to a known-good older Tibia executable for comparative diagnosis")
+	diagnoseCmd.PersistentFlags().StringVar(&diagnoseDirectory, "dir", "", "Diagnose every client build below this directory and print a support matrix")
+	diagnoseCmd.PersistentFlags().StringVar(&diagnoseMatch, "match", edit.DefaultHistoryMatch, "File name pattern selecting client executables for --dir")
+	diagnoseCmd.PersistentFlags().StringVar(&signaturesFile, "signatures", "", "Optional TOML or JSON signature database replacing the built-in BattlEye signatures")
+	diagnoseCmd.PersistentFlags().StringVar(&diagnoseFormat, "format", edit.DiagnoseFormatText, "Output format: text, json or sarif")
+	diagnoseCmd.PersistentFlags().StringVarP(&diagnoseOutput, "output", "o", "", "Write the json or sarif report to this file instead of stdout")
 	diagnoseCmd.PersistentFlags().BoolVar(&strictDiagnoseClientCheck, "strict", false, "Exit with an error when client-check compatibility is partial, warning, or unsupported")
 	diagnoseCmd.PersistentFlags().BoolVar(&strictDiagnoseClientCheck, "fail-on-partial", false, "Alias for --strict")
 	diagnoseCmd.PersistentFlags().BoolVar(&strictDiagnoseClientCheck, "fail-on-unsupported-client-check", false, "Alias for --strict")
@@ -106,6 +178,177 @@ func init() {
 	_ = diagnoseCmd.PersistentFlags().MarkDeprecated("fail-on-partial-client-check-patch", "use --strict")
 	rootCmd.AddCommand(diagnoseCmd)
 
+	applyPatchCmd := &cobra.Command{
+		Use:         "apply-patch",
+		Annotations: skipConfig,
+		Short:       "Apply a patch file exported by edit --export-patch",
+		Run: func(cmd *cobra.Command, args []string) {
+			edit.ApplyPatch(tibiaExe, sourceTibiaExe, patchFile)
+		},
+	}
+	applyPatchCmd.PersistentFlags().StringVarP(&tibiaExe, "tibia-exe", "t", getDefaultTibiaExe(), "Path to Tibia executable")
+	applyPatchCmd.PersistentFlags().StringVar(&sourceTibiaExe, "source-exe", "", "Optional pristine source executable to use as input; defaults to \"client - original.exe\" beside --tibia-exe when present")
+	applyPatchCmd.PersistentFlags().StringVarP(&patchFile, "patch", "p", "", "Path to the patch file")
+	_ = applyPatchCmd.MarkPersistentFlagRequired("patch")
+	rootCmd.AddCommand(applyPatchCmd)
+
+	revertCmd := &cobra.Command{
+		Use:         "revert",
+		Annotations: skipConfig,
+		Short:       "Restore a patched client to its original bytes",
+		Run: func(cmd *cobra.Command, args []string) {
+			edit.LoadSignatureDatabase(signaturesFile)
+			edit.Revert(tibiaExe, patchFile, revertSourceSHA256)
+		},
+	}
+	revertCmd.PersistentFlags().StringVarP(&tibiaExe, "tibia-exe", "t", getDefaultTibiaExe(), "Path to Tibia executable")
+	revertCmd.PersistentFlags().StringVarP(&patchFile, "patch", "p", "", "Edit record or exported patch file to revert; defaults to the record written beside --tibia-exe")
+	revertCmd.PersistentFlags().StringVar(&revertSourceSHA256, "source-sha256", "", "Expected SHA256 of the original client; overrides the recorded source SHA256")
+	revertCmd.PersistentFlags().StringVar(&signaturesFile, "signatures", "", "Optional TOML or JSON signature database replacing the built-in BattlEye signatures")
+	rootCmd.AddCommand(revertCmd)
+
+	backupCmd := &cobra.Command{
+		Use:   "backup",
+		Short: "List, restore or prune BKP<unix>-<client> backups",
+	}
+	backupCmd.PersistentFlags().StringVarP(&tibiaExe, "tibia-exe", "t", getDefaultTibiaExe(), "Path to Tibia executable")
+	backupListCmd := &cobra.Command{
+		Use:         "list",
+		Annotations: skipConfig,
+		Short:       "List backups with their SHA256, patch state and client version",
+		Run: func(cmd *cobra.Command, args []string) {
+			edit.ListBackups(tibiaExe)
+		},
+	}
+	backupRestoreCmd := &cobra.Command{
+		Use:         "restore",
+		Annotations: skipConfig,
+		Short:       "Restore a backup over the client",
+		Run: func(cmd *cobra.Command, args []string) {
+			edit.RestoreBackup(tibiaExe, backupSelector)
+		},
+	}
+	backupRestoreCmd.Flags().StringVarP(&backupSelector, "backup", "b", "", "Backup file name or SHA256 prefix (at least 8 characters); defaults to the newest backup")
+	backupPruneCmd := &cobra.Command{
+		Use:         "prune",
+		Annotations: skipConfig,
+		Short:       "Remove duplicate backups and backups outside the retention policy",
+		Run: func(cmd *cobra.Command, args []string) {
+			edit.PruneBackups(tibiaExe, backupKeepDistinct, backupKeepWithin, dryRunPrune)
+		},
+	}
+	backupPruneCmd.Flags().IntVar(&backupKeepDistinct, "keep", 3, "Number of most recent distinct SHA256 values to keep")
+	backupPruneCmd.Flags().DurationVar(&backupKeepWithin, "keep-within", 0, "Also keep every distinct backup younger than this duration, e.g. 720h")
+	backupPruneCmd.Flags().BoolVar(&dryRunPrune, "dry-run", false, "Only report which backups would be removed")
+	backupCmd.AddCommand(backupListCmd, backupRestoreCmd, backupPruneCmd)
+	rootCmd.AddCommand(backupCmd)
+
+	keyCmd := &cobra.Command{
+		Use:   "key",
+		Short: "Generate or inspect the RSA key written into the client",
+	}
+	keyGenerateCmd := &cobra.Command{
+		Use:         "generate",
+		Annotations: skipConfig,
+		Short:       "Generate a new RSA key pair for the server and the client",
+		Run: func(cmd *cobra.Command, args []string) {
+			edit.GenerateRSAKey(rsaPEMFile, rsaKeyFile, forceKeyGenerate)
+		},
+	}
+	keyGenerateCmd.Flags().StringVar(&rsaPEMFile, "pem", edit.DefaultRSAPEMPath, "Where to write the private key for the server")
+	keyGenerateCmd.Flags().StringVar(&rsaKeyFile, "rsa-key", edit.DefaultRSAKeyPath, "Where to write the public modulus used by edit")
+	keyGenerateCmd.Flags().BoolVar(&forceKeyGenerate, "force", false, "Overwrite existing key files")
+	keyInspectCmd := &cobra.Command{
+		Use:         "inspect",
+		Annotations: skipConfig,
+		Short:       "List the RSA moduli embedded in the client",
+		Run: func(cmd *cobra.Command, args []string) {
+			edit.InspectRSAKeys(tibiaExe, rsaKeyFile)
+		},
+	}
+	keyInspectCmd.Flags().StringVarP(&tibiaExe, "tibia-exe", "t", getDefaultTibiaExe(), "Path to Tibia executable")
+	keyInspectCmd.Flags().StringVar(&rsaKeyFile, "rsa-key", edit.DefaultRSAKeyPath, "OTServ RSA key to recognise")
+	keyCmd.AddCommand(keyGenerateCmd, keyInspectCmd)
+	rootCmd.AddCommand(keyCmd)
+
+	xrefsCmd := &cobra.Command{
+		Use:         "xrefs",
+		Annotations: skipConfig,
+		Short:       "List the code that references a string, an address or an import",
+		Run: func(cmd *cobra.Command, args []string) {
+			edit.Xrefs(xrefOptions)
+		},
+	}
+	xrefsCmd.Flags().StringVarP(&xrefOptions.TibiaExe, "tibia-exe", "t", getDefaultTibiaExe(), "Path to Tibia executable")
+	xrefsCmd.Flags().StringVar(&xrefOptions.String, "string", "", "Find the code that loads this ASCII or UTF-16 string")
+	xrefsCmd.Flags().StringVar(&xrefOptions.RVA, "rva", "", "Find the calls, jumps and loads that target this RVA")
+	xrefsCmd.Flags().StringVar(&xrefOptions.Import, "import", "", "Find the callers of imports whose name contains this text")
+	rootCmd.AddCommand(xrefsCmd)
+
+	qtresCmd := &cobra.Command{
+		Use:   "qtres",
+		Short: "List, extract or replace the Qt resources embedded in the client",
+	}
+	qtresCmd.PersistentFlags().StringVarP(&qtResourceOptions.TibiaExe, "tibia-exe", "t", getDefaultTibiaExe(), "Path to Tibia executable")
+	qtresListCmd := &cobra.Command{
+		Use:         "list",
+		Annotations: skipConfig,
+		Short:       "List every registered resource tree and its files",
+		Run: func(cmd *cobra.Command, args []string) {
+			edit.ListQtResources(qtResourceOptions)
+		},
+	}
+	qtresExtractCmd := &cobra.Command{
+		Use:         "extract",
+		Annotations: skipConfig,
+		Short:       "Write resources to disk, unpacking zlib entries",
+		Run: func(cmd *cobra.Command, args []string) {
+			edit.ExtractQtResources(qtResourceOptions)
+		},
+	}
+	qtresExtractCmd.Flags().StringVarP(&qtResourceOptions.Resource, "resource", "r", "", "Only extract resources matching this pattern, e.g. :/images/*.png; defaults to every resource")
+	qtresExtractCmd.Flags().StringVarP(&qtResourceOptions.OutputDir, "output", "o", "qtres", "Directory to write the resources to")
+	qtresReplaceCmd := &cobra.Command{
+		Use:         "replace",
+		Annotations: skipConfig,
+		Short:       "Replace a resource in place with a same-or-smaller file",
+		Run: func(cmd *cobra.Command, args []string) {
+			edit.ReplaceQtResource(qtResourceOptions)
+		},
+	}
+	qtresReplaceCmd.Flags().StringVarP(&qtResourceOptions.Resource, "resource", "r", "", "Resource path to replace, e.g. :/images/logo.png")
+	qtresReplaceCmd.Flags().StringVarP(&qtResourceOptions.File, "file", "f", "", "File whose contents replace the resource")
+	qtresReplaceCmd.Flags().BoolVar(&qtResourceOptions.DryRun, "dry-run", false, "Check that the replacement fits without writing the client or a backup")
+	_ = qtresReplaceCmd.MarkFlagRequired("resource")
+	_ = qtresReplaceCmd.MarkFlagRequired("file")
+	qtresCmd.AddCommand(qtresListCmd, qtresExtractCmd, qtresReplaceCmd)
+	rootCmd.AddCommand(qtresCmd)
+
+	signaturesCmd := &cobra.Command{
+		Use:   "signatures",
+		Short: "Work with the BattlEye signature database",
+	}
+	signaturesSuggestCmd := &cobra.Command{
+		Use:         "suggest",
+		Annotations: skipConfig,
+		Short:       "Propose rebuilt signatures for a client update by matching functions against an older client",
+		Run: func(cmd *cobra.Command, args []string) {
+			edit.LoadSignatureDatabase(signaturesFile)
+			edit.SuggestSignatures(edit.SuggestOptions{
+				TibiaExe:    tibiaExe,
+				CompareWith: compareTibiaExe,
+				OutputPath:  suggestOutput,
+			})
+		},
+	}
+	signaturesSuggestCmd.Flags().StringVarP(&tibiaExe, "tibia-exe", "t", getDefaultTibiaExe(), "Path to the new Tibia executable the signatures no longer match")
+	signaturesSuggestCmd.Flags().StringVar(&compareTibiaExe, "compare-with", "", "Path to an older Tibia executable the signatures still match")
+	signaturesSuggestCmd.Flags().StringVar(&signaturesFile, "signatures", "", "Optional TOML or JSON signature database replacing the built-in BattlEye signatures")
+	signaturesSuggestCmd.Flags().StringVarP(&suggestOutput, "output", "o", edit.DefaultSuggestionOutput, "Where to write the suggested signature database")
+	_ = signaturesSuggestCmd.MarkFlagRequired("compare-with")
+	signaturesCmd.AddCommand(signaturesSuggestCmd)
+	rootCmd.AddCommand(signaturesCmd)
+
 	appearancesCmd := &cobra.Command{
 		Use:   "appearances",
 		Short: "Edit Tibia's appearances.dat",